@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -59,7 +61,15 @@ func (api *APIServer) Start() error {
 	apiV1.HandleFunc("/metrics", api.handleMetrics)
 	apiV1.HandleFunc("/batch-stats", api.handleBatchStats)
 	apiV1.HandleFunc("/state/snapshot", api.handleStateSnapshot)
+	apiV1.HandleFunc("/state/snapshot/chunks/", api.handleSnapshotChunk)
+	apiV1.HandleFunc("/governance/params", api.handleGovernanceParams)
+	apiV1.HandleFunc("/governance/proposals", api.handleGovernanceProposals)
+	apiV1.HandleFunc("/governance/proposals/", api.handleGovernanceProposal)
 	apiV1.HandleFunc("/transactions/", api.handleTransactionByHash)
+	apiV1.HandleFunc("/htlcs", api.handleHTLCs)
+	apiV1.HandleFunc("/htlcs/", api.handleHTLC)
+	apiV1.HandleFunc("/contracts/", api.handleContract)
+	apiV1.HandleFunc("/fees/estimate", api.handleFeeEstimate)
 
 	// Dynamic handler for accounts and blocks
 	apiV1.HandleFunc("/", api.handleDynamic)
@@ -187,13 +197,17 @@ func (api *APIServer) handleValidators(w http.ResponseWriter, r *http.Request) {
 
 	validatorData := make([]map[string]interface{}, 0, len(validators))
 	for _, v := range validators {
-		validatorData = append(validatorData, map[string]interface{}{
+		entry := map[string]interface{}{
 			"address":            v.Address.ToHex(),
 			"stake":              v.Stake,
 			"delegated_stake":    v.DelegatedStake,
 			"compute_reputation": v.ComputeReputation,
 			"participating":      v.Participating,
-		})
+		}
+		if pending, ok, err := api.node.vr.GetPendingParticipation(v.Address); err == nil && ok {
+			entry["pending_participation"] = pending
+		}
+		validatorData = append(validatorData, entry)
 	}
 
 	api.writeJSON(w, APIResponse{
@@ -247,6 +261,7 @@ func (api *APIServer) handleBlocks(w http.ResponseWriter, r *http.Request) {
 				"fee":   tx.Fee,
 				"type":  tx.Type,
 				"nonce": tx.Nonce,
+				"data":  hex.EncodeToString(tx.Data),
 			})
 		}
 
@@ -292,6 +307,7 @@ func (api *APIServer) handleTransactionPool(w http.ResponseWriter, r *http.Reque
 			"nonce":     tx.Nonce,
 			"type":      tx.Type,
 			"timestamp": tx.Timestamp,
+			"data":      hex.EncodeToString(tx.Data),
 		})
 	}
 
@@ -311,6 +327,7 @@ func (api *APIServer) handleTransactionPool(w http.ResponseWriter, r *http.Reque
 func (api *APIServer) handleTransactionHistory(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
 	address := r.URL.Query().Get("address")
+	dataFilter := r.URL.Query().Get("data")
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
 
@@ -344,6 +361,17 @@ func (api *APIServer) handleTransactionHistory(w http.ResponseWriter, r *http.Re
 			return
 		}
 	}
+	var data []byte
+	if dataFilter != "" {
+		if data, err = hex.DecodeString(dataFilter); err != nil {
+			api.writeJSON(w, APIResponse{
+				Success: false,
+				Error:   "Invalid data filter: must be hex",
+				Code:    400,
+			})
+			return
+		}
+	}
 
 	// Search through recent blocks for transactions
 	currentHeight := api.node.bc.Height()
@@ -352,7 +380,7 @@ func (api *APIServer) handleTransactionHistory(w http.ResponseWriter, r *http.Re
 		startHeight = currentHeight - 100 // Look at last 100 blocks
 	}
 
-	for h := currentHeight; h >= startHeight && len(transactions) < limit+offset; h-- {
+	for h := currentHeight; h+1 > startHeight && len(transactions) < limit+offset; h-- {
 		block, err := api.node.bc.GetBlockByHeight(h)
 		if err != nil {
 			continue
@@ -361,10 +389,14 @@ func (api *APIServer) handleTransactionHistory(w http.ResponseWriter, r *http.Re
 		for _, tx := range block.Transactions {
 			// Filter by address if specified
 			if address != "" {
-				if tx.From != targetAddr && tx.To != targetAddr {
+				if tx.From != targetAddr && !tx.pays(targetAddr) {
 					continue
 				}
 			}
+			// Filter by memo if specified
+			if dataFilter != "" && !bytes.Equal(tx.Data, data) {
+				continue
+			}
 
 			// Apply offset
 			if offset > 0 {
@@ -386,6 +418,8 @@ func (api *APIServer) handleTransactionHistory(w http.ResponseWriter, r *http.Re
 				"nonce":     tx.Nonce,
 				"type":      tx.Type,
 				"timestamp": tx.Timestamp,
+				"data":      hex.EncodeToString(tx.Data),
+				"outputs":   outputsView(tx.Outputs),
 				"block":     h,
 				"confirmed": true,
 			})
@@ -399,6 +433,7 @@ func (api *APIServer) handleTransactionHistory(w http.ResponseWriter, r *http.Re
 			"total":        len(transactions),
 			"limit":        limit,
 			"address":      address,
+			"data":         dataFilter,
 		},
 	})
 }
@@ -447,6 +482,37 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 	value, _ := reqBody["value"].(float64)
 	fee, _ := reqBody["fee"].(float64)
 	txType, _ := reqBody["type"].(string)
+	asset, _ := reqBody["asset"].(string)
+	validFrom, _ := reqBody["validFromHeight"].(float64)
+	validUntil, _ := reqBody["validUntilHeight"].(float64)
+	dataHex, _ := reqBody["data"].(string)
+	data, err := hex.DecodeString(dataHex)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid data: must be hex", Code: 400})
+		return
+	}
+
+	isParticipation := txType == "participation" || txType == "leave_participation"
+	if isParticipation {
+		// Participation changes carry no value and always target the sender
+		value = 0
+		toStr = api.node.address.ToHex()
+	}
+
+	// A multi_transfer pays its outputs; its value is their total
+	var outputs []TransferOutput
+	if txType == "multi_transfer" {
+		outputs, err = parseTransferOutputs(reqBody["outputs"], api.node.address)
+		if err != nil {
+			api.writeJSON(w, APIResponse{Success: false, Error: "Invalid outputs: " + err.Error(), Code: 400})
+			return
+		}
+		value = 0
+		for _, out := range outputs {
+			value += float64(out.Value)
+		}
+		toStr = outputs[0].To.ToHex()
+	}
 
 	// Validate required parameters
 	if toStr == "" {
@@ -458,7 +524,7 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if value <= 0 {
+	if value <= 0 && !isParticipation {
 		api.writeJSON(w, APIResponse{
 			Success: false,
 			Error:   "Value must be greater than 0",
@@ -467,9 +533,14 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Set default fee if not provided
+	// Default to the suggested fee for the next block
 	if fee <= 0 {
-		fee = 1
+		estimate, err := api.node.bc.EstimateFee(TransactionGas(&Transaction{Data: data, Outputs: outputs}))
+		if err != nil {
+			api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 500})
+			return
+		}
+		fee = float64(estimate.SuggestedFee)
 	}
 
 	// Parse recipient address
@@ -484,7 +555,7 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 	}
 
 	// Validate recipient is not the same as sender
-	if toAddr == api.node.address {
+	if toAddr == api.node.address && !isParticipation {
 		api.writeJSON(w, APIResponse{
 			Success: false,
 			Error:   "Cannot send to yourself",
@@ -505,6 +576,19 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 	}
 
 	totalRequired := uint64(value) + uint64(fee)
+	if asset != "" {
+		// Asset transfers move tokens; only the fee is paid natively
+		tokenBalance, err := api.node.state.GetTokenBalance(api.node.address, asset)
+		if err != nil || tokenBalance < uint64(value) {
+			api.writeJSON(w, APIResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Insufficient %s balance. Required: %d, Available: %d", asset, uint64(value), tokenBalance),
+				Code:    400,
+			})
+			return
+		}
+		totalRequired = uint64(fee)
+	}
 	if senderAccount.Balance < totalRequired {
 		api.writeJSON(w, APIResponse{
 			Success: false,
@@ -519,10 +603,10 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 	if txType == "" {
 		txType = "transfer" // Default type
 	}
-	if txType != "transfer" && txType != "stake" && txType != "unstake" && txType != "delegate" && txType != "register_validator" {
+	if txType != "transfer" && txType != "stake" && txType != "unstake" && txType != "delegate" && txType != "register_validator" && txType != "multi_transfer" && !isParticipation {
 		api.writeJSON(w, APIResponse{
 			Success: false,
-			Error:   "Invalid transaction type. Must be one of: transfer, stake, unstake, delegate, register_validator",
+			Error:   "Invalid transaction type. Must be one of: transfer, multi_transfer, stake, unstake, delegate, register_validator, participation, leave_participation",
 			Code:    400,
 		})
 		return
@@ -537,6 +621,20 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 		Nonce:     senderAccount.Nonce + 1,
 		Timestamp: time.Now().UnixNano(),
 		Type:      txType,
+		Asset:     asset,
+
+		ValidFromHeight:  uint64(validFrom),
+		ValidUntilHeight: uint64(validUntil),
+		Data:             data,
+		Outputs:          outputs,
+	}
+	if err := validateTransactionData(tx); err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 400})
+		return
+	}
+	if err := validateValidityWindow(tx); err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 400})
+		return
 	}
 
 	// Sign transaction
@@ -582,6 +680,8 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 				"nonce":     tx.Nonce,
 				"type":      tx.Type,
 				"timestamp": tx.Timestamp,
+				"data":      hex.EncodeToString(tx.Data),
+				"outputs":   outputsView(tx.Outputs),
 			},
 			"summary": map[string]interface{}{
 				"total_cost":     totalRequired,
@@ -595,6 +695,48 @@ func (api *APIServer) handleCreateTransaction(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// outputsView converts the outputs of a multi_transfer to their API form.
+func outputsView(outputs []TransferOutput) []map[string]interface{} {
+	view := make([]map[string]interface{}, 0, len(outputs))
+	for _, out := range outputs {
+		view = append(view, map[string]interface{}{
+			"to":    out.To.ToHex(),
+			"value": out.Value,
+		})
+	}
+	return view
+}
+
+// parseTransferOutputs parses the outputs of a multi_transfer request, given as
+// a list of {"to": hex address, "value": amount} objects.
+func parseTransferOutputs(raw interface{}, sender Address) ([]TransferOutput, error) {
+	items, ok := raw.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errors.New("at least one output is required")
+	}
+	outputs := make([]TransferOutput, 0, len(items))
+	for i, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("output %d must be an object", i)
+		}
+		toStr, _ := fields["to"].(string)
+		to, err := HexToAddress(toStr)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %w", i, err)
+		}
+		if to == sender {
+			return nil, fmt.Errorf("output %d pays the sender", i)
+		}
+		value, _ := fields["value"].(float64)
+		if value <= 0 {
+			return nil, fmt.Errorf("output %d value must be greater than 0", i)
+		}
+		outputs = append(outputs, TransferOutput{To: to, Value: uint64(value)})
+	}
+	return outputs, nil
+}
+
 // handlePeers handles the peers endpoint
 func (api *APIServer) handlePeers(w http.ResponseWriter, r *http.Request) {
 	peers := api.node.p2p.host.Network().Peers()
@@ -701,6 +843,12 @@ func (api *APIServer) handleDynamic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Handle validator reputation history
+	if strings.HasPrefix(path, "/validators/") && strings.HasSuffix(path, "/reputation") {
+		api.handleValidatorReputation(w, r)
+		return
+	}
+
 	// If no pattern matches, return 404
 	http.NotFound(w, r)
 }
@@ -738,29 +886,265 @@ func (api *APIServer) handleAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tokens, err := api.node.state.GetTokenBalances(addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{
+			Success: false,
+			Error:   "Failed to read token balances: " + err.Error(),
+			Code:    500,
+		})
+		return
+	}
+
+	vesting, err := api.node.state.GetVestingStatus(addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{
+			Success: false,
+			Error:   "Failed to read vesting schedule: " + err.Error(),
+			Code:    500,
+		})
+		return
+	}
+
+	data := map[string]interface{}{
+		"address": addr.ToHex(),
+		"balance": account.Balance,
+		"tokens":  tokens,
+	}
+	if vesting != nil {
+		data["vesting"] = vesting
+		data["locked"] = vesting.Locked
+		data["spendable"] = account.Balance - min(account.Balance, vesting.Locked)
+	}
+
 	// Check if it's a balance-only request
 	if len(path) > 8 && path[len(path)-8:] == "/balance" {
 		api.writeJSON(w, APIResponse{
 			Success: true,
-			Data: map[string]interface{}{
-				"address": addr.ToHex(),
-				"balance": account.Balance,
-			},
+			Data:    data,
 		})
 		return
 	}
 
 	// Full account information
+	data["nonce"] = account.Nonce
+	key, err := api.node.state.GetAccountKey(addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Failed to read account key: " + err.Error(), Code: 500})
+		return
+	}
+	if key != nil {
+		data["rotated_key"] = hex.EncodeToString(key.SerializeCompressed())
+	}
+	api.writeJSON(w, APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// handleValidatorReputation handles GET /validators/{address}/reputation
+func (api *APIServer) handleValidatorReputation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	addrStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/validators/"), "/reputation")
+	addr, err := HexToAddress(addrStr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid address", Code: 400})
+		return
+	}
+	v, err := api.node.vr.GetValidator(addr)
+	if err != nil || v == nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Validator not found", Code: 404})
+		return
+	}
+	history, err := api.node.vr.GetReputationHistory(addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Failed to get reputation history", Code: 500})
+		return
+	}
 	api.writeJSON(w, APIResponse{
 		Success: true,
 		Data: map[string]interface{}{
-			"address": addr.ToHex(),
-			"balance": account.Balance,
-			"nonce":   account.Nonce,
+			"address":            addr.ToHex(),
+			"compute_reputation": v.ComputeReputation,
+			"history":            history,
 		},
 	})
 }
 
+// handleGovernanceParams handles GET /governance/params
+func (api *APIServer) handleGovernanceParams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	data := map[string]interface{}{
+		"epoch":  api.node.vr.CurrentEpoch(),
+		"params": api.node.vr.GetConsensusParams(),
+	}
+	if plan, err := api.node.vr.GetUpgradePlan(); err == nil && plan != nil {
+		data["upgrade_plan"] = plan
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: data})
+}
+
+// handleGovernanceProposals handles GET /governance/proposals
+func (api *APIServer) handleGovernanceProposals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	proposals, err := api.node.vr.GetProposals()
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Failed to get proposals", Code: 500})
+		return
+	}
+	status := r.URL.Query().Get("status")
+	filtered := make([]*Proposal, 0, len(proposals))
+	for _, p := range proposals {
+		if status == "" || p.Status == status {
+			filtered = append(filtered, p)
+		}
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: filtered})
+}
+
+// handleGovernanceProposal handles GET /governance/proposals/{id}
+func (api *APIServer) handleGovernanceProposal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	id, err := HexToHash(strings.TrimPrefix(r.URL.Path, "/governance/proposals/"))
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid proposal id", Code: 400})
+		return
+	}
+	proposal, err := api.node.vr.GetProposal(id)
+	if err != nil || proposal == nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Proposal not found", Code: 404})
+		return
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: proposal})
+}
+
+// handleFeeEstimate handles GET /fees/estimate?gas={gas}
+func (api *APIServer) handleFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	gas := uint64(GasTransaction)
+	if gasStr := r.URL.Query().Get("gas"); gasStr != "" {
+		parsed, err := strconv.ParseUint(gasStr, 10, 64)
+		if err != nil || parsed < GasTransaction {
+			api.writeJSON(w, APIResponse{Success: false, Error: fmt.Sprintf("gas must be a number of at least %d", GasTransaction), Code: 400})
+			return
+		}
+		gas = parsed
+	}
+	estimate, err := api.node.bc.EstimateFee(gas)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 500})
+		return
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: estimate})
+}
+
+// handleHTLCs handles GET /htlcs?address={address}
+func (api *APIServer) handleHTLCs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	addr, err := HexToAddress(r.URL.Query().Get("address"))
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid or missing address", Code: 400})
+		return
+	}
+	htlcs, err := api.node.state.GetHTLCsByAddress(addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 500})
+		return
+	}
+	if htlcs == nil {
+		htlcs = []*HTLC{}
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: htlcs})
+}
+
+// handleHTLC handles GET /htlcs/{hashLock}
+func (api *APIServer) handleHTLC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	hashLock, err := HexToHash(strings.TrimPrefix(r.URL.Path, "/htlcs/"))
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid hash lock", Code: 400})
+		return
+	}
+	htlc, err := api.node.state.GetHTLC(hashLock)
+	if err != nil || htlc == nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "HTLC not found", Code: 404})
+		return
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: htlc})
+}
+
+// handleContract handles GET /contracts/{address} and
+// GET /contracts/{address}/storage/{key}
+func (api *APIServer) handleContract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/contracts/"), "/")
+	addr, err := HexToAddress(parts[0])
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid address", Code: 400})
+		return
+	}
+	code := api.node.state.GetContractCode(addr)
+	if code == nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Contract not found", Code: 404})
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "storage" {
+		key, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			api.writeJSON(w, APIResponse{Success: false, Error: "Invalid storage key", Code: 400})
+			return
+		}
+		value, err := api.node.state.GetContractStorage(addr, key)
+		if err != nil {
+			api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 500})
+			return
+		}
+		api.writeJSON(w, APIResponse{Success: true, Data: map[string]interface{}{
+			"address": addr.ToHex(),
+			"key":     key,
+			"value":   value,
+		}})
+		return
+	}
+
+	account, err := api.node.state.GetAccount(addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: err.Error(), Code: 500})
+		return
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: map[string]interface{}{
+		"address": addr.ToHex(),
+		"code":    hex.EncodeToString(code),
+		"size":    len(code),
+		"balance": account.Balance,
+	}})
+}
+
 // handleBlockByHeight handles GET /blocks/{height}
 func (api *APIServer) handleBlockByHeight(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -809,6 +1193,7 @@ func (api *APIServer) handleTransactionByHash(w http.ResponseWriter, r *http.Req
 		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid path", Code: 400})
 		return
 	}
+	txHashStr, wantReceipt := strings.CutSuffix(txHashStr, "/receipt")
 
 	if len(txHashStr) != 64 {
 		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid transaction hash length", Code: 400})
@@ -825,6 +1210,16 @@ func (api *APIServer) handleTransactionByHash(w http.ResponseWriter, r *http.Req
 	var txHash Hash
 	copy(txHash[:], txHashBytes)
 
+	if wantReceipt {
+		receipt, err := api.node.bc.GetReceipt(txHash)
+		if err != nil {
+			api.writeJSON(w, APIResponse{Success: false, Error: "Receipt not found", Code: 404})
+			return
+		}
+		api.writeJSON(w, APIResponse{Success: true, Data: receipt})
+		return
+	}
+
 	// Find transaction in blockchain
 	tx, blockHeight, err := api.node.bc.GetTransactionByHash(txHash)
 	if err != nil {
@@ -853,9 +1248,14 @@ func (api *APIServer) handleTransactionByHash(w http.ResponseWriter, r *http.Req
 			"nonce":        tx.Nonce,
 			"type":         tx.Type,
 			"timestamp":    tx.Timestamp,
+			"data":         hex.EncodeToString(tx.Data),
+			"outputs":      outputsView(tx.Outputs),
 			"block_height": blockHeight,
 			"in_pool":      inPool,
 			"confirmed":    true,
+
+			"valid_from_height":  tx.ValidFromHeight,
+			"valid_until_height": tx.ValidUntilHeight,
 		},
 	})
 }
@@ -921,33 +1321,59 @@ func (api *APIServer) handleBatchStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleStateSnapshot handles GET (export) and POST (import) for state snapshot
+// handleStateSnapshot handles GET (manifest of the latest epoch snapshot, or
+// of ?height=). Snapshots are only imported by fast sync, which verifies them
+// against certified blocks.
 func (api *APIServer) handleStateSnapshot(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		accounts, err := api.node.state.ExportSnapshot()
-		if err != nil {
-			api.writeJSON(w, APIResponse{Success: false, Error: "Failed to export snapshot", Code: 500})
-			return
-		}
-		api.writeJSON(w, APIResponse{Success: true, Data: accounts})
-		return
-	}
-	if r.Method == http.MethodPost {
-		var accounts []*Account
-		if err := json.NewDecoder(r.Body).Decode(&accounts); err != nil {
-			api.writeJSON(w, APIResponse{Success: false, Error: "Invalid snapshot data", Code: 400})
-			return
+		manifest := api.node.snapshots.Latest()
+		if heightStr := r.URL.Query().Get("height"); heightStr != "" {
+			height, err := strconv.ParseUint(heightStr, 10, 64)
+			if err != nil {
+				api.writeJSON(w, APIResponse{Success: false, Error: "Invalid height", Code: 400})
+				return
+			}
+			manifest, _ = api.node.snapshots.Manifest(height)
 		}
-		if err := api.node.state.ImportSnapshot(accounts); err != nil {
-			api.writeJSON(w, APIResponse{Success: false, Error: "Failed to import snapshot", Code: 500})
+		if manifest == nil {
+			api.writeJSON(w, APIResponse{Success: false, Error: "Snapshot not found", Code: 404})
 			return
 		}
-		api.writeJSON(w, APIResponse{Success: true, Message: "Snapshot imported successfully"})
+		api.writeJSON(w, APIResponse{Success: true, Data: manifest})
 		return
 	}
 	w.WriteHeader(http.StatusMethodNotAllowed)
 }
 
+// handleSnapshotChunk handles GET /state/snapshot/chunks/{height}/{index}
+func (api *APIServer) handleSnapshotChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/state/snapshot/chunks/"), "/")
+	if len(parts) != 2 {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Expected /state/snapshot/chunks/{height}/{index}", Code: 400})
+		return
+	}
+	height, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid height", Code: 400})
+		return
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid chunk index", Code: 400})
+		return
+	}
+	chunk, err := api.node.snapshots.Chunk(height, index)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Chunk not found", Code: 404})
+		return
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: chunk})
+}
+
 // writeJSON writes a JSON response with proper headers
 func (api *APIServer) writeJSON(w http.ResponseWriter, response APIResponse) {
 	w.Header().Set("Content-Type", "application/json")
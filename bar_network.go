@@ -226,6 +226,14 @@ func (bn *BARNetwork) banPeerNoLock(peerID peer.ID, reason string) {
 	log.Printf("BAR: Banned peer %s: %s", peerID, reason)
 }
 
+// SetPOMThresholds updates the POM scores at which peers are demoted and banned
+func (bn *BARNetwork) SetPOMThresholds(threshold, banThreshold int) {
+	bn.mu.Lock()
+	defer bn.mu.Unlock()
+	bn.config.POMThreshold = threshold
+	bn.config.POMBanThreshold = banThreshold
+}
+
 // UpdatePOMScore updates the POM score for a peer
 func (bn *BARNetwork) UpdatePOMScore(peerID peer.ID, increment int, reason string) {
 	bn.mu.Lock()
@@ -403,6 +411,31 @@ func (bn *BARNetwork) GetPeerStatus(peerID peer.ID) (PeerStatus, bool) {
 	return PeerStatusGreylist, false
 }
 
+// Application-specific gossipsub scores for BAR peer states
+const (
+	GossipWhitelistScore = 10
+	GossipBannedScore    = -100
+)
+
+// GossipScore returns the application-specific gossipsub score of a peer.
+// Whitelisted peers are preferred in the mesh, greylisted peers lose a point
+// per POM point, and banned peers fall below the graylist threshold.
+func (bn *BARNetwork) GossipScore(peerID peer.ID) float64 {
+	bn.mu.RLock()
+	defer bn.mu.RUnlock()
+
+	if _, exists := bn.whitelist[peerID]; exists {
+		return GossipWhitelistScore
+	}
+	if info, exists := bn.greylist[peerID]; exists {
+		return -float64(info.POMScore)
+	}
+	if _, exists := bn.banned[peerID]; exists {
+		return GossipBannedScore
+	}
+	return 0
+}
+
 // SetOnPeerStatusChange sets the callback for peer status changes
 func (bn *BARNetwork) SetOnPeerStatusChange(callback func(peerID peer.ID, oldStatus, newStatus PeerStatus)) {
 	bn.mu.Lock()
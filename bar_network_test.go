@@ -215,6 +215,23 @@ func TestBARNetwork_GetPeerStatus(t *testing.T) {
 	assert.Equal(t, PeerStatusBanned, status)
 }
 
+func TestBARNetwork_GossipScore(t *testing.T) {
+	bn := NewBARNetwork(nil)
+	peerID := peer.ID("test-peer-1")
+	assert.Equal(t, 0.0, bn.GossipScore(peerID))
+
+	bn.AddPeer(peerID, "addr1")
+	bn.UpdatePOMScore(peerID, 3, "test")
+	assert.Equal(t, -3.0, bn.GossipScore(peerID))
+
+	bn.PromoteToWhitelist(peerID)
+	assert.Equal(t, float64(GossipWhitelistScore), bn.GossipScore(peerID))
+
+	bn.BanPeer(peerID, "test ban")
+	assert.Equal(t, float64(GossipBannedScore), bn.GossipScore(peerID))
+	assert.Less(t, bn.GossipScore(peerID), peerScoreThresholds.GraylistThreshold)
+}
+
 func TestBARNetwork_CleanupReputationRecords(t *testing.T) {
 	bn := NewBARNetwork(&BARConfig{
 		ReputationMemory: 3,
@@ -12,6 +12,7 @@ type BlockApproval struct {
 	Block      *Block
 	Committee  []*Validator
 	Signatures map[string][]byte
+	Approvals  map[string]*Approval // Approvals with signing keys, for the commit certificate
 	Threshold  int
 }
 
@@ -21,7 +22,8 @@ func NewBlockApproval(block *Block, committee []*Validator) *BlockApproval {
 		Block:      block,
 		Committee:  committee,
 		Signatures: make(map[string][]byte),
-		Threshold:  (2 * len(committee) / 3) + 1,
+		Approvals:  make(map[string]*Approval),
+		Threshold:  quorum(len(committee)),
 	}
 }
 
@@ -37,6 +39,15 @@ func (ba *BlockApproval) AddSignature(addr Address, signature []byte) error {
 	return nil
 }
 
+// AddApproval adds a verified approval, keeping it for the block's commit certificate.
+func (ba *BlockApproval) AddApproval(approval *Approval) error {
+	if err := ba.AddSignature(approval.Address, approval.Signature); err != nil {
+		return err
+	}
+	ba.Approvals[approval.Address.ToHex()] = approval
+	return nil
+}
+
 // HasSignature checks if a validator has already signed.
 func (ba *BlockApproval) HasSignature(validator Address) bool {
 	_, ok := ba.Signatures[validator.ToHex()]
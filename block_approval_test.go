@@ -42,3 +42,37 @@ func TestBlockApproval(t *testing.T) {
 	// 5. Assert block is now approved
 	assert.True(t, ba.IsApproved())
 }
+
+func TestVerifyCommitCertificate_RejectsSelfCertifiedBlock(t *testing.T) {
+	state := NewState()
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	keys := make([]*btcec.PrivateKey, 5)
+	for i := range keys {
+		keys[i], _ = btcec.NewPrivateKey()
+		assert.NoError(t, vr.RegisterValidator(&Validator{Address: pubKeyToAddress(keys[i].PubKey()), Stake: 100, Participating: true}))
+	}
+
+	// One registered validator names itself the whole committee and approves
+	block := &Block{Header: &Header{Hash: Hash{1}}}
+	self := &Validator{Address: pubKeyToAddress(keys[0].PubKey())}
+	ba := NewBlockApproval(block, []*Validator{self})
+	assert.NoError(t, ba.AddApproval(&Approval{
+		BlockHash: block.Header.Hash,
+		Address:   self.Address,
+		Signature: ecdsa.Sign(keys[0], block.Header.Hash[:]).Serialize(),
+		PubKey:    keys[0].PubKey().SerializeCompressed(),
+	}))
+	assert.ErrorContains(t, verifyCommitCertificate(state, vr, block.Header, ba.Certificate()), "1 of the 5 committee members")
+
+	// Naming the selected committee, its single approval is short of a quorum
+	committee, err := registryCommittee(vr)
+	assert.NoError(t, err)
+	ba = NewBlockApproval(block, committee)
+	assert.NoError(t, ba.AddApproval(&Approval{
+		BlockHash: block.Header.Hash,
+		Address:   self.Address,
+		Signature: ecdsa.Sign(keys[0], block.Header.Hash[:]).Serialize(),
+		PubKey:    keys[0].PubKey().SerializeCompressed(),
+	}))
+	assert.ErrorContains(t, verifyCommitCertificate(state, vr, block.Header, ba.Certificate()), "1 of the 4 approvals")
+}
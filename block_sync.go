@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	// BlockSyncProtocol serves ranges of finalized headers and blocks on
+	// direct streams.
+	BlockSyncProtocol = protocol.ID("/dyphira/sync/blocks/1")
+
+	// MaxBlockSyncRange is the most blocks a peer returns for one request.
+	MaxBlockSyncRange = 64
+
+	// MaxHeaderSyncRange is the most headers a peer returns for one request.
+	MaxHeaderSyncRange = 512
+
+	// maxSyncHeaders bounds the headers verified ahead of the bodies in one
+	// round of sync.
+	maxSyncHeaders = 4096
+
+	// blockSyncRangesPerPeer is how many body ranges are requested from each
+	// peer in parallel.
+	blockSyncRangesPerPeer = 2
+
+	blockSyncTimeout = 10 * time.Second
+	// blockSyncRetries is how many peers are asked for a range before the
+	// round gives up on it.
+	blockSyncRetries = 3
+)
+
+// blockRangeRequest asks for up to Count headers or blocks starting at height From.
+type blockRangeRequest struct {
+	From    uint64 `json:"from"`
+	Count   uint64 `json:"count"`
+	Headers bool   `json:"headers,omitempty"`
+}
+
+// blockRangeResponse holds consecutive headers or blocks starting at the
+// requested height, fewer than requested if the peer does not have them all.
+type blockRangeResponse struct {
+	Error   string        `json:"error,omitempty"`
+	Headers []*syncHeader `json:"headers,omitempty"`
+	Blocks  []*Block      `json:"blocks,omitempty"`
+}
+
+// syncHeader is a finalized block without its transactions: the header, the
+// proposer's signature and the commit certificate.
+type syncHeader struct {
+	Header      *Header            `json:"header"`
+	ProposerKey []byte             `json:"proposerKey"`
+	Signature   []byte             `json:"signature"`
+	Certificate *CommitCertificate `json:"certificate"`
+}
+
+func newSyncHeader(block *Block) *syncHeader {
+	return &syncHeader{Header: block.Header, ProposerKey: block.ProposerKey, Signature: block.Signature, Certificate: block.Certificate}
+}
+
+// BlockSyncer brings a node up to the best chain its whitelisted peers know. It
+// first downloads the header chain, verifying each header's proposer signature
+// and commit certificate, and then fetches the block bodies from several peers
+// in parallel, checking each against its header's TransactionRoot.
+type BlockSyncer struct {
+	node    *AppNode
+	syncing atomic.Bool
+}
+
+func NewBlockSyncer(node *AppNode) *BlockSyncer {
+	return &BlockSyncer{node: node}
+}
+
+// RegisterProtocol serves BlockSyncProtocol to peers.
+func (bs *BlockSyncer) RegisterProtocol() {
+	bs.node.p2p.SetStreamHandler(BlockSyncProtocol, bs.handleStream)
+}
+
+// syncPeers returns the whitelisted peers of the BAR network.
+func (bs *BlockSyncer) syncPeers() []peer.ID {
+	var peers []peer.ID
+	for _, info := range bs.node.barNet.GetWhitelist() {
+		peers = append(peers, info.ID)
+	}
+	return peers
+}
+
+// Sync downloads and imports blocks until no peer has the next one. Only one
+// sync runs at a time; a call made while another runs returns at once.
+func (bs *BlockSyncer) Sync(ctx context.Context) {
+	if !bs.syncing.CompareAndSwap(false, true) {
+		return
+	}
+	defer bs.syncing.Store(false)
+	defer bs.reportProgress(false, 1, 0, 0)
+
+	for ctx.Err() == nil {
+		peers := bs.syncPeers()
+		if len(peers) == 0 {
+			return
+		}
+		headers, err := bs.syncHeaders(ctx, peers)
+		if err != nil {
+			log.Printf("SYNC: Header sync stopped: %v", err)
+		}
+		if len(headers) == 0 {
+			return
+		}
+		imported, err := bs.syncBodies(ctx, peers, headers)
+		if err != nil {
+			log.Printf("SYNC: %v", err)
+		}
+		if imported == 0 {
+			return
+		}
+	}
+}
+
+// reportProgress publishes the state of sync to the node's metrics.
+func (bs *BlockSyncer) reportProgress(syncing bool, progress, speed float64, peers int) {
+	if bs.node.metrics != nil {
+		bs.node.metrics.UpdateSyncMetrics(syncing, progress, speed, peers)
+	}
+}
+
+// syncHeaders downloads and verifies the headers after the chain tip, up to
+// maxSyncHeaders, asking the peers in turn. It returns the verified headers,
+// with an error if it stopped at one it could not verify.
+func (bs *BlockSyncer) syncHeaders(ctx context.Context, peers []peer.ID) ([]*syncHeader, error) {
+	last, err := bs.node.bc.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	parent := last.Header
+	var headers []*syncHeader
+	next := 0
+	for len(headers) < maxSyncHeaders {
+		batch, id := bs.fetchHeaders(ctx, peers, next, parent.BlockNumber+1)
+		next++
+		if len(batch) == 0 {
+			break
+		}
+		for _, h := range batch {
+			if err := bs.verifyHeader(parent, h); err != nil {
+				// A certificate signed with a key rotated after the node's tip
+				// fails to verify until the rotation has been applied, so a peer
+				// is only penalised for a header right after the tip.
+				if len(headers) == 0 {
+					bs.penalize(id, "synced header failed verification")
+				}
+				return headers, fmt.Errorf("header %d from %s: %w", h.Header.BlockNumber, id, err)
+			}
+			headers = append(headers, h)
+			parent = h.Header
+		}
+		bs.reportProgress(true, 0, 0, len(peers))
+	}
+	return headers, nil
+}
+
+// fetchHeaders requests the headers from height from the peers in turn,
+// starting with the one at offset, until one returns some or blockSyncRetries
+// peers have been asked.
+func (bs *BlockSyncer) fetchHeaders(ctx context.Context, peers []peer.ID, offset int, from uint64) ([]*syncHeader, peer.ID) {
+	for attempt := 0; attempt < blockSyncRetries && attempt < len(peers); attempt++ {
+		id := peers[(offset+attempt)%len(peers)]
+		headers, err := bs.RequestHeaders(ctx, id, from, MaxHeaderSyncRange)
+		if err != nil {
+			log.Printf("SYNC: Headers from %d from %s failed: %v", from, id, err)
+			continue
+		}
+		if len(headers) > 0 {
+			return headers, id
+		}
+	}
+	return nil, ""
+}
+
+// verifyHeader checks that a header follows parent and was proposed and
+// approved with the current keys of its proposer and committee.
+func (bs *BlockSyncer) verifyHeader(parent *Header, h *syncHeader) error {
+	if h.Header.BlockNumber != parent.BlockNumber+1 || h.Header.PreviousHash != parent.Hash {
+		return errors.New("header does not extend the chain")
+	}
+	state := bs.node.state
+	if err := verifyKeySignature(state, h.Header.Proposer, h.ProposerKey, h.Header.Hash, h.Signature); err != nil {
+		return fmt.Errorf("proposer signature: %w", err)
+	}
+	return verifyCommitCertificate(state, bs.node.vr, h.Header, h.Certificate)
+}
+
+// syncBodies fetches the blocks of verified headers in ranges, several peers
+// at a time, and imports them in order as they arrive. It returns the number
+// of blocks imported.
+func (bs *BlockSyncer) syncBodies(ctx context.Context, peers []peer.ID, headers []*syncHeader) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var ranges [][]*syncHeader
+	for start := 0; start < len(headers); start += MaxBlockSyncRange {
+		ranges = append(ranges, headers[start:min(start+MaxBlockSyncRange, len(headers))])
+	}
+	results := make([]chan []*Block, len(ranges))
+	slots := make(chan struct{}, len(peers)*blockSyncRangesPerPeer)
+	for i := range ranges {
+		results[i] = make(chan []*Block, 1)
+		go func(i int) {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				results[i] <- nil
+				return
+			}
+			defer func() { <-slots }()
+			results[i] <- bs.fetchBodies(ctx, peers, i, ranges[i])
+		}(i)
+	}
+
+	started := time.Now()
+	imported := 0
+	for i := range ranges {
+		blocks := <-results[i]
+		if blocks == nil {
+			return imported, fmt.Errorf("no peer served the blocks from height %d", ranges[i][0].Header.BlockNumber)
+		}
+		n, err := bs.importBlocks(blocks)
+		imported += n
+		speed := float64(imported) / time.Since(started).Seconds()
+		bs.reportProgress(true, float64(imported)/float64(len(headers)), speed, len(peers))
+		if err != nil {
+			return imported, err
+		}
+	}
+	log.Printf("SYNC: Imported %d blocks, chain height is now %d", imported, bs.node.bc.Height())
+	return imported, nil
+}
+
+// fetchBodies requests the blocks of a range of headers from the peers in
+// turn, starting with the one at offset, until one returns all of them or
+// blockSyncRetries peers have been asked. It returns nil if none did.
+func (bs *BlockSyncer) fetchBodies(ctx context.Context, peers []peer.ID, offset int, headers []*syncHeader) []*Block {
+	for attempt := 0; attempt < blockSyncRetries && attempt < len(peers); attempt++ {
+		id := peers[(offset+attempt)%len(peers)]
+		blocks, err := bs.RequestBodies(ctx, id, headers)
+		if err != nil {
+			log.Printf("SYNC: Blocks from %d from %s failed: %v", headers[0].Header.BlockNumber, id, err)
+			continue
+		}
+		if len(blocks) == len(headers) {
+			return blocks
+		}
+	}
+	return nil
+}
+
+// importBlocks applies the blocks that extend the chain, storing each once it
+// has applied.
+func (bs *BlockSyncer) importBlocks(blocks []*Block) (int, error) {
+	n := bs.node
+	n.blockImportMu.Lock()
+	defer n.blockImportMu.Unlock()
+
+	imported := 0
+	for _, block := range blocks {
+		height := n.bc.Height()
+		if block.Header.BlockNumber <= height {
+			// Finalized by consensus while the range was downloading
+			continue
+		}
+		last, err := n.bc.GetLastBlock()
+		if err != nil {
+			return imported, err
+		}
+		if block.Header.BlockNumber != height+1 || block.Header.PreviousHash != last.Header.Hash {
+			return imported, fmt.Errorf("block %d does not extend the chain", block.Header.BlockNumber)
+		}
+		// Signatures are checked again against the state the block applies to
+		if err := verifyBlockSignature(n.state, block); err != nil {
+			return imported, fmt.Errorf("block %d: %w", block.Header.BlockNumber, err)
+		}
+		if err := n.importBlock(block); err != nil {
+			return imported, err
+		}
+		for _, tx := range block.Transactions {
+			n.txPool.RemoveTransaction(tx.Hash)
+		}
+		imported++
+	}
+	if imported > 0 {
+		n.updatePool()
+	}
+	return imported, nil
+}
+
+// Backfill downloads the blocks below height, newest first, and stores them
+// without applying them, for a node whose chain starts at a checkpoint. Each
+// block must hash to the PreviousHash of the block above it, so the history is
+// anchored to the block at height, and must lead back to the node's genesis.
+func (bs *BlockSyncer) Backfill(ctx context.Context, height uint64) error {
+	bc := bs.node.bc
+	above, err := bc.GetBlockByHeight(height)
+	if err != nil {
+		return err
+	}
+	log.Printf("SYNC: Backfilling the %d blocks below height %d", height-1, height)
+	for above.Header.BlockNumber > 1 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		top := above.Header.BlockNumber - 1
+		if block, err := bc.GetBlockByHeight(top); err == nil && block.Header.Hash == above.Header.PreviousHash {
+			above = block
+			continue
+		}
+		from := top - min(top-1, MaxBlockSyncRange-1)
+		blocks := bs.fetchHistory(ctx, from, above.Header)
+		if blocks == nil {
+			return fmt.Errorf("no peer served the blocks from height %d", from)
+		}
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if err := bc.AddHistoricalBlock(blocks[i]); err != nil {
+				return err
+			}
+		}
+		above = blocks[0]
+	}
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		return err
+	}
+	if above.Header.PreviousHash != genesis.Header.Hash {
+		return errors.New("backfilled history does not lead to the genesis block")
+	}
+	log.Printf("SYNC: Backfilled the chain below height %d", height)
+	return nil
+}
+
+// fetchHistory requests the blocks from height from up to the one below
+// above from the whitelisted peers in turn, until one returns all of them
+// hash-linked to above. It returns nil if none did.
+func (bs *BlockSyncer) fetchHistory(ctx context.Context, from uint64, above *Header) []*Block {
+	count := above.BlockNumber - from
+	for _, id := range bs.syncPeers() {
+		resp, err := bs.request(ctx, id, &blockRangeRequest{From: from, Count: count})
+		if err != nil {
+			log.Printf("SYNC: Blocks from %d from %s failed: %v", from, id, err)
+			continue
+		}
+		if uint64(len(resp.Blocks)) != count {
+			// The peer may have started from a checkpoint itself
+			continue
+		}
+		if err := verifyHistory(resp.Blocks, above); err != nil {
+			log.Printf("SYNC: Blocks from %d from %s: %v", from, id, err)
+			bs.penalize(id, "backfilled blocks off the chain")
+			continue
+		}
+		return resp.Blocks
+	}
+	return nil
+}
+
+// verifyHistory checks that blocks are well-formed, consecutive and linked by
+// hash up to the header above them.
+func verifyHistory(blocks []*Block, above *Header) error {
+	want := above.PreviousHash
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		height := above.BlockNumber - uint64(len(blocks)-i)
+		if block == nil || block.Header == nil || block.Header.BlockNumber != height {
+			return fmt.Errorf("wrong block for height %d", height)
+		}
+		if hash, err := block.Header.ComputeHash(); err != nil || hash != block.Header.Hash || hash != want {
+			return fmt.Errorf("block %d is not the parent of the block above it", height)
+		}
+		if computeTransactionRoot(block.Transactions) != block.Header.TransactionRoot {
+			return fmt.Errorf("block %d has transactions that do not match its root", height)
+		}
+		want = block.Header.PreviousHash
+	}
+	return nil
+}
+
+// RequestHeaders fetches up to count headers starting at height from. The
+// peer is penalised if the response is not a run of well-formed consecutive
+// headers starting at from.
+func (bs *BlockSyncer) RequestHeaders(ctx context.Context, id peer.ID, from, count uint64) ([]*syncHeader, error) {
+	resp, err := bs.request(ctx, id, &blockRangeRequest{From: from, Count: count, Headers: true})
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(resp.Headers)) > count {
+		bs.penalize(id, "too many headers in sync response")
+		return nil, fmt.Errorf("peer %s sent %d headers for a range of %d", id, len(resp.Headers), count)
+	}
+	for i, h := range resp.Headers {
+		if h == nil || h.Header == nil || h.Header.BlockNumber != from+uint64(i) {
+			bs.penalize(id, "wrong header in sync response")
+			return nil, fmt.Errorf("peer %s sent the wrong header for height %d", id, from+uint64(i))
+		}
+		if hash, err := h.Header.ComputeHash(); err != nil || hash != h.Header.Hash {
+			bs.penalize(id, "header with a bad hash in sync response")
+			return nil, fmt.Errorf("peer %s sent header %d with a bad hash", id, h.Header.BlockNumber)
+		}
+		if i > 0 && h.Header.PreviousHash != resp.Headers[i-1].Header.Hash {
+			bs.penalize(id, "unlinked headers in sync response")
+			return nil, fmt.Errorf("peer %s sent header %d off its own range", id, h.Header.BlockNumber)
+		}
+	}
+	return resp.Headers, nil
+}
+
+// RequestBodies fetches the blocks of verified headers. The peer is penalised
+// for a block that does not match its header or whose transactions do not
+// match the header's TransactionRoot.
+func (bs *BlockSyncer) RequestBodies(ctx context.Context, id peer.ID, headers []*syncHeader) ([]*Block, error) {
+	count := uint64(len(headers))
+	resp, err := bs.request(ctx, id, &blockRangeRequest{From: headers[0].Header.BlockNumber, Count: count})
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(resp.Blocks)) > count {
+		bs.penalize(id, "too many blocks in sync response")
+		return nil, fmt.Errorf("peer %s sent %d blocks for a range of %d", id, len(resp.Blocks), count)
+	}
+	for i, block := range resp.Blocks {
+		want := headers[i].Header
+		if block == nil || block.Header == nil || block.Header.Hash != want.Hash {
+			bs.penalize(id, "wrong block in sync response")
+			return nil, fmt.Errorf("peer %s sent the wrong block for height %d", id, want.BlockNumber)
+		}
+		if hash, err := block.Header.ComputeHash(); err != nil || hash != want.Hash {
+			bs.penalize(id, "block with a bad hash in sync response")
+			return nil, fmt.Errorf("peer %s sent block %d with a bad hash", id, want.BlockNumber)
+		}
+		if err := verifyBlockBody(block); err != nil {
+			bs.penalize(id, "block body does not match its header")
+			return nil, fmt.Errorf("peer %s sent block %d: %w", id, want.BlockNumber, err)
+		}
+		// The verified header's signature and certificate are kept with the block
+		block.ProposerKey, block.Signature, block.Certificate = headers[i].ProposerKey, headers[i].Signature, headers[i].Certificate
+	}
+	return resp.Blocks, nil
+}
+
+// verifyBlockBody checks that a block's transactions hash to their hashes and
+// that those hash to the header's TransactionRoot.
+func verifyBlockBody(block *Block) error {
+	for _, tx := range block.Transactions {
+		if hash, err := transactionContentHash(tx); err != nil || hash != tx.Hash {
+			return fmt.Errorf("transaction %s does not match its hash", tx.Hash.ToHex())
+		}
+	}
+	if computeTransactionRoot(block.Transactions) != block.Header.TransactionRoot {
+		return errors.New("block transactions do not match its root")
+	}
+	return nil
+}
+
+// request sends one request to a peer and reads its response.
+func (bs *BlockSyncer) request(ctx context.Context, id peer.ID, req *blockRangeRequest) (*blockRangeResponse, error) {
+	return requestBlockRange(ctx, bs.node.p2p, id, req)
+}
+
+// requestBlockRange sends one BlockSyncProtocol request to a peer and reads
+// its response.
+func requestBlockRange(ctx context.Context, p2p *P2PNode, id peer.ID, req *blockRangeRequest) (*blockRangeResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, blockSyncTimeout)
+	defer cancel()
+	stream, err := p2p.NewStream(ctx, id, BlockSyncProtocol)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return nil, err
+	}
+	stream.CloseWrite()
+	var resp blockRangeResponse
+	if err := json.NewDecoder(stream).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// handleStream serves one BlockSyncProtocol request.
+func (bs *BlockSyncer) handleStream(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(blockSyncTimeout))
+
+	from := stream.Conn().RemotePeer()
+	if status, ok := bs.node.barNet.GetPeerStatus(from); ok && status == PeerStatusBanned {
+		stream.Reset()
+		return
+	}
+	var req blockRangeRequest
+	if err := json.NewDecoder(stream).Decode(&req); err != nil {
+		log.Printf("SYNC: Malformed request from %s: %v", from, err)
+		return
+	}
+	if err := json.NewEncoder(stream).Encode(bs.serve(&req)); err != nil {
+		log.Printf("SYNC: Failed to answer %s: %v", from, err)
+	}
+}
+
+func (bs *BlockSyncer) serve(req *blockRangeRequest) *blockRangeResponse {
+	resp := &blockRangeResponse{}
+	limit := uint64(MaxBlockSyncRange)
+	if req.Headers {
+		limit = MaxHeaderSyncRange
+	}
+	count := min(req.Count, limit)
+	tip := bs.node.bc.Height()
+	for height := req.From; height < req.From+count && height <= tip; height++ {
+		block, err := bs.node.bc.GetBlockByHeight(height)
+		if err != nil {
+			break
+		}
+		if req.Headers {
+			resp.Headers = append(resp.Headers, newSyncHeader(block))
+		} else {
+			resp.Blocks = append(resp.Blocks, block)
+		}
+	}
+	return resp
+}
+
+func (bs *BlockSyncer) penalize(id peer.ID, reason string) {
+	bs.node.barNet.UpdatePOMScore(id, 1, reason)
+}
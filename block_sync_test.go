@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectSyncPeer connects client to server and whitelists it.
+func connectSyncPeer(t *testing.T, ctx context.Context, client, server *AppNode) peer.ID {
+	id := server.p2p.host.ID()
+	require.NoError(t, client.p2p.host.Connect(ctx, peer.AddrInfo{ID: id, Addrs: server.p2p.host.Addrs()}))
+	client.barNet.AddPeer(id, "")
+	require.True(t, client.barNet.PromoteToWhitelist(id))
+	return id
+}
+
+func pomScore(bn *BARNetwork, id peer.ID) int {
+	for _, info := range bn.GetAllPeers() {
+		if info.ID == id {
+			return info.POMScore
+		}
+	}
+	return 0
+}
+
+// newBlockSyncTest builds a server with a chain of the given length and a
+// client that knows the server's proposer as a validator.
+func newBlockSyncTest(t *testing.T, ctx context.Context, length int) (server, client *AppNode) {
+	server = newSyncTestNode(t, ctx)
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	sender := newTokenTestAccount(t, server.state, 1000)
+	for i := 0; i < length; i++ {
+		extendFastSyncTestChain(t, server, proposer, sender)
+	}
+
+	client = newSyncTestNode(t, ctx)
+	client.metrics = NewMetricsCollector()
+	require.NoError(t, client.state.PutAccount(&Account{Address: sender.addr, Balance: 1000}))
+	require.NoError(t, client.vr.RegisterValidator(&Validator{Address: pubKeyToAddress(proposer.PubKey()), Participating: true}))
+	return server, client
+}
+
+// serveBlockSync replaces a node's BlockSyncProtocol handler with one that
+// answers with whatever respond returns.
+func serveBlockSync(node *AppNode, respond func(req *blockRangeRequest) *blockRangeResponse) {
+	node.p2p.SetStreamHandler(BlockSyncProtocol, func(stream network.Stream) {
+		defer stream.Close()
+		var req blockRangeRequest
+		if err := json.NewDecoder(stream).Decode(&req); err != nil {
+			return
+		}
+		json.NewEncoder(stream).Encode(respond(&req))
+	})
+}
+
+func TestBlockSyncer_SyncsFromSeveralPeers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, client := newBlockSyncTest(t, ctx, 3*MaxBlockSyncRange+10)
+	second := newSyncTestNode(t, ctx)
+	for h := uint64(1); h <= first.bc.Height(); h++ {
+		block, err := first.bc.GetBlockByHeight(h)
+		require.NoError(t, err)
+		require.NoError(t, second.bc.AddBlock(block))
+	}
+
+	// Bodies are fetched from both peers
+	served := make(map[peer.ID]int)
+	var mu sync.Mutex
+	for _, node := range []*AppNode{first, second} {
+		serveBlockSync(node, func(req *blockRangeRequest) *blockRangeResponse {
+			if !req.Headers {
+				mu.Lock()
+				served[node.p2p.host.ID()]++
+				mu.Unlock()
+			}
+			return node.blockSyncer.serve(req)
+		})
+	}
+	connectSyncPeer(t, ctx, client, first)
+	connectSyncPeer(t, ctx, client, second)
+
+	client.blockSyncer.Sync(ctx)
+	assert.Equal(t, first.bc.Height(), client.bc.Height())
+	assert.Equal(t, first.state.Root(), client.state.Root())
+	assert.Len(t, served, 2)
+	last, err := client.bc.GetLastBlock()
+	require.NoError(t, err)
+	assert.NotNil(t, last.Certificate, "synced blocks keep their certificates to serve on")
+
+	assert.False(t, client.metrics.syncing)
+	assert.Equal(t, 1.0, client.metrics.syncProgress)
+
+	// A second sync finds nothing more to import
+	client.blockSyncer.Sync(ctx)
+	assert.Equal(t, first.bc.Height(), client.bc.Height())
+}
+
+func TestBlockSyncer_RequiresCommitCertificates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newBlockSyncTest(t, ctx, 10)
+	serveBlockSync(server, func(req *blockRangeRequest) *blockRangeResponse {
+		resp := server.blockSyncer.serve(req)
+		for _, h := range resp.Headers {
+			if h.Header.BlockNumber >= 4 {
+				h.Certificate = nil
+			}
+		}
+		return resp
+	})
+	id := connectSyncPeer(t, ctx, client, server)
+
+	// Sync imports the blocks before the first header without a certificate.
+	// The peer is penalised once that header follows the tip.
+	client.blockSyncer.Sync(ctx)
+	assert.Equal(t, uint64(3), client.bc.Height())
+	assert.Equal(t, 1, pomScore(client.barNet, id))
+
+	// Approvals must come from a quorum of the committee the registry selects
+	block, err := server.bc.GetBlockByHeight(4)
+	require.NoError(t, err)
+	stranger := &Validator{Address: Address{7}, Participating: true}
+	forged := *block.Certificate
+	forged.Committee = append([]Address{stranger.Address}, forged.Committee...)
+	assert.ErrorContains(t, verifyCommitCertificate(client.state, client.vr, block.Header, &forged), "not in the selected committee")
+	require.NoError(t, client.vr.RegisterValidator(stranger))
+	assert.ErrorContains(t, verifyCommitCertificate(client.state, client.vr, block.Header, block.Certificate), "1 of the 2 committee members")
+	assert.ErrorContains(t, verifyCommitCertificate(client.state, client.vr, block.Header, &forged), "1 of the 2 approvals")
+}
+
+func TestBlockSyncer_RejectedBlocksChangeNothing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A valid transfer from one sender is followed by one from another sender
+	// with the wrong nonce, so the block is rejected after the first applies
+	node := newSyncTestNode(t, ctx)
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	first := newTokenTestAccount(t, node.state, 100)
+	second := newTokenTestAccount(t, node.state, 100)
+	txs := []*Transaction{signedTransfer(t, first, 1, 10), signedTransfer(t, second, 7, 10)}
+	block, err := node.bc.CreateBlockWithState(txs, &Validator{Address: pubKeyToAddress(proposer.PubKey())}, proposer, node.state)
+	require.NoError(t, err)
+	require.NoError(t, block.Sign(proposer))
+
+	root := node.state.Root()
+	imported, err := node.blockSyncer.importBlocks([]*Block{block})
+	assert.ErrorContains(t, err, "invalid nonce")
+	assert.Equal(t, 0, imported)
+	assert.Equal(t, root, node.state.Root())
+	acc, err := node.state.GetAccount(first.addr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), acc.Balance)
+	assert.Equal(t, uint64(0), acc.Nonce)
+	for _, tx := range txs {
+		_, err := node.bc.GetReceipt(tx.Hash)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, uint64(0), node.bc.Height())
+	assert.False(t, node.bc.HasBlock(block.Header.Hash))
+}
+
+func TestBlockSyncer_StopsAtUpgradeHeight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newBlockSyncTest(t, ctx, 10)
+	require.NoError(t, client.vr.ScheduleUpgrade(UpgradePlan{Name: "test-unhandled-sync", Height: 5}))
+	var halted []UpgradePlan
+	client.OnUpgradeHalt = func(plan UpgradePlan) { halted = append(halted, plan) }
+	id := connectSyncPeer(t, ctx, client, server)
+
+	// Blocks at or past an upgrade this binary does not implement are refused
+	client.blockSyncer.Sync(ctx)
+	assert.Equal(t, uint64(4), client.bc.Height())
+	assert.Equal(t, []UpgradePlan{{Name: "test-unhandled-sync", Height: 5}}, halted)
+	assert.Equal(t, 0, pomScore(client.barNet, id), "the peer is not at fault")
+}
+
+func TestBlockSyncer_PenalizesBadBodies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	good, client := newBlockSyncTest(t, ctx, 10)
+
+	// The bad peer serves the right headers but bodies with a transaction dropped
+	bad := newSyncTestNode(t, ctx)
+	serveBlockSync(bad, func(req *blockRangeRequest) *blockRangeResponse {
+		resp := good.blockSyncer.serve(req)
+		for i, block := range resp.Blocks {
+			stripped := *block
+			stripped.Transactions = nil
+			resp.Blocks[i] = &stripped
+		}
+		return resp
+	})
+	badID := connectSyncPeer(t, ctx, client, bad)
+
+	headers, err := client.blockSyncer.RequestHeaders(ctx, badID, 1, 5)
+	require.NoError(t, err)
+	_, err = client.blockSyncer.RequestBodies(ctx, badID, headers)
+	assert.ErrorContains(t, err, "do not match its root")
+	assert.Equal(t, 1, pomScore(client.barNet, badID))
+
+	// Sync still completes with the bodies from the good peer
+	connectSyncPeer(t, ctx, client, good)
+	client.blockSyncer.Sync(ctx)
+	assert.Equal(t, good.bc.Height(), client.bc.Height())
+	assert.Equal(t, good.state.Root(), client.state.Root())
+}
+
+func TestBlockSyncer_PenalizesMalformedHeaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	good, client := newBlockSyncTest(t, ctx, 5)
+	bad := newSyncTestNode(t, ctx)
+	serveBlockSync(bad, func(req *blockRangeRequest) *blockRangeResponse {
+		req.From++
+		return good.blockSyncer.serve(req)
+	})
+	badID := connectSyncPeer(t, ctx, client, bad)
+
+	_, err := client.blockSyncer.RequestHeaders(ctx, badID, 1, 5)
+	assert.ErrorContains(t, err, "wrong header")
+	assert.Equal(t, 1, pomScore(client.barNet, badID))
+}
+
+func TestBlockSyncer_ServeCapsRange(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, _ := newBlockSyncTest(t, ctx, MaxBlockSyncRange+5)
+
+	resp := server.blockSyncer.serve(&blockRangeRequest{From: 3, Count: 1000})
+	require.Len(t, resp.Blocks, MaxBlockSyncRange)
+	assert.Equal(t, uint64(3), resp.Blocks[0].Header.BlockNumber)
+
+	resp = server.blockSyncer.serve(&blockRangeRequest{From: 3, Count: 1000, Headers: true})
+	assert.Len(t, resp.Headers, MaxBlockSyncRange+3)
+
+	resp = server.blockSyncer.serve(&blockRangeRequest{From: server.bc.Height(), Count: 10})
+	assert.Len(t, resp.Blocks, 1, "only blocks up to the tip are served")
+}
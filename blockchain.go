@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
-	"golang.org/x/crypto/sha3"
 )
 
 // Blockchain represents the blockchain itself.
@@ -19,6 +18,9 @@ type Blockchain struct {
 	tip           Hash
 	height        uint64
 	genesisBlock  *Block
+	maxBlockSize  uint64 // governed block size limit in bytes
+	gasLimit      uint64 // governed block gas limit
+	minBaseFee    uint64 // governed floor of the base fee
 }
 
 // In Blockchain struct, add a constant for the height key
@@ -31,6 +33,8 @@ func NewBlockchain(store Storage) (*Blockchain, error) {
 		store:         store,
 		genesisBlock:  genesis,
 		currentHeight: 0, // Start with height 0 (genesis)
+		maxBlockSize:  DefaultMaxBlockSize,
+		gasLimit:      DefaultBlockGasLimit,
 	}
 
 	// Try to load existing tip
@@ -86,6 +90,21 @@ func (bc *Blockchain) AddBlock(b *Block) error {
 	return bc.addBlock(b)
 }
 
+// AddHistoricalBlock stores a block below the chain tip without moving the
+// tip, as when backfilling the history of a chain started from a checkpoint.
+func (bc *Blockchain) AddHistoricalBlock(b *Block) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	if b.Header.BlockNumber == 0 || b.Header.BlockNumber >= bc.currentHeight {
+		return fmt.Errorf("block %d is not below the tip at height %d", b.Header.BlockNumber, bc.currentHeight)
+	}
+	data, err := encodeBlock(b)
+	if err != nil {
+		return err
+	}
+	return bc.store.Put(blockKey(b.Header.BlockNumber), data)
+}
+
 // GetBlockByHeight retrieves a block by its height.
 func (bc *Blockchain) GetBlockByHeight(height uint64) (*Block, error) {
 	if height > bc.currentHeight {
@@ -188,18 +207,36 @@ func decodeBlock(data []byte) (*Block, error) {
 }
 
 func (bc *Blockchain) CreateBlock(txs []*Transaction, proposer *Validator, privKey *btcec.PrivateKey) (*Block, error) {
+	return bc.CreateBlockWithState(txs, proposer, privKey, nil)
+}
+
+// CreateBlockWithState creates a block that also commits to the root of state,
+// the proposer's state after the previous block. Snapshots served for fast
+// sync are verified against it.
+func (bc *Blockchain) CreateBlockWithState(txs []*Transaction, proposer *Validator, privKey *btcec.PrivateKey, state *State) (*Block, error) {
 	lastBlock, err := bc.GetLastBlock()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last block: %w", err)
 	}
 
+	gasLimit, minBaseFee := bc.gasRules()
+	gas := blockGas(txs)
+	if gas > gasLimit {
+		return nil, fmt.Errorf("block gas %d exceeds the %d gas limit", gas, gasLimit)
+	}
+
 	header := &Header{
 		BlockNumber:     lastBlock.Header.BlockNumber + 1,
 		PreviousHash:    lastBlock.Header.Hash,
 		Timestamp:       time.Now().UnixNano(),
 		Proposer:        proposer.Address,
+		Gas:             gas,
+		BaseFee:         CalcNextBaseFee(lastBlock.Header, gasLimit, minBaseFee),
 		TransactionRoot: computeTransactionRoot(txs),
 	}
+	if state != nil {
+		header.StateRoot = state.Root()
+	}
 
 	hash, err := header.ComputeHash()
 	if err != nil {
@@ -212,31 +249,41 @@ func (bc *Blockchain) CreateBlock(txs []*Transaction, proposer *Validator, privK
 		Transactions: txs,
 	}
 
-	// Enforce 256MB block size limit
+	// Enforce the governed block size limit
 	blockBytes, err := encodeBlock(block)
 	if err != nil {
 		return nil, err
 	}
 	block.Size = uint64(len(blockBytes))
-	if block.Size > 256*1024*1024 {
-		return nil, fmt.Errorf("block size %d exceeds 256MB limit", block.Size)
+	bc.lock.RLock()
+	limit := bc.maxBlockSize
+	bc.lock.RUnlock()
+	if limit == 0 {
+		limit = DefaultMaxBlockSize
+	}
+	if block.Size > limit {
+		return nil, fmt.Errorf("block size %d exceeds %d byte limit", block.Size, limit)
 	}
 
 	return block, nil
 }
 
-// computeTransactionRoot calculates the Merkle root of a list of transactions.
+// SetMaxBlockSize sets the size limit enforced when creating blocks.
+func (bc *Blockchain) SetMaxBlockSize(size uint64) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	bc.maxBlockSize = size
+}
+
+// computeTransactionRoot calculates the Merkle root of a list of transactions,
+// the root of the binary tree over their hashes that TransactionProofs prove
+// inclusion in.
 func computeTransactionRoot(txs []*Transaction) Hash {
 	if len(txs) == 0 {
 		return Hash{}
 	}
-	// Simple approach: hash the concatenation of all transaction hashes.
-	var combinedHashes []byte
-	for _, tx := range txs {
-		combinedHashes = append(combinedHashes, tx.Hash[:]...)
-	}
-	hash := sha3.Sum256(combinedHashes)
-	return Hash(hash)
+	levels := transactionTree(txs)
+	return levels[len(levels)-1][0]
 }
 
 // GetDatabaseSize calculates the total size of the blockchain database
@@ -274,64 +321,210 @@ func (bc *Blockchain) Close() error {
 
 // ApplyBlockWithRegistry applies a block's transactions to the state and updates the validator registry.
 func (bc *Blockchain) ApplyBlockWithRegistry(block *Block, state *State, vr *ValidatorRegistry) error {
-	for _, tx := range block.Transactions {
+	// The transactions run against a copy of the state, so a block holding one
+	// that cannot be included is rejected without changing anything
+	trial := state.Copy()
+	if block.Header != nil {
+		trial.SetHeight(block.Header.BlockNumber)
+		gasLimit, minBaseFee := bc.blockGasRules(vr)
+		if err := bc.checkBlockGas(block, gasLimit, minBaseFee); err != nil {
+			return err
+		}
+	}
+	receipts, err := executeBlockTransactions(block, trial, vr)
+	if err != nil {
+		return err
+	}
+	if block.Header != nil {
+		state.SetHeight(block.Header.BlockNumber)
+	}
+	state.Trie.Replace(trial.Trie)
+
+	for i, tx := range block.Transactions {
+		receipt := receipts[i]
+		if err := bc.PutReceipt(receipt); err != nil {
+			return fmt.Errorf("failed to store receipt for %s: %w", tx.Hash, err)
+		}
+		if receipt.Status != ReceiptStatusSuccess {
+			continue
+		}
+
 		// Handle special transaction types that affect the validator registry
 		switch tx.Type {
-		case "participation":
-			v, err := vr.GetValidator(tx.From)
-			if err == nil && v != nil && !v.Participating {
-				v.Participating = true
-				_ = vr.RegisterValidator(v)
-			}
 		case "register_validator":
-			// Register or update validator with the staked amount
+			// Register or update validator with the staked amount. Like any
+			// other participation change, joining takes effect next epoch.
 			v, err := vr.GetValidator(tx.From)
-			if err != nil {
-				// Create new validator
-				v = &Validator{
-					Address:           tx.From,
-					Stake:             tx.Value,
-					DelegatedStake:    0,
-					ComputeReputation: 0,
-					Participating:     true, // Auto-participate when registered
-				}
-			} else if v == nil {
-				// Validator not found, create new one
-				v = &Validator{
-					Address:           tx.From,
-					Stake:             tx.Value,
-					DelegatedStake:    0,
-					ComputeReputation: 0,
-					Participating:     true, // Auto-participate when registered
-				}
+			if err != nil || v == nil {
+				v = &Validator{Address: tx.From, Stake: tx.Value}
 			} else {
-				// Update existing validator's stake
 				v.Stake += tx.Value
-				v.Participating = true
 			}
-			_ = vr.RegisterValidator(v)
+			if err := vr.RegisterValidator(v); err != nil {
+				return fmt.Errorf("failed to register validator %s: %w", tx.From.ToHex(), err)
+			}
+			if !v.Participating {
+				if err := vr.ScheduleParticipation(tx.From, true); err != nil {
+					return fmt.Errorf("failed to schedule participation for %s: %w", tx.From.ToHex(), err)
+				}
+			}
 		case "delegate":
-			// Delegate stake from sender to recipient (validator)
+			// Add delegated stake to the validator
 			v, err := vr.GetValidator(tx.To)
 			if err != nil {
-				return fmt.Errorf("cannot delegate to non-registered validator %s: %w", tx.To.ToHex(), err)
+				return fmt.Errorf("failed to look up validator %s: %w", tx.To.ToHex(), err)
 			}
-			if v == nil {
-				return fmt.Errorf("validator %s not found", tx.To.ToHex())
-			}
-			// Add delegated stake to the validator
 			v.DelegatedStake += tx.Value
 			_ = vr.RegisterValidator(v)
 		}
 
-		// Apply the transaction to state (balance updates, nonce increments, etc.)
-		if err := state.ApplyTransaction(tx); err != nil {
-			return fmt.Errorf("failed to apply transaction %s: %w", tx.Hash, err)
+		// Participation changes, compute attestations and governance actions are
+		// only recorded once the transaction has passed the nonce and balance
+		// checks; they take effect at the next epoch boundary.
+		switch tx.Type {
+		case "participation", "leave_participation":
+			v, err := vr.GetValidator(tx.From)
+			if err != nil {
+				return fmt.Errorf("failed to look up validator %s: %w", tx.From.ToHex(), err)
+			}
+			if v == nil {
+				log.Printf("WARN: Ignoring %s transaction %s from unregistered validator %s", tx.Type, tx.Hash.ToHex(), tx.From.ToHex())
+				continue
+			}
+			if err := vr.ScheduleParticipation(tx.From, tx.Type == "participation"); err != nil {
+				return fmt.Errorf("failed to schedule participation change for %s: %w", tx.From.ToHex(), err)
+			}
+		case "compute_attestation":
+			// Only committee members may report on registered validators
+			member, err := isCommitteeMember(vr, tx.From)
+			if err != nil {
+				return fmt.Errorf("failed to select committee: %w", err)
+			}
+			if !member {
+				log.Printf("WARN: Ignoring compute attestation %s from non-committee member %s", tx.Hash.ToHex(), tx.From.ToHex())
+				continue
+			}
+			subject, err := vr.GetValidator(tx.Attestation.Subject)
+			if err != nil {
+				return fmt.Errorf("failed to look up validator %s: %w", tx.Attestation.Subject.ToHex(), err)
+			}
+			if subject == nil {
+				log.Printf("WARN: Ignoring compute attestation %s for unregistered validator %s", tx.Hash.ToHex(), tx.Attestation.Subject.ToHex())
+				continue
+			}
+			if err := vr.RecordAttestation(tx.From, tx.Attestation.Subject, tx.Attestation.Score); err != nil {
+				return fmt.Errorf("failed to record compute attestation: %w", err)
+			}
+		case "submit_proposal":
+			// Only registered validators may open proposals
+			v, err := vr.GetValidator(tx.From)
+			if err != nil {
+				return fmt.Errorf("failed to look up validator %s: %w", tx.From.ToHex(), err)
+			}
+			if v == nil {
+				log.Printf("WARN: Ignoring proposal %s from unregistered validator %s", tx.Hash.ToHex(), tx.From.ToHex())
+				continue
+			}
+			epoch := vr.CurrentEpoch().Number
+			proposal := &Proposal{
+				ID:             tx.Hash,
+				Proposer:       tx.From,
+				Title:          tx.Proposal.Title,
+				Description:    tx.Proposal.Description,
+				Changes:        tx.Proposal.Changes,
+				Upgrade:        tx.Proposal.Upgrade,
+				SubmitEpoch:    epoch,
+				VotingEndEpoch: epoch + GovernanceVotingEpochs,
+				Status:         ProposalStatusVoting,
+			}
+			if err := vr.PutProposal(proposal); err != nil {
+				return fmt.Errorf("failed to store proposal: %w", err)
+			}
+		case "vote":
+			proposal, err := vr.GetProposal(tx.Vote.ProposalID)
+			if err != nil {
+				return fmt.Errorf("failed to look up proposal %s: %w", tx.Vote.ProposalID.ToHex(), err)
+			}
+			if proposal == nil || proposal.Status != ProposalStatusVoting {
+				log.Printf("WARN: Ignoring vote %s on proposal %s that is not open for voting", tx.Hash.ToHex(), tx.Vote.ProposalID.ToHex())
+				continue
+			}
+			v, err := vr.GetValidator(tx.From)
+			if err != nil {
+				return fmt.Errorf("failed to look up validator %s: %w", tx.From.ToHex(), err)
+			}
+			if v == nil {
+				log.Printf("WARN: Ignoring vote %s from unregistered validator %s", tx.Hash.ToHex(), tx.From.ToHex())
+				continue
+			}
+			if err := vr.RecordVote(tx.Vote.ProposalID, tx.From, tx.Vote.Approve); err != nil {
+				return fmt.Errorf("failed to record vote: %w", err)
+			}
+		}
+	}
+
+	if block.Header != nil && vr != nil {
+		if err := advanceEpoch(block.Header.BlockNumber, vr); err != nil {
+			return fmt.Errorf("failed to process epoch transition at block %d: %w", block.Header.BlockNumber, err)
 		}
 	}
 	return nil
 }
 
+// executeBlockTransactions checks that each of a block's transactions can be
+// included and applies it to state, returning their receipts. Transactions
+// that fail to execute are kept in the block with a failed receipt, and their
+// sender still pays the fee.
+func executeBlockTransactions(block *Block, state *State, vr *ValidatorRegistry) ([]*Receipt, error) {
+	// Validators registered earlier in the block can take delegations, though
+	// the registry only records them once the block has applied
+	registered := make(map[Address]bool)
+	receipts := make([]*Receipt, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		if block.Header != nil {
+			if err := checkBaseFee(tx, block.Header.BaseFee); err != nil {
+				return nil, fmt.Errorf("transaction %s: %w", tx.Hash, err)
+			}
+			if err := checkValidityWindow(tx, block.Header.BlockNumber); err != nil {
+				return nil, fmt.Errorf("transaction %s: %w", tx.Hash, err)
+			}
+		}
+		if err := checkInclusion(state, tx); err != nil {
+			return nil, fmt.Errorf("transaction %s: %w", tx.Hash, err)
+		}
+
+		// Delegations must target a registered validator
+		var applyErr error
+		if tx.Type == "delegate" && !registered[tx.To] {
+			if v, err := vr.GetValidator(tx.To); err != nil || v == nil {
+				applyErr = fmt.Errorf("cannot delegate to non-registered validator %s", tx.To.ToHex())
+			}
+		}
+
+		var receipt *Receipt
+		if applyErr == nil {
+			receipt, applyErr = state.ApplyTransactionWithReceipt(tx)
+		}
+		if applyErr != nil {
+			log.Printf("WARN: Transaction %s failed: %v", tx.Hash.ToHex(), applyErr)
+			var err error
+			if receipt, err = state.failTransaction(tx, applyErr); err != nil {
+				return nil, fmt.Errorf("failed to record failed transaction %s: %w", tx.Hash, err)
+			}
+		}
+		if block.Header != nil {
+			if err := payFees(state, block.Header, tx, receipt); err != nil {
+				return nil, fmt.Errorf("failed to pay fees of %s: %w", tx.Hash, err)
+			}
+		}
+		if tx.Type == "register_validator" && receipt.Status == ReceiptStatusSuccess {
+			registered[tx.From] = true
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
 // Helper to marshal uint64
 func mustMarshalUint64(h uint64) []byte {
 	b, _ := json.Marshal(h)
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// checkpointRetryInterval is how long checkpoint sync waits before asking the
+// whitelisted peers again when none served the checkpoint.
+const checkpointRetryInterval = 5 * time.Second
+
+// Checkpoint is a finalized block a node trusts as the start of its chain, so
+// that it need not sync from genesis: the block's height and hash and the state
+// root after it. Checkpoints must be at an epoch boundary, where peers take the
+// snapshots they serve.
+type Checkpoint struct {
+	Height    uint64 `json:"height"`
+	Hash      Hash   `json:"hash"`
+	StateRoot Hash   `json:"stateRoot"`
+}
+
+// ParseCheckpoint parses a checkpoint written as height:blockHash:stateRoot,
+// with the hashes in hex.
+func ParseCheckpoint(s string) (*Checkpoint, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, errors.New("checkpoint must be height:blockHash:stateRoot")
+	}
+	height, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || height == 0 {
+		return nil, fmt.Errorf("invalid checkpoint height %q", parts[0])
+	}
+	hash, err := HexToHash(strings.TrimPrefix(parts[1], "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint block hash: %w", err)
+	}
+	root, err := HexToHash(strings.TrimPrefix(parts[2], "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint state root: %w", err)
+	}
+	return &Checkpoint{Height: height, Hash: hash, StateRoot: root}, nil
+}
+
+// SyncToCheckpoint makes the checkpoint block the node's chain tip, with the
+// state and validator registry of the snapshot taken at it. It asks the
+// whitelisted peers in turn until one serves a snapshot matching the
+// checkpoint's state root and a block matching its hash whose commit
+// certificate the snapshot's validators signed, and keeps asking until ctx is
+// done. The node neither produces nor imports blocks in the meantime.
+func (fsm *FastSyncManager) SyncToCheckpoint(ctx context.Context, cp *Checkpoint) error {
+	fsm.importing.Store(true)
+	defer fsm.importing.Store(false)
+
+	log.Printf("FASTSYNC: Syncing to checkpoint %s at height %d", cp.Hash.ToHex(), cp.Height)
+	for {
+		fsm.peers = fsm.discoverPeers()
+		for _, id := range fsm.peers {
+			err := fsm.syncCheckpointFrom(ctx, id, cp)
+			if err == nil {
+				log.Printf("FASTSYNC: Started from checkpoint at height %d", cp.Height)
+				return nil
+			}
+			log.Printf("FASTSYNC: Checkpoint from %s rejected: %v", id, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(checkpointRetryInterval):
+		}
+	}
+}
+
+// syncCheckpointFrom fetches and verifies the checkpoint's snapshot, validator
+// registry and block from one peer and imports them.
+func (fsm *FastSyncManager) syncCheckpointFrom(ctx context.Context, id peer.ID, cp *Checkpoint) error {
+	resp, err := fsm.request(ctx, id, &fastSyncRequest{Type: "manifest", Height: cp.Height})
+	if err != nil {
+		return err
+	}
+	manifest := resp.Manifest
+	if manifest == nil || manifest.Height != cp.Height || manifest.Root != cp.StateRoot {
+		fsm.penalize(id, "snapshot does not match the checkpoint")
+		return errors.New("snapshot does not match the checkpoint's state root")
+	}
+	importer, err := NewSnapshotImporter(manifest)
+	if err != nil {
+		fsm.penalize(id, "invalid snapshot manifest")
+		return err
+	}
+	if err := fsm.requestChunks(ctx, id, importer); err != nil {
+		return err
+	}
+	state, err := importer.State()
+	if err != nil {
+		fsm.penalize(id, "inconsistent snapshot manifest")
+		return err
+	}
+
+	base, err := fsm.requestBlock(ctx, id, cp.Height)
+	if err != nil {
+		return err
+	}
+	if base.Header.Hash != cp.Hash {
+		fsm.penalize(id, "block does not match the checkpoint")
+		return fmt.Errorf("block %d is not the checkpoint block", cp.Height)
+	}
+
+	validators, _, err := fsm.requestValidators(ctx, id, state, base)
+	if err != nil {
+		return err
+	}
+	return fsm.applyCheckpoint(state, validators, base)
+}
+
+// requestValidators fetches the validator registry exported with the snapshot
+// at block's height from a peer. The registry is not committed to by the state
+// root, so it is only accepted if it is for the epoch ending after block,
+// selects the same committee as the node's own registry and holds the
+// committee that certified block. It returns the exported entries and a
+// registry holding them.
+func (fsm *FastSyncManager) requestValidators(ctx context.Context, id peer.ID, state *State, block *Block) ([]KVPair, *ValidatorRegistry, error) {
+	height := block.Header.BlockNumber
+	resp, err := fsm.request(ctx, id, &fastSyncRequest{Type: "validators", Height: height})
+	if err != nil {
+		return nil, nil, err
+	}
+	validators := NewValidatorRegistry(NewMemoryStore(), "validators")
+	if err := validators.Import(resp.Validators); err != nil {
+		return nil, nil, err
+	}
+	if end := validators.CurrentEpoch().EndHeight(); end != height+1 {
+		fsm.penalize(id, "validator set from another epoch")
+		return nil, nil, fmt.Errorf("validator set is for an epoch ending at height %d, not %d", end, height+1)
+	}
+	// A peer could otherwise name a committee of its own to certify the block
+	local, err := registryCommittee(fsm.node.vr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("select committee: %w", err)
+	}
+	if len(local) == 0 {
+		return nil, nil, errors.New("the node's registry selects no committee to check the validator set against")
+	}
+	if selected, err := registryCommittee(validators); err != nil || !sameCommittee(local, selected) {
+		fsm.penalize(id, "validator set selects another committee")
+		return nil, nil, errors.New("validator set selects another committee than the node's registry")
+	}
+	if err := verifyCommitCertificate(state, validators, block.Header, block.Certificate); err != nil {
+		fsm.penalize(id, "validator set does not certify the snapshot's block")
+		return nil, nil, fmt.Errorf("block %d: %w", height, err)
+	}
+	return resp.Validators, validators, nil
+}
+
+// applyCheckpoint replaces the node's state and validator registry with those
+// of a verified snapshot and makes the snapshot's block the chain tip.
+func (fsm *FastSyncManager) applyCheckpoint(state *State, validators []KVPair, base *Block) error {
+	n := fsm.node
+	n.blockImportMu.Lock()
+	defer n.blockImportMu.Unlock()
+
+	n.state.Trie.Replace(state.Trie)
+	n.state.SetHeight(base.Header.BlockNumber)
+	if err := n.vr.Import(validators); err != nil {
+		return fmt.Errorf("failed to import validator set: %w", err)
+	}
+	if err := n.bc.AddBlock(base); err != nil {
+		return err
+	}
+	// Serve the checkpoint on to other syncing peers
+	n.snapshots.Add(NewStateSnapshot(n.state))
+	n.snapshots.AddValidators(base.Header.BlockNumber, validators)
+	return nil
+}
+
+// startFromCheckpoint syncs the node to its checkpoint, catches up from there
+// and, if asked to, backfills the blocks below the checkpoint.
+func (n *AppNode) startFromCheckpoint() {
+	if err := n.fastSyncManager.SyncToCheckpoint(n.ctx, n.Checkpoint); err != nil {
+		log.Printf("ERROR: Checkpoint sync stopped: %v", err)
+		return
+	}
+	n.updatePool()
+	n.performBlockSync()
+	if !n.Backfill {
+		return
+	}
+	if err := n.blockSyncer.Backfill(n.ctx, n.Checkpoint.Height); err != nil {
+		log.Printf("WARN: Backfill stopped: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCheckpoint(t *testing.T) {
+	hash, root := Hash{1}, Hash{2}
+	cp, err := ParseCheckpoint(fmt.Sprintf("42:0x%s:%s", hash.ToHex(), root.ToHex()))
+	require.NoError(t, err)
+	assert.Equal(t, &Checkpoint{Height: 42, Hash: hash, StateRoot: root}, cp)
+
+	for _, bad := range []string{
+		"42:" + hash.ToHex(),
+		"0:" + hash.ToHex() + ":" + root.ToHex(),
+		"x:" + hash.ToHex() + ":" + root.ToHex(),
+		"42:abcd:" + root.ToHex(),
+	} {
+		_, err := ParseCheckpoint(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// newCheckpointClient builds a node whose registry, like that of every node
+// of server's chain, starts with the validators that finalize it.
+func newCheckpointClient(t *testing.T, ctx context.Context, server *AppNode) *AppNode {
+	client := newSyncTestNode(t, ctx)
+	validators, err := server.vr.GetAllValidators()
+	require.NoError(t, err)
+	for _, v := range validators {
+		require.NoError(t, client.vr.RegisterValidator(v))
+	}
+	return client
+}
+
+// newCheckpointTest builds a server whose chain ends at an epoch boundary it
+// has a snapshot of, and returns the checkpoint of that boundary.
+func newCheckpointTest(t *testing.T, ctx context.Context, length int) (*AppNode, *Checkpoint) {
+	server := newSyncTestNode(t, ctx)
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	require.NoError(t, server.vr.RegisterValidator(&Validator{Address: pubKeyToAddress(proposer.PubKey()), Participating: true}))
+	require.NoError(t, server.vr.SetCurrentEpoch(EpochInfo{Number: 1, StartHeight: 1, Length: uint64(length)}))
+	sender := newTokenTestAccount(t, server.state, 1000)
+	for i := 0; i < length; i++ {
+		extendFastSyncTestChain(t, server, proposer, sender)
+	}
+	server.snapshots.AfterBlock(server.bc.Height(), server.state, server.vr)
+
+	last, err := server.bc.GetLastBlock()
+	require.NoError(t, err)
+	return server, &Checkpoint{Height: last.Header.BlockNumber, Hash: last.Header.Hash, StateRoot: server.state.Root()}
+}
+
+func TestFastSyncManager_SyncToCheckpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, cp := newCheckpointTest(t, ctx, MaxBlockSyncRange+10)
+	client := newCheckpointClient(t, ctx, server)
+	connectSyncPeer(t, ctx, client, server)
+
+	require.NoError(t, client.fastSyncManager.SyncToCheckpoint(ctx, cp))
+	assert.False(t, client.fastSyncManager.Importing())
+	assert.Equal(t, cp.Height, client.bc.Height())
+	assert.Equal(t, cp.StateRoot, client.state.Root())
+	last, err := client.bc.GetLastBlock()
+	require.NoError(t, err)
+	assert.Equal(t, cp.Hash, last.Header.Hash)
+	assert.Equal(t, server.vr.CurrentEpoch(), client.vr.CurrentEpoch(), "the committee set is taken from the checkpoint")
+	assert.NotNil(t, client.snapshots.Latest(), "the checkpoint is served on")
+	self, err := client.vr.GetValidator(client.address)
+	require.NoError(t, err)
+	assert.Nil(t, self, "the node joins the validator set only through register_validator")
+
+	// History below the checkpoint is absent until backfilled
+	_, err = client.bc.GetBlockByHeight(1)
+	assert.Error(t, err)
+	require.NoError(t, client.blockSyncer.Backfill(ctx, cp.Height))
+	for h := uint64(1); h < cp.Height; h++ {
+		want, err := server.bc.GetBlockByHeight(h)
+		require.NoError(t, err)
+		got, err := client.bc.GetBlockByHeight(h)
+		require.NoError(t, err)
+		assert.Equal(t, want.Header.Hash, got.Header.Hash)
+	}
+	assert.Equal(t, cp.Height, client.bc.Height(), "backfill leaves the tip alone")
+}
+
+func TestFastSyncManager_SyncToCheckpointRejectsMismatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, cp := newCheckpointTest(t, ctx, 5)
+	client := newCheckpointClient(t, ctx, server)
+	id := connectSyncPeer(t, ctx, client, server)
+
+	for _, bad := range []*Checkpoint{
+		{Height: cp.Height, Hash: cp.Hash, StateRoot: Hash{1}},
+		{Height: cp.Height, Hash: Hash{1}, StateRoot: cp.StateRoot},
+	} {
+		err := client.fastSyncManager.syncCheckpointFrom(ctx, id, bad)
+		assert.ErrorContains(t, err, "checkpoint")
+	}
+	assert.Equal(t, 2, pomScore(client.barNet, id))
+
+	// A validator set naming a committee of the peer's choosing is refused,
+	// however the checkpoint block's certificate is signed
+	require.NoError(t, server.vr.Import(nil))
+	require.NoError(t, server.vr.RegisterValidator(&Validator{Address: Address{7}, Participating: true}))
+	require.NoError(t, server.vr.SetCurrentEpoch(EpochInfo{Number: 1, StartHeight: 1, Length: cp.Height}))
+	validators, err := server.vr.Export()
+	require.NoError(t, err)
+	server.snapshots.AddValidators(cp.Height, validators)
+	assert.ErrorContains(t, client.fastSyncManager.syncCheckpointFrom(ctx, id, cp), "selects another committee")
+	assert.Equal(t, uint64(0), client.bc.Height())
+	assert.Equal(t, 3, pomScore(client.barNet, id))
+
+	// With no peer serving the checkpoint, sync waits until it is cancelled
+	waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer waitCancel()
+	assert.ErrorIs(t, client.fastSyncManager.SyncToCheckpoint(waitCtx, cp), context.DeadlineExceeded)
+}
+
+func TestBlockSyncer_BackfillRejectsUnlinkedHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, cp := newCheckpointTest(t, ctx, 5)
+	other, _ := newCheckpointTest(t, ctx, 5)
+	client := newCheckpointClient(t, ctx, server)
+	connectSyncPeer(t, ctx, client, server)
+	require.NoError(t, client.fastSyncManager.SyncToCheckpoint(ctx, cp))
+
+	// A peer on another chain cannot fill in the history
+	bad := connectSyncPeer(t, ctx, client, other)
+	require.True(t, client.barNet.DemoteToGreylist(server.p2p.host.ID()))
+	assert.ErrorContains(t, client.blockSyncer.Backfill(ctx, cp.Height), "no peer served")
+	assert.Equal(t, 1, pomScore(client.barNet, bad))
+}
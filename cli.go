@@ -2,10 +2,16 @@ package main
 
 import (
 	"bufio"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
 )
 
 // CLI represents the command-line interface
@@ -74,12 +80,72 @@ func (cli *CLI) executeCommand(cmd string, args []string) error {
 		return cli.cmdAccount(args)
 	case "send":
 		return cli.cmdSend(args)
+	case "multi-send":
+		return cli.cmdMultiSend(args)
+	case "rotate-key":
+		return cli.cmdRotateKey(args)
 	case "create":
 		return cli.cmdCreate(args)
 	case "delegate":
 		return cli.cmdDelegate(args)
 	case "register":
 		return cli.cmdRegister(args)
+	case "participate":
+		return cli.cmdParticipation("participation", args)
+	case "leave":
+		return cli.cmdParticipation("leave_participation", args)
+	case "attest":
+		return cli.cmdAttest(args)
+	case "reputation":
+		return cli.cmdReputation(args)
+	case "propose":
+		return cli.cmdPropose(args)
+	case "propose-upgrade":
+		return cli.cmdProposeUpgrade(args)
+	case "vote":
+		return cli.cmdVote(args)
+	case "proposals":
+		return cli.cmdProposals(args)
+	case "params":
+		return cli.cmdParams(args)
+	case "issue-token":
+		return cli.cmdIssueToken(args)
+	case "mint-token":
+		return cli.cmdMintToken(args)
+	case "send-token":
+		return cli.cmdSendToken(args)
+	case "pubkey":
+		return cli.cmdPubKey(args)
+	case "multisig-address":
+		return cli.cmdMultisigAddress(args)
+	case "multisig-tx":
+		return cli.cmdMultisigTx(args)
+	case "multisig-sign":
+		return cli.cmdMultisigSign(args)
+	case "multisig-combine":
+		return cli.cmdMultisigCombine(args)
+	case "multisig-submit":
+		return cli.cmdMultisigSubmit(args)
+	case "vest":
+		return cli.cmdVest(args)
+	case "htlc-lock":
+		return cli.cmdHTLCLock(args)
+	case "htlc-claim":
+		return cli.cmdHTLCClaim(args)
+	case "htlc-refund":
+		return cli.cmdHTLCRefund(args)
+	case "htlc":
+		return cli.cmdHTLC(args)
+	case "deploy":
+		return cli.cmdDeploy(args)
+	case "call":
+		return cli.cmdCall(args)
+	case "contract":
+		return cli.cmdContract(args)
+	case "fees":
+		return cli.cmdFees(args)
+	case "receipt":
+		return cli.cmdReceipt(args)
 	case "block":
 		return cli.cmdBlock(args)
 	case "blocks":
@@ -111,11 +177,41 @@ func (cli *CLI) cmdHelp() error {
 	fmt.Fprintln(cli.out, "  exit  - Exit the CLI")
 	fmt.Fprintln(cli.out, "  balance [address] - Show balance for address (default: own address)")
 	fmt.Fprintln(cli.out, "  account [address] - Show account details for address (default: own address)")
-	fmt.Fprintln(cli.out, "  send <to> <amount> [fee] - Send tokens to address")
+	fmt.Fprintln(cli.out, "  send <to> <amount> [fee] [memo] - Send tokens to address")
+	fmt.Fprintln(cli.out, "  multi-send <to:amount,...> [fee] - Pay several addresses in one transaction")
 	fmt.Fprintln(cli.out, "  create <type> <to> <amount> [fee] - Create transaction with type")
 	fmt.Fprintln(cli.out, "    Types: transfer, delegate, register_validator")
 	fmt.Fprintln(cli.out, "  delegate <validator> <amount> - Delegate stake to validator")
 	fmt.Fprintln(cli.out, "  register <stake> - Register as validator")
+	fmt.Fprintln(cli.out, "  participate [fee] - Join the committee from the next epoch")
+	fmt.Fprintln(cli.out, "  leave [fee] - Leave the committee from the next epoch")
+	fmt.Fprintln(cli.out, "  attest <validator> <score> [fee] - Report a validator's compute score for this epoch")
+	fmt.Fprintln(cli.out, "  reputation [address] - Show compute reputation history (default: own address)")
+	fmt.Fprintln(cli.out, "  propose <param> <value> [fee] - Propose a consensus parameter change")
+	fmt.Fprintln(cli.out, "  propose-upgrade <name> <height> [fee] - Propose a software upgrade at a block height")
+	fmt.Fprintln(cli.out, "  vote <proposal-id> <yes|no> [fee] - Vote on a governance proposal")
+	fmt.Fprintln(cli.out, "  proposals - Show governance proposals")
+	fmt.Fprintln(cli.out, "  params - Show the consensus parameters in force")
+	fmt.Fprintln(cli.out, "  issue-token <symbol> <decimals> <supply> [fee] - Issue a token; you keep the mint authority")
+	fmt.Fprintln(cli.out, "  mint-token <symbol> <to> <amount> [fee] - Mint additional supply of a token")
+	fmt.Fprintln(cli.out, "  send-token <to> <symbol> <amount> [fee] - Send a token to address")
+	fmt.Fprintln(cli.out, "  pubkey - Show this node's compressed public key")
+	fmt.Fprintln(cli.out, "  rotate-key <new-private-key-hex> [fee] - Bind a new signing key to this node's address")
+	fmt.Fprintln(cli.out, "  multisig-address <threshold> <pubkey,...> - Show the address of an M-of-N account")
+	fmt.Fprintln(cli.out, "  multisig-tx <threshold> <pubkey,...> <to> <amount> <file> [fee] - Write an unsigned transfer from a multisig account")
+	fmt.Fprintln(cli.out, "  multisig-sign <file> [out-file] - Add this node's signature to a multisig transaction")
+	fmt.Fprintln(cli.out, "  multisig-combine <out-file> <file> <file>... - Combine partially signed multisig transactions")
+	fmt.Fprintln(cli.out, "  multisig-submit <file> - Broadcast a fully signed multisig transaction")
+	fmt.Fprintln(cli.out, "  vest <to> <amount> <start> <cliff> <end> [fee] - Send tokens that unlock linearly between block heights")
+	fmt.Fprintln(cli.out, "  htlc-lock <to> <amount> <hash-lock> <timeout-height> [fee] - Lock funds claimable with the SHA-256 preimage")
+	fmt.Fprintln(cli.out, "  htlc-claim <hash-lock> <preimage-hex> [fee] - Claim an HTLC before its timeout")
+	fmt.Fprintln(cli.out, "  htlc-refund <hash-lock> [fee] - Refund an HTLC after its timeout")
+	fmt.Fprintln(cli.out, "  htlc <hash-lock> - Show an HTLC")
+	fmt.Fprintln(cli.out, "  deploy <code-hex> <gas-limit> [value] [fee] - Deploy contract bytecode")
+	fmt.Fprintln(cli.out, "  call <contract> <gas-limit> [value] [input-hex] [fee] - Call a contract")
+	fmt.Fprintln(cli.out, "  contract <address> [storage-key] - Show a contract or one of its storage words")
+	fmt.Fprintln(cli.out, "  receipt <hash> - Show the execution receipt of an included transaction")
+	fmt.Fprintln(cli.out, "  fees [gas] - Show the base fee and suggested fee for the next block")
 	fmt.Fprintln(cli.out, "  block <height> - Show block at height")
 	fmt.Fprintln(cli.out, "  blocks [start] [end] - Show blocks in range")
 	fmt.Fprintln(cli.out, "  tx <hash> - Show transaction by hash")
@@ -153,6 +249,25 @@ func (cli *CLI) cmdBalance(args []string) error {
 	}
 
 	fmt.Fprintf(cli.out, "Address: %s\nBalance: %d\nNonce: %d\n", addr.ToHex(), acc.Balance, acc.Nonce)
+	if err := cli.printVesting(addr, ""); err != nil {
+		return err
+	}
+
+	tokens, err := cli.node.state.GetTokenBalances(addr)
+	if err != nil {
+		return fmt.Errorf("failed to read token balances: %v", err)
+	}
+	if len(tokens) > 0 {
+		symbols := make([]string, 0, len(tokens))
+		for symbol := range tokens {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		fmt.Fprintln(cli.out, "Tokens:")
+		for _, symbol := range symbols {
+			fmt.Fprintf(cli.out, "  %s: %d\n", symbol, tokens[symbol])
+		}
+	}
 	return nil
 }
 
@@ -178,6 +293,9 @@ func (cli *CLI) cmdAccount(args []string) error {
 	fmt.Fprintf(cli.out, "  Address: %s\n", addr.ToHex())
 	fmt.Fprintf(cli.out, "  Balance: %d\n", acc.Balance)
 	fmt.Fprintf(cli.out, "  Nonce: %d\n", acc.Nonce)
+	if err := cli.printVesting(addr, "  "); err != nil {
+		return err
+	}
 
 	// Try to get validator info
 	validator, err := cli.node.vr.GetValidator(addr)
@@ -195,7 +313,7 @@ func (cli *CLI) cmdAccount(args []string) error {
 // cmdSend sends tokens to an address
 func (cli *CLI) cmdSend(args []string) error {
 	if len(args) < 2 {
-		return fmt.Errorf("usage: send <to> <amount> [fee]")
+		return fmt.Errorf("usage: send <to> <amount> [fee] [memo]")
 	}
 
 	toAddr, err := HexToAddress(args[0])
@@ -212,8 +330,17 @@ func (cli *CLI) cmdSend(args []string) error {
 		return fmt.Errorf("amount must be greater than 0")
 	}
 
+	// Parse optional memo, the rest of the line after the fee
+	var memo []byte
+	if len(args) >= 4 {
+		memo = []byte(strings.Join(args[3:], " "))
+		if len(memo) > MaxTransactionDataLength {
+			return fmt.Errorf("memo exceeds %d bytes", MaxTransactionDataLength)
+		}
+	}
+
 	// Parse optional fee
-	fee := uint64(1) // Default fee
+	fee := cli.suggestedFee(intrinsicGas(&Transaction{Data: memo}))
 	if len(args) >= 3 {
 		if _, err := fmt.Sscanf(args[2], "%d", &fee); err != nil {
 			return fmt.Errorf("invalid fee: %v", err)
@@ -247,6 +374,9 @@ func (cli *CLI) cmdSend(args []string) error {
 	fmt.Fprintf(cli.out, "  Current Balance: %d\n", acc.Balance)
 	fmt.Fprintf(cli.out, "  Balance After: %d\n", acc.Balance-totalRequired)
 	fmt.Fprintf(cli.out, "  Nonce: %d\n", acc.Nonce+1)
+	if len(memo) > 0 {
+		fmt.Fprintf(cli.out, "  Memo: %s\n", memo)
+	}
 
 	tx := &Transaction{
 		From:      cli.node.address,
@@ -256,6 +386,7 @@ func (cli *CLI) cmdSend(args []string) error {
 		Fee:       fee,
 		Timestamp: time.Now().UnixNano(),
 		Type:      "transfer",
+		Data:      memo,
 	}
 
 	// Sign the transaction
@@ -276,6 +407,38 @@ func (cli *CLI) cmdSend(args []string) error {
 	return nil
 }
 
+// cmdMultiSend pays several addresses in one multi_transfer transaction
+func (cli *CLI) cmdMultiSend(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: multi-send <to:amount,...> [fee]")
+	}
+
+	tx := &Transaction{Type: "multi_transfer"}
+	for _, pair := range strings.Split(args[0], ",") {
+		toStr, amountStr, ok := strings.Cut(pair, ":")
+		if !ok {
+			return fmt.Errorf("invalid output %q: want <to>:<amount>", pair)
+		}
+		toAddr, err := HexToAddress(toStr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient address: %v", err)
+		}
+		var amount uint64
+		if _, err := fmt.Sscanf(amountStr, "%d", &amount); err != nil {
+			return fmt.Errorf("invalid amount: %v", err)
+		}
+		tx.Outputs = append(tx.Outputs, TransferOutput{To: toAddr, Value: amount})
+		tx.Value += amount
+	}
+	if len(tx.Outputs) > 0 {
+		tx.To = tx.Outputs[0].To
+	}
+	if err := validateMultiTransfer(tx); err != nil {
+		return err
+	}
+	return cli.submitTx(tx, args[1:])
+}
+
 // cmdCreate creates a transaction with a specific type
 func (cli *CLI) cmdCreate(args []string) error {
 	if len(args) < 3 {
@@ -295,7 +458,7 @@ func (cli *CLI) cmdCreate(args []string) error {
 	}
 
 	// Parse optional fee
-	fee := uint64(1) // Default fee
+	fee := cli.suggestedFee(GasTransaction)
 	if len(args) >= 4 {
 		if _, err := fmt.Sscanf(args[3], "%d", &fee); err != nil {
 			return fmt.Errorf("invalid fee: %v", err)
@@ -459,6 +622,291 @@ func (cli *CLI) cmdRegister(args []string) error {
 	return nil
 }
 
+// cmdParticipation submits a participation or leave_participation transaction
+func (cli *CLI) cmdParticipation(txType string, args []string) error {
+	fee := cli.suggestedFee(GasTransaction)
+	if len(args) >= 1 {
+		if _, err := fmt.Sscanf(args[0], "%d", &fee); err != nil {
+			return fmt.Errorf("invalid fee: %v", err)
+		}
+	}
+
+	validator, err := cli.node.vr.GetValidator(cli.node.address)
+	if err != nil || validator == nil {
+		return fmt.Errorf("node %s is not a registered validator", cli.node.address.ToHex())
+	}
+
+	// Get current nonce
+	acc, err := cli.node.state.GetAccount(cli.node.address)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+
+	tx := &Transaction{
+		From:      cli.node.address,
+		To:        cli.node.address,
+		Value:     0,
+		Nonce:     acc.Nonce + 1,
+		Fee:       fee,
+		Timestamp: time.Now().UnixNano(),
+		Type:      txType,
+	}
+
+	// Sign the transaction
+	if err := tx.Sign(cli.node.privKey); err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+
+	// Broadcast the transaction
+	if err := cli.node.BroadcastTransaction(tx); err != nil {
+		return fmt.Errorf("failed to broadcast transaction: %v", err)
+	}
+
+	fmt.Fprintf(cli.out, "Participation change submitted (takes effect next epoch): %s\n", tx.Hash.ToHex())
+	return nil
+}
+
+// cmdAttest submits a compute attestation for another validator
+func (cli *CLI) cmdAttest(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: attest <validator> <score> [fee]")
+	}
+
+	subject, err := HexToAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid validator address: %v", err)
+	}
+
+	var score uint64
+	if _, err := fmt.Sscanf(args[1], "%d", &score); err != nil {
+		return fmt.Errorf("invalid score: %v", err)
+	}
+
+	fee := cli.suggestedFee(GasTransaction)
+	if len(args) >= 3 {
+		if _, err := fmt.Sscanf(args[2], "%d", &fee); err != nil {
+			return fmt.Errorf("invalid fee: %v", err)
+		}
+	}
+
+	acc, err := cli.node.state.GetAccount(cli.node.address)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+
+	tx := &Transaction{
+		From:        cli.node.address,
+		To:          subject,
+		Nonce:       acc.Nonce + 1,
+		Fee:         fee,
+		Timestamp:   time.Now().UnixNano(),
+		Type:        "compute_attestation",
+		Attestation: &ComputeAttestation{Subject: subject, Score: score},
+	}
+	if err := validateComputeAttestation(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Sign(cli.node.privKey); err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+
+	if err := cli.node.BroadcastTransaction(tx); err != nil {
+		return fmt.Errorf("failed to broadcast transaction: %v", err)
+	}
+
+	fmt.Fprintf(cli.out, "Compute attestation submitted: %s\n", tx.Hash.ToHex())
+	return nil
+}
+
+// cmdReputation shows the compute reputation history of a validator
+func (cli *CLI) cmdReputation(args []string) error {
+	addr := cli.node.address
+	if len(args) > 0 {
+		var err error
+		addr, err = HexToAddress(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid address: %v", err)
+		}
+	}
+
+	history, err := cli.node.vr.GetReputationHistory(addr)
+	if err != nil {
+		return fmt.Errorf("failed to get reputation history: %v", err)
+	}
+
+	fmt.Fprintf(cli.out, "Compute reputation history for %s:\n", addr.ToHex())
+	if len(history) == 0 {
+		fmt.Fprintln(cli.out, "  (no records)")
+		return nil
+	}
+	for _, r := range history {
+		fmt.Fprintf(cli.out, "  Epoch %d: score %d from %d attestations, reputation %d\n", r.Epoch, r.EpochScore, r.Attestations, r.Reputation)
+	}
+	return nil
+}
+
+// submitGovernanceTx fills in sender, nonce and fee, then signs and broadcasts a governance transaction
+func (cli *CLI) submitGovernanceTx(tx *Transaction, feeArg []string) error {
+	fee := cli.suggestedFee(TransactionGas(tx))
+	if len(feeArg) >= 1 {
+		if _, err := fmt.Sscanf(feeArg[0], "%d", &fee); err != nil {
+			return fmt.Errorf("invalid fee: %v", err)
+		}
+	}
+
+	acc, err := cli.node.state.GetAccount(cli.node.address)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+
+	tx.From = cli.node.address
+	tx.To = cli.node.address
+	tx.Nonce = acc.Nonce + 1
+	tx.Fee = fee
+	tx.Timestamp = time.Now().UnixNano()
+
+	if err := tx.Sign(cli.node.privKey); err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	if err := cli.node.BroadcastTransaction(tx); err != nil {
+		return fmt.Errorf("failed to broadcast transaction: %v", err)
+	}
+	return nil
+}
+
+// cmdPropose submits a proposal to change a single consensus parameter
+func (cli *CLI) cmdPropose(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: propose <param> <value> [fee]")
+	}
+
+	var value uint64
+	if _, err := fmt.Sscanf(args[1], "%d", &value); err != nil {
+		return fmt.Errorf("invalid value: %v", err)
+	}
+
+	tx := &Transaction{
+		Type: "submit_proposal",
+		Proposal: &ProposalPayload{
+			Title:   fmt.Sprintf("Set %s to %d", args[0], value),
+			Changes: []ParamChange{{Name: args[0], Value: value}},
+		},
+	}
+	if err := validateProposal(tx); err != nil {
+		return err
+	}
+	if err := cli.submitGovernanceTx(tx, args[2:]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cli.out, "Proposal submitted: %s\n", tx.Hash.ToHex())
+	return nil
+}
+
+// cmdProposeUpgrade submits a proposal scheduling a software upgrade
+func (cli *CLI) cmdProposeUpgrade(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: propose-upgrade <name> <height> [fee]")
+	}
+
+	var height uint64
+	if _, err := fmt.Sscanf(args[1], "%d", &height); err != nil {
+		return fmt.Errorf("invalid height: %v", err)
+	}
+	if height <= cli.node.bc.Height() {
+		return fmt.Errorf("upgrade height must be above the current height %d", cli.node.bc.Height())
+	}
+
+	tx := &Transaction{
+		Type: "submit_proposal",
+		Proposal: &ProposalPayload{
+			Title:   fmt.Sprintf("Upgrade %s at height %d", args[0], height),
+			Upgrade: &UpgradePlan{Name: args[0], Height: height},
+		},
+	}
+	if err := validateProposal(tx); err != nil {
+		return err
+	}
+	if err := cli.submitGovernanceTx(tx, args[2:]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cli.out, "Upgrade proposal submitted: %s\n", tx.Hash.ToHex())
+	return nil
+}
+
+// cmdVote votes on a governance proposal
+func (cli *CLI) cmdVote(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: vote <proposal-id> <yes|no> [fee]")
+	}
+
+	id, err := HexToHash(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid proposal id: %v", err)
+	}
+
+	var approve bool
+	switch strings.ToLower(args[1]) {
+	case "yes":
+		approve = true
+	case "no":
+		approve = false
+	default:
+		return fmt.Errorf("vote must be 'yes' or 'no'")
+	}
+
+	tx := &Transaction{
+		Type: "vote",
+		Vote: &VotePayload{ProposalID: id, Approve: approve},
+	}
+	if err := cli.submitGovernanceTx(tx, args[2:]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cli.out, "Vote submitted: %s\n", tx.Hash.ToHex())
+	return nil
+}
+
+// cmdProposals shows all governance proposals
+func (cli *CLI) cmdProposals(args []string) error {
+	proposals, err := cli.node.vr.GetProposals()
+	if err != nil {
+		return fmt.Errorf("failed to get proposals: %v", err)
+	}
+
+	fmt.Fprintf(cli.out, "Governance proposals (%d):\n", len(proposals))
+	for _, p := range proposals {
+		fmt.Fprintf(cli.out, "  %s [%s] %s\n", p.ID.ToHex(), p.Status, p.Title)
+		fmt.Fprintf(cli.out, "    Voting ends with epoch %d, yes %d / no %d of %d stake\n", p.VotingEndEpoch, p.YesStake, p.NoStake, p.TotalStake)
+	}
+	return nil
+}
+
+// cmdParams shows the consensus parameters in force
+func (cli *CLI) cmdParams(args []string) error {
+	params := cli.node.vr.GetConsensusParams()
+	epoch := cli.node.vr.CurrentEpoch()
+
+	fmt.Fprintf(cli.out, "Consensus parameters (epoch %d, started at height %d):\n", epoch.Number, epoch.StartHeight)
+	fmt.Fprintf(cli.out, "  epoch_length: %d\n", params.EpochLength)
+	fmt.Fprintf(cli.out, "  committee_size: %d\n", params.CommitteeSize)
+	fmt.Fprintf(cli.out, "  block_interval_ms: %d\n", params.BlockIntervalMs)
+	fmt.Fprintf(cli.out, "  max_block_size: %d\n", params.MaxBlockSize)
+	fmt.Fprintf(cli.out, "  pom_threshold: %d\n", params.POMThreshold)
+	fmt.Fprintf(cli.out, "  pom_ban_threshold: %d\n", params.POMBanThreshold)
+	fmt.Fprintf(cli.out, "  min_transaction_fee: %d\n", params.MinTransactionFee)
+	fmt.Fprintf(cli.out, "  max_batch_fee: %d\n", params.MaxBatchFee)
+	fmt.Fprintf(cli.out, "  block_gas_limit: %d\n", params.BlockGasLimit)
+	fmt.Fprintf(cli.out, "  min_base_fee: %d\n", params.MinBaseFee)
+
+	if plan, err := cli.node.vr.GetUpgradePlan(); err == nil && plan != nil {
+		fmt.Fprintf(cli.out, "Scheduled upgrade: %s at height %d\n", plan.Name, plan.Height)
+	}
+	return nil
+}
+
 // cmdBlock shows a specific block
 func (cli *CLI) cmdBlock(args []string) error {
 	if len(args) < 1 {
@@ -538,8 +986,14 @@ func (cli *CLI) cmdTx(args []string) error {
 				fmt.Fprintf(cli.out, "  From: %s\n", tx.From.ToHex())
 				fmt.Fprintf(cli.out, "  To: %s\n", tx.To.ToHex())
 				fmt.Fprintf(cli.out, "  Value: %d\n", tx.Value)
+				for _, out := range tx.Outputs {
+					fmt.Fprintf(cli.out, "    -> %s: %d\n", out.To.ToHex(), out.Value)
+				}
 				fmt.Fprintf(cli.out, "  Nonce: %d\n", tx.Nonce)
 				fmt.Fprintf(cli.out, "  Type: %s\n", tx.Type)
+				if len(tx.Data) > 0 {
+					fmt.Fprintf(cli.out, "  Data: %x\n", tx.Data)
+				}
 				fmt.Fprintf(cli.out, "  Block: %d\n", h)
 				return nil
 			}
@@ -577,13 +1031,13 @@ func (cli *CLI) cmdHistory(args []string) error {
 		}
 
 		for _, tx := range block.Transactions {
-			if tx.From == addr || tx.To == addr {
+			if tx.From == addr || tx.pays(addr) {
 				if !found {
 					found = true
 				}
 
 				direction := "OUT"
-				if tx.To == addr {
+				if tx.pays(addr) {
 					direction = "IN"
 				}
 
@@ -591,7 +1045,13 @@ func (cli *CLI) cmdHistory(args []string) error {
 				fmt.Fprintf(cli.out, "    From: %s\n", tx.From.ToHex())
 				fmt.Fprintf(cli.out, "    To: %s\n", tx.To.ToHex())
 				fmt.Fprintf(cli.out, "    Value: %d | Fee: %d | Type: %s\n", tx.Value, tx.Fee, tx.Type)
+				for _, out := range tx.Outputs {
+					fmt.Fprintf(cli.out, "      -> %s: %d\n", out.To.ToHex(), out.Value)
+				}
 				fmt.Fprintf(cli.out, "    Nonce: %d | Timestamp: %d\n", tx.Nonce, tx.Timestamp)
+				if len(tx.Data) > 0 {
+					fmt.Fprintf(cli.out, "    Data: %x\n", tx.Data)
+				}
 				fmt.Fprintf(cli.out, "\n")
 			}
 		}
@@ -659,3 +1119,677 @@ func (cli *CLI) cmdMetrics(args []string) error {
 	fmt.Fprintln(cli.out, "  (Not implemented yet)")
 	return nil
 }
+
+// suggestedFee returns the fee suggested for a transaction reserving gas in
+// the next block
+func (cli *CLI) suggestedFee(gas uint64) uint64 {
+	estimate, err := cli.node.bc.EstimateFee(gas)
+	if err != nil {
+		return 1
+	}
+	return estimate.SuggestedFee
+}
+
+// submitTx fills in the sender fields of a transaction, signs it and
+// broadcasts it
+func (cli *CLI) submitTx(tx *Transaction, feeArg []string) error {
+	fee := cli.suggestedFee(TransactionGas(tx))
+	if len(feeArg) >= 1 {
+		if _, err := fmt.Sscanf(feeArg[0], "%d", &fee); err != nil {
+			return fmt.Errorf("invalid fee: %v", err)
+		}
+	}
+
+	acc, err := cli.node.state.GetAccount(cli.node.address)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+	if acc.Balance < fee {
+		return fmt.Errorf("insufficient balance for fee. Required: %d, Available: %d", fee, acc.Balance)
+	}
+
+	tx.From = cli.node.address
+	tx.Nonce = acc.Nonce + 1
+	tx.Fee = fee
+	tx.Timestamp = time.Now().UnixNano()
+
+	if err := tx.Sign(cli.node.privKey); err != nil {
+		return fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	if err := cli.node.BroadcastTransaction(tx); err != nil {
+		return fmt.Errorf("failed to broadcast transaction: %v", err)
+	}
+	fmt.Fprintf(cli.out, "✅ %s transaction submitted: %s\n", tx.Type, tx.Hash.ToHex())
+	return nil
+}
+
+// cmdIssueToken issues a new token with this node as issuer and mint authority
+func (cli *CLI) cmdIssueToken(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: issue-token <symbol> <decimals> <supply> [fee]")
+	}
+
+	var decimals uint8
+	if _, err := fmt.Sscanf(args[1], "%d", &decimals); err != nil {
+		return fmt.Errorf("invalid decimals: %v", err)
+	}
+	var supply uint64
+	if _, err := fmt.Sscanf(args[2], "%d", &supply); err != nil {
+		return fmt.Errorf("invalid supply: %v", err)
+	}
+
+	tx := &Transaction{
+		To:   cli.node.address,
+		Type: "issue_token",
+		Token: &TokenIssuance{
+			Symbol:        strings.ToUpper(args[0]),
+			Decimals:      decimals,
+			Supply:        supply,
+			MintAuthority: cli.node.address,
+		},
+	}
+	if err := validateTokenIssuance(tx); err != nil {
+		return err
+	}
+	if err := checkTokenIssuance(cli.node.state, tx); err != nil {
+		return err
+	}
+	return cli.submitTx(tx, args[3:])
+}
+
+// cmdMintToken mints additional supply of a token to an address
+func (cli *CLI) cmdMintToken(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: mint-token <symbol> <to> <amount> [fee]")
+	}
+
+	toAddr, err := HexToAddress(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	var amount uint64
+	if _, err := fmt.Sscanf(args[2], "%d", &amount); err != nil {
+		return fmt.Errorf("invalid amount: %v", err)
+	}
+
+	tx := &Transaction{
+		To:    toAddr,
+		Value: amount,
+		Type:  "mint_token",
+		Asset: strings.ToUpper(args[0]),
+	}
+	if err := validateTokenMint(tx); err != nil {
+		return err
+	}
+	if err := checkTokenFunds(cli.node.state, cli.node.address, tx); err != nil {
+		return err
+	}
+	return cli.submitTx(tx, args[3:])
+}
+
+// cmdSendToken sends a token balance to an address
+func (cli *CLI) cmdSendToken(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: send-token <to> <symbol> <amount> [fee]")
+	}
+
+	toAddr, err := HexToAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	if toAddr == cli.node.address {
+		return fmt.Errorf("cannot send to yourself")
+	}
+	var amount uint64
+	if _, err := fmt.Sscanf(args[2], "%d", &amount); err != nil {
+		return fmt.Errorf("invalid amount: %v", err)
+	}
+	if amount == 0 {
+		return fmt.Errorf("amount must be greater than 0")
+	}
+
+	tx := &Transaction{
+		To:    toAddr,
+		Value: amount,
+		Type:  "transfer",
+		Asset: strings.ToUpper(args[1]),
+	}
+	if err := checkTokenFunds(cli.node.state, cli.node.address, tx); err != nil {
+		return err
+	}
+	return cli.submitTx(tx, args[3:])
+}
+
+// cmdRotateKey binds a new key to the node's address. The new key proves
+// possession by signing the rotation, which the current key then signs.
+func (cli *CLI) cmdRotateKey(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: rotate-key <new-private-key-hex> [fee]")
+	}
+
+	keyBytes, err := hex.DecodeString(args[0])
+	if err != nil || len(keyBytes) != btcec.PrivKeyBytesLen {
+		return fmt.Errorf("invalid private key: want %d hex-encoded bytes", btcec.PrivKeyBytesLen)
+	}
+	newKey, _ := btcec.PrivKeyFromBytes(keyBytes)
+
+	acc, err := cli.node.state.GetAccount(cli.node.address)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+	tx := &Transaction{
+		To:          cli.node.address,
+		Type:        "rotate_key",
+		KeyRotation: NewKeyRotation(cli.node.address, acc.Nonce+1, newKey),
+	}
+	if err := cli.submitTx(tx, args[1:]); err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.out, "Once included, transactions from %s must be signed with key %x\n", cli.node.address.ToHex(), newKey.PubKey().SerializeCompressed())
+	return nil
+}
+
+// cmdPubKey shows the node's compressed public key, as used in multisig key sets
+func (cli *CLI) cmdPubKey(args []string) error {
+	fmt.Fprintf(cli.out, "Public Key: %s\n", hex.EncodeToString(cli.node.privKey.PubKey().SerializeCompressed()))
+	return nil
+}
+
+// parseMultisigKeySet parses a threshold and a comma-separated list of hex public keys
+func parseMultisigKeySet(thresholdArg, keysArg string) (*MultisigEnvelope, error) {
+	var threshold int
+	if _, err := fmt.Sscanf(thresholdArg, "%d", &threshold); err != nil {
+		return nil, fmt.Errorf("invalid threshold: %v", err)
+	}
+	var pubKeys []*btcec.PublicKey
+	for _, keyHex := range strings.Split(keysArg, ",") {
+		data, err := hex.DecodeString(strings.TrimSpace(keyHex))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %v", keyHex, err)
+		}
+		pub, err := btcec.ParsePubKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %v", keyHex, err)
+		}
+		pubKeys = append(pubKeys, pub)
+	}
+	return NewMultisigEnvelope(threshold, pubKeys)
+}
+
+func readMultisigTx(path string) (*Transaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	var tx Transaction
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	if tx.Multisig == nil {
+		return nil, fmt.Errorf("%s is not a multisig transaction", path)
+	}
+	return &tx, nil
+}
+
+func writeMultisigTx(path string, tx *Transaction) error {
+	data, err := json.MarshalIndent(tx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// cmdMultisigAddress shows the address of an M-of-N account
+func (cli *CLI) cmdMultisigAddress(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: multisig-address <threshold> <pubkey,...>")
+	}
+	env, err := parseMultisigKeySet(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.out, "Multisig Address (%d of %d): %s\n", env.Threshold, len(env.PubKeys), env.Address().ToHex())
+	return nil
+}
+
+// cmdMultisigTx writes an unsigned transfer from a multisig account to a file
+// for the co-signers to sign offline
+func (cli *CLI) cmdMultisigTx(args []string) error {
+	if len(args) < 5 {
+		return fmt.Errorf("usage: multisig-tx <threshold> <pubkey,...> <to> <amount> <file> [fee]")
+	}
+	env, err := parseMultisigKeySet(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	toAddr, err := HexToAddress(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	var value uint64
+	if _, err := fmt.Sscanf(args[3], "%d", &value); err != nil {
+		return fmt.Errorf("invalid amount: %v", err)
+	}
+	fee := cli.suggestedFee(GasTransaction)
+	if len(args) >= 6 {
+		if _, err := fmt.Sscanf(args[5], "%d", &fee); err != nil {
+			return fmt.Errorf("invalid fee: %v", err)
+		}
+	}
+
+	from := env.Address()
+	acc, err := cli.node.state.GetAccount(from)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %v", err)
+	}
+
+	tx := &Transaction{
+		From:      from,
+		To:        toAddr,
+		Value:     value,
+		Nonce:     acc.Nonce + 1,
+		Fee:       fee,
+		Timestamp: time.Now().UnixNano(),
+		Type:      "transfer",
+		Multisig:  env,
+	}
+	if tx.Hash, err = tx.MultisigHash(); err != nil {
+		return err
+	}
+	if err := writeMultisigTx(args[4], tx); err != nil {
+		return fmt.Errorf("failed to write %s: %v", args[4], err)
+	}
+	fmt.Fprintf(cli.out, "Unsigned multisig transaction %s written to %s (needs %d signatures)\n", tx.Hash.ToHex(), args[4], env.Threshold)
+	return nil
+}
+
+// cmdMultisigSign adds this node's signature to a multisig transaction file
+func (cli *CLI) cmdMultisigSign(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: multisig-sign <file> [out-file]")
+	}
+	tx, err := readMultisigTx(args[0])
+	if err != nil {
+		return err
+	}
+	if err := tx.SignMultisig(cli.node.privKey); err != nil {
+		return err
+	}
+	out := args[0]
+	if len(args) >= 2 {
+		out = args[1]
+	}
+	if err := writeMultisigTx(out, tx); err != nil {
+		return fmt.Errorf("failed to write %s: %v", out, err)
+	}
+	fmt.Fprintf(cli.out, "Signed %s (%d of %d signatures) and wrote %s\n", tx.Hash.ToHex(), len(tx.Multisig.Signatures), tx.Multisig.Threshold, out)
+	return nil
+}
+
+// cmdMultisigCombine merges the signatures of partially signed copies of a
+// multisig transaction
+func (cli *CLI) cmdMultisigCombine(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: multisig-combine <out-file> <file> <file>...")
+	}
+	var txs []*Transaction
+	for _, path := range args[1:] {
+		tx, err := readMultisigTx(path)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+	}
+	combined := txs[0]
+	if err := combined.CombineMultisig(txs[1:]...); err != nil {
+		return err
+	}
+	if err := writeMultisigTx(args[0], combined); err != nil {
+		return fmt.Errorf("failed to write %s: %v", args[0], err)
+	}
+	fmt.Fprintf(cli.out, "Combined %d of %d signatures into %s\n", len(combined.Multisig.Signatures), combined.Multisig.Threshold, args[0])
+	return nil
+}
+
+// cmdMultisigSubmit verifies and broadcasts a fully signed multisig transaction
+func (cli *CLI) cmdMultisigSubmit(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: multisig-submit <file>")
+	}
+	tx, err := readMultisigTx(args[0])
+	if err != nil {
+		return err
+	}
+	if err := tx.VerifyMultisig(); err != nil {
+		return err
+	}
+	if err := cli.node.BroadcastTransaction(tx); err != nil {
+		return fmt.Errorf("failed to broadcast transaction: %v", err)
+	}
+	fmt.Fprintf(cli.out, "✅ Multisig transaction submitted: %s\n", tx.Hash.ToHex())
+	return nil
+}
+
+// printVesting prints the vested and locked amounts of a vesting account
+func (cli *CLI) printVesting(addr Address, indent string) error {
+	vesting, err := cli.node.state.GetVestingStatus(addr)
+	if err != nil {
+		return fmt.Errorf("failed to read vesting schedule: %v", err)
+	}
+	if vesting == nil {
+		return nil
+	}
+	fmt.Fprintf(cli.out, "%sVesting: %d (start %d, cliff %d, end %d)\n", indent, vesting.Total, vesting.Start, vesting.Cliff, vesting.End)
+	fmt.Fprintf(cli.out, "%sVested: %d\n", indent, vesting.Vested)
+	fmt.Fprintf(cli.out, "%sLocked: %d\n", indent, vesting.Locked)
+	return nil
+}
+
+// cmdVest creates a vesting account funded by this node
+func (cli *CLI) cmdVest(args []string) error {
+	if len(args) < 5 {
+		return fmt.Errorf("usage: vest <to> <amount> <start> <cliff> <end> [fee]")
+	}
+
+	toAddr, err := HexToAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	var amount, start, cliff, end uint64
+	for i, target := range []*uint64{&amount, &start, &cliff, &end} {
+		if _, err := fmt.Sscanf(args[i+1], "%d", target); err != nil {
+			return fmt.Errorf("invalid argument %q: %v", args[i+1], err)
+		}
+	}
+
+	tx := &Transaction{
+		To:      toAddr,
+		Value:   amount,
+		Type:    "create_vesting",
+		Vesting: &VestingSchedule{Total: amount, Start: start, Cliff: cliff, End: end},
+	}
+	if err := validateCreateVesting(tx); err != nil {
+		return err
+	}
+	if err := checkCreateVesting(cli.node.state, tx); err != nil {
+		return err
+	}
+	return cli.submitTx(tx, args[5:])
+}
+
+// cmdHTLCLock locks funds in a hash time-locked transfer
+func (cli *CLI) cmdHTLCLock(args []string) error {
+	if len(args) < 4 {
+		return fmt.Errorf("usage: htlc-lock <to> <amount> <hash-lock> <timeout-height> [fee]")
+	}
+	toAddr, err := HexToAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %v", err)
+	}
+	var amount, timeout uint64
+	if _, err := fmt.Sscanf(args[1], "%d", &amount); err != nil {
+		return fmt.Errorf("invalid amount: %v", err)
+	}
+	hashLock, err := HexToHash(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid hash lock: %v", err)
+	}
+	if _, err := fmt.Sscanf(args[3], "%d", &timeout); err != nil {
+		return fmt.Errorf("invalid timeout height: %v", err)
+	}
+
+	tx := &Transaction{
+		To:    toAddr,
+		Value: amount,
+		Type:  "htlc_lock",
+		HTLC:  &HTLCPayload{HashLock: hashLock, TimeoutHeight: timeout},
+	}
+	return cli.submitHTLCTx(tx, args[4:])
+}
+
+// cmdHTLCClaim claims an HTLC by revealing its preimage
+func (cli *CLI) cmdHTLCClaim(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: htlc-claim <hash-lock> <preimage-hex> [fee]")
+	}
+	hashLock, err := HexToHash(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid hash lock: %v", err)
+	}
+	preimage, err := hex.DecodeString(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid preimage: %v", err)
+	}
+	tx := &Transaction{
+		Type: "htlc_claim",
+		HTLC: &HTLCPayload{HashLock: hashLock, Preimage: preimage},
+	}
+	return cli.submitHTLCTx(tx, args[2:])
+}
+
+// cmdHTLCRefund returns a timed out HTLC to its sender
+func (cli *CLI) cmdHTLCRefund(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: htlc-refund <hash-lock> [fee]")
+	}
+	hashLock, err := HexToHash(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid hash lock: %v", err)
+	}
+	tx := &Transaction{
+		Type: "htlc_refund",
+		HTLC: &HTLCPayload{HashLock: hashLock},
+	}
+	return cli.submitHTLCTx(tx, args[1:])
+}
+
+// submitHTLCTx checks an HTLC transaction against the next block and submits it
+func (cli *CLI) submitHTLCTx(tx *Transaction, feeArg []string) error {
+	if tx.To == (Address{}) {
+		tx.To = cli.node.address
+	}
+	if err := validateHTLC(tx); err != nil {
+		return err
+	}
+	if err := checkHTLC(cli.node.state, tx, cli.node.state.Height()+1); err != nil {
+		return err
+	}
+	return cli.submitTx(tx, feeArg)
+}
+
+// cmdHTLC shows an HTLC by its hash lock
+func (cli *CLI) cmdHTLC(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: htlc <hash-lock>")
+	}
+	hashLock, err := HexToHash(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid hash lock: %v", err)
+	}
+	htlc, err := cli.node.state.GetHTLC(hashLock)
+	if err != nil {
+		return err
+	}
+	if htlc == nil {
+		return fmt.Errorf("htlc %s not found", args[0])
+	}
+	fmt.Fprintln(cli.out, "HTLC Details:")
+	fmt.Fprintf(cli.out, "  Hash Lock: %s\n", htlc.HashLock.ToHex())
+	fmt.Fprintf(cli.out, "  Sender: %s\n", htlc.Sender.ToHex())
+	fmt.Fprintf(cli.out, "  Recipient: %s\n", htlc.Recipient.ToHex())
+	fmt.Fprintf(cli.out, "  Amount: %d\n", htlc.Amount)
+	fmt.Fprintf(cli.out, "  Timeout Height: %d\n", htlc.TimeoutHeight)
+	fmt.Fprintf(cli.out, "  Status: %s\n", htlc.Status)
+	if len(htlc.Preimage) > 0 {
+		fmt.Fprintf(cli.out, "  Preimage: %s\n", hex.EncodeToString(htlc.Preimage))
+	}
+	return nil
+}
+
+// cmdDeploy deploys contract bytecode
+func (cli *CLI) cmdDeploy(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: deploy <code-hex> <gas-limit> [value] [fee]")
+	}
+	code, err := hex.DecodeString(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid code: %v", err)
+	}
+	var gasLimit, value uint64
+	if _, err := fmt.Sscanf(args[1], "%d", &gasLimit); err != nil {
+		return fmt.Errorf("invalid gas limit: %v", err)
+	}
+	if len(args) >= 3 {
+		if _, err := fmt.Sscanf(args[2], "%d", &value); err != nil {
+			return fmt.Errorf("invalid value: %v", err)
+		}
+	}
+
+	tx := &Transaction{
+		Value:    value,
+		Type:     "deploy_contract",
+		Contract: &ContractPayload{Code: code, GasLimit: gasLimit},
+	}
+	if err := validateContractTx(tx); err != nil {
+		return err
+	}
+	var feeArg []string
+	if len(args) >= 4 {
+		feeArg = args[3:]
+	}
+	if err := cli.submitTx(tx, feeArg); err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.out, "  Contract Address: %s\n", ContractAddress(tx.From, tx.Nonce).ToHex())
+	return nil
+}
+
+// cmdCall calls a deployed contract
+func (cli *CLI) cmdCall(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: call <contract> <gas-limit> [value] [input-hex] [fee]")
+	}
+	contract, err := HexToAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid contract address: %v", err)
+	}
+	var gasLimit, value uint64
+	if _, err := fmt.Sscanf(args[1], "%d", &gasLimit); err != nil {
+		return fmt.Errorf("invalid gas limit: %v", err)
+	}
+	if len(args) >= 3 {
+		if _, err := fmt.Sscanf(args[2], "%d", &value); err != nil {
+			return fmt.Errorf("invalid value: %v", err)
+		}
+	}
+	var input []byte
+	if len(args) >= 4 {
+		if input, err = hex.DecodeString(args[3]); err != nil {
+			return fmt.Errorf("invalid input: %v", err)
+		}
+	}
+
+	tx := &Transaction{
+		To:       contract,
+		Value:    value,
+		Type:     "call_contract",
+		Contract: &ContractPayload{Input: input, GasLimit: gasLimit},
+	}
+	if err := validateContractTx(tx); err != nil {
+		return err
+	}
+	var feeArg []string
+	if len(args) >= 5 {
+		feeArg = args[4:]
+	}
+	return cli.submitTx(tx, feeArg)
+}
+
+// cmdContract shows a deployed contract or one of its storage words
+func (cli *CLI) cmdContract(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: contract <address> [storage-key]")
+	}
+	addr, err := HexToAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid contract address: %v", err)
+	}
+	code := cli.node.state.GetContractCode(addr)
+	if code == nil {
+		return fmt.Errorf("no contract deployed at %s", args[0])
+	}
+	if len(args) >= 2 {
+		var key uint64
+		if _, err := fmt.Sscanf(args[1], "%d", &key); err != nil {
+			return fmt.Errorf("invalid storage key: %v", err)
+		}
+		value, err := cli.node.state.GetContractStorage(addr, key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cli.out, "Storage[%d]: %d\n", key, value)
+		return nil
+	}
+	acc, err := cli.node.state.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cli.out, "Contract Details:")
+	fmt.Fprintf(cli.out, "  Address: %s\n", addr.ToHex())
+	fmt.Fprintf(cli.out, "  Code Size: %d bytes\n", len(code))
+	fmt.Fprintf(cli.out, "  Balance: %d\n", acc.Balance)
+	return nil
+}
+
+// cmdFees shows the fee market state of the next block
+func (cli *CLI) cmdFees(args []string) error {
+	gas := uint64(GasTransaction)
+	if len(args) >= 1 {
+		if _, err := fmt.Sscanf(args[0], "%d", &gas); err != nil {
+			return fmt.Errorf("invalid gas: %v", err)
+		}
+	}
+	estimate, err := cli.node.bc.EstimateFee(gas)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cli.out, "Fee Estimate:")
+	fmt.Fprintf(cli.out, "  Base Fee: %d per gas\n", estimate.BaseFee)
+	fmt.Fprintf(cli.out, "  Gas: %d\n", estimate.Gas)
+	fmt.Fprintf(cli.out, "  Burned: %d\n", estimate.BaseFeeCost)
+	fmt.Fprintf(cli.out, "  Suggested Tip: %d\n", estimate.SuggestedTip)
+	fmt.Fprintf(cli.out, "  Suggested Fee: %d\n", estimate.SuggestedFee)
+	fmt.Fprintf(cli.out, "  Last Block Gas: %d / %d\n", estimate.ParentGasUsed, estimate.BlockGasLimit)
+	return nil
+}
+
+// cmdReceipt shows the receipt of a transaction included in a block
+func (cli *CLI) cmdReceipt(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: receipt <hash>")
+	}
+	hash, err := HexToHash(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid transaction hash: %v", err)
+	}
+	receipt, err := cli.node.bc.GetReceipt(hash)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cli.out, "Receipt:")
+	fmt.Fprintf(cli.out, "  Transaction: %s\n", receipt.TxHash.ToHex())
+	fmt.Fprintf(cli.out, "  Block: %d\n", receipt.BlockHeight)
+	fmt.Fprintf(cli.out, "  Status: %s\n", receipt.Status)
+	if receipt.Error != "" {
+		fmt.Fprintf(cli.out, "  Error: %s\n", receipt.Error)
+	}
+	fmt.Fprintf(cli.out, "  Fee Paid: %d\n", receipt.FeePaid)
+	fmt.Fprintf(cli.out, "  Gas Used: %d\n", receipt.GasUsed)
+	if receipt.ContractAddress != nil {
+		fmt.Fprintf(cli.out, "  Contract Address: %s\n", receipt.ContractAddress.ToHex())
+	}
+	for _, l := range receipt.Logs {
+		fmt.Fprintf(cli.out, "  Log: contract %s topic %d data %d\n", l.Contract.ToHex(), l.Topic, l.Data)
+	}
+	return nil
+}
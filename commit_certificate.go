@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CommitCertificate is the quorum certificate of a finalized block: the
+// committee that approved it and the approvals of more than two thirds of it.
+type CommitCertificate struct {
+	BlockHash Hash        `json:"blockHash"`
+	Committee []Address   `json:"committee"`
+	Approvals []*Approval `json:"approvals"`
+}
+
+// Certificate builds the commit certificate of an approved block.
+func (ba *BlockApproval) Certificate() *CommitCertificate {
+	cert := &CommitCertificate{BlockHash: ba.Block.Header.Hash}
+	for _, member := range ba.Committee {
+		cert.Committee = append(cert.Committee, member.Address)
+	}
+	for _, approval := range ba.Approvals {
+		cert.Approvals = append(cert.Approvals, approval)
+	}
+	sort.Slice(cert.Approvals, func(i, j int) bool {
+		return cert.Approvals[i].Address.ToHex() < cert.Approvals[j].Address.ToHex()
+	})
+	return cert
+}
+
+// quorum returns the number of approvals a committee of size n must give.
+func quorum(n int) int {
+	return (2 * n / 3) + 1
+}
+
+// verifyCommitCertificate checks that a block's certificate holds valid
+// approvals of the block from a quorum of the committee the registry selects,
+// so a certificate naming any other committee is rejected however it is
+// signed. Approvals are checked against the signers' keys in state, so a
+// certificate signed with keys rotated after state may fail.
+func verifyCommitCertificate(state *State, vr *ValidatorRegistry, header *Header, cert *CommitCertificate) error {
+	if cert == nil {
+		return errors.New("block has no commit certificate")
+	}
+	committee, err := registryCommittee(vr)
+	if err != nil {
+		return fmt.Errorf("select committee: %w", err)
+	}
+	if len(committee) == 0 {
+		return errors.New("the registry selects no committee")
+	}
+	expected := make(map[Address]bool, len(committee))
+	for _, v := range committee {
+		expected[v.Address] = true
+	}
+	for _, addr := range cert.Committee {
+		if !expected[addr] {
+			return fmt.Errorf("committee member %s is not in the selected committee", addr.ToHex())
+		}
+	}
+	if len(cert.Committee) != len(committee) {
+		return fmt.Errorf("commit certificate lists %d of the %d committee members", len(cert.Committee), len(committee))
+	}
+	_, err = verifyCertificateApprovals(state, header, cert)
+	return err
+}
+
+// verifyCertificateApprovals checks that a certificate holds valid approvals
+// of the block from a quorum of the committee it lists, and returns the
+// committee members that signed.
+func verifyCertificateApprovals(state *State, header *Header, cert *CommitCertificate) (map[Address]bool, error) {
+	if cert == nil {
+		return nil, errors.New("block has no commit certificate")
+	}
+	if cert.BlockHash != header.Hash {
+		return nil, errors.New("commit certificate is for another block")
+	}
+	if len(cert.Committee) == 0 {
+		return nil, errors.New("commit certificate has an empty committee")
+	}
+	members := make(map[Address]bool, len(cert.Committee))
+	for _, addr := range cert.Committee {
+		if members[addr] {
+			return nil, fmt.Errorf("committee member %s listed twice", addr.ToHex())
+		}
+		members[addr] = true
+	}
+
+	signed := make(map[Address]bool)
+	for _, approval := range cert.Approvals {
+		if !members[approval.Address] {
+			return nil, fmt.Errorf("approval from %s, who is not in the committee", approval.Address.ToHex())
+		}
+		if signed[approval.Address] {
+			return nil, fmt.Errorf("two approvals from %s", approval.Address.ToHex())
+		}
+		if approval.BlockHash != header.Hash {
+			return nil, fmt.Errorf("approval from %s is for another block", approval.Address.ToHex())
+		}
+		if err := verifyApproval(state, approval); err != nil {
+			return nil, fmt.Errorf("approval from %s: %w", approval.Address.ToHex(), err)
+		}
+		signed[approval.Address] = true
+	}
+	if len(signed) < quorum(len(cert.Committee)) {
+		return nil, fmt.Errorf("commit certificate has %d of the %d approvals required", len(signed), quorum(len(cert.Committee)))
+	}
+	return signed, nil
+}
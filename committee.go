@@ -61,6 +61,43 @@ func (cs *CommitteeSelector) SelectCommittee(n int) ([]*Validator, error) {
 	return committee, nil
 }
 
+// registryCommittee returns the committee the registry currently selects, at
+// the size its consensus parameters set.
+func registryCommittee(vr *ValidatorRegistry) ([]*Validator, error) {
+	size := int(vr.GetConsensusParams().CommitteeSize)
+	return (&CommitteeSelector{Registry: vr}).SelectCommittee(size)
+}
+
+// sameCommittee reports whether two committees have the same members.
+func sameCommittee(a, b []*Validator) bool {
+	addresses := func(committee []*Validator) []Address {
+		out := make([]Address, len(committee))
+		for i, v := range committee {
+			out[i] = v.Address
+		}
+		return out
+	}
+	return sameMembers(addresses(a), addresses(b))
+}
+
+// sameMembers reports whether two lists of committee members hold the same
+// addresses.
+func sameMembers(a, b []Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	members := make(map[Address]bool, len(a))
+	for _, addr := range a {
+		members[addr] = true
+	}
+	for _, addr := range b {
+		if !members[addr] {
+			return false
+		}
+	}
+	return true
+}
+
 // ProposerSelector manages leader rotation for block production.
 type ProposerSelector struct {
 	Committee   []*Validator
@@ -49,6 +49,8 @@ func makeTestValidatorsWithParticipation(vr *ValidatorRegistry, state *State, tx
 				block := &Block{Transactions: []*Transaction{tx}}
 				bc, _ := NewBlockchain(NewMemoryStore())
 				_ = bc.ApplyBlockWithRegistry(block, state, vr)
+				// Participation takes effect at the next epoch boundary
+				_ = vr.ActivatePendingParticipation()
 			}
 		}
 	}
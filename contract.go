@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	MaxContractInputLength = 4096
+
+	// Contract code and storage live in the state trie. Storage keys are the
+	// contract address followed by the 8-byte storage key.
+	contractCodeKeyPrefix    = "code:"
+	contractStorageKeyPrefix = "cstore:"
+)
+
+var contractAddressDomain = []byte("dyphira/contract/v1")
+
+// ContractPayload is the payload of the deploy_contract and call_contract
+// transactions. A call is sent to the contract address in To.
+type ContractPayload struct {
+	Code     []byte `json:"code,omitempty"`  // deploy_contract only
+	Input    []byte `json:"input,omitempty"` // call_contract only
+	GasLimit uint64 `json:"gasLimit"`
+}
+
+// ContractAddress derives the address of a contract from its deployer and the
+// nonce of the deploying transaction.
+func ContractAddress(deployer Address, nonce uint64) Address {
+	h := sha3.New256()
+	h.Write(contractAddressDomain)
+	h.Write(deployer[:])
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], nonce)
+	h.Write(n[:])
+	var addr Address
+	copy(addr[:], h.Sum(nil))
+	return addr
+}
+
+func contractCodeKey(addr Address) []byte {
+	return append([]byte(contractCodeKeyPrefix), addr[:]...)
+}
+
+func contractStorageKey(addr Address, key uint64) []byte {
+	k := append([]byte(contractStorageKeyPrefix), addr[:]...)
+	return binary.BigEndian.AppendUint64(k, key)
+}
+
+// deployGas is the intrinsic gas of deploying code.
+func deployGas(code []byte) uint64 {
+	return GasDeployBase + uint64(len(code))*GasCodeByte
+}
+
+// validateContractTx performs the stateless checks on a contract transaction.
+func validateContractTx(tx *Transaction) error {
+	if tx.Contract == nil {
+		return fmt.Errorf("%s transaction missing contract payload", tx.Type)
+	}
+	if tx.Type == "deploy_contract" {
+		if _, err := ValidateCode(tx.Contract.Code); err != nil {
+			return err
+		}
+		if tx.Contract.GasLimit < deployGas(tx.Contract.Code) {
+			return fmt.Errorf("gas limit %d below the deployment cost %d", tx.Contract.GasLimit, deployGas(tx.Contract.Code))
+		}
+		return nil
+	}
+	if len(tx.Contract.Input) > MaxContractInputLength {
+		return fmt.Errorf("contract input exceeds %d bytes", MaxContractInputLength)
+	}
+	if tx.Contract.GasLimit < GasCallBase {
+		return fmt.Errorf("gas limit %d below the call cost %d", tx.Contract.GasLimit, GasCallBase)
+	}
+	return nil
+}
+
+// GetContractCode returns the code deployed at addr, or nil if there is none.
+func (s *State) GetContractCode(addr Address) []byte {
+	code, _ := s.Trie.Get(contractCodeKey(addr))
+	return code
+}
+
+// GetContractStorage returns a word of a contract's storage.
+func (s *State) GetContractStorage(addr Address, key uint64) (uint64, error) {
+	data, found := s.Trie.Get(contractStorageKey(addr, key))
+	if !found {
+		return 0, nil
+	}
+	if len(data) != 8 {
+		return 0, errors.New("corrupt contract storage entry")
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// contractStorageOverlay buffers the storage writes of a call so that they are
+// only applied when the call succeeds.
+type contractStorageOverlay struct {
+	state    *State
+	contract Address
+	writes   map[uint64]uint64
+}
+
+func (o *contractStorageOverlay) Load(key uint64) (uint64, error) {
+	if v, ok := o.writes[key]; ok {
+		return v, nil
+	}
+	return o.state.GetContractStorage(o.contract, key)
+}
+
+func (o *contractStorageOverlay) Store(key, value uint64) {
+	o.writes[key] = value
+}
+
+func (o *contractStorageOverlay) commit() {
+	keys := make([]uint64, 0, len(o.writes))
+	for k := range o.writes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, k := range keys {
+		o.state.Trie.Insert(contractStorageKey(o.contract, k), binary.BigEndian.AppendUint64(nil, o.writes[k]))
+	}
+}
+
+// contractExecution is a deployment or call that has been run but not yet
+// written to state.
+type contractExecution struct {
+	contract Address
+	overlay  *contractStorageOverlay
+	result   *ExecutionResult
+}
+
+// executeContract runs a deploy_contract or call_contract transaction at
+// height without changing the state. Calls that run out of gas or revert
+// return an error.
+func (s *State) executeContract(tx *Transaction, height uint64) (*contractExecution, error) {
+	if tx.Type == "deploy_contract" {
+		addr := ContractAddress(tx.From, tx.Nonce)
+		if s.GetContractCode(addr) != nil {
+			return nil, fmt.Errorf("contract %s already exists", addr.ToHex())
+		}
+		return &contractExecution{
+			contract: addr,
+			result:   &ExecutionResult{GasUsed: deployGas(tx.Contract.Code)},
+		}, nil
+	}
+
+	code := s.GetContractCode(tx.To)
+	if code == nil {
+		return nil, fmt.Errorf("no contract deployed at %s", tx.To.ToHex())
+	}
+	overlay := &contractStorageOverlay{state: s, contract: tx.To, writes: make(map[uint64]uint64)}
+	result, err := Execute(code, &CallContext{
+		Contract: tx.To,
+		Caller:   tx.From,
+		Value:    tx.Value,
+		Input:    tx.Contract.Input,
+		Height:   height,
+		GasLimit: tx.Contract.GasLimit - GasCallBase,
+	}, overlay)
+	if err != nil {
+		return nil, fmt.Errorf("contract call failed: %w", err)
+	}
+	result.GasUsed += GasCallBase
+	return &contractExecution{contract: tx.To, overlay: overlay, result: result}, nil
+}
+
+// commit writes an execution to state: the code of a deployment or the
+// storage writes of a call, and the value sent to the contract.
+func (e *contractExecution) commit(s *State, tx *Transaction, receipt *Receipt) error {
+	if tx.Type == "deploy_contract" {
+		s.Trie.Insert(contractCodeKey(e.contract), tx.Contract.Code)
+		addr := e.contract
+		receipt.ContractAddress = &addr
+	} else {
+		e.overlay.commit()
+	}
+
+	acc, err := s.GetAccount(e.contract)
+	if err != nil {
+		return err
+	}
+	acc.Balance += tx.Value
+	if err := s.PutAccount(acc); err != nil {
+		return err
+	}
+
+	receipt.GasUsed += e.result.GasUsed
+	receipt.ReturnValue = e.result.ReturnValue
+	receipt.Logs = append(receipt.Logs, e.result.Logs...)
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asm assembles test bytecode. OpCode items are emitted as instructions,
+// uint64 items as the 8-byte immediate of a PUSH and int items as the 1-byte
+// immediate of a DUP or SWAP.
+func asm(items ...interface{}) []byte {
+	var code []byte
+	for _, item := range items {
+		switch v := item.(type) {
+		case OpCode:
+			code = append(code, byte(v))
+		case uint64:
+			code = binary.BigEndian.AppendUint64(code, v)
+		case int:
+			code = append(code, byte(v))
+		}
+	}
+	return code
+}
+
+// counterCode increments storage word 0, logs the new value under topic 7 and
+// returns it. It reverts after the store when called with any input.
+func counterCode() []byte {
+	return asm(
+		OpPush, uint64(0), OpSLoad, // 0
+		OpPush, uint64(1), OpAdd, // 10
+		OpDup, 1, OpPush, uint64(0), OpSStore, // 20
+		OpDup, 1, OpPush, uint64(7), OpLog, // 32
+		OpCallDataSize, OpIsZero, OpPush, uint64(57), OpJumpI, // 44
+		OpRevert, // 56
+		OpReturn, // 57
+	)
+}
+
+func emptyStorage() ContractStorage {
+	return &contractStorageOverlay{state: NewState(), writes: make(map[uint64]uint64)}
+}
+
+func TestVM_Arithmetic(t *testing.T) {
+	// (7 - 3) * 5, with SUB taking top - second
+	code := asm(OpPush, uint64(3), OpPush, uint64(7), OpSub, OpPush, uint64(5), OpMul, OpReturn)
+	result, err := Execute(code, &CallContext{GasLimit: 100}, emptyStorage())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), result.ReturnValue)
+	assert.Equal(t, uint64(4*GasVeryLow+GasLow), result.GasUsed)
+
+	// Division by zero yields zero rather than failing
+	code = asm(OpPush, uint64(0), OpPush, uint64(9), OpDiv, OpReturn)
+	result, err = Execute(code, &CallContext{GasLimit: 100}, emptyStorage())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), result.ReturnValue)
+}
+
+func TestVM_Errors(t *testing.T) {
+	ctx := &CallContext{GasLimit: 1000}
+
+	// An endless loop stops when the gas runs out
+	result, err := Execute(asm(OpPush, uint64(0), OpJump), ctx, emptyStorage())
+	assert.ErrorIs(t, err, ErrOutOfGas)
+	assert.Equal(t, uint64(1000), result.GasUsed)
+
+	// Jumps into an immediate are rejected
+	_, err = Execute(asm(OpPush, uint64(1), OpJump), ctx, emptyStorage())
+	assert.ErrorIs(t, err, ErrInvalidJump)
+
+	_, err = Execute(asm(OpAdd), ctx, emptyStorage())
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+
+	_, err = Execute(asm(OpRevert), ctx, emptyStorage())
+	assert.ErrorIs(t, err, ErrExecutionReverts)
+
+	_, err = ValidateCode([]byte{0xEE})
+	assert.ErrorIs(t, err, ErrInvalidOpCode)
+	_, err = ValidateCode(asm(OpPush, 1))
+	assert.ErrorContains(t, err, "truncated immediate")
+}
+
+func deployTestContract(t *testing.T, state *State, deployer tokenTestAccount) Address {
+	code := counterCode()
+	tx := tokenTx(t, state, deployer, &Transaction{
+		Type:     "deploy_contract",
+		Contract: &ContractPayload{Code: code, GasLimit: deployGas(code)},
+	})
+	receipt, err := state.ApplyTransactionWithReceipt(tx)
+	require.NoError(t, err)
+	require.NotNil(t, receipt.ContractAddress)
+	assert.Equal(t, ContractAddress(deployer.addr, tx.Nonce), *receipt.ContractAddress)
+	assert.Equal(t, GasTransaction+deployGas(code), receipt.GasUsed)
+	return *receipt.ContractAddress
+}
+
+func TestContract_DeployAndCall(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	contract := deployTestContract(t, state, user)
+	assert.Equal(t, counterCode(), state.GetContractCode(contract))
+
+	for i := uint64(1); i <= 2; i++ {
+		call := tokenTx(t, state, user, &Transaction{
+			To: contract, Value: 5, Type: "call_contract",
+			Contract: &ContractPayload{GasLimit: 2000},
+		})
+		receipt, err := state.ApplyTransactionWithReceipt(call)
+		require.NoError(t, err)
+		assert.Equal(t, i, receipt.ReturnValue)
+		require.Len(t, receipt.Logs, 1)
+		assert.Equal(t, ContractLog{Contract: contract, Topic: 7, Data: i}, receipt.Logs[0])
+		assert.Greater(t, receipt.GasUsed, uint64(GasTransaction+GasCallBase))
+	}
+
+	value, err := state.GetContractStorage(contract, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), value)
+	acc, _ := state.GetAccount(contract)
+	assert.Equal(t, uint64(10), acc.Balance, "call value is credited to the contract")
+
+	// A reverting call leaves storage, balances and the nonce untouched
+	before, _ := state.GetAccount(user.addr)
+	revert := tokenTx(t, state, user, &Transaction{
+		To: contract, Type: "call_contract",
+		Contract: &ContractPayload{Input: []byte{1}, GasLimit: 2000},
+	})
+	_, err = state.ApplyTransactionWithReceipt(revert)
+	assert.ErrorIs(t, err, ErrExecutionReverts)
+	value, _ = state.GetContractStorage(contract, 0)
+	assert.Equal(t, uint64(2), value)
+	after, _ := state.GetAccount(user.addr)
+	assert.Equal(t, before, after)
+
+	// Calls must target deployed code
+	missing := tokenTx(t, state, user, &Transaction{
+		To: user.addr, Type: "call_contract",
+		Contract: &ContractPayload{GasLimit: 2000},
+	})
+	assert.ErrorContains(t, state.ApplyTransaction(missing), "no contract deployed")
+}
+
+func TestContract_PoolRejectsFailingCall(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	contract := deployTestContract(t, state, user)
+	tp := NewTransactionPool()
+
+	lowGas := tokenTx(t, state, user, &Transaction{
+		To: contract, Type: "call_contract",
+		Contract: &ContractPayload{GasLimit: GasCallBase + 10},
+	})
+	assert.ErrorIs(t, tp.AddTransaction(lowGas, user.key.PubKey(), state), ErrOutOfGas)
+
+	ok := tokenTx(t, state, user, &Transaction{
+		To: contract, Type: "call_contract",
+		Contract: &ContractPayload{GasLimit: 2000},
+	})
+	require.NoError(t, tp.AddTransaction(ok, user.key.PubKey(), state))
+}
+
+func TestBlockchain_StoresReceipts(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+	code := counterCode()
+	deploy := tokenTx(t, state, user, &Transaction{
+		Type:     "deploy_contract",
+		Contract: &ContractPayload{Code: code, GasLimit: deployGas(code)},
+	})
+	applyAt(t, bc, state, vr, 3, deploy)
+
+	receipt, err := bc.GetReceipt(deploy.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), receipt.BlockHeight)
+	require.NotNil(t, receipt.ContractAddress)
+	assert.NotNil(t, state.GetContractCode(*receipt.ContractAddress))
+}
+
+func TestAPIServer_ContractEndpoints(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	contract := deployTestContract(t, state, user)
+	call := tokenTx(t, state, user, &Transaction{
+		To: contract, Type: "call_contract",
+		Contract: &ContractPayload{GasLimit: 2000},
+	})
+	require.NoError(t, state.ApplyTransaction(call))
+	api := &APIServer{node: &AppNode{state: state}}
+
+	w := httptest.NewRecorder()
+	api.handleContract(w, httptest.NewRequest(http.MethodGet, "/contracts/"+contract.ToHex(), nil))
+	var response struct {
+		Success bool
+		Data    map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, float64(len(counterCode())), response.Data["size"])
+
+	w = httptest.NewRecorder()
+	api.handleContract(w, httptest.NewRequest(http.MethodGet, "/contracts/"+contract.ToHex()+"/storage/0", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(1), response.Data["value"])
+
+	w = httptest.NewRecorder()
+	api.handleContract(w, httptest.NewRequest(http.MethodGet, "/contracts/"+user.addr.ToHex(), nil))
+	assert.Contains(t, w.Body.String(), "Contract not found")
+}
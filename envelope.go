@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// envelopeDomain separates envelope signatures from anything else signed
+// with a node's libp2p key.
+const envelopeDomain = "dyphira/envelope/1"
+
+// SignedEnvelope wraps every gossiped payload with the key of the peer that
+// sent it and that peer's signature, so receivers need not trust the sender
+// fields inside the payload.
+type SignedEnvelope struct {
+	PublicKey   []byte `json:"publicKey"` // libp2p-marshalled sender key
+	PayloadType string `json:"payloadType"`
+	Payload     []byte `json:"payload"`
+	Signature   []byte `json:"signature"`
+}
+
+// envelopeSigningBytes returns the bytes an envelope signature covers.
+func envelopeSigningBytes(payloadType string, payload []byte) []byte {
+	buf := make([]byte, 0, len(envelopeDomain)+2*binary.MaxVarintLen64+len(payloadType)+len(payload))
+	buf = append(buf, envelopeDomain...)
+	buf = binary.AppendUvarint(buf, uint64(len(payloadType)))
+	buf = append(buf, payloadType...)
+	return append(buf, payload...)
+}
+
+// SealEnvelope signs a payload of the given type with key.
+func SealEnvelope(key crypto.PrivKey, payloadType string, payload []byte) (*SignedEnvelope, error) {
+	pubKey, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope key: %w", err)
+	}
+	sig, err := key.Sign(envelopeSigningBytes(payloadType, payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign envelope: %w", err)
+	}
+	return &SignedEnvelope{
+		PublicKey:   pubKey,
+		PayloadType: payloadType,
+		Payload:     payload,
+		Signature:   sig,
+	}, nil
+}
+
+// Open verifies the envelope signature and returns the signing peer.
+func (e *SignedEnvelope) Open() (peer.ID, error) {
+	if len(e.PublicKey) == 0 || len(e.Signature) == 0 {
+		return "", errors.New("envelope is not signed")
+	}
+	pubKey, err := crypto.UnmarshalPublicKey(e.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid envelope key: %w", err)
+	}
+	ok, err := pubKey.Verify(envelopeSigningBytes(e.PayloadType, e.Payload), e.Signature)
+	if err != nil || !ok {
+		return "", errors.New("invalid envelope signature")
+	}
+	signer, err := peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid envelope key: %w", err)
+	}
+	return signer, nil
+}
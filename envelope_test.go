@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedEnvelope_Open(t *testing.T) {
+	key, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	other, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+
+	env, err := SealEnvelope(key, BlockTopic, []byte("payload"))
+	require.NoError(t, err)
+	signer, err := env.Open()
+	require.NoError(t, err)
+	assert.Equal(t, id, signer)
+
+	forged := *env
+	forged.Payload = []byte("other payload")
+	_, err = forged.Open()
+	assert.Error(t, err, "changed payload")
+
+	forged = *env
+	forged.PayloadType = TransactionTopic
+	_, err = forged.Open()
+	assert.Error(t, err, "changed type")
+
+	forged = *env
+	forged.PublicKey, err = crypto.MarshalPublicKey(other.GetPublic())
+	require.NoError(t, err)
+	_, err = forged.Open()
+	assert.Error(t, err, "other key")
+
+	forged = *env
+	forged.Signature = nil
+	_, err = forged.Open()
+	assert.ErrorContains(t, err, "not signed")
+}
+
+// newRawGossipPeer creates a gossipsub peer without the topic validators of
+// P2PNode, so it can publish anything on topicName.
+func newRawGossipPeer(t *testing.T, ctx context.Context, topicName string) (crypto.PrivKey, host.Host, *pubsub.Topic) {
+	key, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	h, err := libp2p.New(libp2p.Identity(key), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	require.NoError(t, err)
+	topic, err := ps.Join(topicName)
+	require.NoError(t, err)
+	return key, h, topic
+}
+
+func TestP2PNode_DropsForgedMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	key, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	receiver, err := NewP2PNode(ctx, 0, key)
+	require.NoError(t, err)
+	t.Cleanup(func() { receiver.host.Close() })
+	receiver.RegisterTopic(ValidatorTopic)
+	barNet := NewBARNetwork(nil)
+	received := make(chan []byte, 16)
+	invalid := make(chan peer.ID, 16)
+	receiver.OnInvalidMessage = func(peerID peer.ID, reason string) {
+		barNet.UpdatePOMScore(peerID, 1, reason)
+		invalid <- peerID
+	}
+	receiver.PeerScore = barNet.GossipScore
+	receiver.Subscribe(ctx, func(topic string, msg *pubsub.Message) { received <- msg.Data })
+
+	senderKey, sender, topic := newRawGossipPeer(t, ctx, ValidatorTopic)
+	barNet.AddPeer(sender.ID(), "")
+	require.NoError(t, sender.Connect(ctx, peer.AddrInfo{ID: receiver.host.ID(), Addrs: receiver.host.Addrs()}))
+	seal := func(key crypto.PrivKey, payloadType string, payload string) []byte {
+		env, err := SealEnvelope(key, payloadType, []byte(payload))
+		require.NoError(t, err)
+		data, err := json.Marshal(env)
+		require.NoError(t, err)
+		return data
+	}
+
+	// Retry until the receiver's subscription is known; handlers see only the payload
+	require.Eventually(t, func() bool {
+		require.NoError(t, topic.Publish(ctx, seal(senderKey, ValidatorTopic, `{"stake":1}`)))
+		select {
+		case data := <-received:
+			return assert.Equal(t, []byte(`{"stake":1}`), data)
+		case <-time.After(200 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, 100*time.Millisecond)
+
+	other, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	forged := [][]byte{
+		[]byte(`{"stake":2}`),
+		seal(other, ValidatorTopic, `{"stake":3}`),
+		seal(senderKey, BlockTopic, `{"stake":4}`),
+	}
+	for _, data := range forged {
+		require.NoError(t, topic.Publish(ctx, data))
+		select {
+		case id := <-invalid:
+			assert.Equal(t, sender.ID(), id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("forged message was not reported")
+		}
+	}
+	assert.Equal(t, len(forged), pomScore(barNet, sender.ID()))
+
+	// Nothing forged reached the handler before the next genuine message
+	require.NoError(t, topic.Publish(ctx, seal(senderKey, ValidatorTopic, `{"stake":5}`)))
+	for done := false; !done; {
+		select {
+		case data := <-received:
+			done = string(data) == `{"stake":5}`
+			if !done {
+				require.Equal(t, `{"stake":1}`, string(data))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("genuine message was not delivered")
+		}
+	}
+
+	// A banned peer scores below the graylist threshold and is not heard at all
+	barNet.BanPeer(sender.ID(), "test")
+	require.NoError(t, topic.Publish(ctx, seal(senderKey, ValidatorTopic, `{"stake":6}`)))
+	select {
+	case data := <-received:
+		t.Fatalf("message from a banned peer was delivered: %s", data)
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// EpochInfo describes a single epoch. Epoch lengths are governed parameters, so
+// the boundaries are tracked explicitly rather than derived from the height.
+type EpochInfo struct {
+	Number      uint64 `json:"number"`
+	StartHeight uint64 `json:"startHeight"`
+	Length      uint64 `json:"length"`
+}
+
+// EndHeight returns the height of the first block of the following epoch.
+func (e EpochInfo) EndHeight() uint64 {
+	return e.StartHeight + e.Length
+}
+
+// advanceEpoch processes the epoch transition when the block at height is the
+// first block past the current epoch.
+func advanceEpoch(height uint64, vr *ValidatorRegistry) error {
+	current := vr.CurrentEpoch()
+	if height < current.EndHeight() {
+		return nil
+	}
+	return processEpochTransition(current.Number+1, vr)
+}
+
+// processEpochTransition runs the consensus-level changes that are deferred to
+// the start of an epoch. Several nodes may share a validator store (as the
+// integration tests do), so each epoch is only processed once per registry.
+func processEpochTransition(epoch uint64, vr *ValidatorRegistry) error {
+	current := vr.CurrentEpoch()
+	if current.Number >= epoch {
+		return nil
+	}
+
+	// Reputation is aggregated over the epoch that just ended, before the
+	// participation changes for the new epoch take effect.
+	if err := vr.AggregateReputation(current.Number); err != nil {
+		return fmt.Errorf("failed to aggregate compute reputation: %w", err)
+	}
+
+	// Proposals are tallied against the stake of the epoch that just ended
+	if err := vr.TallyProposals(current); err != nil {
+		return fmt.Errorf("failed to tally governance proposals: %w", err)
+	}
+
+	if err := vr.ActivatePendingParticipation(); err != nil {
+		return fmt.Errorf("failed to activate participation changes: %w", err)
+	}
+
+	// The new epoch uses the parameters as they stand after the tally
+	next := EpochInfo{
+		Number:      epoch,
+		StartHeight: current.EndHeight(),
+		Length:      vr.GetConsensusParams().EpochLength,
+	}
+	if err := vr.SetCurrentEpoch(next); err != nil {
+		return fmt.Errorf("failed to record epoch transition: %w", err)
+	}
+	log.Printf("INFO: Processed transition into epoch %d (start height %d, length %d)", next.Number, next.StartHeight, next.Length)
+	return nil
+}
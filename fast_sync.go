@@ -2,27 +2,87 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	// FastSyncProtocol serves node status, epoch state snapshots and blocks
+	// on direct streams between peers.
+	FastSyncProtocol = protocol.ID("/dyphira/fastsync/1")
+
+	// FastSyncMinLag is how far a peer must be ahead for the node to fast
+	// sync; smaller gaps are closed by block gossip.
+	FastSyncMinLag = 16
+
+	fastSyncRequestTimeout = 30 * time.Second
+	// fastSyncAnchorWait bounds the wait for the header that commits to a
+	// snapshot's state root when the snapshot was taken at the tip.
+	fastSyncAnchorWait = 30 * time.Second
 )
 
+// fastSyncRequest is a request sent on a FastSyncProtocol stream.
+type fastSyncRequest struct {
+	Type   string `json:"type"`             // "status", "manifest", "chunk", "validators" or "block"
+	Height uint64 `json:"height,omitempty"` // Zero asks for the latest manifest
+	Index  int    `json:"index,omitempty"`
+}
+
+// fastSyncResponse answers a fastSyncRequest; exactly one of the payloads is
+// set unless Error is.
+type fastSyncResponse struct {
+	Error      string            `json:"error,omitempty"`
+	Status     *fastSyncStatus   `json:"status,omitempty"`
+	Manifest   *SnapshotManifest `json:"manifest,omitempty"`
+	Chunk      *SnapshotChunk    `json:"chunk,omitempty"`
+	Validators []KVPair          `json:"validators,omitempty"`
+	Block      *Block            `json:"block,omitempty"`
+}
+
+// fastSyncStatus is a peer's chain tip.
+type fastSyncStatus struct {
+	Height uint64 `json:"height"`
+	Hash   Hash   `json:"hash"`
+}
+
 // FastSyncManager handles rapid node synchronization to the latest block height/state.
 type FastSyncManager struct {
 	node      *AppNode
-	peers     []string // Peer addresses (could be peer.IDs in a real implementation)
+	peers     []peer.ID // Whitelisted peers taking part in the current sync
 	isSyncing bool
+	importing atomic.Bool // Set while the snapshot and catch-up blocks are applied
 	mu        sync.Mutex
 }
 
 func NewFastSyncManager(node *AppNode) *FastSyncManager {
 	return &FastSyncManager{
 		node:      node,
-		peers:     make([]string, 0),
+		peers:     make([]peer.ID, 0),
 		isSyncing: false,
 	}
 }
 
+// RegisterProtocol serves FastSyncProtocol to peers.
+func (fsm *FastSyncManager) RegisterProtocol() {
+	fsm.node.p2p.SetStreamHandler(FastSyncProtocol, fsm.handleStream)
+}
+
+// Importing reports whether fast sync is applying state and blocks, during
+// which the node neither produces nor accepts gossiped blocks.
+func (fsm *FastSyncManager) Importing() bool {
+	return fsm.importing.Load()
+}
+
 // Start initiates the fast sync process if the node is behind.
 func (fsm *FastSyncManager) Start(ctx context.Context) {
 	fsm.mu.Lock()
@@ -45,64 +105,389 @@ func (fsm *FastSyncManager) syncLoop(ctx context.Context) {
 
 	log.Printf("FASTSYNC: Starting fast sync protocol...")
 
-	// 1. Discover peers (stub)
+	// 1. Discover whitelisted peers and their chain tips
 	fsm.peers = fsm.discoverPeers()
 	if len(fsm.peers) == 0 {
 		log.Printf("FASTSYNC: No peers available for fast sync.")
 		return
 	}
-
-	// 2. Request state snapshot from peers (stub)
-	if err := fsm.requestStateSnapshot(); err != nil {
-		log.Printf("FASTSYNC: Failed to get state snapshot: %v", err)
+	statuses := fsm.requestStatuses(ctx)
+	localHeight := fsm.node.bc.Height()
+	var candidates []peer.ID
+	for id, status := range statuses {
+		if status.Height >= localHeight+FastSyncMinLag {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		log.Printf("FASTSYNC: No peer is %d blocks ahead of height %d; leaving sync to block gossip.", FastSyncMinLag, localHeight)
 		return
 	}
+	sort.Slice(candidates, func(i, j int) bool { return statuses[candidates[i]].Height > statuses[candidates[j]].Height })
+
+	for _, id := range candidates {
+		// 2. Request a state snapshot and validator registry and verify them
+		// against a finalized state root and commit certificate
+		state, validators, base, err := fsm.requestStateSnapshot(ctx, id)
+		if err != nil {
+			log.Printf("FASTSYNC: Snapshot from %s rejected: %v", id, err)
+			continue
+		}
 
-	// 3. Request block stream from peers (stub)
-	if err := fsm.requestBlockStream(); err != nil {
-		log.Printf("FASTSYNC: Failed to get block stream: %v", err)
+		// 3. Import it and catch up on the blocks after it
+		if err := fsm.applyStateAndBlocks(ctx, state, validators, base); err != nil {
+			log.Printf("FASTSYNC: Failed to apply state/blocks: %v", err)
+			return
+		}
+
+		// 4. Switch to normal sync
+		fsm.switchToNormalSync()
 		return
 	}
+	log.Printf("FASTSYNC: No peer served a verifiable snapshot.")
+}
 
-	// 4. Apply state and blocks in order (stub)
-	if err := fsm.applyStateAndBlocks(); err != nil {
-		log.Printf("FASTSYNC: Failed to apply state/blocks: %v", err)
-		return
+// discoverPeers returns the whitelisted peers of the BAR network, which have
+// completed the handshake and not misbehaved.
+func (fsm *FastSyncManager) discoverPeers() []peer.ID {
+	if fsm.node.p2p == nil || fsm.node.barNet == nil {
+		return nil
+	}
+	var peers []peer.ID
+	for _, info := range fsm.node.barNet.GetWhitelist() {
+		peers = append(peers, info.ID)
+	}
+	return peers
+}
+
+// requestStatuses asks every sync peer for its chain tip.
+func (fsm *FastSyncManager) requestStatuses(ctx context.Context) map[peer.ID]*fastSyncStatus {
+	statuses := make(map[peer.ID]*fastSyncStatus)
+	for _, id := range fsm.peers {
+		resp, err := fsm.request(ctx, id, &fastSyncRequest{Type: "status"})
+		if err != nil || resp.Status == nil {
+			log.Printf("FASTSYNC: No status from %s: %v", id, err)
+			continue
+		}
+		statuses[id] = resp.Status
 	}
+	return statuses
+}
 
-	// 5. Switch to normal sync
-	fsm.switchToNormalSync()
+// requestStateSnapshot fetches a peer's latest epoch snapshot, downloading
+// its chunks from any sync peer, and verifies it against the state root
+// committed by the next block. That block's header is anchored to the node's
+// tip by a header chain whose commit certificates are checked against the
+// committee the node's registry selects, so no peer can vouch for its own
+// snapshot. The validator registry exported with the snapshot is checked as
+// in checkpoint sync. It returns the state, the registry and the block the
+// snapshot was taken at.
+func (fsm *FastSyncManager) requestStateSnapshot(ctx context.Context, id peer.ID) (*State, []KVPair, *Block, error) {
+	log.Printf("FASTSYNC: Requesting snapshot manifest from %s...", id)
+	resp, err := fsm.request(ctx, id, &fastSyncRequest{Type: "manifest"})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if resp.Manifest == nil {
+		return nil, nil, nil, errors.New("empty manifest response")
+	}
+	snap := resp.Manifest
+	if localHeight := fsm.node.bc.Height(); snap.Height <= localHeight {
+		return nil, nil, nil, fmt.Errorf("snapshot at height %d is not ahead of height %d", snap.Height, localHeight)
+	}
+	importer, err := NewSnapshotImporter(snap)
+	if err != nil {
+		fsm.penalize(id, "invalid snapshot manifest")
+		return nil, nil, nil, err
+	}
+
+	headers, err := fsm.anchorHeaders(ctx, snap.Height+1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	baseHeader, next := headers[len(headers)-2], headers[len(headers)-1]
+	if next.Header.StateRoot != snap.Root {
+		fsm.penalize(id, "snapshot root not committed by the chain")
+		return nil, nil, nil, fmt.Errorf("snapshot root %s does not match the state root %s committed at height %d",
+			snap.Root.ToHex(), next.Header.StateRoot.ToHex(), snap.Height+1)
+	}
+
+	if err := fsm.requestChunks(ctx, id, importer); err != nil {
+		return nil, nil, nil, err
+	}
+	state, err := importer.State()
+	if err != nil {
+		fsm.penalize(id, "inconsistent snapshot manifest")
+		return nil, nil, nil, err
+	}
+
+	base, err := fsm.requestBlock(ctx, id, snap.Height)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("block %d: %w", snap.Height, err)
+	}
+	if base.Header.Hash != baseHeader.Header.Hash {
+		fsm.penalize(id, "block off the anchored chain")
+		return nil, nil, nil, fmt.Errorf("block %d is not on the anchored header chain", snap.Height)
+	}
+	// The certificate is not part of the block hash, so the verified one is kept
+	base.Certificate = baseHeader.Certificate
+	validators, registry, err := fsm.requestValidators(ctx, id, state, base)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// The snapshot holds the keys the committee of the next block signed with
+	if err := verifyCommitCertificate(state, registry, next.Header, next.Certificate); err != nil {
+		fsm.penalize(id, "validator set does not certify the block after the snapshot")
+		return nil, nil, nil, fmt.Errorf("block %d: %w", snap.Height+1, err)
+	}
+	log.Printf("FASTSYNC: Verified snapshot of %d entries in %d chunks at height %d against root %s",
+		snap.Entries, len(snap.Chunks), snap.Height, snap.Root.ToHex())
+	return state, validators, base, nil
 }
 
-func (fsm *FastSyncManager) discoverPeers() []string {
-	// TODO: Integrate with P2P to discover peers
-	return []string{"peer1", "peer2"}
+// anchorHeaders fetches the header chain from the node's tip up to height
+// from the sync peers and verifies it as block sync does: each header must
+// extend the one before it, be signed by its proposer and carry a commit
+// certificate of the committee the node's registry selects. It waits for the
+// peers to reach height, and returns the headers after the tip.
+func (fsm *FastSyncManager) anchorHeaders(ctx context.Context, height uint64) ([]*syncHeader, error) {
+	bs := fsm.node.blockSyncer
+	last, err := fsm.node.bc.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	parent := last.Header
+	var headers []*syncHeader
+	deadline := time.Now().Add(fastSyncAnchorWait)
+	for attempt := 0; parent.BlockNumber < height; attempt++ {
+		batch, id := bs.fetchHeaders(ctx, fsm.peers, attempt, parent.BlockNumber+1)
+		if len(batch) == 0 {
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("no sync peer has the headers up to height %d", height)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		for _, h := range batch {
+			if h.Header.BlockNumber > height {
+				break
+			}
+			if err := bs.verifyHeader(parent, h); err != nil {
+				fsm.penalize(id, "fast sync header failed verification")
+				return nil, fmt.Errorf("header %d from %s: %w", h.Header.BlockNumber, id, err)
+			}
+			headers = append(headers, h)
+			parent = h.Header
+		}
+	}
+	return headers, nil
 }
 
-func (fsm *FastSyncManager) requestStateSnapshot() error {
-	// TODO: Request state snapshot from peers
-	log.Printf("FASTSYNC: Requesting state snapshot from peers...")
-	// Simulate delay
-	time.Sleep(1 * time.Second)
+// requestChunks downloads the chunks of a snapshot, asking the peer that
+// served the manifest first and the other sync peers after it. Chunks are
+// checked against the manifest as they arrive.
+func (fsm *FastSyncManager) requestChunks(ctx context.Context, source peer.ID, importer *SnapshotImporter) error {
+	peers := []peer.ID{source}
+	for _, id := range fsm.peers {
+		if id != source {
+			peers = append(peers, id)
+		}
+	}
+	height := importer.manifest.Height
+	for _, index := range importer.Missing() {
+		for _, id := range peers {
+			resp, err := fsm.request(ctx, id, &fastSyncRequest{Type: "chunk", Height: height, Index: index})
+			if err != nil || resp.Chunk == nil {
+				continue
+			}
+			if err := importer.AddChunk(resp.Chunk); err != nil {
+				log.Printf("FASTSYNC: Bad snapshot chunk from %s: %v", id, err)
+				fsm.penalize(id, "bad snapshot chunk")
+				continue
+			}
+			break
+		}
+	}
+	if missing := importer.Missing(); len(missing) > 0 {
+		return fmt.Errorf("no sync peer served %d of the %d chunks of the snapshot at height %d",
+			len(missing), len(importer.manifest.Chunks), height)
+	}
 	return nil
 }
 
-func (fsm *FastSyncManager) requestBlockStream() error {
-	// TODO: Request block stream from peers
-	log.Printf("FASTSYNC: Requesting block stream from peers...")
-	// Simulate delay
-	time.Sleep(1 * time.Second)
-	return nil
+// requestBlock fetches the block at height from a peer and checks its hash.
+func (fsm *FastSyncManager) requestBlock(ctx context.Context, id peer.ID, height uint64) (*Block, error) {
+	resp, err := fsm.request(ctx, id, &fastSyncRequest{Type: "block", Height: height})
+	if err != nil {
+		return nil, err
+	}
+	block := resp.Block
+	if block == nil || block.Header == nil || block.Header.BlockNumber != height {
+		fsm.penalize(id, "wrong block in fast sync response")
+		return nil, fmt.Errorf("peer %s sent the wrong block for height %d", id, height)
+	}
+	if hash, err := block.Header.ComputeHash(); err != nil || hash != block.Header.Hash {
+		fsm.penalize(id, "block with a bad hash in fast sync response")
+		return nil, fmt.Errorf("peer %s sent block %d with a bad hash", id, height)
+	}
+	return block, nil
 }
 
-func (fsm *FastSyncManager) applyStateAndBlocks() error {
-	// TODO: Apply state and blocks in order
-	log.Printf("FASTSYNC: Applying state and blocks...")
-	// Simulate delay
-	time.Sleep(1 * time.Second)
+// requestBlockStream fetches the certified blocks after height from the sync
+// peers until none has the next one, and applies each in turn.
+func (fsm *FastSyncManager) requestBlockStream(ctx context.Context, height uint64, parent Hash) (uint64, error) {
+	log.Printf("FASTSYNC: Requesting blocks from height %d...", height+1)
+	for {
+		var block *Block
+		for _, id := range fsm.peers {
+			b, err := fsm.requestBlock(ctx, id, height+1)
+			if err != nil {
+				continue
+			}
+			if b.Header.PreviousHash != parent {
+				fsm.penalize(id, "fast sync block off the synced chain")
+				continue
+			}
+			if err := verifyBlockSignature(fsm.node.state, b); err != nil {
+				fsm.penalize(id, "fast sync block with a bad signature")
+				continue
+			}
+			if err := verifyCommitCertificate(fsm.node.state, fsm.node.vr, b.Header, b.Certificate); err != nil {
+				fsm.penalize(id, "fast sync block without a valid commit certificate")
+				continue
+			}
+			block = b
+			break
+		}
+		if block == nil {
+			return height, nil
+		}
+		if err := fsm.node.importBlock(block); err != nil {
+			return height, err
+		}
+		height, parent = block.Header.BlockNumber, block.Header.Hash
+	}
+}
+
+// applyStateAndBlocks replaces the node's state and validator registry with a
+// verified snapshot, makes the snapshot's block the chain tip and catches up
+// from there.
+func (fsm *FastSyncManager) applyStateAndBlocks(ctx context.Context, state *State, validators []KVPair, base *Block) error {
+	fsm.importing.Store(true)
+	defer fsm.importing.Store(false)
+
+	log.Printf("FASTSYNC: Applying state at height %d...", base.Header.BlockNumber)
+	if err := fsm.applyCheckpoint(state, validators, base); err != nil {
+		return err
+	}
+
+	height, err := fsm.requestBlockStream(ctx, base.Header.BlockNumber, base.Header.Hash)
+	if err != nil {
+		return err
+	}
+	log.Printf("FASTSYNC: Caught up to height %d", height)
 	return nil
 }
 
 func (fsm *FastSyncManager) switchToNormalSync() {
+	fsm.node.updatePool()
 	log.Printf("FASTSYNC: Fast sync complete. Switching to normal sync mode.")
 }
+
+// request sends one request to a peer and reads its response.
+func (fsm *FastSyncManager) request(ctx context.Context, id peer.ID, req *fastSyncRequest) (*fastSyncResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, fastSyncRequestTimeout)
+	defer cancel()
+	stream, err := fsm.node.p2p.NewStream(ctx, id, FastSyncProtocol)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return nil, err
+	}
+	stream.CloseWrite()
+	var resp fastSyncResponse
+	if err := json.NewDecoder(stream).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// handleStream serves one FastSyncProtocol request.
+func (fsm *FastSyncManager) handleStream(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(fastSyncRequestTimeout))
+
+	from := stream.Conn().RemotePeer()
+	if status, ok := fsm.node.barNet.GetPeerStatus(from); ok && status == PeerStatusBanned {
+		stream.Reset()
+		return
+	}
+	var req fastSyncRequest
+	if err := json.NewDecoder(stream).Decode(&req); err != nil {
+		log.Printf("FASTSYNC: Malformed request from %s: %v", from, err)
+		return
+	}
+	if err := json.NewEncoder(stream).Encode(fsm.serve(&req)); err != nil {
+		log.Printf("FASTSYNC: Failed to answer %s: %v", from, err)
+	}
+}
+
+func (fsm *FastSyncManager) serve(req *fastSyncRequest) *fastSyncResponse {
+	switch req.Type {
+	case "status":
+		last, err := fsm.node.bc.GetLastBlock()
+		if err != nil {
+			return &fastSyncResponse{Error: err.Error()}
+		}
+		return &fastSyncResponse{Status: &fastSyncStatus{Height: last.Header.BlockNumber, Hash: last.Header.Hash}}
+	case "manifest":
+		if req.Height == 0 {
+			if latest := fsm.node.snapshots.Latest(); latest != nil {
+				return &fastSyncResponse{Manifest: latest}
+			}
+			return &fastSyncResponse{Error: "no snapshot available"}
+		}
+		manifest, err := fsm.node.snapshots.Manifest(req.Height)
+		if err != nil {
+			return &fastSyncResponse{Error: err.Error()}
+		}
+		return &fastSyncResponse{Manifest: manifest}
+	case "chunk":
+		chunk, err := fsm.node.snapshots.Chunk(req.Height, req.Index)
+		if err != nil {
+			return &fastSyncResponse{Error: err.Error()}
+		}
+		return &fastSyncResponse{Chunk: chunk}
+	case "validators":
+		validators, err := fsm.node.snapshots.Validators(req.Height)
+		if err != nil {
+			return &fastSyncResponse{Error: err.Error()}
+		}
+		return &fastSyncResponse{Validators: validators}
+	case "block":
+		block, err := fsm.node.bc.GetBlockByHeight(req.Height)
+		if err != nil {
+			return &fastSyncResponse{Error: err.Error()}
+		}
+		return &fastSyncResponse{Block: block}
+	default:
+		return &fastSyncResponse{Error: fmt.Sprintf("unknown request type %q", req.Type)}
+	}
+}
+
+func (fsm *FastSyncManager) penalize(id peer.ID, reason string) {
+	fsm.node.barNet.UpdatePOMScore(id, 1, reason)
+}
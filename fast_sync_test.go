@@ -4,6 +4,12 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type stubNode struct{}
@@ -78,3 +84,181 @@ func TestStateSnapshotExportImport(t *testing.T) {
 
 	t.Logf("Successfully exported and imported %d accounts", len(exportedAccounts))
 }
+
+// newSyncTestNode builds the parts of a node that fast sync and block sync use.
+func newSyncTestNode(t *testing.T, ctx context.Context) *AppNode {
+	p2pKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p2p, err := NewP2PNode(ctx, 0, p2pKey)
+	require.NoError(t, err)
+	t.Cleanup(func() { p2p.host.Close() })
+	bc, err := NewBlockchain(NewMemoryStore())
+	require.NoError(t, err)
+
+	node := &AppNode{
+		ctx: ctx, p2p: p2p, bc: bc, state: NewState(), txPool: NewTransactionPool(), barNet: NewBARNetwork(nil),
+		vr: NewValidatorRegistry(NewMemoryStore(), "validators"), snapshots: NewSnapshotStore(),
+	}
+	node.fastSyncManager = NewFastSyncManager(node)
+	node.fastSyncManager.RegisterProtocol()
+	node.blockSyncer = NewBlockSyncer(node)
+	node.blockSyncer.RegisterProtocol()
+	node.lightServer = NewLightServer(node)
+	node.lightServer.RegisterProtocol()
+	return node
+}
+
+// extendFastSyncTestChain adds a block with one transfer to a node's chain,
+// finalized by a committee of its proposer alone.
+func extendFastSyncTestChain(t *testing.T, node *AppNode, proposer *btcec.PrivateKey, sender tokenTestAccount) {
+	tx := tokenTx(t, node.state, sender, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+	validator := &Validator{Address: pubKeyToAddress(proposer.PubKey())}
+	block, err := node.bc.CreateBlockWithState([]*Transaction{tx}, validator, proposer, node.state)
+	require.NoError(t, err)
+	require.NoError(t, block.Sign(proposer))
+	approval := NewBlockApproval(block, []*Validator{validator})
+	require.NoError(t, approval.AddApproval(&Approval{
+		BlockHash: block.Header.Hash,
+		Address:   validator.Address,
+		Signature: ecdsa.Sign(proposer, block.Header.Hash[:]).Serialize(),
+		PubKey:    proposer.PubKey().SerializeCompressed(),
+	}))
+	block.Certificate = approval.Certificate()
+	require.NoError(t, node.bc.AddBlock(block))
+	require.NoError(t, node.bc.ApplyBlockWithRegistry(block, node.state, nil))
+}
+
+// newSnapshotSyncServer builds a node with a chain FastSyncMinLag+4 blocks
+// long, finalized by a single validator, and a snapshot at height 10, where
+// its first epoch ends. It returns the node and the validator's address.
+func newSnapshotSyncServer(t *testing.T, ctx context.Context) (*AppNode, Address) {
+	server := newSyncTestNode(t, ctx)
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	proposerAddr := pubKeyToAddress(proposer.PubKey())
+	require.NoError(t, server.vr.RegisterValidator(&Validator{Address: proposerAddr, Stake: 100, Participating: true}))
+	require.NoError(t, server.vr.SetCurrentEpoch(EpochInfo{Number: 1, StartHeight: 1, Length: 10}))
+	sender := newTokenTestAccount(t, server.state, 1000)
+	for i := 0; i < FastSyncMinLag+4; i++ {
+		extendFastSyncTestChain(t, server, proposer, sender)
+		server.snapshots.AfterBlock(server.bc.Height(), server.state, server.vr)
+	}
+	require.NotNil(t, server.snapshots.Latest())
+	require.Equal(t, uint64(10), server.snapshots.Latest().Height)
+	return server, proposerAddr
+}
+
+// newSnapshotSyncClient builds a node that, like every node of the chain,
+// starts from a registry holding the validator that finalizes it.
+func newSnapshotSyncClient(t *testing.T, ctx context.Context, validator Address) *AppNode {
+	client := newSyncTestNode(t, ctx)
+	require.NoError(t, client.vr.RegisterValidator(&Validator{Address: validator, Stake: 100, Participating: true}))
+	return client
+}
+
+// runSyncLoop runs one fast sync of node to completion.
+func runSyncLoop(t *testing.T, ctx context.Context, node *AppNode) {
+	done := make(chan struct{})
+	go func() {
+		node.fastSyncManager.syncLoop(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("fast sync did not finish")
+	}
+}
+
+func TestFastSyncManager_SnapshotSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, proposerAddr := newSnapshotSyncServer(t, ctx)
+	client := newSnapshotSyncClient(t, ctx, proposerAddr)
+	require.NoError(t, client.state.PutAccount(&Account{Address: Address{0xaa}, Balance: 5}))
+	connectSyncPeer(t, ctx, client, server)
+	runSyncLoop(t, ctx, client)
+	assert.Equal(t, server.bc.Height(), client.bc.Height())
+	assert.Equal(t, server.state.Root(), client.state.Root())
+	acc, _ := client.state.GetAccount(Address{1})
+	assert.Equal(t, uint64(FastSyncMinLag+4), acc.Balance)
+	stray, _ := client.state.GetAccount(Address{0xaa})
+	assert.Equal(t, uint64(0), stray.Balance, "the snapshot replaces the local state")
+	assert.Equal(t, uint64(2), client.vr.CurrentEpoch().Number, "the registry is taken from the snapshot and advanced by the blocks after it")
+	v, err := client.vr.GetValidator(proposerAddr)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, uint64(100), v.Stake)
+	assert.False(t, client.fastSyncManager.Importing())
+}
+
+func TestFastSyncManager_RequiresCommitCertificates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, proposerAddr := newSnapshotSyncServer(t, ctx)
+	stripCertificate := func(height uint64) {
+		block, err := server.bc.GetBlockByHeight(height)
+		require.NoError(t, err)
+		block.Certificate = nil
+		data, err := encodeBlock(block)
+		require.NoError(t, err)
+		require.NoError(t, server.bc.store.Put(blockKey(height), data))
+	}
+
+	// The stream stops before a block without a certificate, and nothing of it
+	// is applied
+	stripCertificate(15)
+	client := newSnapshotSyncClient(t, ctx, proposerAddr)
+	id := connectSyncPeer(t, ctx, client, server)
+	runSyncLoop(t, ctx, client)
+	assert.Equal(t, uint64(14), client.bc.Height())
+	acc, _ := client.state.GetAccount(Address{1})
+	assert.Equal(t, uint64(14), acc.Balance)
+	assert.Equal(t, 1, pomScore(client.barNet, id))
+
+	// Nor is a snapshot accepted from a chain certified by a committee other
+	// than the one the client's registry selects
+	client = newSnapshotSyncClient(t, ctx, Address{7})
+	id = connectSyncPeer(t, ctx, client, server)
+	runSyncLoop(t, ctx, client)
+	assert.Equal(t, uint64(0), client.bc.Height())
+	assert.Equal(t, 1, pomScore(client.barNet, id))
+
+	// Or whose next block is not certified
+	stripCertificate(11)
+	client = newSnapshotSyncClient(t, ctx, proposerAddr)
+	connectSyncPeer(t, ctx, client, server)
+	runSyncLoop(t, ctx, client)
+	assert.Equal(t, uint64(0), client.bc.Height())
+}
+
+func TestFastSyncManager_RejectsUncommittedSnapshots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The server replaces its snapshot with a state the chain never had
+	server, proposerAddr := newSnapshotSyncServer(t, ctx)
+	forged := NewState()
+	require.NoError(t, forged.PutAccount(&Account{Address: Address{0xbb}, Balance: 1000000}))
+	forged.SetHeight(10)
+	server.snapshots.Add(NewStateSnapshot(forged))
+
+	client := newSnapshotSyncClient(t, ctx, proposerAddr)
+	id := connectSyncPeer(t, ctx, client, server)
+	runSyncLoop(t, ctx, client)
+	assert.Equal(t, uint64(0), client.bc.Height())
+	acc, _ := client.state.GetAccount(Address{0xbb})
+	assert.Equal(t, uint64(0), acc.Balance)
+	assert.Equal(t, 1, pomScore(client.barNet, id))
+}
+
+func TestMerkleTrie_RootIndependentOfInsertOrder(t *testing.T) {
+	a, b := NewMerkleTrie(), NewMerkleTrie()
+	a.Insert([]byte("tok:GOLD"), []byte("1"))
+	a.Insert([]byte("tok:GOLDEN"), []byte("2"))
+	b.Insert([]byte("tok:GOLDEN"), []byte("2"))
+	b.Insert([]byte("tok:GOLD"), []byte("1"))
+	assert.Equal(t, a.RootHash(), b.RootHash())
+}
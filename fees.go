@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// GasTransaction is the intrinsic gas of every transaction. Contract
+	// transactions reserve their gas limit on top of it.
+	GasTransaction = 1000
+	// GasTxDataByte is charged for every byte of a transaction's memo.
+	GasTxDataByte = 16
+
+	DefaultBlockGasLimit = 10_000_000
+	MinBlockGasLimit     = 100_000
+
+	// The base fee moves towards the point where blocks use half of the gas
+	// limit, by at most 1/BaseFeeChangeDenominator per block.
+	BaseFeeElasticity        = 2
+	BaseFeeChangeDenominator = 8
+
+	// feeEstimateBlocks is the number of recent blocks the tip suggestion is
+	// taken from.
+	feeEstimateBlocks = 10
+)
+
+// intrinsicGas returns the gas every transaction uses: the base cost and its memo.
+func intrinsicGas(tx *Transaction) uint64 {
+	return GasTransaction + uint64(len(tx.Data))*GasTxDataByte
+}
+
+// TransactionGas returns the gas a transaction reserves in its block: its
+// intrinsic gas, the outputs of a multi_transfer and, for contract
+// transactions, their gas limit.
+func TransactionGas(tx *Transaction) uint64 {
+	gas := intrinsicGas(tx) + uint64(len(tx.Outputs))*GasTransferOutput
+	if tx.Contract != nil {
+		gas += tx.Contract.GasLimit
+	}
+	return gas
+}
+
+// blockGas returns the gas reserved by a list of transactions.
+func blockGas(txs []*Transaction) uint64 {
+	total := uint64(0)
+	for _, tx := range txs {
+		total += TransactionGas(tx)
+	}
+	return total
+}
+
+// mulDiv returns a*b/c, saturating instead of overflowing.
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	if hi >= c {
+		return math.MaxUint64
+	}
+	q, _ := bits.Div64(hi, lo, c)
+	return q
+}
+
+// baseFeeCost returns the part of a transaction's fee that is burned at baseFee.
+func baseFeeCost(tx *Transaction, baseFee uint64) uint64 {
+	return mulDiv(baseFee, TransactionGas(tx), 1)
+}
+
+// checkBaseFee checks that a transaction's fee covers the base fee of its gas.
+// The fee is always charged in full; whatever exceeds the base fee cost is the
+// proposer's tip.
+func checkBaseFee(tx *Transaction, baseFee uint64) error {
+	if cost := baseFeeCost(tx, baseFee); tx.Fee < cost {
+		return fmt.Errorf("fee %d below the base fee cost %d (%d gas at %d)", tx.Fee, cost, TransactionGas(tx), baseFee)
+	}
+	return nil
+}
+
+// CalcNextBaseFee returns the base fee of the block following parent.
+func CalcNextBaseFee(parent *Header, gasLimit, minBaseFee uint64) uint64 {
+	target := gasLimit / BaseFeeElasticity
+	baseFee := parent.BaseFee
+	switch {
+	case target == 0 || parent.Gas == target:
+	case parent.Gas > target:
+		delta := mulDiv(baseFee, parent.Gas-target, target) / BaseFeeChangeDenominator
+		if delta == 0 {
+			delta = 1
+		}
+		if baseFee > math.MaxUint64-delta {
+			baseFee = math.MaxUint64
+		} else {
+			baseFee += delta
+		}
+	default:
+		baseFee -= mulDiv(baseFee, target-parent.Gas, target) / BaseFeeChangeDenominator
+	}
+	if baseFee < minBaseFee {
+		baseFee = minBaseFee
+	}
+	return baseFee
+}
+
+// FeeEstimate is the fee suggestion served to wallets.
+type FeeEstimate struct {
+	BaseFee       uint64 `json:"baseFee"` // per unit of gas, for the next block
+	Gas           uint64 `json:"gas"`
+	BaseFeeCost   uint64 `json:"baseFeeCost"` // burned part of the fee
+	SuggestedTip  uint64 `json:"suggestedTip"`
+	SuggestedFee  uint64 `json:"suggestedFee"`
+	BlockGasLimit uint64 `json:"blockGasLimit"`
+	ParentGasUsed uint64 `json:"parentGasUsed"`
+}
+
+// EstimateFee suggests a fee for a transaction reserving gas in the next
+// block. The tip is the median tip of recent blocks, and at least 1.
+func (bc *Blockchain) EstimateFee(gas uint64) (*FeeEstimate, error) {
+	last, err := bc.GetLastBlock()
+	if err != nil {
+		return nil, err
+	}
+	if last == nil || last.Header == nil {
+		return nil, errors.New("chain has no blocks")
+	}
+
+	var tips []uint64
+	for h := last.Header.BlockNumber; h > 0 && last.Header.BlockNumber-h < feeEstimateBlocks; h-- {
+		block, err := bc.GetBlockByHeight(h)
+		if err != nil || block.Header == nil {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			if cost := baseFeeCost(tx, block.Header.BaseFee); tx.Fee > cost {
+				tips = append(tips, tx.Fee-cost)
+			}
+		}
+	}
+	tip := uint64(1)
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool { return tips[i] < tips[j] })
+		if median := tips[len(tips)/2]; median > tip {
+			tip = median
+		}
+	}
+
+	gasLimit, minBaseFee := bc.gasRules()
+	baseFee := CalcNextBaseFee(last.Header, gasLimit, minBaseFee)
+	cost := mulDiv(baseFee, gas, 1)
+	return &FeeEstimate{
+		BaseFee:       baseFee,
+		Gas:           gas,
+		BaseFeeCost:   cost,
+		SuggestedTip:  tip,
+		SuggestedFee:  cost + tip,
+		BlockGasLimit: gasLimit,
+		ParentGasUsed: last.Header.Gas,
+	}, nil
+}
+
+// SetGasRules sets the governed block gas limit and base fee floor that the
+// node builds its blocks and fee estimates with. Blocks are validated against
+// the registry's parameters instead; see blockGasRules.
+func (bc *Blockchain) SetGasRules(gasLimit, minBaseFee uint64) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	bc.gasLimit = gasLimit
+	bc.minBaseFee = minBaseFee
+}
+
+func (bc *Blockchain) gasRules() (gasLimit, minBaseFee uint64) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	gasLimit = bc.gasLimit
+	if gasLimit == 0 {
+		gasLimit = DefaultBlockGasLimit
+	}
+	return gasLimit, bc.minBaseFee
+}
+
+// NextBaseFee returns the base fee of the block following the chain tip.
+func (bc *Blockchain) NextBaseFee() uint64 {
+	last, err := bc.GetLastBlock()
+	if err != nil || last == nil || last.Header == nil {
+		return 0
+	}
+	gasLimit, minBaseFee := bc.gasRules()
+	return CalcNextBaseFee(last.Header, gasLimit, minBaseFee)
+}
+
+// blockGasRules returns the gas limit and base fee floor a block applied with
+// vr must follow: the consensus parameters vr holds for the current epoch. A
+// block applied without a registry follows the rules set with SetGasRules.
+func (bc *Blockchain) blockGasRules(vr *ValidatorRegistry) (gasLimit, minBaseFee uint64) {
+	if vr == nil {
+		return bc.gasRules()
+	}
+	params := vr.GetConsensusParams()
+	return params.BlockGasLimit, params.MinBaseFee
+}
+
+// checkBlockGas validates the gas accounting of a block header: the declared
+// gas must match its transactions and stay within the limit, and the base fee
+// must follow from the parent when the parent is known.
+func (bc *Blockchain) checkBlockGas(block *Block, gasLimit, minBaseFee uint64) error {
+	gas := blockGas(block.Transactions)
+	if block.Header.Gas != gas {
+		return fmt.Errorf("header gas %d does not match the transactions' gas %d", block.Header.Gas, gas)
+	}
+	if gas > gasLimit {
+		return fmt.Errorf("block gas %d exceeds the %d gas limit", gas, gasLimit)
+	}
+	if block.Header.BlockNumber == 0 {
+		return nil
+	}
+	parent, err := bc.GetBlockByHeight(block.Header.BlockNumber - 1)
+	if err != nil || parent.Header == nil {
+		// Blocks applied without their parent (state imports) cannot be checked
+		return nil
+	}
+	if want := CalcNextBaseFee(parent.Header, gasLimit, minBaseFee); block.Header.BaseFee != want {
+		return fmt.Errorf("base fee %d does not match the expected %d", block.Header.BaseFee, want)
+	}
+	return nil
+}
+
+// payFees burns the base fee cost of a transaction and credits the rest of the
+// fee it paid to the block proposer.
+func payFees(state *State, header *Header, tx *Transaction, receipt *Receipt) error {
+	if receipt.FeePaid == 0 {
+		return nil
+	}
+	tip := receipt.FeePaid - baseFeeCost(tx, header.BaseFee)
+	if tip == 0 {
+		return nil
+	}
+	proposer, err := state.GetAccount(header.Proposer)
+	if err != nil {
+		return err
+	}
+	proposer.Balance += tip
+	return state.PutAccount(proposer)
+}
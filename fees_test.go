@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalcNextBaseFee(t *testing.T) {
+	const limit = 1_000_000
+	assert.Equal(t, uint64(800), CalcNextBaseFee(&Header{BaseFee: 800, Gas: limit / 2}, limit, 0), "at target")
+	assert.Equal(t, uint64(900), CalcNextBaseFee(&Header{BaseFee: 800, Gas: limit}, limit, 0), "full block")
+	assert.Equal(t, uint64(700), CalcNextBaseFee(&Header{BaseFee: 800, Gas: 0}, limit, 0), "empty block")
+	assert.Equal(t, uint64(1), CalcNextBaseFee(&Header{BaseFee: 0, Gas: limit}, limit, 0), "a zero base fee can still rise")
+	assert.Equal(t, uint64(750), CalcNextBaseFee(&Header{BaseFee: 800, Gas: 0}, limit, 750), "floored at the minimum")
+}
+
+func TestBlockchain_BurnsBaseFeeAndTipsProposer(t *testing.T) {
+	state, vr, bc, vals := setupGovernanceTest(t, 100)
+	proposer := vals[0]
+	user := newTokenTestAccount(t, state, 50_000)
+	params := vr.GetConsensusParams()
+	params.BlockGasLimit, params.MinBaseFee = MinBlockGasLimit, 10
+	require.NoError(t, vr.SetConsensusParams(params))
+	bc.SetGasRules(params.BlockGasLimit, params.MinBaseFee)
+
+	tx := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 100, Type: "transfer"})
+	tx.Fee = 10_500
+	require.NoError(t, tx.Sign(user.key))
+
+	block, err := bc.CreateBlock([]*Transaction{tx}, &Validator{Address: proposer.addr}, proposer.key)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(GasTransaction), block.Header.Gas)
+	assert.Equal(t, uint64(10), block.Header.BaseFee)
+	require.NoError(t, bc.AddBlock(block))
+	require.NoError(t, bc.ApplyBlockWithRegistry(block, state, vr))
+
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(50_000-100-10_500), acc.Balance, "the whole fee is charged")
+	acc, _ = state.GetAccount(proposer.addr)
+	assert.Equal(t, uint64(100+500), acc.Balance, "the proposer only receives the tip")
+
+	// The next block must carry the base fee derived from its parent
+	bad := &Block{Header: &Header{BlockNumber: 2, BaseFee: 11}}
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(bad, state, vr), "base fee 11 does not match")
+
+	// Transactions that do not cover the base fee invalidate the block
+	cheap := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+	low := &Block{Header: &Header{BlockNumber: 2, BaseFee: bc.NextBaseFee(), Gas: GasTransaction}, Transactions: []*Transaction{cheap}}
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(low, state, vr), "below the base fee cost")
+
+	mismatch := &Block{Header: &Header{BlockNumber: 2, BaseFee: bc.NextBaseFee()}, Transactions: []*Transaction{cheap}}
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(mismatch, state, vr), "does not match the transactions' gas")
+}
+
+func TestBlockchain_EnforcesGasLimit(t *testing.T) {
+	state, _, bc, vals := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+	bc.SetGasRules(MinBlockGasLimit, 0)
+
+	call := tokenTx(t, state, user, &Transaction{
+		To: Address{1}, Type: "call_contract",
+		Contract: &ContractPayload{GasLimit: MinBlockGasLimit},
+	})
+	_, err := bc.CreateBlock([]*Transaction{call}, &Validator{Address: vals[0].addr}, vals[0].key)
+	assert.ErrorContains(t, err, "exceeds the 100000 gas limit")
+
+	tp := NewTransactionPool()
+	tp.SetGasRules(MinBlockGasLimit, 0)
+	assert.ErrorContains(t, tp.AddTransaction(call, user.key.PubKey(), state), "exceeds the 100000 block gas limit")
+}
+
+func TestBlockchain_ValidatesGasAgainstRegistryParams(t *testing.T) {
+	state, vr, bc, vals := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+
+	// The block is built under the default rules cached on the chain, but the
+	// registry's parameters for the epoch lower the limit
+	call := tokenTx(t, state, user, &Transaction{
+		To: Address{1}, Type: "call_contract",
+		Contract: &ContractPayload{GasLimit: MinBlockGasLimit},
+	})
+	block, err := bc.CreateBlock([]*Transaction{call}, &Validator{Address: vals[0].addr}, vals[0].key)
+	require.NoError(t, err)
+	params := vr.GetConsensusParams()
+	params.BlockGasLimit = MinBlockGasLimit
+	require.NoError(t, vr.SetConsensusParams(params))
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(block, state, vr), "exceeds the 100000 gas limit")
+
+	// And a raised base fee floor applies from the registry as well
+	params.BlockGasLimit, params.MinBaseFee = DefaultBlockGasLimit, 7
+	require.NoError(t, vr.SetConsensusParams(params))
+	empty, err := bc.CreateBlock(nil, &Validator{Address: vals[0].addr}, vals[0].key)
+	require.NoError(t, err)
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(empty, state, vr), "does not match the expected 7")
+}
+
+func TestTransactionPool_BaseFee(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 50_000)
+	tp := NewTransactionPool()
+	tp.SetGasRules(DefaultBlockGasLimit, 2)
+
+	tx := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+	assert.ErrorContains(t, tp.AddTransaction(tx, user.key.PubKey(), state), "below the base fee cost 2000")
+
+	tx.Fee = 2001
+	require.NoError(t, tx.Sign(user.key))
+	require.NoError(t, tp.AddTransaction(tx, user.key.PubKey(), state))
+
+	// A rising base fee keeps the transaction out of blocks until it drops again
+	tp.SetGasRules(DefaultBlockGasLimit, 3)
+	assert.Empty(t, tp.SelectTransactions(10, state))
+	assert.Empty(t, tp.CreateOptimizedBatch(state).Transactions)
+}
+
+func TestAPIServer_FeeEstimate(t *testing.T) {
+	bc, err := NewBlockchain(NewMemoryStore())
+	require.NoError(t, err)
+	bc.SetGasRules(DefaultBlockGasLimit, 5)
+	api := &APIServer{node: &AppNode{bc: bc}}
+
+	w := httptest.NewRecorder()
+	api.handleFeeEstimate(w, httptest.NewRequest(http.MethodGet, "/fees/estimate?gas=3000", nil))
+	var response struct {
+		Success bool
+		Data    FeeEstimate
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, uint64(5), response.Data.BaseFee)
+	assert.Equal(t, uint64(15_000), response.Data.BaseFeeCost)
+	assert.Equal(t, uint64(15_001), response.Data.SuggestedFee)
+
+	w = httptest.NewRecorder()
+	api.handleFeeEstimate(w, httptest.NewRequest(http.MethodGet, "/fees/estimate?gas=1", nil))
+	assert.Contains(t, w.Body.String(), "gas must be a number of at least")
+}
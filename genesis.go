@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// GenesisAccount is an allocation in the genesis file. Accounts with a vesting
+// schedule hold its total as part of their balance.
+type GenesisAccount struct {
+	Address string           `json:"address"`
+	Balance uint64           `json:"balance"`
+	Vesting *VestingSchedule `json:"vesting,omitempty"`
+}
+
+// GenesisValidator is a validator registered at genesis. It participates
+// from the first epoch.
+type GenesisValidator struct {
+	Address string `json:"address"`
+	Stake   uint64 `json:"stake"`
+}
+
+// Genesis holds the initial allocations and validator set loaded before a
+// node starts. Every node of a network must load the same file.
+type Genesis struct {
+	Accounts   []GenesisAccount   `json:"accounts"`
+	Validators []GenesisValidator `json:"validators,omitempty"`
+}
+
+// LoadGenesis reads a genesis file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genesis file: %w", err)
+	}
+	var genesis Genesis
+	if err := json.Unmarshal(data, &genesis); err != nil {
+		return nil, fmt.Errorf("failed to decode genesis file: %w", err)
+	}
+	return &genesis, nil
+}
+
+// Apply writes the genesis allocations to the state and the genesis
+// validators to the registry.
+func (g *Genesis) Apply(state *State, vr *ValidatorRegistry) error {
+	for i, alloc := range g.Accounts {
+		addr, err := HexToAddress(alloc.Address)
+		if err != nil {
+			return fmt.Errorf("genesis account %d: %w", i, err)
+		}
+		if alloc.Vesting != nil {
+			if err := alloc.Vesting.Validate(); err != nil {
+				return fmt.Errorf("genesis account %s: %w", alloc.Address, err)
+			}
+			if alloc.Vesting.Total > alloc.Balance {
+				return fmt.Errorf("genesis account %s: vesting total %d exceeds balance %d", alloc.Address, alloc.Vesting.Total, alloc.Balance)
+			}
+			if err := state.PutVesting(addr, alloc.Vesting); err != nil {
+				return err
+			}
+		}
+		acc, err := state.GetAccount(addr)
+		if err != nil {
+			return err
+		}
+		acc.Balance = alloc.Balance
+		if err := state.PutAccount(acc); err != nil {
+			return err
+		}
+	}
+	for i, gv := range g.Validators {
+		addr, err := HexToAddress(gv.Address)
+		if err != nil {
+			return fmt.Errorf("genesis validator %d: %w", i, err)
+		}
+		if gv.Stake == 0 {
+			return fmt.Errorf("genesis validator %s: stake must be positive", gv.Address)
+		}
+		if err := vr.RegisterValidator(&Validator{Address: addr, Stake: gv.Stake, Participating: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Committee returns the addresses of the committee the genesis validators
+// form, which certifies the first epoch.
+func (g *Genesis) Committee() ([]Address, error) {
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	if err := g.Apply(NewState(), vr); err != nil {
+		return nil, err
+	}
+	committee, err := registryCommittee(vr)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]Address, len(committee))
+	for i, v := range committee {
+		addresses[i] = v.Address
+	}
+	return addresses, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// registerTopicValidators sets the checks gossiped transactions, blocks,
+// approvals and validator announcements must pass before they are delivered
+// or forwarded. The checks need no chain state: anything that depends on it
+// is left to the handlers.
+func (n *AppNode) registerTopicValidators() {
+	n.p2p.SetTopicValidator(TransactionTopic, validateTransactionMessage)
+	n.p2p.SetTopicValidator(BlockTopic, n.validateBlockMessage)
+	n.p2p.SetTopicValidator(ApprovalTopic, validateApprovalMessage)
+	n.p2p.SetTopicValidator(ValidatorTopic, validateValidatorRegistrationMessage)
+}
+
+// validatedTransaction is a gossiped transaction that passed
+// validateTransactionMessage, handed to handleTransaction in ValidatorData.
+type validatedTransaction struct {
+	tx     *Transaction
+	pubKey *btcec.PublicKey // nil for multisig transactions
+}
+
+// validateTransactionMessage checks that a gossiped transaction hashes to its
+// Hash and is signed by the key it carries. The decoded transaction is left
+// in msg.ValidatorData.
+func validateTransactionMessage(msg *pubsub.Message) error {
+	var netTx NetworkTransaction
+	if err := json.Unmarshal(msg.Data, &netTx); err != nil {
+		return fmt.Errorf("malformed transaction message: %w", err)
+	}
+	tx := netTx.Tx
+	if tx == nil {
+		return errors.New("nil transaction in message")
+	}
+	// Multisig transactions carry their key set in the envelope
+	if tx.Multisig != nil {
+		if err := tx.VerifyMultisig(); err != nil {
+			return err
+		}
+		msg.ValidatorData = &validatedTransaction{tx: tx}
+		return nil
+	}
+	if hash, err := transactionContentHash(tx); err != nil || hash != tx.Hash {
+		return errors.New("transaction hash mismatch")
+	}
+	pubKey, err := UnmarshalPublicKey(netTx.PubKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	if !tx.Verify(pubKey) {
+		return errors.New("invalid transaction signature")
+	}
+	msg.ValidatorData = &validatedTransaction{tx: tx, pubKey: pubKey}
+	return nil
+}
+
+// validateBlockMessage checks that a gossiped block matches its header and is
+// signed by the key it carries. Blocks outside the heights processReceivedBlock
+// accepts are ignored rather than forwarded.
+func (n *AppNode) validateBlockMessage(msg *pubsub.Message) error {
+	var block Block
+	if err := json.Unmarshal(msg.Data, &block); err != nil {
+		return fmt.Errorf("malformed block message: %w", err)
+	}
+	if block.Header == nil {
+		return errors.New("block has no header")
+	}
+	hash, err := block.Header.ComputeHash()
+	if err != nil || hash != block.Header.Hash {
+		return errors.New("block header hash mismatch")
+	}
+	if err := checkSignature(block.ProposerKey, hash, block.Signature); err != nil {
+		return fmt.Errorf("block proposal: %w", err)
+	}
+	if err := verifyBlockBody(&block); err != nil {
+		return err
+	}
+	height := n.bc.Height()
+	if block.Header.BlockNumber < height || block.Header.BlockNumber > height+10 {
+		return errIgnoreMessage
+	}
+	return nil
+}
+
+// validateApprovalMessage checks that a gossiped approval is signed by the key
+// it carries.
+func validateApprovalMessage(msg *pubsub.Message) error {
+	var approval Approval
+	if err := json.Unmarshal(msg.Data, &approval); err != nil {
+		return fmt.Errorf("malformed approval message: %w", err)
+	}
+	if err := checkSignature(approval.PubKey, approval.BlockHash, approval.Signature); err != nil {
+		return fmt.Errorf("approval: %w", err)
+	}
+	return nil
+}
+
+// validateValidatorRegistrationMessage checks that a gossiped validator
+// announcement names the peer whose envelope carries it and is signed by the
+// key it carries, so a peer cannot replay another validator's announcement as
+// its own. Whether the key belongs to the announced address is checked against
+// state by handleValidatorRegistration.
+func validateValidatorRegistrationMessage(msg *pubsub.Message) error {
+	var registration ValidatorRegistration
+	if err := json.Unmarshal(msg.Data, &registration); err != nil {
+		return fmt.Errorf("malformed validator announcement: %w", err)
+	}
+	if registration.PeerID != msg.GetFrom().String() {
+		return fmt.Errorf("validator announcement for peer %s published by %s", registration.PeerID, msg.GetFrom())
+	}
+	hash, err := registration.SigningHash()
+	if err != nil {
+		return fmt.Errorf("malformed validator announcement: %w", err)
+	}
+	if err := checkSignature(registration.PubKey, hash, registration.Signature); err != nil {
+		return fmt.Errorf("validator announcement: %w", err)
+	}
+	return nil
+}
+
+// checkSignature checks a signature over hash against a serialized public key.
+// Whether the key belongs to the signer it is used for is checked against
+// state by verifyKeySignature.
+func checkSignature(pubKeyBytes []byte, hash Hash, signature []byte) error {
+	pub, err := btcec.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	sig, err := ecdsa.ParseDERSignature(signature)
+	if err != nil || !sig.Verify(hash[:], pub) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
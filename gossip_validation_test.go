@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gossipMessage wraps the JSON encoding of v as an opened gossip message.
+func gossipMessage(t *testing.T, v interface{}) *pubsub.Message {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return &pubsub.Message{Message: &pb.Message{Data: data}}
+}
+
+func TestValidateTransactionMessage(t *testing.T) {
+	state := NewState()
+	sender := newTokenTestAccount(t, state, 1000)
+	other := newTokenTestAccount(t, state, 1000)
+	newTx := func() *NetworkTransaction {
+		tx := tokenTx(t, state, sender, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+		return &NetworkTransaction{Tx: tx, PubKey: MarshalPublicKey(sender.key.PubKey())}
+	}
+	msg := gossipMessage(t, newTx())
+	require.NoError(t, validateTransactionMessage(msg))
+	validated, ok := msg.ValidatorData.(*validatedTransaction)
+	require.True(t, ok)
+	assert.True(t, validated.pubKey.IsEqual(sender.key.PubKey()))
+
+	changed := newTx()
+	changed.Tx.Value = 100
+	assert.ErrorContains(t, validateTransactionMessage(gossipMessage(t, changed)), "hash mismatch")
+
+	otherKey := newTx()
+	otherKey.PubKey = MarshalPublicKey(other.key.PubKey())
+	assert.ErrorContains(t, validateTransactionMessage(gossipMessage(t, otherKey)), "invalid transaction signature")
+
+	assert.Error(t, validateTransactionMessage(gossipMessage(t, &NetworkTransaction{})))
+	assert.Error(t, validateTransactionMessage(&pubsub.Message{Message: &pb.Message{Data: []byte("{")}}))
+}
+
+func TestAppNode_HandleTransactionDoesNotPenalizeRelayer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := newSyncTestNode(t, ctx)
+	node.metrics = NewMetricsCollector()
+	sender := newTokenTestAccount(t, node.state, 1000)
+	relayer := randomPeerID(t)
+	node.barNet.AddPeer(relayer, "")
+
+	tx := tokenTx(t, node.state, sender, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+	deliver := func() {
+		msg := gossipMessage(t, &NetworkTransaction{Tx: tx, PubKey: MarshalPublicKey(sender.key.PubKey())})
+		require.NoError(t, validateTransactionMessage(msg))
+		msg.ReceivedFrom = relayer
+		node.handleTransaction(msg)
+	}
+	deliver()
+	assert.Len(t, node.txPool.GetTransactions(), 1)
+
+	// The same transaction again is rejected by the pool, which an honest
+	// relayer cannot know
+	deliver()
+	assert.Len(t, node.txPool.GetTransactions(), 1)
+	assert.Equal(t, 0, pomScore(node.barNet, relayer))
+}
+
+func TestAppNode_ValidateBlockMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := newSyncTestNode(t, ctx)
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	sender := newTokenTestAccount(t, node.state, 1000)
+	tx := tokenTx(t, node.state, sender, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+	block, err := node.bc.CreateBlockWithState([]*Transaction{tx}, &Validator{Address: pubKeyToAddress(proposer.PubKey())}, proposer, node.state)
+	require.NoError(t, err)
+	require.NoError(t, block.Sign(proposer))
+	assert.NoError(t, node.validateBlockMessage(gossipMessage(t, block)))
+
+	clone := func() *Block {
+		var b Block
+		require.NoError(t, json.Unmarshal(gossipMessage(t, block).Data, &b))
+		return &b
+	}
+
+	forged := clone()
+	forged.Header.Timestamp++
+	assert.ErrorContains(t, node.validateBlockMessage(gossipMessage(t, forged)), "hash mismatch")
+
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	forged = clone()
+	forged.Signature = ecdsa.Sign(other, block.Header.Hash[:]).Serialize()
+	assert.ErrorContains(t, node.validateBlockMessage(gossipMessage(t, forged)), "invalid signature")
+
+	forged = clone()
+	forged.Transactions[0].Value = 100
+	assert.ErrorContains(t, node.validateBlockMessage(gossipMessage(t, forged)), "does not match its hash")
+
+	// A well-formed block too far ahead is dropped without a penalty
+	ahead := clone()
+	ahead.Header.BlockNumber = 50
+	ahead.Header.Hash = Hash{}
+	require.NoError(t, ahead.Sign(proposer))
+	assert.ErrorIs(t, node.validateBlockMessage(gossipMessage(t, ahead)), errIgnoreMessage)
+}
+
+func TestValidateApprovalMessage(t *testing.T) {
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	blockHash := Hash{1}
+	approval := &Approval{
+		BlockHash: blockHash,
+		Address:   pubKeyToAddress(key.PubKey()),
+		Signature: ecdsa.Sign(key, blockHash[:]).Serialize(),
+		PubKey:    key.PubKey().SerializeCompressed(),
+	}
+	assert.NoError(t, validateApprovalMessage(gossipMessage(t, approval)))
+
+	forged := *approval
+	forged.BlockHash = Hash{2}
+	assert.ErrorContains(t, validateApprovalMessage(gossipMessage(t, &forged)), "invalid signature")
+
+	forged = *approval
+	forged.PubKey = nil
+	assert.ErrorContains(t, validateApprovalMessage(gossipMessage(t, &forged)), "invalid public key")
+}
+
+func TestValidatorRegistrationMessage_RequiresItsValidatorAndPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := newSyncTestNode(t, ctx)
+	publisher := newSyncTestNode(t, ctx).p2p.host.ID()
+	key, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	announce := func(r *ValidatorRegistration) *pubsub.Message {
+		msg := gossipMessage(t, r)
+		msg.From = []byte(publisher)
+		return msg
+	}
+	registration := &ValidatorRegistration{Address: pubKeyToAddress(key.PubKey()), Stake: 100, PeerID: publisher.String()}
+	require.NoError(t, registration.Sign(key))
+	assert.NoError(t, validateValidatorRegistrationMessage(announce(registration)))
+
+	// Another peer cannot publish the announcement as its own
+	forged := *registration
+	forged.PeerID = node.p2p.host.ID().String()
+	assert.ErrorContains(t, validateValidatorRegistrationMessage(announce(&forged)), "published by")
+
+	forged = *registration
+	forged.Stake = 1000
+	assert.ErrorContains(t, validateValidatorRegistrationMessage(announce(&forged)), "invalid signature")
+
+	// A key of its own cannot announce another address
+	other, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	forged = ValidatorRegistration{Address: registration.Address, Stake: 100, PeerID: publisher.String()}
+	require.NoError(t, forged.Sign(other))
+	require.NoError(t, validateValidatorRegistrationMessage(announce(&forged)))
+	node.barNet.AddPeer(publisher, "")
+	node.handleValidatorRegistration(announce(&forged))
+	assert.Equal(t, 1, pomScore(node.barNet, publisher))
+	node.handleValidatorRegistration(announce(registration))
+	assert.Equal(t, 1, pomScore(node.barNet, publisher))
+}
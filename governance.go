@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBlockIntervalMs = 2000
+	DefaultMaxBlockSize    = 256 * 1024 * 1024 // 256MB
+	DefaultMaxBatchFee     = 1000
+
+	// GovernanceVotingEpochs is the number of full epochs after the submission
+	// epoch during which a proposal accepts votes.
+	GovernanceVotingEpochs = 1
+	// GovernanceQuorumPercent is the share of total stake that must vote for a tally to count.
+	GovernanceQuorumPercent = 34
+	// GovernanceThresholdPercent is the share of the voting stake a proposal must exceed to pass.
+	GovernanceThresholdPercent = 50
+
+	MaxProposalTitleLength       = 140
+	MaxProposalDescriptionLength = 2000
+
+	ProposalStatusVoting   = "voting"
+	ProposalStatusPassed   = "passed"
+	ProposalStatusRejected = "rejected"
+	ProposalStatusFailed   = "failed"
+
+	consensusParamsKey = "consensus_params"
+	proposalPrefix     = "gov_proposal_"
+	votePrefix         = "gov_vote_"
+)
+
+// ConsensusParams holds the protocol parameters that can be changed through
+// governance. Nodes read them at every epoch boundary.
+type ConsensusParams struct {
+	EpochLength       uint64 `json:"epoch_length"`
+	CommitteeSize     uint64 `json:"committee_size"`
+	BlockIntervalMs   uint64 `json:"block_interval_ms"`
+	MaxBlockSize      uint64 `json:"max_block_size"`
+	POMThreshold      uint64 `json:"pom_threshold"`
+	POMBanThreshold   uint64 `json:"pom_ban_threshold"`
+	MinTransactionFee uint64 `json:"min_transaction_fee"`
+	MaxBatchFee       uint64 `json:"max_batch_fee"`
+	BlockGasLimit     uint64 `json:"block_gas_limit"`
+	MinBaseFee        uint64 `json:"min_base_fee"`
+}
+
+// DefaultConsensusParams returns the parameters the chain starts with.
+func DefaultConsensusParams() ConsensusParams {
+	return ConsensusParams{
+		EpochLength:       EpochLength,
+		CommitteeSize:     CommitteeSize,
+		BlockIntervalMs:   DefaultBlockIntervalMs,
+		MaxBlockSize:      DefaultMaxBlockSize,
+		POMThreshold:      DefaultPOMThreshold,
+		POMBanThreshold:   DefaultPOMBanThreshold,
+		MinTransactionFee: 0,
+		MaxBatchFee:       DefaultMaxBatchFee,
+		BlockGasLimit:     DefaultBlockGasLimit,
+		MinBaseFee:        0,
+	}
+}
+
+// BlockInterval returns the block production interval.
+func (p ConsensusParams) BlockInterval() time.Duration {
+	return time.Duration(p.BlockIntervalMs) * time.Millisecond
+}
+
+// Validate checks that the parameters leave the chain in a workable state.
+func (p ConsensusParams) Validate() error {
+	if p.EpochLength == 0 {
+		return errors.New("epoch_length must be positive")
+	}
+	if p.CommitteeSize == 0 {
+		return errors.New("committee_size must be positive")
+	}
+	if p.BlockIntervalMs < 100 {
+		return errors.New("block_interval_ms must be at least 100")
+	}
+	if p.MaxBlockSize < 1024 || p.MaxBlockSize > DefaultMaxBlockSize {
+		return fmt.Errorf("max_block_size must be between 1024 and %d", DefaultMaxBlockSize)
+	}
+	if p.POMThreshold == 0 || p.POMBanThreshold < p.POMThreshold {
+		return errors.New("pom_threshold must be positive and not above pom_ban_threshold")
+	}
+	if p.MaxBatchFee == 0 {
+		return errors.New("max_batch_fee must be positive")
+	}
+	if p.BlockGasLimit < MinBlockGasLimit {
+		return fmt.Errorf("block_gas_limit must be at least %d", MinBlockGasLimit)
+	}
+	return nil
+}
+
+// ParamChange sets a single consensus parameter, named by its JSON field name.
+type ParamChange struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// WithChanges returns a copy of the parameters with the changes applied.
+func (p ConsensusParams) WithChanges(changes []ParamChange) (ConsensusParams, error) {
+	for _, c := range changes {
+		switch c.Name {
+		case "epoch_length":
+			p.EpochLength = c.Value
+		case "committee_size":
+			p.CommitteeSize = c.Value
+		case "block_interval_ms":
+			p.BlockIntervalMs = c.Value
+		case "max_block_size":
+			p.MaxBlockSize = c.Value
+		case "pom_threshold":
+			p.POMThreshold = c.Value
+		case "pom_ban_threshold":
+			p.POMBanThreshold = c.Value
+		case "min_transaction_fee":
+			p.MinTransactionFee = c.Value
+		case "max_batch_fee":
+			p.MaxBatchFee = c.Value
+		case "block_gas_limit":
+			p.BlockGasLimit = c.Value
+		case "min_base_fee":
+			p.MinBaseFee = c.Value
+		default:
+			return p, fmt.Errorf("unknown consensus parameter: %s", c.Name)
+		}
+	}
+	return p, p.Validate()
+}
+
+// ProposalPayload is the payload of a submit_proposal transaction.
+type ProposalPayload struct {
+	Title       string        `json:"title"`
+	Description string        `json:"description,omitempty"`
+	Changes     []ParamChange `json:"changes,omitempty"`
+	Upgrade     *UpgradePlan  `json:"upgrade,omitempty"`
+}
+
+// VotePayload is the payload of a vote transaction.
+type VotePayload struct {
+	ProposalID Hash `json:"proposalId"`
+	Approve    bool `json:"approve"`
+}
+
+// Proposal is a governance proposal as recorded on chain. Its ID is the hash
+// of the transaction that submitted it.
+type Proposal struct {
+	ID             Hash          `json:"id"`
+	Proposer       Address       `json:"proposer"`
+	Title          string        `json:"title"`
+	Description    string        `json:"description,omitempty"`
+	Changes        []ParamChange `json:"changes,omitempty"`
+	Upgrade        *UpgradePlan  `json:"upgrade,omitempty"`
+	SubmitEpoch    uint64        `json:"submitEpoch"`
+	VotingEndEpoch uint64        `json:"votingEndEpoch"`
+	Status         string        `json:"status"`
+	YesStake       uint64        `json:"yesStake"`
+	NoStake        uint64        `json:"noStake"`
+	TotalStake     uint64        `json:"totalStake"`
+	FailureReason  string        `json:"failureReason,omitempty"`
+}
+
+// validateProposal performs the stateless checks on a submit_proposal transaction.
+func validateProposal(tx *Transaction) error {
+	if tx.Proposal == nil {
+		return errors.New("proposal payload is missing")
+	}
+	if tx.Value != 0 {
+		return errors.New("governance transactions must not carry value")
+	}
+	if tx.Proposal.Title == "" || len(tx.Proposal.Title) > MaxProposalTitleLength {
+		return fmt.Errorf("proposal title must be 1-%d characters", MaxProposalTitleLength)
+	}
+	if len(tx.Proposal.Description) > MaxProposalDescriptionLength {
+		return fmt.Errorf("proposal description exceeds %d characters", MaxProposalDescriptionLength)
+	}
+	if len(tx.Proposal.Changes) == 0 && tx.Proposal.Upgrade == nil {
+		return errors.New("proposal must change a parameter or schedule an upgrade")
+	}
+	if tx.Proposal.Upgrade != nil {
+		if err := validateUpgradePlan(tx.Proposal.Upgrade); err != nil {
+			return fmt.Errorf("invalid upgrade plan: %w", err)
+		}
+	}
+	// The changes must be valid on their own; they are re-checked against the
+	// parameters in force when the proposal passes.
+	if _, err := DefaultConsensusParams().WithChanges(tx.Proposal.Changes); err != nil {
+		return fmt.Errorf("invalid parameter change: %w", err)
+	}
+	return nil
+}
+
+// validateVote performs the stateless checks on a vote transaction.
+func validateVote(tx *Transaction) error {
+	if tx.Vote == nil {
+		return errors.New("vote payload is missing")
+	}
+	if tx.Value != 0 {
+		return errors.New("governance transactions must not carry value")
+	}
+	return nil
+}
+
+// GetConsensusParams returns the parameters currently in force.
+func (vr *ValidatorRegistry) GetConsensusParams() ConsensusParams {
+	data, err := vr.store.Get([]byte(consensusParamsKey))
+	if err == nil {
+		// Parameters added after the record was written keep their defaults
+		params := DefaultConsensusParams()
+		if err := json.Unmarshal(data, &params); err == nil {
+			return params
+		}
+	}
+	return DefaultConsensusParams()
+}
+
+// SetConsensusParams replaces the parameters currently in force.
+func (vr *ValidatorRegistry) SetConsensusParams(params ConsensusParams) error {
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put([]byte(consensusParamsKey), data)
+}
+
+func (vr *ValidatorRegistry) proposalKey(id Hash) []byte {
+	return append([]byte(proposalPrefix), id[:]...)
+}
+
+func (vr *ValidatorRegistry) voteKey(id Hash, voter Address) []byte {
+	key := append([]byte(votePrefix), id[:]...)
+	return append(key, voter[:]...)
+}
+
+// PutProposal stores a proposal.
+func (vr *ValidatorRegistry) PutProposal(p *Proposal) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put(vr.proposalKey(p.ID), data)
+}
+
+// GetProposal returns a proposal by ID, or nil if it does not exist.
+func (vr *ValidatorRegistry) GetProposal(id Hash) (*Proposal, error) {
+	data, err := vr.store.Get(vr.proposalKey(id))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var p Proposal
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetProposals returns all proposals, oldest first.
+func (vr *ValidatorRegistry) GetProposals() ([]*Proposal, error) {
+	allData, err := vr.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	proposals := make([]*Proposal, 0)
+	for key, data := range allData {
+		if !strings.HasPrefix(key, proposalPrefix) {
+			continue
+		}
+		var p Proposal
+		if err := json.Unmarshal(data, &p); err != nil {
+			continue
+		}
+		proposals = append(proposals, &p)
+	}
+	sort.Slice(proposals, func(i, j int) bool {
+		if proposals[i].SubmitEpoch != proposals[j].SubmitEpoch {
+			return proposals[i].SubmitEpoch < proposals[j].SubmitEpoch
+		}
+		return bytes.Compare(proposals[i].ID[:], proposals[j].ID[:]) < 0
+	})
+	return proposals, nil
+}
+
+// RecordVote stores a validator's vote on a proposal. A later vote from the
+// same validator replaces the earlier one.
+func (vr *ValidatorRegistry) RecordVote(id Hash, voter Address, approve bool) error {
+	data, err := json.Marshal(approve)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put(vr.voteKey(id, voter), data)
+}
+
+// TallyProposals closes voting on every proposal whose voting period ends with
+// the given epoch. Votes are weighted by the voter's current stake plus
+// delegations; passed parameter changes are applied to the consensus
+// parameters in submission order, and passed upgrades are scheduled.
+func (vr *ValidatorRegistry) TallyProposals(ended EpochInfo) error {
+	proposals, err := vr.GetProposals()
+	if err != nil {
+		return err
+	}
+
+	var due []*Proposal
+	for _, p := range proposals {
+		if p.Status == ProposalStatusVoting && p.VotingEndEpoch <= ended.Number {
+			due = append(due, p)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	validators, err := vr.GetAllValidators()
+	if err != nil {
+		return err
+	}
+	weights := make(map[Address]uint64, len(validators))
+	var totalStake uint64
+	for _, v := range validators {
+		weights[v.Address] = v.Stake + v.DelegatedStake
+		totalStake += v.Stake + v.DelegatedStake
+	}
+
+	allData, err := vr.store.List()
+	if err != nil {
+		return err
+	}
+
+	params := vr.GetConsensusParams()
+	for _, p := range due {
+		prefix := string(append([]byte(votePrefix), p.ID[:]...))
+		p.YesStake, p.NoStake, p.TotalStake = 0, 0, totalStake
+		for key, data := range allData {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			var voter Address
+			copy(voter[:], key[len(prefix):])
+			var approve bool
+			if err := json.Unmarshal(data, &approve); err == nil {
+				if approve {
+					p.YesStake += weights[voter]
+				} else {
+					p.NoStake += weights[voter]
+				}
+			}
+			if err := vr.store.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		voted := p.YesStake + p.NoStake
+		switch {
+		case totalStake == 0 || voted*100 < totalStake*GovernanceQuorumPercent:
+			p.Status = ProposalStatusRejected
+			p.FailureReason = "quorum not reached"
+		case p.YesStake*100 <= voted*GovernanceThresholdPercent:
+			p.Status = ProposalStatusRejected
+		case p.Upgrade != nil && p.Upgrade.Height <= ended.EndHeight():
+			p.Status = ProposalStatusFailed
+			p.FailureReason = fmt.Sprintf("upgrade height %d has already been reached", p.Upgrade.Height)
+		default:
+			updated, err := params.WithChanges(p.Changes)
+			if err != nil {
+				p.Status = ProposalStatusFailed
+				p.FailureReason = err.Error()
+				break
+			}
+			if p.Upgrade != nil {
+				if err := vr.ScheduleUpgrade(*p.Upgrade); err != nil {
+					return err
+				}
+			}
+			params = updated
+			p.Status = ProposalStatusPassed
+		}
+		log.Printf("INFO: Governance proposal %s %s (yes %d, no %d, total %d)", p.ID.ToHex(), p.Status, p.YesStake, p.NoStake, p.TotalStake)
+
+		if err := vr.PutProposal(p); err != nil {
+			return err
+		}
+	}
+	return vr.SetConsensusParams(params)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type govTestValidator struct {
+	key  *btcec.PrivateKey
+	addr Address
+}
+
+func setupGovernanceTest(t *testing.T, stakes ...uint64) (*State, *ValidatorRegistry, *Blockchain, []govTestValidator) {
+	state := NewState()
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	bc, err := NewBlockchain(NewMemoryStore())
+	require.NoError(t, err)
+
+	vals := make([]govTestValidator, len(stakes))
+	for i, stake := range stakes {
+		key, _ := btcec.NewPrivateKey()
+		addr := pubKeyToAddress(key.PubKey())
+		require.NoError(t, vr.RegisterValidator(&Validator{Address: addr, Stake: stake, Participating: true}))
+		require.NoError(t, state.PutAccount(&Account{Address: addr, Balance: 100}))
+		vals[i] = govTestValidator{key: key, addr: addr}
+	}
+	return state, vr, bc, vals
+}
+
+func govTx(t *testing.T, state *State, v govTestValidator, tx *Transaction) *Transaction {
+	acc, _ := state.GetAccount(v.addr)
+	tx.From = v.addr
+	tx.To = v.addr
+	tx.Nonce = acc.Nonce + 1
+	tx.Fee = 1
+	tx.Timestamp = time.Now().UnixNano()
+	require.NoError(t, tx.Sign(v.key))
+	return tx
+}
+
+func applyAt(t *testing.T, bc *Blockchain, state *State, vr *ValidatorRegistry, height uint64, txs ...*Transaction) {
+	block := &Block{Header: &Header{BlockNumber: height, Gas: blockGas(txs)}, Transactions: txs}
+	require.NoError(t, bc.ApplyBlockWithRegistry(block, state, vr))
+}
+
+func TestConsensusParams_WithChanges(t *testing.T) {
+	params := DefaultConsensusParams()
+	require.NoError(t, params.Validate())
+
+	updated, err := params.WithChanges([]ParamChange{{Name: "epoch_length", Value: 10}, {Name: "min_transaction_fee", Value: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), updated.EpochLength)
+	assert.Equal(t, uint64(2), updated.MinTransactionFee)
+	assert.Equal(t, uint64(EpochLength), params.EpochLength, "original must be unchanged")
+
+	_, err = params.WithChanges([]ParamChange{{Name: "no_such_param", Value: 1}})
+	assert.Error(t, err)
+	_, err = params.WithChanges([]ParamChange{{Name: "committee_size", Value: 0}})
+	assert.Error(t, err)
+	_, err = params.WithChanges([]ParamChange{{Name: "pom_ban_threshold", Value: 1}})
+	assert.Error(t, err)
+}
+
+func TestGovernance_ParameterChangePasses(t *testing.T) {
+	state, vr, bc, vals := setupGovernanceTest(t, 100, 100, 100)
+
+	proposal := govTx(t, state, vals[0], &Transaction{
+		Type: "submit_proposal",
+		Proposal: &ProposalPayload{
+			Title:   "Shorter epochs",
+			Changes: []ParamChange{{Name: "epoch_length", Value: 10}},
+		},
+	})
+	applyAt(t, bc, state, vr, 1, proposal)
+
+	p, err := vr.GetProposal(proposal.Hash)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, ProposalStatusVoting, p.Status)
+	assert.Equal(t, uint64(1), p.VotingEndEpoch)
+
+	yes := govTx(t, state, vals[0], &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: proposal.Hash, Approve: true}})
+	yes2 := govTx(t, state, vals[1], &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: proposal.Hash, Approve: true}})
+	no := govTx(t, state, vals[2], &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: proposal.Hash, Approve: false}})
+	applyAt(t, bc, state, vr, 2, yes, yes2, no)
+
+	// Still open after the submission epoch ends
+	applyAt(t, bc, state, vr, EpochLength)
+	p, _ = vr.GetProposal(proposal.Hash)
+	assert.Equal(t, ProposalStatusVoting, p.Status)
+	assert.Equal(t, uint64(EpochLength), vr.GetConsensusParams().EpochLength)
+
+	// Tallied at the end of the voting epoch; the next epoch uses the new length
+	applyAt(t, bc, state, vr, 2*EpochLength)
+	p, _ = vr.GetProposal(proposal.Hash)
+	assert.Equal(t, ProposalStatusPassed, p.Status)
+	assert.Equal(t, uint64(200), p.YesStake)
+	assert.Equal(t, uint64(100), p.NoStake)
+	assert.Equal(t, uint64(300), p.TotalStake)
+	assert.Equal(t, uint64(10), vr.GetConsensusParams().EpochLength)
+	assert.Equal(t, EpochInfo{Number: 2, StartHeight: 2 * EpochLength, Length: 10}, vr.CurrentEpoch())
+
+	applyAt(t, bc, state, vr, 2*EpochLength+10)
+	assert.Equal(t, uint64(3), vr.CurrentEpoch().Number)
+}
+
+func TestGovernance_RejectedWithoutQuorum(t *testing.T) {
+	state, vr, bc, vals := setupGovernanceTest(t, 10, 100, 100)
+
+	proposal := govTx(t, state, vals[0], &Transaction{
+		Type: "submit_proposal",
+		Proposal: &ProposalPayload{
+			Title:   "Raise fees",
+			Changes: []ParamChange{{Name: "min_transaction_fee", Value: 5}},
+		},
+	})
+	applyAt(t, bc, state, vr, 1, proposal)
+	vote := govTx(t, state, vals[0], &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: proposal.Hash, Approve: true}})
+	applyAt(t, bc, state, vr, 2, vote)
+
+	require.NoError(t, processEpochTransition(1, vr))
+	require.NoError(t, processEpochTransition(2, vr))
+
+	p, _ := vr.GetProposal(proposal.Hash)
+	assert.Equal(t, ProposalStatusRejected, p.Status)
+	assert.Equal(t, uint64(0), vr.GetConsensusParams().MinTransactionFee)
+
+	// Votes on closed proposals are ignored
+	late := govTx(t, state, vals[1], &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: proposal.Hash, Approve: true}})
+	applyAt(t, bc, state, vr, 3, late)
+	p, _ = vr.GetProposal(proposal.Hash)
+	assert.Equal(t, ProposalStatusRejected, p.Status)
+}
+
+func TestGovernance_TransactionValidation(t *testing.T) {
+	state, priv, addr1, _ := setupTxPoolTest()
+	tp := NewTransactionPool()
+
+	bad := &Transaction{From: addr1, Nonce: 1, Type: "submit_proposal", Proposal: &ProposalPayload{
+		Title:   "Empty committee",
+		Changes: []ParamChange{{Name: "committee_size", Value: 0}},
+	}}
+	require.NoError(t, bad.Sign(priv))
+	assert.Error(t, tp.AddTransaction(bad, priv.PubKey(), state))
+
+	noVote := &Transaction{From: addr1, Nonce: 1, Type: "vote"}
+	require.NoError(t, noVote.Sign(priv))
+	assert.Error(t, tp.AddTransaction(noVote, priv.PubKey(), state))
+
+	// The governed minimum fee applies to every transaction type
+	tp.SetFeeRules(5, DefaultMaxBatchFee)
+	cheap := makePoolTestTx(addr1, Address{2}, 10, 1, priv)
+	assert.ErrorContains(t, tp.AddTransaction(cheap, priv.PubKey(), state), "below minimum")
+}
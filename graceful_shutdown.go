@@ -12,6 +12,8 @@ import (
 type ShutdownStatus struct {
 	Reason     string
 	Components map[string]string // component name -> status
+	Halted     bool              // block production stopped while the process keeps serving
+	Upgrade    *UpgradePlan      // upgrade the node halted for, if any
 }
 
 type GracefulShutdown struct {
@@ -69,6 +71,19 @@ func (gs *GracefulShutdown) Shutdown(reason string) {
 	log.Printf("GracefulShutdown: All components shut down. Reason: %s", reason)
 }
 
+// Halt records that block production has stopped for a scheduled upgrade. The
+// process and its API keep running so operators can see why the node stopped;
+// a later Shutdown stops the remaining components.
+func (gs *GracefulShutdown) Halt(reason string, upgrade *UpgradePlan) {
+	gs.statusMu.Lock()
+	gs.status.Reason = reason
+	gs.status.Halted = true
+	gs.status.Upgrade = upgrade
+	gs.status.Components["block-production"] = "halted"
+	gs.statusMu.Unlock()
+	log.Printf("GracefulShutdown: Block production halted. Reason: %s", reason)
+}
+
 // Status returns the current shutdown status
 func (gs *GracefulShutdown) Status() ShutdownStatus {
 	gs.statusMu.Lock()
@@ -35,3 +35,26 @@ func TestGracefulShutdown_Shutdown(t *testing.T) {
 		t.Errorf("componentB status wrong: %q", status.Components["componentB"])
 	}
 }
+
+func TestGracefulShutdown_HaltForUpgrade(t *testing.T) {
+	gs := NewGracefulShutdown()
+	called := false
+	gs.Register("componentA", func() error {
+		called = true
+		return nil
+	})
+
+	plan := &UpgradePlan{Name: "v2", Height: 100}
+	gs.Halt("upgrade \"v2\" required at height 100", plan)
+
+	if called {
+		t.Errorf("Halt must not stop registered components")
+	}
+	status := gs.Status()
+	if !status.Halted || status.Upgrade != plan {
+		t.Errorf("Halt status not recorded: %+v", status)
+	}
+	if status.Components["block-production"] != "halted" {
+		t.Errorf("block-production status wrong: %q", status.Components["block-production"])
+	}
+}
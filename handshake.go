@@ -7,19 +7,22 @@ import (
 	"log"
 	"time"
 
-	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 const (
-	HandshakeTopic = "/dyphira/handshake/v1"
-	PingTimeout    = 5 * time.Second
+	// HandshakeProtocol carries the ping of a handshake and its pong and ack
+	// on one stream between the two peers.
+	HandshakeProtocol = protocol.ID("/dyphira/handshake/1")
+	PingTimeout       = 5 * time.Second
 )
 
 // HandshakeMessage represents a handshake message
 type HandshakeMessage struct {
 	Type          string  `json:"type"` // "ping", "pong", or "ack"
-	From          peer.ID `json:"from"`
+	From          peer.ID `json:"from"` // Replaced on receipt by the peer at the other end of the stream
 	To            peer.ID `json:"to"`
 	Round         uint64  `json:"round"`
 	RoundSeed     []byte  `json:"round_seed"`
@@ -57,65 +60,59 @@ func (hm *HandshakeManager) Start(ctx context.Context) {
 		return
 	}
 
-	// Register handshake topic
-	hm.node.p2p.RegisterTopic(HandshakeTopic)
-
-	// Subscribe to handshake messages
-	hm.node.p2p.Subscribe(ctx, hm.handleHandshakeMessage)
+	// Answer pings from other peers
+	hm.node.p2p.SetStreamHandler(HandshakeProtocol, hm.handleStream)
 
 	// Start periodic handshake with greylist peers
 	go hm.handshakeLoop(ctx)
 }
 
-// handleHandshakeMessage handles incoming handshake messages
-func (hm *HandshakeManager) handleHandshakeMessage(topic string, msg *pubsub.Message) {
-	if topic != HandshakeTopic {
-		return
-	}
+// handleStream answers a ping with a pong and an ack. The sender is the peer
+// the stream is authenticated to, whatever the message says.
+func (hm *HandshakeManager) handleStream(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(PingTimeout))
 
-	// Check if P2P node is available (for tests)
-	if hm.node.p2p == nil {
+	from := stream.Conn().RemotePeer()
+	if status, ok := hm.node.barNet.GetPeerStatus(from); ok && status == PeerStatusBanned {
+		stream.Reset()
 		return
 	}
 
-	var handshakeMsg HandshakeMessage
-	if err := json.Unmarshal(msg.Data, &handshakeMsg); err != nil {
+	var ping HandshakeMessage
+	if err := json.NewDecoder(stream).Decode(&ping); err != nil {
 		log.Printf("BAR: Failed to decode handshake message: %v", err)
+		hm.node.barNet.UpdatePOMScore(from, 1, "malformed handshake message")
 		return
 	}
-
-	// Don't process our own messages
-	if handshakeMsg.From == hm.node.p2p.host.ID() {
+	ping.From = from
+	if ping.Type != "ping" {
+		hm.node.barNet.UpdatePOMScore(from, 1, "unexpected handshake message")
 		return
 	}
 
-	switch handshakeMsg.Type {
-	case "ping":
-		hm.handlePing(&handshakeMsg)
-	case "pong":
-		hm.handlePong(&handshakeMsg)
-	case "ack":
-		hm.handleAck(&handshakeMsg)
+	encoder := json.NewEncoder(stream)
+	for _, reply := range hm.handlePing(&ping) {
+		if err := encoder.Encode(reply); err != nil {
+			log.Printf("BAR: Failed to send %s to %s: %v", reply.Type, from, err)
+			return
+		}
 	}
 }
 
-// handlePing handles incoming ping messages
-func (hm *HandshakeManager) handlePing(ping *HandshakeMessage) {
+// handlePing checks an incoming ping and returns the pong and ack to answer
+// it with, or nothing if the ping is invalid
+func (hm *HandshakeManager) handlePing(ping *HandshakeMessage) []*HandshakeMessage {
 	// Check if P2P node is available (for tests)
 	if hm.node.p2p == nil {
-		return
-	}
-
-	// Verify the ping is for us
-	if ping.To != hm.node.p2p.host.ID() {
-		return
+		return nil
 	}
 
 	// Verify round seed is valid for this round
 	if !hm.verifyRoundSeed(ping.Round, ping.RoundSeed) {
 		log.Printf("BAR: Invalid round seed in ping from %s", ping.From)
 		hm.node.barNet.UpdatePOMScore(ping.From, 1, "invalid round seed")
-		return
+		return nil
 	}
 
 	// Verify that this peer is actually selected by our PRNG for this round
@@ -131,61 +128,30 @@ func (hm *HandshakeManager) handlePing(ping *HandshakeMessage) {
 	if !isSelected {
 		log.Printf("BAR: Peer %s not selected by PRNG for round %d", ping.From, ping.Round)
 		hm.node.barNet.UpdatePOMScore(ping.From, 1, "not selected by PRNG")
-		return
-	}
-
-	// Send pong response with full version info
-	pong := &HandshakeMessage{
-		Type:          "pong",
-		From:          hm.node.p2p.host.ID(),
-		To:            ping.From,
-		Round:         ping.Round,
-		RoundSeed:     ping.RoundSeed,
-		Timestamp:     time.Now().UnixNano(),
-		ClientVersion: "dyphira-v1.0",
-		AddrReceived:  ping.AddrFrom,
-		AddrFrom:      hm.node.p2p.GetListenAddr(),
-		LastRound:     hm.round,
-		Nonce:         hm.generateNonce(),
-	}
-
-	pongData, err := json.Marshal(pong)
-	if err != nil {
-		log.Printf("BAR: Failed to marshal pong: %v", err)
-		return
-	}
-
-	if err := hm.node.p2p.Publish(hm.node.ctx, HandshakeTopic, pongData); err != nil {
-		log.Printf("BAR: Failed to send pong: %v", err)
-		return
-	}
-
-	// Send ACK message to confirm successful handshake
-	ack := &HandshakeMessage{
-		Type:          "ack",
-		From:          hm.node.p2p.host.ID(),
-		To:            ping.From,
-		Round:         ping.Round,
-		RoundSeed:     ping.RoundSeed,
-		Timestamp:     time.Now().UnixNano(),
-		ClientVersion: "dyphira-v1.0",
-		AddrReceived:  ping.AddrFrom,
-		AddrFrom:      hm.node.p2p.GetListenAddr(),
-		LastRound:     hm.round,
-		Nonce:         hm.generateNonce(),
-	}
-
-	ackData, err := json.Marshal(ack)
-	if err != nil {
-		log.Printf("BAR: Failed to marshal ack: %v", err)
-		return
-	}
-
-	if err := hm.node.p2p.Publish(hm.node.ctx, HandshakeTopic, ackData); err != nil {
-		log.Printf("BAR: Failed to send ack: %v", err)
-	}
-
-	log.Printf("BAR: Sent pong and ack to peer %s for round %d", ping.From, ping.Round)
+		return nil
+	}
+
+	// Answer with a pong with full version info, and an ACK to confirm the
+	// successful handshake
+	replies := make([]*HandshakeMessage, 0, 2)
+	for _, replyType := range []string{"pong", "ack"} {
+		replies = append(replies, &HandshakeMessage{
+			Type:          replyType,
+			From:          hm.node.p2p.host.ID(),
+			To:            ping.From,
+			Round:         ping.Round,
+			RoundSeed:     ping.RoundSeed,
+			Timestamp:     time.Now().UnixNano(),
+			ClientVersion: "dyphira-v1.0",
+			AddrReceived:  ping.AddrFrom,
+			AddrFrom:      hm.node.p2p.GetListenAddr(),
+			LastRound:     hm.round,
+			Nonce:         hm.generateNonce(),
+		})
+	}
+
+	log.Printf("BAR: Sending pong and ack to peer %s for round %d", ping.From, ping.Round)
+	return replies
 }
 
 // handlePong handles incoming pong messages
@@ -195,11 +161,6 @@ func (hm *HandshakeManager) handlePong(pong *HandshakeMessage) {
 		return
 	}
 
-	// Verify the pong is for us
-	if pong.To != hm.node.p2p.host.ID() {
-		return
-	}
-
 	// Verify round seed is valid
 	if !hm.verifyRoundSeed(pong.Round, pong.RoundSeed) {
 		log.Printf("BAR: Invalid round seed in pong from %s", pong.From)
@@ -238,11 +199,6 @@ func (hm *HandshakeManager) handleAck(ack *HandshakeMessage) {
 		return
 	}
 
-	// Verify the ack is for us
-	if ack.To != hm.node.p2p.host.ID() {
-		return
-	}
-
 	// Verify round seed is valid
 	if !hm.verifyRoundSeed(ack.Round, ack.RoundSeed) {
 		log.Printf("BAR: Invalid round seed in ack from %s", ack.From)
@@ -260,7 +216,8 @@ func (hm *HandshakeManager) handleAck(ack *HandshakeMessage) {
 	log.Printf("BAR: Received ack from peer %s for round %d", ack.From, ack.Round)
 }
 
-// SendPing sends a ping to a specific peer
+// SendPing sends a ping to a specific peer over a HandshakeProtocol stream
+// and handles its pong and ack
 func (hm *HandshakeManager) SendPing(peerID peer.ID) error {
 	// Check if P2P node is available (for tests)
 	if hm.node.p2p == nil {
@@ -281,12 +238,49 @@ func (hm *HandshakeManager) SendPing(peerID peer.ID) error {
 		Nonce:         hm.generateNonce(),
 	}
 
-	pingData, err := json.Marshal(ping)
+	ctx, cancel := context.WithTimeout(hm.node.ctx, PingTimeout)
+	defer cancel()
+	stream, err := hm.node.p2p.NewStream(ctx, peerID, HandshakeProtocol)
 	if err != nil {
-		return fmt.Errorf("failed to marshal ping: %v", err)
+		return err
 	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(ping); err != nil {
+		return fmt.Errorf("failed to send ping: %v", err)
+	}
+	stream.CloseWrite()
 
-	return hm.node.p2p.Publish(hm.node.ctx, HandshakeTopic, pingData)
+	decoder := json.NewDecoder(stream)
+	pong, err := hm.readReply(decoder, peerID, "pong")
+	if err != nil {
+		return err
+	}
+	hm.handlePong(pong)
+	ack, err := hm.readReply(decoder, peerID, "ack")
+	if err != nil {
+		return err
+	}
+	hm.handleAck(ack)
+	return nil
+}
+
+// readReply reads the next reply of a handshake from the peer at the other
+// end of the stream, which must be of the wanted type
+func (hm *HandshakeManager) readReply(decoder *json.Decoder, from peer.ID, want string) (*HandshakeMessage, error) {
+	var reply HandshakeMessage
+	if err := decoder.Decode(&reply); err != nil {
+		return nil, fmt.Errorf("no %s from %s: %v", want, from, err)
+	}
+	reply.From = from
+	if reply.Type != want {
+		hm.node.barNet.UpdatePOMScore(from, 1, "unexpected handshake message")
+		return nil, fmt.Errorf("expected %s from %s, got %q", want, from, reply.Type)
+	}
+	return &reply, nil
 }
 
 // handshakeLoop periodically performs handshakes with greylist peers
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -232,3 +234,70 @@ func TestHandshakeManager_MessageTypes(t *testing.T) {
 	assert.Equal(t, "pong", pong.Type)
 	assert.Equal(t, "ack", ack.Type)
 }
+
+// randomPeerID returns the ID of a peer that does not exist.
+func randomPeerID(t *testing.T) peer.ID {
+	_, pub, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+	return id
+}
+
+// newHandshakeTest builds two connected nodes with handshake managers on the
+// same round. The server whitelists the client; the client greylists the server.
+func newHandshakeTest(t *testing.T, ctx context.Context) (server, client *AppNode) {
+	server, client = newSyncTestNode(t, ctx), newSyncTestNode(t, ctx)
+	// Round seeds are derived from the PRNG seed, which peers must share
+	server.barNet.prngSeed = client.barNet.prngSeed
+	for _, node := range []*AppNode{server, client} {
+		node.handshakeManager = NewHandshakeManager(node)
+		node.handshakeManager.Start(ctx)
+		node.handshakeManager.UpdateRound(1)
+	}
+	connectSyncPeer(t, ctx, server, client)
+	client.barNet.AddPeer(server.p2p.host.ID(), "")
+	return server, client
+}
+
+func TestHandshakeManager_HandshakeOverStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newHandshakeTest(t, ctx)
+	serverID := server.p2p.host.ID()
+	require.NoError(t, client.handshakeManager.SendPing(serverID))
+	status, ok := client.barNet.GetPeerStatus(serverID)
+	require.True(t, ok)
+	assert.Equal(t, PeerStatusWhitelist, status)
+}
+
+func TestHandshakeManager_SenderFromConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newHandshakeTest(t, ctx)
+	clientID := client.p2p.host.ID()
+	require.True(t, server.barNet.DemoteToGreylist(clientID))
+
+	// The client claims to be a whitelisted peer, but is answered as itself
+	victim := randomPeerID(t)
+	server.barNet.AddPeer(victim, "")
+	require.True(t, server.barNet.PromoteToWhitelist(victim))
+	stream, err := client.p2p.NewStream(ctx, server.p2p.host.ID(), HandshakeProtocol)
+	require.NoError(t, err)
+	defer stream.Close()
+	require.NoError(t, json.NewEncoder(stream).Encode(&HandshakeMessage{
+		Type:          "ping",
+		From:          victim,
+		Round:         1,
+		RoundSeed:     client.handshakeManager.roundSeed,
+		ClientVersion: "dyphira-v1.0",
+	}))
+	stream.CloseWrite()
+	var reply HandshakeMessage
+	assert.Error(t, json.NewDecoder(stream).Decode(&reply), "no pong for a peer not selected")
+
+	assert.Equal(t, 1, pomScore(server.barNet, clientID))
+	assert.Equal(t, 0, pomScore(server.barNet, victim))
+}
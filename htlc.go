@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	MaxHTLCPreimageLength = 256
+
+	HTLCStatusLocked   = "locked"
+	HTLCStatusClaimed  = "claimed"
+	HTLCStatusRefunded = "refunded"
+
+	// HTLCs are stored in the state trie under the prefix followed by the hash lock
+	htlcKeyPrefix = "htlc:"
+)
+
+// HTLCPayload is the payload of the htlc_lock, htlc_claim and htlc_refund
+// transactions. The hash lock is the SHA-256 of the preimage, as used by the
+// chains we swap with, and identifies the HTLC.
+type HTLCPayload struct {
+	HashLock      Hash   `json:"hashLock"`
+	TimeoutHeight uint64 `json:"timeoutHeight,omitempty"` // htlc_lock only
+	Preimage      []byte `json:"preimage,omitempty"`      // htlc_claim only
+}
+
+// HTLC is a hash time-locked transfer held in escrow. The recipient can claim
+// it with the preimage before the timeout height; from the timeout height on
+// the sender can take it back.
+type HTLC struct {
+	HashLock      Hash    `json:"hashLock"`
+	Sender        Address `json:"sender"`
+	Recipient     Address `json:"recipient"`
+	Amount        uint64  `json:"amount"`
+	TimeoutHeight uint64  `json:"timeoutHeight"`
+	Status        string  `json:"status"`
+	Preimage      []byte  `json:"preimage,omitempty"`
+	LockTx        Hash    `json:"lockTx"`
+}
+
+func htlcKey(hashLock Hash) []byte {
+	return append([]byte(htlcKeyPrefix), hashLock[:]...)
+}
+
+// validateHTLC performs the stateless checks on an HTLC transaction.
+func validateHTLC(tx *Transaction) error {
+	if tx.HTLC == nil {
+		return fmt.Errorf("%s transaction missing htlc payload", tx.Type)
+	}
+	switch tx.Type {
+	case "htlc_lock":
+		if tx.Value == 0 {
+			return errors.New("htlc amount must be positive")
+		}
+		if tx.HTLC.TimeoutHeight == 0 {
+			return errors.New("htlc timeout height must be positive")
+		}
+		if tx.HTLC.HashLock == (Hash{}) {
+			return errors.New("htlc hash lock missing")
+		}
+	case "htlc_claim":
+		if len(tx.HTLC.Preimage) == 0 || len(tx.HTLC.Preimage) > MaxHTLCPreimageLength {
+			return fmt.Errorf("htlc preimage must be 1-%d bytes", MaxHTLCPreimageLength)
+		}
+		fallthrough
+	default:
+		if tx.Value != 0 {
+			return fmt.Errorf("%s transactions must not carry value", tx.Type)
+		}
+	}
+	return nil
+}
+
+// checkHTLC checks an HTLC transaction against the escrow state at height.
+func checkHTLC(state *State, tx *Transaction, height uint64) error {
+	existing, err := state.GetHTLC(tx.HTLC.HashLock)
+	if err != nil {
+		return err
+	}
+	if tx.Type == "htlc_lock" {
+		if existing != nil {
+			return fmt.Errorf("htlc %s already exists", tx.HTLC.HashLock.ToHex())
+		}
+		if tx.HTLC.TimeoutHeight <= height {
+			return fmt.Errorf("htlc timeout height %d has already passed", tx.HTLC.TimeoutHeight)
+		}
+		return nil
+	}
+
+	if existing == nil {
+		return fmt.Errorf("unknown htlc %s", tx.HTLC.HashLock.ToHex())
+	}
+	if existing.Status != HTLCStatusLocked {
+		return fmt.Errorf("htlc %s is already %s", tx.HTLC.HashLock.ToHex(), existing.Status)
+	}
+	switch tx.Type {
+	case "htlc_claim":
+		if height >= existing.TimeoutHeight {
+			return fmt.Errorf("htlc %s timed out at height %d", tx.HTLC.HashLock.ToHex(), existing.TimeoutHeight)
+		}
+		digest := sha256.Sum256(tx.HTLC.Preimage)
+		if !bytes.Equal(digest[:], existing.HashLock[:]) {
+			return errors.New("htlc preimage does not match the hash lock")
+		}
+	case "htlc_refund":
+		if height < existing.TimeoutHeight {
+			return fmt.Errorf("htlc %s cannot be refunded before height %d", tx.HTLC.HashLock.ToHex(), existing.TimeoutHeight)
+		}
+	}
+	return nil
+}
+
+// GetHTLC returns the HTLC with the given hash lock, or nil if there is none.
+func (s *State) GetHTLC(hashLock Hash) (*HTLC, error) {
+	data, found := s.Trie.Get(htlcKey(hashLock))
+	if !found {
+		return nil, nil
+	}
+	var htlc HTLC
+	if err := json.Unmarshal(data, &htlc); err != nil {
+		return nil, err
+	}
+	return &htlc, nil
+}
+
+// PutHTLC stores an HTLC in the trie.
+func (s *State) PutHTLC(htlc *HTLC) error {
+	data, err := json.Marshal(htlc)
+	if err != nil {
+		return err
+	}
+	s.Trie.Insert(htlcKey(htlc.HashLock), data)
+	return nil
+}
+
+// GetHTLCsByAddress returns the HTLCs an address sent or can claim, ordered by
+// timeout height.
+func (s *State) GetHTLCsByAddress(addr Address) ([]*HTLC, error) {
+	var htlcs []*HTLC
+	for _, kv := range s.Trie.PrefixScan([]byte(htlcKeyPrefix)) {
+		var htlc HTLC
+		if err := json.Unmarshal(kv.Value, &htlc); err != nil {
+			return nil, err
+		}
+		if htlc.Sender == addr || htlc.Recipient == addr {
+			htlcs = append(htlcs, &htlc)
+		}
+	}
+	sort.SliceStable(htlcs, func(i, j int) bool { return htlcs[i].TimeoutHeight < htlcs[j].TimeoutHeight })
+	return htlcs, nil
+}
+
+// applyHTLCTransaction moves funds into or out of escrow. The transaction has
+// already been checked by ApplyTransaction, which debited the locked amount
+// from the sender of an htlc_lock.
+func (s *State) applyHTLCTransaction(tx *Transaction) error {
+	if tx.Type == "htlc_lock" {
+		return s.PutHTLC(&HTLC{
+			HashLock:      tx.HTLC.HashLock,
+			Sender:        tx.From,
+			Recipient:     tx.To,
+			Amount:        tx.Value,
+			TimeoutHeight: tx.HTLC.TimeoutHeight,
+			Status:        HTLCStatusLocked,
+			LockTx:        tx.Hash,
+		})
+	}
+
+	htlc, err := s.GetHTLC(tx.HTLC.HashLock)
+	if err != nil {
+		return err
+	}
+	payee := htlc.Sender
+	if tx.Type == "htlc_claim" {
+		payee = htlc.Recipient
+		htlc.Status = HTLCStatusClaimed
+		htlc.Preimage = tx.HTLC.Preimage
+	} else {
+		htlc.Status = HTLCStatusRefunded
+	}
+	acc, err := s.GetAccount(payee)
+	if err != nil {
+		return err
+	}
+	acc.Balance += htlc.Amount
+	if err := s.PutAccount(acc); err != nil {
+		return err
+	}
+	return s.PutHTLC(htlc)
+}
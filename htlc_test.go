@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lockTestHTLC(t *testing.T, state *State, sender, recipient tokenTestAccount, preimage []byte, timeout uint64) Hash {
+	hashLock := Hash(sha256.Sum256(preimage))
+	lock := tokenTx(t, state, sender, &Transaction{
+		To:    recipient.addr,
+		Value: 50,
+		Type:  "htlc_lock",
+		HTLC:  &HTLCPayload{HashLock: hashLock, TimeoutHeight: timeout},
+	})
+	require.NoError(t, state.ApplyTransaction(lock))
+	return hashLock
+}
+
+func TestHTLC_Claim(t *testing.T) {
+	state := NewState()
+	sender := newTokenTestAccount(t, state, 100)
+	recipient := newTokenTestAccount(t, state, 10)
+	state.SetHeight(5)
+	hashLock := lockTestHTLC(t, state, sender, recipient, []byte("secret"), 20)
+
+	acc, _ := state.GetAccount(sender.addr)
+	assert.Equal(t, uint64(49), acc.Balance, "amount and fee leave the sender")
+	htlc, err := state.GetHTLC(hashLock)
+	require.NoError(t, err)
+	assert.Equal(t, HTLCStatusLocked, htlc.Status)
+	assert.Equal(t, uint64(50), htlc.Amount)
+
+	wrong := tokenTx(t, state, recipient, &Transaction{Type: "htlc_claim", HTLC: &HTLCPayload{HashLock: hashLock, Preimage: []byte("guess")}})
+	assert.ErrorContains(t, state.ApplyTransaction(wrong), "does not match")
+
+	// Refunds are not possible before the timeout
+	early := tokenTx(t, state, sender, &Transaction{Type: "htlc_refund", HTLC: &HTLCPayload{HashLock: hashLock}})
+	assert.ErrorContains(t, state.ApplyTransaction(early), "cannot be refunded before")
+
+	claim := tokenTx(t, state, recipient, &Transaction{Type: "htlc_claim", HTLC: &HTLCPayload{HashLock: hashLock, Preimage: []byte("secret")}})
+	require.NoError(t, state.ApplyTransaction(claim))
+
+	acc, _ = state.GetAccount(recipient.addr)
+	assert.Equal(t, uint64(59), acc.Balance)
+	htlc, _ = state.GetHTLC(hashLock)
+	assert.Equal(t, HTLCStatusClaimed, htlc.Status)
+	assert.Equal(t, []byte("secret"), htlc.Preimage, "the preimage is published for the other chain")
+
+	again := tokenTx(t, state, recipient, &Transaction{Type: "htlc_claim", HTLC: &HTLCPayload{HashLock: hashLock, Preimage: []byte("secret")}})
+	assert.ErrorContains(t, state.ApplyTransaction(again), "already claimed")
+}
+
+func TestHTLC_RefundAfterTimeout(t *testing.T) {
+	state := NewState()
+	sender := newTokenTestAccount(t, state, 100)
+	recipient := newTokenTestAccount(t, state, 10)
+	state.SetHeight(5)
+	hashLock := lockTestHTLC(t, state, sender, recipient, []byte("secret"), 20)
+
+	// A second lock with the same hash is rejected
+	dup := tokenTx(t, state, sender, &Transaction{
+		To: recipient.addr, Value: 1, Type: "htlc_lock",
+		HTLC: &HTLCPayload{HashLock: hashLock, TimeoutHeight: 30},
+	})
+	assert.ErrorContains(t, state.ApplyTransaction(dup), "already exists")
+
+	state.SetHeight(20)
+	late := tokenTx(t, state, recipient, &Transaction{Type: "htlc_claim", HTLC: &HTLCPayload{HashLock: hashLock, Preimage: []byte("secret")}})
+	assert.ErrorContains(t, state.ApplyTransaction(late), "timed out")
+
+	refund := tokenTx(t, state, sender, &Transaction{Type: "htlc_refund", HTLC: &HTLCPayload{HashLock: hashLock}})
+	require.NoError(t, state.ApplyTransaction(refund))
+
+	acc, _ := state.GetAccount(sender.addr)
+	assert.Equal(t, uint64(98), acc.Balance, "only the two fees are spent")
+	htlc, _ := state.GetHTLC(hashLock)
+	assert.Equal(t, HTLCStatusRefunded, htlc.Status)
+}
+
+func TestHTLC_PoolChecksNextBlock(t *testing.T) {
+	state := NewState()
+	sender := newTokenTestAccount(t, state, 100)
+	recipient := newTokenTestAccount(t, state, 10)
+	state.SetHeight(5)
+	hashLock := lockTestHTLC(t, state, sender, recipient, []byte("secret"), 7)
+	tp := NewTransactionPool()
+
+	expired := tokenTx(t, state, sender, &Transaction{
+		To: recipient.addr, Value: 1, Type: "htlc_lock",
+		HTLC: &HTLCPayload{HashLock: Hash{1}, TimeoutHeight: 6},
+	})
+	assert.ErrorContains(t, tp.AddTransaction(expired, sender.key.PubKey(), state), "already passed")
+
+	claim := tokenTx(t, state, recipient, &Transaction{Type: "htlc_claim", HTLC: &HTLCPayload{HashLock: hashLock, Preimage: []byte("secret")}})
+	require.NoError(t, tp.AddTransaction(claim, recipient.key.PubKey(), state))
+}
+
+func TestAPIServer_HTLCEndpoints(t *testing.T) {
+	state := NewState()
+	sender := newTokenTestAccount(t, state, 100)
+	recipient := newTokenTestAccount(t, state, 10)
+	hashLock := lockTestHTLC(t, state, sender, recipient, []byte("secret"), 20)
+	api := &APIServer{node: &AppNode{state: state}}
+
+	w := httptest.NewRecorder()
+	api.handleHTLC(w, httptest.NewRequest(http.MethodGet, "/htlcs/"+hashLock.ToHex(), nil))
+	var response struct {
+		Success bool
+		Data    HTLC
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, recipient.addr, response.Data.Recipient)
+
+	w = httptest.NewRecorder()
+	api.handleHTLC(w, httptest.NewRequest(http.MethodGet, "/htlcs/"+Hash{}.ToHex(), nil))
+	assert.Contains(t, w.Body.String(), "HTLC not found")
+
+	w = httptest.NewRecorder()
+	api.handleHTLCs(w, httptest.NewRequest(http.MethodGet, "/htlcs?address="+recipient.addr.ToHex(), nil))
+	var list struct {
+		Success bool
+		Data    []HTLC
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+}
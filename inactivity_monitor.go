@@ -8,20 +8,24 @@ import (
 	"sync"
 	"time"
 
-	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 const (
-	InactivityTopic         = "/dyphira/inactivity/v1"
-	InactivityTimeout       = 5 * time.Minute // Time after which a peer is considered inactive
-	InactivityCheckInterval = 1 * time.Minute // How often to check for inactivity
+	// InactivityProtocol carries one inactivity message per stream, from the
+	// peer that opened it.
+	InactivityProtocol      = protocol.ID("/dyphira/inactivity/1")
+	InactivityTimeout       = 5 * time.Minute  // Time after which a peer is considered inactive
+	InactivityCheckInterval = 1 * time.Minute  // How often to check for inactivity
+	inactivityStreamTimeout = 10 * time.Second // Time to send or read one message
 )
 
 // InactivityMessage represents an inactivity marking message
 type InactivityMessage struct {
 	Type          string   `json:"type"` // "mark_inactive", "inactivity_report"
-	From          peer.ID  `json:"from"`
+	From          peer.ID  `json:"from"` // Replaced on receipt by the peer at the other end of the stream
 	To            peer.ID  `json:"to"`
 	TargetPeer    peer.ID  `json:"target_peer"`
 	Timestamp     int64    `json:"timestamp"`
@@ -77,11 +81,8 @@ func (im *InactivityMonitor) Start(ctx context.Context) {
 		return
 	}
 
-	// Register inactivity topic
-	im.node.p2p.RegisterTopic(InactivityTopic)
-
-	// Subscribe to inactivity messages
-	im.node.p2p.Subscribe(ctx, im.handleInactivityMessage)
+	// Receive inactivity messages from other peers
+	im.node.p2p.SetStreamHandler(InactivityProtocol, im.handleStream)
 
 	// Start monitoring loop if this is a seed node
 	if im.isSeedNode {
@@ -198,13 +199,7 @@ func (im *InactivityMonitor) reportInactivity(peerID peer.ID, reason string, evi
 			Evidence:      evidence,
 		}
 
-		reportData, err := json.Marshal(report)
-		if err != nil {
-			log.Printf("BAR: Failed to marshal inactivity report: %v", err)
-			continue
-		}
-
-		if err := im.node.p2p.Publish(im.node.ctx, InactivityTopic, reportData); err != nil {
+		if err := im.sendInactivityMessage(seedNode.ID, report); err != nil {
 			log.Printf("BAR: Failed to send inactivity report to %s: %v", seedNode.ID, err)
 			continue
 		}
@@ -213,28 +208,41 @@ func (im *InactivityMonitor) reportInactivity(peerID peer.ID, reason string, evi
 	}
 }
 
-// handleInactivityMessage handles incoming inactivity messages
-func (im *InactivityMonitor) handleInactivityMessage(topic string, msg *pubsub.Message) {
-	if topic != InactivityTopic {
-		return
+// sendInactivityMessage sends one inactivity message to a peer over an
+// InactivityProtocol stream
+func (im *InactivityMonitor) sendInactivityMessage(to peer.ID, msg *InactivityMessage) error {
+	ctx, cancel := context.WithTimeout(im.node.ctx, inactivityStreamTimeout)
+	defer cancel()
+	stream, err := im.node.p2p.NewStream(ctx, to, InactivityProtocol)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
 	}
+	return json.NewEncoder(stream).Encode(msg)
+}
 
-	// Check if P2P node is available (for tests)
-	if im.node.p2p == nil {
+// handleStream handles an incoming inactivity message. The sender is the peer
+// the stream is authenticated to, whatever the message says.
+func (im *InactivityMonitor) handleStream(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(inactivityStreamTimeout))
+
+	from := stream.Conn().RemotePeer()
+	if status, ok := im.node.barNet.GetPeerStatus(from); ok && status == PeerStatusBanned {
+		stream.Reset()
 		return
 	}
 
 	var inactivityMsg InactivityMessage
-	if err := json.Unmarshal(msg.Data, &inactivityMsg); err != nil {
+	if err := json.NewDecoder(stream).Decode(&inactivityMsg); err != nil {
 		log.Printf("BAR: Failed to decode inactivity message: %v", err)
-		im.node.barNet.UpdatePOMScore(msg.ReceivedFrom, 1, "malformed inactivity message")
-		return
-	}
-
-	// Don't process our own messages
-	if inactivityMsg.From == im.node.p2p.host.ID() {
+		im.node.barNet.UpdatePOMScore(from, 1, "malformed inactivity message")
 		return
 	}
+	inactivityMsg.From = from
 
 	switch inactivityMsg.Type {
 	case "mark_inactive":
@@ -251,11 +259,6 @@ func (im *InactivityMonitor) handleMarkInactive(markMsg *InactivityMessage) {
 		return
 	}
 
-	// Verify the message is for us
-	if markMsg.To != im.node.p2p.host.ID() {
-		return
-	}
-
 	// Only seed nodes should receive these messages
 	if !im.isSeedNode {
 		log.Printf("BAR: Received inactivity mark from non-seed node %s", markMsg.From)
@@ -282,11 +285,6 @@ func (im *InactivityMonitor) handleInactivityReport(reportMsg *InactivityMessage
 		return
 	}
 
-	// Verify the message is for us
-	if reportMsg.To != im.node.p2p.host.ID() {
-		return
-	}
-
 	log.Printf("BAR: Received inactivity report for peer %s from %s",
 		reportMsg.TargetPeer, reportMsg.From)
 
@@ -374,7 +372,7 @@ func (im *InactivityMonitor) markPeerAsInactive(peerID peer.ID) {
 	im.broadcastInactivityReport(peerID)
 }
 
-// broadcastInactivityReport broadcasts an inactivity report to all peers
+// broadcastInactivityReport sends an inactivity report to all peers
 func (im *InactivityMonitor) broadcastInactivityReport(peerID peer.ID) {
 	im.recordsMu.RLock()
 	record, exists := im.records[peerID]
@@ -384,26 +382,25 @@ func (im *InactivityMonitor) broadcastInactivityReport(peerID peer.ID) {
 		return
 	}
 
-	report := &InactivityMessage{
-		Type:          "inactivity_report",
-		From:          im.node.p2p.host.ID(),
-		To:            "", // Broadcast to all
-		TargetPeer:    peerID,
-		Timestamp:     time.Now().UnixNano(),
-		ClientVersion: "dyphira-v1.0",
-		Reason:        fmt.Sprintf("marked inactive by %d seed nodes", len(record.Reporters)),
-		Evidence:      record.Evidence,
-	}
-
-	reportData, err := json.Marshal(report)
-	if err != nil {
-		log.Printf("BAR: Failed to marshal inactivity report: %v", err)
-		return
-	}
-
-	if err := im.node.p2p.Publish(im.node.ctx, InactivityTopic, reportData); err != nil {
-		log.Printf("BAR: Failed to broadcast inactivity report: %v", err)
-		return
+	// Send the report to every peer that is not banned
+	peers := append(im.node.barNet.GetWhitelist(), im.node.barNet.GetGreylist()...)
+	for _, peerInfo := range peers {
+		if peerInfo.ID == peerID {
+			continue
+		}
+		report := &InactivityMessage{
+			Type:          "inactivity_report",
+			From:          im.node.p2p.host.ID(),
+			To:            peerInfo.ID,
+			TargetPeer:    peerID,
+			Timestamp:     time.Now().UnixNano(),
+			ClientVersion: "dyphira-v1.0",
+			Reason:        fmt.Sprintf("marked inactive by %d seed nodes", len(record.Reporters)),
+			Evidence:      record.Evidence,
+		}
+		if err := im.sendInactivityMessage(peerInfo.ID, report); err != nil {
+			log.Printf("BAR: Failed to send inactivity report to %s: %v", peerInfo.ID, err)
+		}
 	}
 
 	log.Printf("BAR: Broadcasted inactivity report for peer %s", peerID)
@@ -278,3 +278,40 @@ func TestInactivityMonitor_Integration(t *testing.T) {
 	allPeers := im.node.barNet.GetAllPeers()
 	assert.NotNil(t, allPeers) // Should be empty but not nil
 }
+
+func TestInactivityMonitor_ReportsOverStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	seed, reporter := newSyncTestNode(t, ctx), newSyncTestNode(t, ctx)
+	seed.inactivityMonitor = NewInactivityMonitor(seed, true)
+	seed.inactivityMonitor.Start(ctx)
+	defer seed.inactivityMonitor.Stop()
+	reporter.inactivityMonitor = NewInactivityMonitor(reporter, true)
+	connectSyncPeer(t, ctx, reporter, seed)
+
+	target := randomPeerID(t)
+	reporter.inactivityMonitor.reportInactivity(target, "no recent activity", []string{"timeout"})
+	assert.Eventually(t, func() bool {
+		_, ok := seed.inactivityMonitor.GetInactivityRecord(target)
+		return ok
+	}, 5*time.Second, 20*time.Millisecond)
+	record, _ := seed.inactivityMonitor.GetInactivityRecord(target)
+	assert.Equal(t, []peer.ID{reporter.p2p.host.ID()}, record.Reporters)
+
+	// A reporter cannot speak for other seed nodes
+	forged := randomPeerID(t)
+	require.NoError(t, reporter.inactivityMonitor.sendInactivityMessage(seed.p2p.host.ID(), &InactivityMessage{
+		Type:       "mark_inactive",
+		From:       forged,
+		To:         seed.p2p.host.ID(),
+		TargetPeer: target,
+		Reason:     "no recent activity",
+	}))
+	assert.Eventually(t, func() bool {
+		record, _ := seed.inactivityMonitor.GetInactivityRecord(target)
+		return record.ReportCount == 2
+	}, 5*time.Second, 20*time.Millisecond)
+	record, _ = seed.inactivityMonitor.GetInactivityRecord(target)
+	assert.Equal(t, []peer.ID{reporter.p2p.host.ID()}, record.Reporters)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// Keys bound by rotate_key are stored in the state trie under the prefix
+// followed by the address
+const accountKeyPrefix = "akey:"
+
+// keyRotationDomain separates key rotation proofs from other signatures.
+var keyRotationDomain = []byte("dyphira/rotate_key/v1")
+
+// KeyRotation is the payload of a rotate_key transaction. The transaction is
+// signed with the address's current key; Proof is the new key's signature over
+// keyRotationHash, showing that the sender holds it.
+type KeyRotation struct {
+	PubKey []byte `json:"pubKey"` // Compressed secp256k1 key
+	Proof  []byte `json:"proof"`
+}
+
+func accountKeyKey(addr Address) []byte {
+	return append([]byte(accountKeyPrefix), addr[:]...)
+}
+
+// keyRotationHash is the message the new key signs. It commits to the address
+// and the nonce of the rotation, so a proof cannot be replayed to bind the key
+// to another address or again after a later rotation.
+func keyRotationHash(addr Address, nonce uint64) Hash {
+	msg := append([]byte{}, keyRotationDomain...)
+	msg = append(msg, addr[:]...)
+	msg = binary.BigEndian.AppendUint64(msg, nonce)
+	return sha3.Sum256(msg)
+}
+
+// NewKeyRotation builds the payload of the rotate_key transaction with the
+// given nonce that binds newKey to addr.
+func NewKeyRotation(addr Address, nonce uint64, newKey *btcec.PrivateKey) *KeyRotation {
+	hash := keyRotationHash(addr, nonce)
+	return &KeyRotation{
+		PubKey: newKey.PubKey().SerializeCompressed(),
+		Proof:  ecdsa.Sign(newKey, hash[:]).Serialize(),
+	}
+}
+
+// validateKeyRotation performs the stateless checks on a rotate_key transaction.
+func validateKeyRotation(tx *Transaction) error {
+	if tx.KeyRotation == nil {
+		return errors.New("rotate_key transaction missing key rotation payload")
+	}
+	if tx.Value != 0 {
+		return errors.New("rotate_key transactions must not carry value")
+	}
+	if tx.Multisig != nil {
+		return errors.New("multisig accounts cannot rotate to a single key")
+	}
+	pub, err := btcec.ParsePubKey(tx.KeyRotation.PubKey)
+	if err != nil {
+		return fmt.Errorf("invalid new public key: %w", err)
+	}
+	hash := keyRotationHash(tx.From, tx.Nonce)
+	sig, err := ecdsa.ParseDERSignature(tx.KeyRotation.Proof)
+	if err != nil || !sig.Verify(hash[:], pub) {
+		return errors.New("invalid proof of possession of the new key")
+	}
+	return nil
+}
+
+// GetAccountKey returns the key bound to an address by its latest rotate_key
+// transaction, or nil if it was never rotated.
+func (s *State) GetAccountKey(addr Address) (*btcec.PublicKey, error) {
+	data, found := s.Trie.Get(accountKeyKey(addr))
+	if !found {
+		return nil, nil
+	}
+	return btcec.ParsePubKey(data)
+}
+
+// PutAccountKey binds a key to an address.
+func (s *State) PutAccountKey(addr Address, pub *btcec.PublicKey) error {
+	s.Trie.Insert(accountKeyKey(addr), pub.SerializeCompressed())
+	return nil
+}
+
+// applyKeyRotation binds the new key of a validated rotate_key transaction.
+func (s *State) applyKeyRotation(tx *Transaction) error {
+	pub, err := btcec.ParsePubKey(tx.KeyRotation.PubKey)
+	if err != nil {
+		return err
+	}
+	return s.PutAccountKey(tx.From, pub)
+}
+
+// checkSigningKey checks that pubKey is the current key of addr: the key bound
+// by its latest rotation or, for an address never rotated, the key it was
+// derived from.
+func checkSigningKey(state *State, addr Address, pubKey *btcec.PublicKey) error {
+	current, err := state.GetAccountKey(addr)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		if !current.IsEqual(pubKey) {
+			return fmt.Errorf("key is not the current key of %s", addr.ToHex())
+		}
+		return nil
+	}
+	if pubKeyToAddress(pubKey) != addr {
+		return fmt.Errorf("key does not belong to %s", addr.ToHex())
+	}
+	return nil
+}
+
+// verifyBlockSignature checks that a block is signed by the current key of its
+// proposer.
+func verifyBlockSignature(state *State, block *Block) error {
+	if block.Header == nil {
+		return errors.New("block has no header")
+	}
+	hash, err := block.Header.ComputeHash()
+	if err != nil {
+		return err
+	}
+	if hash != block.Header.Hash {
+		return errors.New("block header hash mismatch")
+	}
+	return verifyKeySignature(state, block.Header.Proposer, block.ProposerKey, hash, block.Signature)
+}
+
+// verifyApproval checks that an approval is signed by the current key of the
+// validator it names.
+func verifyApproval(state *State, approval *Approval) error {
+	return verifyKeySignature(state, approval.Address, approval.PubKey, approval.BlockHash, approval.Signature)
+}
+
+func verifyKeySignature(state *State, addr Address, pubKeyBytes []byte, hash Hash, signature []byte) error {
+	pub, err := btcec.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	if err := checkSigningKey(state, addr, pub); err != nil {
+		return err
+	}
+	sig, err := ecdsa.ParseDERSignature(signature)
+	if err != nil || !sig.Verify(hash[:], pub) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rotateTestKey(t *testing.T, state *State, user tokenTestAccount) *btcec.PrivateKey {
+	newKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	acc, _ := state.GetAccount(user.addr)
+	tx := tokenTx(t, state, user, &Transaction{
+		To: user.addr, Type: "rotate_key",
+		KeyRotation: NewKeyRotation(user.addr, acc.Nonce+1, newKey),
+	})
+	require.NoError(t, NewTransactionPool().AddTransaction(tx, user.key.PubKey(), state))
+	require.NoError(t, state.ApplyTransaction(tx))
+	return newKey
+}
+
+func TestKeyRotation_PoolUsesCurrentKey(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	newKey := rotateTestKey(t, state, user)
+
+	current, err := state.GetAccountKey(user.addr)
+	require.NoError(t, err)
+	assert.True(t, current.IsEqual(newKey.PubKey()))
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(99), acc.Balance, "the rotation only costs the fee")
+
+	pool := NewTransactionPool()
+	old := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 5, Type: "transfer"})
+	assert.ErrorContains(t, pool.AddTransaction(old, user.key.PubKey(), state), "not the current key")
+
+	rotated := tokenTx(t, state, tokenTestAccount{key: newKey, addr: user.addr}, &Transaction{To: Address{1}, Value: 5, Type: "transfer"})
+	require.NoError(t, pool.AddTransaction(rotated, newKey.PubKey(), state))
+
+	// The new key's own address is unaffected
+	other := tokenTestAccount{key: newKey, addr: pubKeyToAddress(newKey.PubKey())}
+	require.NoError(t, state.PutAccount(&Account{Address: other.addr, Balance: 10}))
+	require.NoError(t, pool.AddTransaction(tokenTx(t, state, other, &Transaction{To: Address{1}, Value: 1, Type: "transfer"}), newKey.PubKey(), state))
+}
+
+func TestKeyRotation_RequiresProofOfPossession(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	victim, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	// A proof made for another address cannot bind the victim's key to ours
+	stolen := NewKeyRotation(pubKeyToAddress(victim.PubKey()), 1, victim)
+	tx := tokenTx(t, state, user, &Transaction{To: user.addr, Type: "rotate_key", KeyRotation: stolen})
+	assert.ErrorContains(t, NewTransactionPool().AddTransaction(tx, user.key.PubKey(), state), "proof of possession")
+	assert.ErrorContains(t, state.ApplyTransaction(tx), "proof of possession")
+
+	// Nor can a proof for an earlier nonce
+	replayed := NewKeyRotation(user.addr, 5, victim)
+	tx = tokenTx(t, state, user, &Transaction{To: user.addr, Type: "rotate_key", KeyRotation: replayed})
+	assert.ErrorContains(t, state.ApplyTransaction(tx), "proof of possession")
+
+	current, err := state.GetAccountKey(user.addr)
+	require.NoError(t, err)
+	assert.Nil(t, current)
+}
+
+func TestKeyRotation_BlocksAndApprovals(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+
+	block := &Block{Header: &Header{BlockNumber: 1, Proposer: user.addr}}
+	require.NoError(t, block.Sign(user.key))
+	require.NoError(t, verifyBlockSignature(state, block))
+
+	approval := &Approval{BlockHash: block.Header.Hash, Address: user.addr, PubKey: user.key.PubKey().SerializeCompressed()}
+	approval.Signature = ecdsa.Sign(user.key, approval.BlockHash[:]).Serialize()
+	require.NoError(t, verifyApproval(state, approval))
+
+	newKey := rotateTestKey(t, state, user)
+	assert.ErrorContains(t, verifyBlockSignature(state, block), "not the current key")
+	assert.ErrorContains(t, verifyApproval(state, approval), "not the current key")
+
+	block.Signature = nil
+	require.NoError(t, block.Sign(newKey))
+	require.NoError(t, verifyBlockSignature(state, block))
+
+	// A signature must match the key it claims
+	approval.PubKey = newKey.PubKey().SerializeCompressed()
+	assert.ErrorContains(t, verifyApproval(state, approval), "invalid signature")
+}
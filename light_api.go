@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LightAPIServer serves the read-only subset of the REST API a light client
+// can answer: headers, and accounts and transactions verified by proof.
+type LightAPIServer struct {
+	client *LightClient
+	port   int
+}
+
+// NewLightAPIServer creates an API server for a light client
+func NewLightAPIServer(client *LightClient, port int) *LightAPIServer {
+	return &LightAPIServer{client: client, port: port}
+}
+
+// Start starts the API server
+func (api *LightAPIServer) Start() error {
+	apiV1 := http.NewServeMux()
+	apiV1.HandleFunc("/health", api.handleHealth)
+	apiV1.HandleFunc("/status", api.handleStatus)
+	apiV1.HandleFunc("/blocks/", api.handleBlockByHeight)
+	apiV1.HandleFunc("/accounts/", api.handleAccount)
+	apiV1.HandleFunc("/transactions/", api.handleTransactionByHash)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/v1/", http.StripPrefix("/api/v1", apiV1))
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", api.port),
+		Handler: mux,
+	}
+
+	go func() {
+		log.Printf("Light API server starting on port %d", api.port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Light API server error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// handleHealth handles the health check endpoint
+func (api *LightAPIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	api.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"node_id":   api.client.p2p.host.ID().String(),
+			"status":    "healthy",
+			"mode":      "light",
+			"timestamp": time.Now().Unix(),
+		},
+	})
+}
+
+// handleStatus handles the node status endpoint
+func (api *LightAPIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	api.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"node_id":           api.client.p2p.host.ID().String(),
+			"mode":              "light",
+			"blockchain_height": api.client.Height(),
+			"connected_peers":   len(api.client.p2p.host.Network().Peers()),
+		},
+	})
+}
+
+// handleBlockByHeight handles GET /blocks/{height}, returning the block
+// without its transactions
+func (api *LightAPIServer) handleBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Method not allowed", Code: 405})
+		return
+	}
+	height, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/blocks/"), 10, 64)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid block height", Code: 400})
+		return
+	}
+	if height > api.client.Height() {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Block not found", Code: 404})
+		return
+	}
+	h, err := api.client.Header(height)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Block not found", Code: 404})
+		return
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: &Block{
+		Header:      h.Header,
+		ProposerKey: h.ProposerKey,
+		Signature:   h.Signature,
+		Certificate: h.Certificate,
+	}})
+}
+
+// handleAccount handles GET /accounts/{address} and /accounts/{address}/balance
+func (api *LightAPIServer) handleAccount(w http.ResponseWriter, r *http.Request) {
+	addrStr, balanceOnly := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/accounts/"), "/balance")
+	addr, err := HexToAddress(addrStr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid address", Code: 400})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), lightProofWait+lightRequestTimeout)
+	defer cancel()
+	account, height, err := api.client.GetAccount(ctx, addr)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Account not verified: " + err.Error(), Code: 502})
+		return
+	}
+
+	data := map[string]interface{}{
+		"address": addr.ToHex(),
+		"balance": account.Balance,
+		"height":  height,
+	}
+	if !balanceOnly {
+		data["nonce"] = account.Nonce
+	}
+	api.writeJSON(w, APIResponse{Success: true, Data: data})
+}
+
+// handleTransactionByHash handles GET /transactions/{hash}
+func (api *LightAPIServer) handleTransactionByHash(w http.ResponseWriter, r *http.Request) {
+	txHashStr := strings.TrimPrefix(r.URL.Path, "/transactions/")
+	txHashBytes, err := hex.DecodeString(txHashStr)
+	if err != nil || len(txHashBytes) != 32 {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Invalid transaction hash format", Code: 400})
+		return
+	}
+	var txHash Hash
+	copy(txHash[:], txHashBytes)
+
+	ctx, cancel := context.WithTimeout(r.Context(), lightProofWait+lightRequestTimeout)
+	defer cancel()
+	tx, blockHeight, err := api.client.GetTransaction(ctx, txHash)
+	if err != nil {
+		api.writeJSON(w, APIResponse{Success: false, Error: "Transaction not found", Code: 404})
+		return
+	}
+
+	api.writeJSON(w, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"hash":         tx.Hash.ToHex(),
+			"from":         tx.From.ToHex(),
+			"to":           tx.To.ToHex(),
+			"value":        tx.Value,
+			"fee":          tx.Fee,
+			"nonce":        tx.Nonce,
+			"type":         tx.Type,
+			"timestamp":    tx.Timestamp,
+			"data":         hex.EncodeToString(tx.Data),
+			"outputs":      outputsView(tx.Outputs),
+			"block_height": blockHeight,
+			"confirmed":    true,
+		},
+	})
+}
+
+// writeJSON writes a JSON response with proper headers
+func (api *LightAPIServer) writeJSON(w http.ResponseWriter, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if response.Code != 0 {
+		w.WriteHeader(response.Code)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// lightSyncInterval is how often a light client asks its peers for new headers.
+	lightSyncInterval = 10 * time.Second
+
+	// lightProofWait bounds the wait for the header that commits to the state
+	// an account proof was made against, which is the header after the tip of
+	// the full node that served it.
+	lightProofWait = 30 * time.Second
+
+	lightHeaderPrefix = "light_header_"
+	lightTipKey       = "light_tip"
+	lightCommitteeKey = "light_committee"
+)
+
+// LightClient follows the chain by its headers and commit certificates alone.
+// It starts out trusting the genesis committee. Each header must link to the
+// previous one and carry a certificate from a quorum of its committee, and a
+// quorum of the trusted committee must have signed it. A header may name a
+// new committee only at the first block of an epoch; that committee is
+// trusted from then on, so the client follows committee changes across
+// epochs. Account state and transactions are fetched from full nodes with
+// Merkle proofs against the stored headers.
+type LightClient struct {
+	p2p    *P2PNode
+	barNet *BARNetwork
+	store  Storage
+	// keys is an empty state: without account state, signatures are checked
+	// against the keys the signers' addresses derive from, so approvals made
+	// with rotated keys do not count towards a quorum
+	keys *State
+
+	epochLength uint64 // Blocks per epoch; the committee may change after each
+
+	tip       *syncHeader
+	committee []Address // Committee trusted to certify the next header
+	mu        sync.RWMutex
+	syncing   atomic.Bool
+}
+
+// NewLightClient creates a light client that keeps its headers in store,
+// resuming from the headers stored there or else from genesis, where it
+// trusts the genesis committee.
+func NewLightClient(p2p *P2PNode, barNet *BARNetwork, store Storage, genesisCommittee []Address, epochLength uint64) (*LightClient, error) {
+	if len(genesisCommittee) == 0 {
+		return nil, errors.New("light client needs the genesis committee to verify headers")
+	}
+	lc := &LightClient{p2p: p2p, barNet: barNet, store: store, keys: NewState(), epochLength: epochLength, committee: genesisCommittee}
+	data, err := store.Get([]byte(lightTipKey))
+	if err != nil {
+		lc.tip = &syncHeader{Header: createGenesisBlock().Header}
+		return lc, nil
+	}
+	if lc.tip, err = lc.Header(binary.BigEndian.Uint64(data)); err != nil {
+		return nil, fmt.Errorf("failed to load the header tip: %w", err)
+	}
+	if data, err := store.Get([]byte(lightCommitteeKey)); err == nil {
+		if err := json.Unmarshal(data, &lc.committee); err != nil {
+			return nil, fmt.Errorf("failed to load the trusted committee: %w", err)
+		}
+	}
+	return lc, nil
+}
+
+func lightHeaderKey(height uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(lightHeaderPrefix), height)
+}
+
+// Start follows the chain in the background, from the checkpoint if one is
+// given and the client is not past it.
+func (lc *LightClient) Start(ctx context.Context, checkpoint *Checkpoint) {
+	go func() {
+		for checkpoint != nil && lc.Height() < checkpoint.Height {
+			if err := lc.TrustCheckpoint(ctx, checkpoint); err == nil {
+				break
+			} else {
+				log.Printf("LIGHT: Checkpoint not reached: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(checkpointRetryInterval):
+			}
+		}
+		ticker := time.NewTicker(lightSyncInterval)
+		defer ticker.Stop()
+		for {
+			lc.Sync(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Height returns the height of the latest verified header.
+func (lc *LightClient) Height() uint64 {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.tip.Header.BlockNumber
+}
+
+// Tip returns the latest verified header.
+func (lc *LightClient) Tip() *syncHeader {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.tip
+}
+
+// Header returns the verified header at height.
+func (lc *LightClient) Header(height uint64) (*syncHeader, error) {
+	if height == 0 {
+		return &syncHeader{Header: createGenesisBlock().Header}, nil
+	}
+	data, err := lc.store.Get(lightHeaderKey(height))
+	if err != nil {
+		return nil, fmt.Errorf("no header at height %d", height)
+	}
+	var h syncHeader
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// addHeader stores a verified header as the new tip and trusts its committee.
+func (lc *LightClient) addHeader(h *syncHeader) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	committee, err := json.Marshal(h.Certificate.Committee)
+	if err != nil {
+		return err
+	}
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	height := h.Header.BlockNumber
+	if err := lc.store.Put(lightHeaderKey(height), data); err != nil {
+		return err
+	}
+	if err := lc.store.Put([]byte(lightCommitteeKey), committee); err != nil {
+		return err
+	}
+	if err := lc.store.Put([]byte(lightTipKey), binary.BigEndian.AppendUint64(nil, height)); err != nil {
+		return err
+	}
+	lc.tip, lc.committee = h, h.Certificate.Committee
+	return nil
+}
+
+// peers returns the connected peers that are not banned.
+func (lc *LightClient) peers() []peer.ID {
+	var peers []peer.ID
+	for _, info := range append(lc.barNet.GetWhitelist(), lc.barNet.GetGreylist()...) {
+		peers = append(peers, info.ID)
+	}
+	return peers
+}
+
+func (lc *LightClient) penalize(id peer.ID, reason string) {
+	lc.barNet.UpdatePOMScore(id, 1, reason)
+}
+
+// TrustCheckpoint makes the checkpoint's header the tip, without verifying
+// the headers before it, and trusts the committee that certified it. A quorum
+// of the trusted committee must have signed the header, as for any other.
+func (lc *LightClient) TrustCheckpoint(ctx context.Context, cp *Checkpoint) error {
+	for _, id := range lc.peers() {
+		resp, err := requestBlockRange(ctx, lc.p2p, id, &blockRangeRequest{From: cp.Height, Count: 1, Headers: true})
+		if err != nil || len(resp.Headers) == 0 {
+			continue
+		}
+		h := resp.Headers[0]
+		if h == nil || h.Header == nil || h.Header.Hash != cp.Hash {
+			lc.penalize(id, "header does not match the checkpoint")
+			continue
+		}
+		if hash, err := h.Header.ComputeHash(); err != nil || hash != cp.Hash {
+			lc.penalize(id, "header with a bad hash")
+			continue
+		}
+		if _, err := lc.verifyCertificate(h); err != nil {
+			log.Printf("LIGHT: Checkpoint header from %s: %v", id, err)
+			continue
+		}
+		if err := lc.addHeader(h); err != nil {
+			return err
+		}
+		log.Printf("LIGHT: Started from checkpoint at height %d", cp.Height)
+		return nil
+	}
+	return errors.New("no peer served the checkpoint header")
+}
+
+// Sync fetches and verifies headers until no peer has the next one. Only one
+// sync runs at a time; a call made while another runs returns at once.
+func (lc *LightClient) Sync(ctx context.Context) {
+	if !lc.syncing.CompareAndSwap(false, true) {
+		return
+	}
+	defer lc.syncing.Store(false)
+
+	for ctx.Err() == nil {
+		progressed := false
+		for _, id := range lc.peers() {
+			added, err := lc.syncFrom(ctx, id)
+			if err != nil {
+				log.Printf("LIGHT: Headers from %s: %v", id, err)
+			}
+			if added > 0 {
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return
+		}
+	}
+}
+
+// syncFrom fetches the headers after the tip from one peer and adds those
+// that verify, returning how many it added.
+func (lc *LightClient) syncFrom(ctx context.Context, id peer.ID) (int, error) {
+	parent := lc.Tip().Header
+	resp, err := requestBlockRange(ctx, lc.p2p, id, &blockRangeRequest{From: parent.BlockNumber + 1, Count: MaxHeaderSyncRange, Headers: true})
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, h := range resp.Headers {
+		if err := checkHeaderLink(parent, h); err != nil {
+			lc.penalize(id, "malformed header for light client")
+			return added, err
+		}
+		// Certificates may fail for want of rotated keys, so a peer is not
+		// penalised for them
+		if err := lc.verifyHeader(h); err != nil {
+			return added, fmt.Errorf("header %d: %w", h.Header.BlockNumber, err)
+		}
+		if err := lc.addHeader(h); err != nil {
+			return added, err
+		}
+		parent = h.Header
+		added++
+	}
+	return added, nil
+}
+
+// checkHeaderLink checks that a header is well-formed and follows parent.
+func checkHeaderLink(parent *Header, h *syncHeader) error {
+	if h == nil || h.Header == nil {
+		return errors.New("empty header")
+	}
+	if h.Header.BlockNumber != parent.BlockNumber+1 || h.Header.PreviousHash != parent.Hash {
+		return errors.New("header does not extend the chain")
+	}
+	if hash, err := h.Header.ComputeHash(); err != nil || hash != h.Header.Hash {
+		return errors.New("header has a bad hash")
+	}
+	return nil
+}
+
+// verifyHeader checks the header after the tip: its certificate must verify
+// against the trusted committee, and it may name another committee only at
+// the first block of an epoch.
+func (lc *LightClient) verifyHeader(h *syncHeader) error {
+	trusted, err := lc.verifyCertificate(h)
+	if err != nil {
+		return err
+	}
+	if !lc.startsEpoch(h.Header.BlockNumber) && !sameMembers(trusted, h.Certificate.Committee) {
+		return errors.New("committee changed within an epoch")
+	}
+	return nil
+}
+
+// verifyCertificate checks a header's proposer signature and certificate, and
+// that a quorum of the trusted committee signed it. It returns the trusted
+// committee it checked against.
+func (lc *LightClient) verifyCertificate(h *syncHeader) ([]Address, error) {
+	if err := verifyKeySignature(lc.keys, h.Header.Proposer, h.ProposerKey, h.Header.Hash, h.Signature); err != nil {
+		return nil, fmt.Errorf("proposer signature: %w", err)
+	}
+	signed, err := verifyCertificateApprovals(lc.keys, h.Header, h.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	lc.mu.RLock()
+	trusted := lc.committee
+	lc.mu.RUnlock()
+	vouching := 0
+	for _, addr := range trusted {
+		if signed[addr] {
+			vouching++
+		}
+	}
+	if vouching < quorum(len(trusted)) {
+		return nil, fmt.Errorf("signed by %d of the %d members of the trusted committee, %d required", vouching, len(trusted), quorum(len(trusted)))
+	}
+	return trusted, nil
+}
+
+// startsEpoch reports whether the block at height is the first of an epoch,
+// the first the committee elected at the end of the previous one certifies.
+func (lc *LightClient) startsEpoch(height uint64) bool {
+	return lc.epochLength > 0 && height > 1 && (height-1)%lc.epochLength == 0
+}
+
+// waitForHeader returns the header at height, syncing until it arrives or
+// lightProofWait passes.
+func (lc *LightClient) waitForHeader(ctx context.Context, height uint64) (*syncHeader, error) {
+	deadline := time.Now().Add(lightProofWait)
+	for {
+		if height <= lc.Height() {
+			return lc.Header(height)
+		}
+		lc.Sync(ctx)
+		if height <= lc.Height() {
+			return lc.Header(height)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no verified header at height %d", height)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// request sends one LightProtocol request to a peer and reads its response.
+func (lc *LightClient) request(ctx context.Context, id peer.ID, req *lightRequest) (*lightResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, lightRequestTimeout)
+	defer cancel()
+	stream, err := lc.p2p.NewStream(ctx, id, LightProtocol)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return nil, err
+	}
+	stream.CloseWrite()
+	var resp lightResponse
+	if err := json.NewDecoder(stream).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// GetAccount fetches an account with a proof against the state root committed
+// by a verified header. It returns the account and the height of the block
+// after which the account was in that state. The proof must be made against
+// state no older than that of the verified tip, so a peer cannot answer with
+// an account's state from a height of its choosing.
+func (lc *LightClient) GetAccount(ctx context.Context, addr Address) (*Account, uint64, error) {
+	for _, id := range lc.peers() {
+		verified := lc.Height()
+		resp, err := lc.request(ctx, id, &lightRequest{Type: "account", Address: addr})
+		if err != nil || resp.Proof == nil {
+			continue
+		}
+		if resp.Height+1 < verified {
+			lc.penalize(id, "account proof against stale state")
+			continue
+		}
+		header, err := lc.waitForHeader(ctx, resp.Height+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !bytes.Equal(resp.Proof.Key, addr[:]) {
+			lc.penalize(id, "account proof for another key")
+			continue
+		}
+		if err := VerifyMerkleProof(header.Header.StateRoot, resp.Proof); err != nil {
+			log.Printf("LIGHT: Account proof from %s: %v", id, err)
+			lc.penalize(id, "invalid account proof")
+			continue
+		}
+		account := &Account{Address: addr}
+		if resp.Proof.Value != nil {
+			if err := json.Unmarshal(resp.Proof.Value, account); err != nil {
+				return nil, 0, err
+			}
+		}
+		return account, resp.Height, nil
+	}
+	return nil, 0, errors.New("no peer served a verifiable account proof")
+}
+
+// GetTransaction fetches a finalized transaction with a proof of its inclusion
+// in a verified header, and returns it with the height of its block.
+func (lc *LightClient) GetTransaction(ctx context.Context, hash Hash) (*Transaction, uint64, error) {
+	for _, id := range lc.peers() {
+		resp, err := lc.request(ctx, id, &lightRequest{Type: "transaction", Hash: hash})
+		if err != nil || resp.Transaction == nil {
+			continue
+		}
+		if contentHash, err := transactionContentHash(resp.Transaction); err != nil || contentHash != hash || resp.Transaction.Hash != hash {
+			lc.penalize(id, "transaction does not match its hash")
+			continue
+		}
+		header, err := lc.waitForHeader(ctx, resp.Height)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := VerifyTransactionProof(header.Header.TransactionRoot, hash, resp.TxProof); err != nil {
+			log.Printf("LIGHT: Transaction proof from %s: %v", id, err)
+			lc.penalize(id, "invalid transaction proof")
+			continue
+		}
+		return resp.Transaction, resp.Height, nil
+	}
+	return nil, 0, errors.New("transaction not found")
+}
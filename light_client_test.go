@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLightTestClient creates a light client connected to server that starts
+// from the given genesis committee.
+func newLightTestClient(t *testing.T, ctx context.Context, server *AppNode, epochLength uint64, genesis []Address) (*LightClient, peer.ID) {
+	node := newSyncTestNode(t, ctx)
+	id := connectSyncPeer(t, ctx, node, server)
+	lc, err := NewLightClient(node.p2p, node.barNet, NewMemoryStore(), genesis, epochLength)
+	require.NoError(t, err)
+	return lc, id
+}
+
+func keyAddresses(keys ...*btcec.PrivateKey) []Address {
+	addresses := make([]Address, len(keys))
+	for i, key := range keys {
+		addresses[i] = pubKeyToAddress(key.PubKey())
+	}
+	return addresses
+}
+
+// extendLightTestChain adds a block with one transfer to a node's chain,
+// finalized by the given committee.
+func extendLightTestChain(t *testing.T, node *AppNode, committee []*btcec.PrivateKey, sender tokenTestAccount) *Block {
+	tx := tokenTx(t, node.state, sender, &Transaction{To: Address{1}, Value: 1, Type: "transfer"})
+	validators := make([]*Validator, len(committee))
+	for i, key := range committee {
+		validators[i] = &Validator{Address: pubKeyToAddress(key.PubKey())}
+	}
+	block, err := node.bc.CreateBlockWithState([]*Transaction{tx}, validators[0], committee[0], node.state)
+	require.NoError(t, err)
+	require.NoError(t, block.Sign(committee[0]))
+	approval := NewBlockApproval(block, validators)
+	for i, key := range committee {
+		require.NoError(t, approval.AddApproval(&Approval{
+			BlockHash: block.Header.Hash,
+			Address:   validators[i].Address,
+			Signature: ecdsa.Sign(key, block.Header.Hash[:]).Serialize(),
+			PubKey:    key.PubKey().SerializeCompressed(),
+		}))
+	}
+	block.Certificate = approval.Certificate()
+	require.NoError(t, node.bc.AddBlock(block))
+	require.NoError(t, node.bc.ApplyBlockWithRegistry(block, node.state, nil))
+	return block
+}
+
+func TestLightClient_FollowsCommitteeChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	b, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	c, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	server := newSyncTestNode(t, ctx)
+	sender := newTokenTestAccount(t, server.state, 10000)
+	epochLength := uint64(MaxHeaderSyncRange + 5)
+	for i := uint64(0); i < epochLength; i++ {
+		extendLightTestChain(t, server, []*btcec.PrivateKey{a}, sender)
+	}
+	// The next epoch's committee takes over at its first block, which the
+	// genesis committee also certifies
+	extendLightTestChain(t, server, []*btcec.PrivateKey{a, b}, sender)
+	extendLightTestChain(t, server, []*btcec.PrivateKey{a, b}, sender)
+
+	lc, id := newLightTestClient(t, ctx, server, epochLength, keyAddresses(a))
+	lc.Sync(ctx)
+	assert.Equal(t, server.bc.Height(), lc.Height())
+	last, err := server.bc.GetLastBlock()
+	require.NoError(t, err)
+	assert.Equal(t, last.Header.Hash, lc.Tip().Header.Hash)
+	assert.Equal(t, 0, pomScore(lc.barNet, id))
+
+	// Within an epoch the committee cannot change, even with the trusted
+	// committee's signatures
+	extendLightTestChain(t, server, []*btcec.PrivateKey{a, b, c}, sender)
+	_, err = lc.syncFrom(ctx, id)
+	assert.ErrorContains(t, err, "committee changed within an epoch")
+	assert.Equal(t, server.bc.Height()-1, lc.Height())
+
+	// Headers and the trusted committee survive a restart
+	restarted, err := NewLightClient(lc.p2p, lc.barNet, lc.store, keyAddresses(a), epochLength)
+	require.NoError(t, err)
+	assert.Equal(t, lc.Height(), restarted.Height())
+	assert.Equal(t, keyAddresses(a, b), restarted.committee)
+}
+
+func TestLightClient_StartsFromGenesisCommittee(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	b, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	server := newSyncTestNode(t, ctx)
+	sender := newTokenTestAccount(t, server.state, 1000)
+	extendLightTestChain(t, server, []*btcec.PrivateKey{a}, sender)
+	extendLightTestChain(t, server, []*btcec.PrivateKey{a}, sender)
+	// A committee the trusted one did not vouch for is refused, even at the
+	// start of an epoch
+	extendLightTestChain(t, server, []*btcec.PrivateKey{b}, sender)
+
+	lc, id := newLightTestClient(t, ctx, server, 2, keyAddresses(a))
+	lc.Sync(ctx)
+	assert.Equal(t, uint64(2), lc.Height())
+
+	// A client whose genesis committee did not certify the chain follows none of it
+	other, _ := newLightTestClient(t, ctx, server, 2, keyAddresses(b))
+	other.Sync(ctx)
+	assert.Equal(t, uint64(0), other.Height())
+	assert.Equal(t, 0, pomScore(lc.barNet, id), "certificates are not held against peers")
+
+	_, err = NewLightClient(lc.p2p, lc.barNet, NewMemoryStore(), nil, 2)
+	assert.ErrorContains(t, err, "genesis committee")
+}
+
+func TestLightClient_TrustCheckpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newBlockSyncTest(t, ctx, 10)
+	committee, err := registryCommittee(client.vr)
+	require.NoError(t, err)
+	lc, id := newLightTestClient(t, ctx, server, EpochLength, []Address{committee[0].Address})
+	block, err := server.bc.GetBlockByHeight(6)
+	require.NoError(t, err)
+
+	assert.Error(t, lc.TrustCheckpoint(ctx, &Checkpoint{Height: 6, Hash: Hash{1}}))
+	assert.Equal(t, 1, pomScore(lc.barNet, id))
+
+	require.NoError(t, lc.TrustCheckpoint(ctx, &Checkpoint{Height: 6, Hash: block.Header.Hash}))
+	assert.Equal(t, uint64(6), lc.Height())
+	lc.Sync(ctx)
+	assert.Equal(t, uint64(10), lc.Height())
+}
+
+func TestLightClient_VerifiesAccountsAndTransactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	server := newSyncTestNode(t, ctx)
+	sender := newTokenTestAccount(t, server.state, 1000)
+	var blocks []*Block
+	for i := 0; i < 5; i++ {
+		blocks = append(blocks, extendLightTestChain(t, server, []*btcec.PrivateKey{proposer}, sender))
+	}
+	lc, _ := newLightTestClient(t, ctx, server, EpochLength, keyAddresses(proposer))
+	lc.Sync(ctx)
+
+	tx := blocks[2].Transactions[0]
+	got, height, err := lc.GetTransaction(ctx, tx.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), height)
+	assert.Equal(t, tx.Hash, got.Hash)
+	_, _, err = lc.GetTransaction(ctx, Hash{1})
+	assert.Error(t, err)
+
+	// The account proof is against the state after block 5, which block 6
+	// commits to, so the server's chain grows once the proof is served
+	served := make(chan struct{})
+	server.p2p.SetStreamHandler(LightProtocol, func(stream network.Stream) {
+		server.lightServer.handleStream(stream)
+		close(served)
+	})
+	go func() {
+		<-served
+		server.blockImportMu.Lock()
+		defer server.blockImportMu.Unlock()
+		extendLightTestChain(t, server, []*btcec.PrivateKey{proposer}, sender)
+	}()
+	account, height, err := lc.GetAccount(ctx, Address{1})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), height)
+	assert.Equal(t, uint64(5), account.Balance)
+	assert.Equal(t, uint64(6), lc.Height())
+}
+
+func TestLightClient_PenalizesBadProofs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proposer, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	server := newSyncTestNode(t, ctx)
+	sender := newTokenTestAccount(t, server.state, 1000)
+	extendLightTestChain(t, server, []*btcec.PrivateKey{proposer}, sender)
+	stale := server.lightServer.serve(&lightRequest{Type: "account", Address: Address{1}})
+	require.NotNil(t, stale.Proof)
+	for i := 0; i < 2; i++ {
+		extendLightTestChain(t, server, []*btcec.PrivateKey{proposer}, sender)
+	}
+	lc, id := newLightTestClient(t, ctx, server, EpochLength, keyAddresses(proposer))
+	lc.Sync(ctx)
+
+	// The server claims a larger balance for an account of block 2's state
+	server.p2p.SetStreamHandler(LightProtocol, func(stream network.Stream) {
+		defer stream.Close()
+		var req lightRequest
+		if err := json.NewDecoder(stream).Decode(&req); err != nil {
+			return
+		}
+		resp := server.lightServer.serve(&req)
+		resp.Height = 2
+		resp.Proof.Value = []byte(`{"Address":"` + Address{1}.ToHex() + `","Balance":1000}`)
+		json.NewEncoder(stream).Encode(resp)
+	})
+	_, _, err = lc.GetAccount(ctx, Address{1})
+	assert.ErrorContains(t, err, "no peer served")
+	assert.Equal(t, 1, pomScore(lc.barNet, id))
+
+	// A genuine proof of the state after block 1 is refused once the client
+	// has verified later headers
+	server.p2p.SetStreamHandler(LightProtocol, func(stream network.Stream) {
+		defer stream.Close()
+		json.NewEncoder(stream).Encode(stale)
+	})
+	_, _, err = lc.GetAccount(ctx, Address{1})
+	assert.ErrorContains(t, err, "no peer served")
+	assert.Equal(t, 2, pomScore(lc.barNet, id))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	// LightProtocol serves the Merkle proofs light clients verify account
+	// state and transactions with.
+	LightProtocol = protocol.ID("/dyphira/light/1")
+
+	lightRequestTimeout = 10 * time.Second
+)
+
+// lightRequest is a request sent on a LightProtocol stream.
+type lightRequest struct {
+	Type    string  `json:"type"` // "account" or "transaction"
+	Address Address `json:"address,omitempty"`
+	Hash    Hash    `json:"hash,omitempty"`
+}
+
+// lightResponse answers a lightRequest. An account proof is against the state
+// after the block at Height, which the next block's StateRoot commits to; a
+// transaction proof is against the TransactionRoot of the block at Height.
+type lightResponse struct {
+	Error       string            `json:"error,omitempty"`
+	Height      uint64            `json:"height"`
+	Proof       *MerkleProof      `json:"proof,omitempty"`
+	Transaction *Transaction      `json:"transaction,omitempty"`
+	TxProof     *TransactionProof `json:"txProof,omitempty"`
+}
+
+// LightServer answers the proof requests of light clients.
+type LightServer struct {
+	node *AppNode
+}
+
+func NewLightServer(node *AppNode) *LightServer {
+	return &LightServer{node: node}
+}
+
+// RegisterProtocol serves LightProtocol to peers.
+func (ls *LightServer) RegisterProtocol() {
+	ls.node.p2p.SetStreamHandler(LightProtocol, ls.handleStream)
+}
+
+// handleStream serves one LightProtocol request.
+func (ls *LightServer) handleStream(stream network.Stream) {
+	defer stream.Close()
+	stream.SetDeadline(time.Now().Add(lightRequestTimeout))
+
+	from := stream.Conn().RemotePeer()
+	if status, ok := ls.node.barNet.GetPeerStatus(from); ok && status == PeerStatusBanned {
+		stream.Reset()
+		return
+	}
+	var req lightRequest
+	if err := json.NewDecoder(stream).Decode(&req); err != nil {
+		log.Printf("LIGHT: Malformed request from %s: %v", from, err)
+		return
+	}
+	if err := json.NewEncoder(stream).Encode(ls.serve(&req)); err != nil {
+		log.Printf("LIGHT: Failed to answer %s: %v", from, err)
+	}
+}
+
+func (ls *LightServer) serve(req *lightRequest) *lightResponse {
+	n := ls.node
+	switch req.Type {
+	case "account":
+		// Blocks are applied under the import lock, so the proof and the
+		// height are of the same state
+		n.blockImportMu.Lock()
+		height := n.bc.Height()
+		_, proof := n.state.Trie.Prove(req.Address[:])
+		n.blockImportMu.Unlock()
+		return &lightResponse{Height: height, Proof: proof}
+	case "transaction":
+		tx, height, err := n.bc.GetTransactionByHash(req.Hash)
+		if err != nil {
+			return &lightResponse{Error: err.Error()}
+		}
+		block, err := n.bc.GetBlockByHeight(height)
+		if err != nil {
+			return &lightResponse{Error: err.Error()}
+		}
+		for i, btx := range block.Transactions {
+			if btx.Hash == tx.Hash {
+				proof, err := NewTransactionProof(block.Transactions, i)
+				if err != nil {
+					return &lightResponse{Error: err.Error()}
+				}
+				return &lightResponse{Height: height, Transaction: tx, TxProof: proof}
+			}
+		}
+		return &lightResponse{Error: fmt.Sprintf("transaction %s is not in block %d", req.Hash.ToHex(), height)}
+	default:
+		return &lightResponse{Error: fmt.Sprintf("unknown request type %q", req.Type)}
+	}
+}
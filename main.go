@@ -2,16 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 const (
@@ -23,31 +23,43 @@ func main() {
 	port := flag.Int("port", 8080, "Port number for the node to listen on")
 	peerAddr := flag.String("peer", "", "Address of a peer to connect to")
 	apiPort := flag.Int("api-port", APIPort, "Port number for the API server")
-	fastSyncPeer := flag.String("fast-sync-peer", "", "HTTP address of a peer to fast sync from (e.g. http://host:8081)")
+	checkpointFlag := flag.String("checkpoint", "", "Trusted checkpoint to start from instead of genesis, as height:blockHash:stateRoot")
+	backfill := flag.Bool("backfill", false, "With --checkpoint, download the blocks below the checkpoint in the background")
+	lightMode := flag.Bool("light", false, "Run as a light client that follows block headers and verifies state with proofs from full nodes")
 	cliMode := flag.Bool("cli", false, "Enable interactive CLI mode")
+	genesisPath := flag.String("genesis", "", "Path to a genesis file with initial allocations, vesting schedules and validators")
+	keyHex := flag.String("key", "", "Hex-encoded secp256k1 private key of the node's account; a new key is generated if empty")
 	flag.Parse()
 
+	var checkpoint *Checkpoint
+	if *checkpointFlag != "" {
+		cp, err := ParseCheckpoint(*checkpointFlag)
+		if err != nil {
+			log.Fatalf("Invalid --checkpoint: %v", err)
+		}
+		checkpoint = cp
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if *lightMode {
+		runLightClient(ctx, *port, *apiPort, *peerAddr, *genesisPath, checkpoint)
+		return
+	}
+
 	// --- 1. Initialize Graceful Shutdown Manager ---
 	shutdownManager := NewGracefulShutdown()
 
 	// --- 2. Initialization ---
 	dbPath := fmt.Sprintf("dyphira-%d.db", *port)
 
-	// Clean up previous DB for a fresh start with better error handling
-	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
-		log.Printf("Warning: Could not remove existing database file %s: %v", dbPath, err)
-		// Wait a bit to ensure any file locks are released
-		time.Sleep(100 * time.Millisecond)
-	}
-
 	// --- 3. Create Node Identity ---
-	// Generate ECDSA private key for blockchain signing
-	privKey, err := btcec.NewPrivateKey()
+	// The ECDSA key signs blocks and transactions. A fixed key keeps the
+	// node's address stable so that a genesis file can name it as a validator.
+	privKey, err := loadAccountKey(*keyHex)
 	if err != nil {
-		log.Fatalf("Failed to generate ECDSA private key: %v", err)
+		log.Fatalf("Failed to load ECDSA private key: %v", err)
 	}
 
 	// Generate libp2p private key
@@ -57,80 +69,20 @@ func main() {
 	}
 
 	// --- 4. Create and Start Node ---
-	node, err := NewAppNode(ctx, *port, dbPath, p2pPrivKey, privKey)
+	node, err := newFreshNode(ctx, *port, dbPath, p2pPrivKey, privKey)
 	if err != nil {
 		log.Fatalf("Failed to create application node: %v", err)
 	}
 
-	// --- Fast Sync Logic ---
-	if *fastSyncPeer != "" && node.bc.Height() < 10 {
-		log.Printf("Attempting fast sync from peer: %s", *fastSyncPeer)
-		resp, err := http.Get(*fastSyncPeer + "/api/v1/state/snapshot")
+	if *genesisPath != "" {
+		genesis, err := LoadGenesis(*genesisPath)
 		if err != nil {
-			log.Fatalf("Failed to fetch snapshot from peer: %v", err)
-		}
-		defer resp.Body.Close()
-		var apiResp struct {
-			Success bool
-			Data    []*Account
-			Error   string
+			log.Fatalf("Failed to load genesis: %v", err)
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-			log.Fatalf("Failed to decode snapshot response: %v", err)
-		}
-		if !apiResp.Success {
-			log.Fatalf("Peer returned error: %s", apiResp.Error)
-		}
-		if err := node.state.ImportSnapshot(apiResp.Data); err != nil {
-			log.Fatalf("Failed to import snapshot: %v", err)
-		}
-		log.Printf("Fast sync: imported %d accounts from peer", len(apiResp.Data))
-
-		// Fetch peer's latest block height
-		heightResp, err := http.Get(*fastSyncPeer + "/api/v1/node/status")
-		if err != nil {
-			log.Fatalf("Failed to fetch peer status: %v", err)
+		if err := genesis.Apply(node.state, node.vr); err != nil {
+			log.Fatalf("Failed to apply genesis: %v", err)
 		}
-		defer heightResp.Body.Close()
-		var statusResp struct {
-			Success bool
-			Data    map[string]interface{}
-			Error   string
-		}
-		if err := json.NewDecoder(heightResp.Body).Decode(&statusResp); err != nil {
-			log.Fatalf("Failed to decode status response: %v", err)
-		}
-		if !statusResp.Success {
-			log.Fatalf("Peer returned error: %s", statusResp.Error)
-		}
-		peerHeight, ok := statusResp.Data["height"].(float64)
-		if !ok {
-			log.Fatalf("Peer status missing height field")
-		}
-		localHeight := node.bc.Height()
-		for h := localHeight + 1; h <= uint64(peerHeight); h++ {
-			blockResp, err := http.Get(fmt.Sprintf("%s/api/v1/blocks/%d", *fastSyncPeer, h))
-			if err != nil {
-				log.Fatalf("Failed to fetch block %d: %v", h, err)
-			}
-			defer blockResp.Body.Close()
-			var blockAPIResp struct {
-				Success bool
-				Data    *Block
-				Error   string
-			}
-			if err := json.NewDecoder(blockResp.Body).Decode(&blockAPIResp); err != nil {
-				log.Fatalf("Failed to decode block %d: %v", h, err)
-			}
-			if !blockAPIResp.Success || blockAPIResp.Data == nil {
-				log.Fatalf("Peer returned error for block %d: %s", h, blockAPIResp.Error)
-			}
-			if err := node.bc.AddBlock(blockAPIResp.Data); err != nil {
-				log.Fatalf("Failed to add block %d: %v", h, err)
-			}
-			log.Printf("Fast sync: imported block %d", h)
-		}
-		log.Printf("Fast sync complete: chain height is now %d", node.bc.Height())
+		log.Printf("Applied genesis file %s with %d accounts and %d validators", *genesisPath, len(genesis.Accounts), len(genesis.Validators))
 	}
 
 	// --- 5. Register Node Components for Graceful Shutdown ---
@@ -170,6 +122,16 @@ func main() {
 		return nil
 	})
 
+	node.Checkpoint = checkpoint
+	node.Backfill = *backfill
+
+	// Halt block production, but keep serving the API, when a scheduled
+	// upgrade this binary does not implement is reached
+	node.OnUpgradeHalt = func(plan UpgradePlan) {
+		reason := fmt.Sprintf("upgrade %q required at height %d", plan.Name, plan.Height)
+		shutdownManager.Halt(reason, &plan)
+	}
+
 	if err := node.Start(); err != nil {
 		log.Fatalf("Failed to start node: %v", err)
 	}
@@ -213,3 +175,103 @@ func main() {
 
 	fmt.Println("Node shutdown complete.")
 }
+
+// newFreshNode creates a node on a new chain. The chain database at dbPath is
+// removed first, so the node also resets the validator registry kept next to
+// it, including any upgrade plan the previous chain scheduled. A binary
+// implementing that upgrade runs its migration when the chain it syncs from
+// its peers reaches the upgrade height.
+func newFreshNode(ctx context.Context, port int, dbPath string, p2pPrivKey crypto.PrivKey, privKey *btcec.PrivateKey) (*AppNode, error) {
+	// Clean up previous DB for a fresh start with better error handling
+	if err := os.Remove(dbPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Could not remove existing database file %s: %v", dbPath, err)
+		// Wait a bit to ensure any file locks are released
+		time.Sleep(100 * time.Millisecond)
+	}
+	return NewAppNode(ctx, port, dbPath, p2pPrivKey, privKey)
+}
+
+// loadAccountKey parses a hex-encoded private key, or generates a new one if
+// keyHex is empty.
+func loadAccountKey(keyHex string) (*btcec.PrivateKey, error) {
+	if keyHex == "" {
+		return btcec.NewPrivateKey()
+	}
+	keyBytes, err := hex.DecodeString(keyHex)
+	if err != nil || len(keyBytes) != btcec.PrivKeyBytesLen {
+		return nil, fmt.Errorf("invalid private key: want %d hex-encoded bytes", btcec.PrivKeyBytesLen)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(keyBytes)
+	return privKey, nil
+}
+
+// runLightClient runs a light client instead of a full node until shutdown.
+// The genesis file names the validators whose committee the client trusts
+// to certify the first epoch.
+func runLightClient(ctx context.Context, port, apiPort int, peerAddr, genesisPath string, checkpoint *Checkpoint) {
+	shutdownManager := NewGracefulShutdown()
+
+	if genesisPath == "" {
+		log.Fatalf("A light client needs --genesis to know the committee it starts from")
+	}
+	genesis, err := LoadGenesis(genesisPath)
+	if err != nil {
+		log.Fatalf("Failed to load genesis: %v", err)
+	}
+	committee, err := genesis.Committee()
+	if err != nil {
+		log.Fatalf("Failed to select the genesis committee: %v", err)
+	}
+
+	p2pPrivKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		log.Fatalf("Failed to generate libp2p private key: %v", err)
+	}
+	p2p, err := NewP2PNode(ctx, port, p2pPrivKey)
+	if err != nil {
+		log.Fatalf("Failed to create P2P node: %v", err)
+	}
+	barNet := NewBARNetwork(nil)
+	p2p.OnPeerConnect = func(peerID peer.ID, address string) {
+		barNet.AddPeer(peerID, address)
+	}
+	p2p.OnInvalidMessage = func(peerID peer.ID, reason string) {
+		barNet.UpdatePOMScore(peerID, 1, reason)
+	}
+	p2p.PeerScore = barNet.GossipScore
+
+	// Headers are kept across restarts, unlike the full node's chain
+	store, err := NewBoltStore(fmt.Sprintf("dyphira-light-%d.db", port), "headers")
+	if err != nil {
+		log.Fatalf("Failed to open header store: %v", err)
+	}
+	client, err := NewLightClient(p2p, barNet, store, committee, DefaultConsensusParams().EpochLength)
+	if err != nil {
+		log.Fatalf("Failed to create light client: %v", err)
+	}
+	shutdownManager.Register("p2p", func() error {
+		log.Printf("Shutting down P2P component...")
+		return p2p.host.Close()
+	})
+	shutdownManager.Register("headers", func() error {
+		log.Printf("Shutting down header store...")
+		return store.Close()
+	})
+
+	if peerAddr != "" {
+		if err := p2p.Connect(ctx, peerAddr); err != nil {
+			log.Printf("Failed to connect to initial peer: %v", err)
+		}
+	}
+	go p2p.Discover(ctx)
+	client.Start(ctx, checkpoint)
+
+	if err := NewLightAPIServer(client, apiPort).Start(); err != nil {
+		log.Fatalf("Failed to start API server: %v", err)
+	}
+
+	shutdownManager.ListenAndServe()
+	fmt.Printf("Light client is running on P2P port %d, API port %d. Press Ctrl+C to exit.\n", port, apiPort)
+	<-ctx.Done()
+	shutdownManager.Shutdown("manual shutdown")
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/hex"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
 )
 
 func TestCLIHelpAndExit(t *testing.T) {
@@ -161,3 +167,82 @@ func (m *MockStorage) List() (map[string][]byte, error) {
 func (m *MockStorage) Close() error {
 	return nil
 }
+
+func TestLoadAccountKey(t *testing.T) {
+	key, err := loadAccountKey("")
+	if err != nil || key == nil {
+		t.Fatalf("Expected a generated key, got %v", err)
+	}
+	keyHex := hex.EncodeToString(key.Serialize())
+	loaded, err := loadAccountKey(keyHex)
+	if err != nil {
+		t.Fatalf("Failed to load key: %v", err)
+	}
+	if pubKeyToAddress(loaded.PubKey()) != pubKeyToAddress(key.PubKey()) {
+		t.Errorf("Loaded key has a different address")
+	}
+	if _, err := loadAccountKey("zz"); err == nil {
+		t.Errorf("Expected an error for an invalid key")
+	}
+}
+
+func TestNewFreshNode_ResetsPreviousChain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dbPath := filepath.Join(t.TempDir(), "node.db")
+
+	// A previous run left a chain and a registry with a pending upgrade behind
+	chainStore, err := NewBoltStore(dbPath, "chain")
+	if err != nil {
+		t.Fatalf("Failed to open chain store: %v", err)
+	}
+	bc, err := NewBlockchain(chainStore)
+	if err != nil {
+		t.Fatalf("Failed to create blockchain: %v", err)
+	}
+	if err := bc.AddBlock(&Block{Header: &Header{BlockNumber: 5}}); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	chainStore.Close()
+	validatorStore, err := NewBoltStore(dbPath+".validators", "validators")
+	if err != nil {
+		t.Fatalf("Failed to open validator store: %v", err)
+	}
+	vr := NewValidatorRegistry(validatorStore, "validators")
+	if err := vr.RegisterValidator(&Validator{Address: Address{1}, Stake: 100, Participating: true}); err != nil {
+		t.Fatalf("Failed to register validator: %v", err)
+	}
+	if err := vr.ScheduleUpgrade(UpgradePlan{Name: "test-fresh-node", Height: 2}); err != nil {
+		t.Fatalf("Failed to schedule upgrade: %v", err)
+	}
+	validatorStore.Close()
+
+	p2pKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatalf("Failed to generate libp2p key: %v", err)
+	}
+	privKey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	node, err := newFreshNode(ctx, 0, dbPath, p2pKey, privKey)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer node.validatorStore.Close()
+	defer node.chainStore.Close()
+	defer node.p2p.host.Close()
+
+	if height := node.bc.Height(); height != 0 {
+		t.Errorf("Expected a new chain, got height %d", height)
+	}
+	if validators, _ := node.vr.GetAllValidators(); len(validators) != 0 {
+		t.Errorf("Expected no validators from the previous chain, got %d", len(validators))
+	}
+	if plan, _ := node.vr.GetUpgradePlan(); plan != nil {
+		t.Errorf("Expected the previous chain's upgrade plan to be dropped, got %+v", plan)
+	}
+	if !node.checkUpgradeHeight(2) {
+		t.Errorf("The new chain halted for the previous chain's upgrade")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionData_SignedAndCharged(t *testing.T) {
+	user := newTokenTestAccount(t, NewState(), 100)
+	a := &Transaction{From: user.addr, To: Address{1}, Value: 1, Nonce: 1, Type: "transfer", Data: []byte("deposit-1")}
+	b := *a
+	b.Data = []byte("deposit-2")
+	require.NoError(t, a.Sign(user.key))
+	require.NoError(t, b.Sign(user.key))
+	assert.NotEqual(t, a.Hash, b.Hash, "the memo is part of the signed hash")
+
+	assert.Equal(t, uint64(GasTransaction+9*GasTxDataByte), TransactionGas(a))
+	assert.ErrorContains(t, checkBaseFee(&Transaction{Fee: 1000, Data: a.Data}, 1), "below the base fee cost 1144")
+}
+
+func TestTransactionData_Bounded(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	tx := tokenTx(t, state, user, &Transaction{
+		To: Address{1}, Value: 1, Type: "transfer",
+		Data: []byte(strings.Repeat("x", MaxTransactionDataLength+1)),
+	})
+	assert.ErrorContains(t, NewTransactionPool().AddTransaction(tx, user.key.PubKey(), state), "data exceeds")
+	assert.ErrorContains(t, state.ApplyTransaction(tx), "data exceeds")
+
+	tx = tokenTx(t, state, user, &Transaction{
+		To: Address{1}, Value: 1, Type: "transfer",
+		Data: []byte(strings.Repeat("x", MaxTransactionDataLength)),
+	})
+	require.NoError(t, state.ApplyTransaction(tx))
+}
+
+func TestAPIServer_TransactionHistoryDataFilter(t *testing.T) {
+	state := NewState()
+	bc, err := NewBlockchain(NewMemoryStore())
+	require.NoError(t, err)
+	user := newTokenTestAccount(t, state, 100)
+	var txs []*Transaction
+	for _, memo := range []string{"alice", "bob", "alice"} {
+		tx := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer", Data: []byte(memo)})
+		require.NoError(t, state.ApplyTransaction(tx))
+		txs = append(txs, tx)
+	}
+	block, err := bc.CreateBlock(txs, &Validator{Address: user.addr}, user.key)
+	require.NoError(t, err)
+	require.NoError(t, bc.AddBlock(block))
+	api := &APIServer{node: &AppNode{state: state, bc: bc}}
+
+	w := httptest.NewRecorder()
+	api.handleTransactionHistory(w, httptest.NewRequest(http.MethodGet, "/transactions/history?data="+hex.EncodeToString([]byte("alice")), nil))
+	var response struct {
+		Success bool
+		Data    struct {
+			Transactions []map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	require.Len(t, response.Data.Transactions, 2)
+	assert.Equal(t, hex.EncodeToString([]byte("alice")), response.Data.Transactions[0]["data"])
+
+	w = httptest.NewRecorder()
+	api.handleTransactionHistory(w, httptest.NewRequest(http.MethodGet, "/transactions/history?data=zz", nil))
+	assert.Contains(t, w.Body.String(), "Invalid data filter")
+}
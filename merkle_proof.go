@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// ProofStep is a node on the path from the root of a MerkleTrie to a key: the
+// hash of its child off the path and, if a shorter key ends at the node, the
+// hash of its value.
+type ProofStep struct {
+	Sibling   Hash  `json:"sibling"`
+	ValueHash *Hash `json:"valueHash,omitempty"`
+}
+
+// MerkleProof proves the value of a key, or its absence, against a trie root.
+// Path holds the nodes from the root down to the deepest node on the key's
+// path. If that is the key's own node, Left and Right are its children.
+type MerkleProof struct {
+	Key   []byte      `json:"key"`
+	Value []byte      `json:"value,omitempty"` // Nil for a proof of absence
+	Left  Hash        `json:"left"`
+	Right Hash        `json:"right"`
+	Path  []ProofStep `json:"path"`
+}
+
+func keyBit(key []byte, depth int) byte {
+	return (key[depth/8] >> (7 - (depth % 8))) & 1
+}
+
+// Prove returns the root of the trie and a proof of the value of key, or of
+// its absence, against it.
+func (t *MerkleTrie) Prove(key []byte) (Hash, *MerkleProof) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	proof := &MerkleProof{Key: key}
+	node := t.Root
+	for depth := 0; depth < len(key)*8; depth++ {
+		var next, sibling *Node
+		if keyBit(key, depth) == 0 {
+			next, sibling = node.Left, node.Right
+		} else {
+			next, sibling = node.Right, node.Left
+		}
+		step := ProofStep{}
+		if sibling != nil {
+			step.Sibling = sibling.Hash
+		}
+		if node.Value != nil {
+			valueHash := Hash(sha3.Sum256(node.Value))
+			step.ValueHash = &valueHash
+		}
+		proof.Path = append(proof.Path, step)
+		if next == nil {
+			return t.Root.Hash, proof
+		}
+		node = next
+	}
+	proof.Value = node.Value
+	if node.Left != nil {
+		proof.Left = node.Left.Hash
+	}
+	if node.Right != nil {
+		proof.Right = node.Right.Hash
+	}
+	return t.Root.Hash, proof
+}
+
+// VerifyMerkleProof checks a proof against a trie root, hashing the path from
+// the key's node up the way MerkleTrie does.
+func VerifyMerkleProof(root Hash, proof *MerkleProof) error {
+	if proof == nil {
+		return errors.New("missing proof")
+	}
+	bits := len(proof.Key) * 8
+	if len(proof.Path) > bits {
+		return fmt.Errorf("proof path of %d steps is longer than the key", len(proof.Path))
+	}
+
+	// The hash of the deepest node on the path, zero where the path ends
+	var hash Hash
+	switch {
+	case len(proof.Path) < bits:
+		if proof.Value != nil {
+			return errors.New("proof ends above the key it has a value for")
+		}
+	case proof.Left == (Hash{}) && proof.Right == (Hash{}):
+		if proof.Value != nil {
+			hash = sha3.Sum256(proof.Value)
+		}
+	default:
+		combined := append(proof.Left[:], proof.Right[:]...)
+		if proof.Value != nil {
+			valueHash := sha3.Sum256(proof.Value)
+			combined = append(valueHash[:], combined...)
+		}
+		hash = sha3.Sum256(combined)
+	}
+
+	for depth := len(proof.Path) - 1; depth >= 0; depth-- {
+		step := proof.Path[depth]
+		left, right := hash, step.Sibling
+		if keyBit(proof.Key, depth) == 1 {
+			left, right = step.Sibling, hash
+		}
+		if left == (Hash{}) && right == (Hash{}) {
+			// A node without children is a leaf, hashed as its value alone.
+			// Only the root of an empty trie has neither.
+			if step.ValueHash != nil {
+				hash = *step.ValueHash
+			} else if depth != 0 {
+				return fmt.Errorf("proof has an empty node at depth %d", depth)
+			}
+			continue
+		}
+		combined := append(left[:], right[:]...)
+		if step.ValueHash != nil {
+			combined = append(step.ValueHash[:], combined...)
+		}
+		hash = sha3.Sum256(combined)
+	}
+	if hash != root {
+		return fmt.Errorf("proof hashes to %s, not the root %s", hash.ToHex(), root.ToHex())
+	}
+	return nil
+}
+
+// TransactionProof proves that a transaction hash is leaf Index of the
+// TransactionRoot of a block with Total transactions.
+type TransactionProof struct {
+	Index    int    `json:"index"`
+	Total    int    `json:"total"`
+	Siblings []Hash `json:"siblings"`
+}
+
+// hashPair hashes two nodes of a transaction tree.
+func hashPair(left, right Hash) Hash {
+	return sha3.Sum256(append(left[:], right[:]...))
+}
+
+// transactionTree returns the levels of the binary Merkle tree over
+// transaction hashes, leaves first. A node without a sibling moves up a level
+// unchanged.
+func transactionTree(txs []*Transaction) [][]Hash {
+	level := make([]Hash, len(txs))
+	for i, tx := range txs {
+		level[i] = tx.Hash
+	}
+	levels := [][]Hash{level}
+	for len(level) > 1 {
+		next := make([]Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, hashPair(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// NewTransactionProof proves the inclusion of transaction index of a block.
+func NewTransactionProof(txs []*Transaction, index int) (*TransactionProof, error) {
+	if index < 0 || index >= len(txs) {
+		return nil, fmt.Errorf("block has no transaction %d", index)
+	}
+	proof := &TransactionProof{Index: index, Total: len(txs)}
+	for _, level := range transactionTree(txs) {
+		if len(level) == 1 {
+			break
+		}
+		if index%2 == 1 {
+			proof.Siblings = append(proof.Siblings, level[index-1])
+		} else if index+1 < len(level) {
+			proof.Siblings = append(proof.Siblings, level[index+1])
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyTransactionProof checks that txHash is included under a TransactionRoot.
+func VerifyTransactionProof(root, txHash Hash, proof *TransactionProof) error {
+	if proof == nil {
+		return errors.New("missing proof")
+	}
+	if proof.Index < 0 || proof.Index >= proof.Total {
+		return fmt.Errorf("no transaction %d in a block of %d", proof.Index, proof.Total)
+	}
+	hash, index, width, used := txHash, proof.Index, proof.Total, 0
+	for width > 1 {
+		if index%2 == 1 || index+1 < width {
+			if used == len(proof.Siblings) {
+				return errors.New("proof is missing siblings")
+			}
+			if index%2 == 1 {
+				hash = hashPair(proof.Siblings[used], hash)
+			} else {
+				hash = hashPair(hash, proof.Siblings[used])
+			}
+			used++
+		}
+		index, width = index/2, (width+1)/2
+	}
+	if used != len(proof.Siblings) {
+		return errors.New("proof has unused siblings")
+	}
+	if hash != root {
+		return fmt.Errorf("proof hashes to %s, not the transaction root %s", hash.ToHex(), root.ToHex())
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleTrie_Prove(t *testing.T) {
+	trie := NewMerkleTrie()
+	root, proof := trie.Prove([]byte("hello"))
+	assert.NoError(t, VerifyMerkleProof(root, proof), "absence from an empty trie")
+
+	// "he" ends at an internal node on the path to "hello"
+	entries := map[string]string{"hello": "world", "he": "prefix", "foo": "bar", "another": "entry"}
+	for k, v := range entries {
+		trie.Insert([]byte(k), []byte(v))
+	}
+	for k, v := range entries {
+		root, proof := trie.Prove([]byte(k))
+		assert.Equal(t, []byte(v), proof.Value)
+		assert.NoError(t, VerifyMerkleProof(root, proof), k)
+	}
+	for _, k := range []string{"hel", "nonexistent", "f"} {
+		root, proof := trie.Prove([]byte(k))
+		assert.Nil(t, proof.Value)
+		assert.NoError(t, VerifyMerkleProof(root, proof), k)
+	}
+}
+
+func TestVerifyMerkleProof_RejectsTampering(t *testing.T) {
+	trie := NewMerkleTrie()
+	trie.Insert([]byte("hello"), []byte("world"))
+	trie.Insert([]byte("help"), []byte("me"))
+	root, proof := trie.Prove([]byte("hello"))
+
+	forged := *proof
+	forged.Value = []byte("w0rld")
+	assert.Error(t, VerifyMerkleProof(root, &forged), "changed value")
+
+	forged = *proof
+	forged.Value = nil
+	assert.Error(t, VerifyMerkleProof(root, &forged), "claimed absence")
+
+	forged = *proof
+	forged.Key = []byte("help!")
+	assert.Error(t, VerifyMerkleProof(root, &forged), "other key")
+
+	forged = *proof
+	forged.Path = proof.Path[:len(proof.Path)-1]
+	assert.Error(t, VerifyMerkleProof(root, &forged), "truncated path")
+
+	assert.Error(t, VerifyMerkleProof(Hash{1}, proof), "other root")
+	assert.Error(t, VerifyMerkleProof(root, nil))
+}
+
+func TestTransactionProof(t *testing.T) {
+	for total := 1; total <= 9; total++ {
+		txs := make([]*Transaction, total)
+		for i := range txs {
+			txs[i] = &Transaction{Hash: Hash{byte(i + 1)}}
+		}
+		root := computeTransactionRoot(txs)
+		for i, tx := range txs {
+			proof, err := NewTransactionProof(txs, i)
+			require.NoError(t, err)
+			assert.NoError(t, VerifyTransactionProof(root, tx.Hash, proof), fmt.Sprintf("%d of %d", i, total))
+			assert.Error(t, VerifyTransactionProof(root, Hash{0xff}, proof), "other transaction")
+			if total > 1 {
+				moved := *proof
+				moved.Index = (i + 1) % total
+				assert.Error(t, VerifyTransactionProof(root, tx.Hash, &moved), "other index")
+			}
+		}
+	}
+	_, err := NewTransactionProof(nil, 0)
+	assert.Error(t, err)
+}
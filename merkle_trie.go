@@ -3,6 +3,9 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	"golang.org/x/crypto/sha3"
 )
@@ -21,6 +24,7 @@ type MerkleTrie struct {
 	Root *Node
 	// Keep a map for efficient retrieval of all key-value pairs
 	kvMap map[string][]byte
+	mu    sync.RWMutex
 }
 
 // NewMerkleTrie creates a new Merkle Trie.
@@ -33,6 +37,8 @@ func NewMerkleTrie() *MerkleTrie {
 
 // Insert adds a key-value pair to the trie.
 func (t *MerkleTrie) Insert(key []byte, value []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.Root = t.insert(t.Root, key, value, 0)
 	// Store in map for efficient retrieval
 	t.kvMap[string(key)] = value
@@ -46,7 +52,7 @@ func (t *MerkleTrie) insert(node *Node, key []byte, value []byte, depth int) *No
 	if depth == len(key)*8 {
 		node.Value = value
 		node.Key = key // Store the original key
-		node.Hash = Hash(sha3.Sum256(value))
+		node.Hash = t.recalculateHash(node)
 		return node
 	}
 
@@ -63,6 +69,8 @@ func (t *MerkleTrie) insert(node *Node, key []byte, value []byte, depth int) *No
 
 // Get retrieves a value by its key.
 func (t *MerkleTrie) Get(key []byte) ([]byte, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	node := t.get(t.Root, key, 0)
 	if node != nil && node.Value != nil {
 		return node.Value, true
@@ -85,7 +93,12 @@ func (t *MerkleTrie) get(node *Node, key []byte, depth int) *Node {
 	return t.get(node.Right, key, depth+1)
 }
 
+// recalculateHash hashes a node from its children and, for a node holding a
+// key that other keys extend, its value. Leaves hash to the hash of their value.
 func (t *MerkleTrie) recalculateHash(node *Node) Hash {
+	if node.Left == nil && node.Right == nil && node.Value != nil {
+		return Hash(sha3.Sum256(node.Value))
+	}
 	var leftHash, rightHash [32]byte
 	if node.Left != nil {
 		leftHash = node.Left.Hash
@@ -95,11 +108,17 @@ func (t *MerkleTrie) recalculateHash(node *Node) Hash {
 	}
 
 	combined := append(leftHash[:], rightHash[:]...)
+	if node.Value != nil {
+		valueHash := sha3.Sum256(node.Value)
+		combined = append(valueHash[:], combined...)
+	}
 	hash := sha3.Sum256(combined)
 	return Hash(hash)
 }
 
 func (t *MerkleTrie) String() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	var buf bytes.Buffer
 	t.print(t.Root, 0, &buf)
 	return buf.String()
@@ -122,6 +141,8 @@ type KVPair struct {
 
 // All returns all key-value pairs in the trie
 func (t *MerkleTrie) All() []KVPair {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	var pairs []KVPair
 	for key, value := range t.kvMap {
 		pairs = append(pairs, KVPair{
@@ -131,3 +152,79 @@ func (t *MerkleTrie) All() []KVPair {
 	}
 	return pairs
 }
+
+// PrefixScan returns the key-value pairs whose key starts with prefix, sorted by key
+func (t *MerkleTrie) PrefixScan(prefix []byte) []KVPair {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var pairs []KVPair
+	for key, value := range t.kvMap {
+		if strings.HasPrefix(key, string(prefix)) {
+			pairs = append(pairs, KVPair{
+				Key:   []byte(key),
+				Value: value,
+			})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].Key, pairs[j].Key) < 0
+	})
+	return pairs
+}
+
+// RootHash returns the hash of the trie's root, which commits to all of its
+// key-value pairs.
+func (t *MerkleTrie) RootHash() Hash {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.Root.Hash
+}
+
+// Snapshot returns the root hash and all key-value pairs of the trie, sorted
+// by key, as of the same moment.
+func (t *MerkleTrie) Snapshot() (Hash, []KVPair) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	pairs := make([]KVPair, 0, len(t.kvMap))
+	for key, value := range t.kvMap {
+		pairs = append(pairs, KVPair{Key: []byte(key), Value: value})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].Key, pairs[j].Key) < 0
+	})
+	return t.Root.Hash, pairs
+}
+
+// Copy returns a copy of the trie that can be changed without changing t.
+// Values are shared, as the trie never modifies a stored value in place.
+func (t *MerkleTrie) Copy() *MerkleTrie {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	kvMap := make(map[string][]byte, len(t.kvMap))
+	for key, value := range t.kvMap {
+		kvMap[key] = value
+	}
+	return &MerkleTrie{Root: copyNode(t.Root), kvMap: kvMap}
+}
+
+func copyNode(node *Node) *Node {
+	if node == nil {
+		return nil
+	}
+	c := *node
+	c.Left = copyNode(node.Left)
+	c.Right = copyNode(node.Right)
+	return &c
+}
+
+// Replace swaps the contents of the trie for those of other.
+func (t *MerkleTrie) Replace(other *MerkleTrie) {
+	other.mu.RLock()
+	root, kvMap := other.Root, other.kvMap
+	other.mu.RUnlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Root = root
+	t.kvMap = kvMap
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	MaxTransferOutputs = 256
+
+	// GasTransferOutput is charged for every output of a multi_transfer on top
+	// of the intrinsic gas.
+	GasTransferOutput = 500
+)
+
+// TransferOutput is a single payment of a multi_transfer transaction.
+type TransferOutput struct {
+	To    Address `json:"to"`
+	Value uint64  `json:"value"`
+}
+
+// feeUnits returns the number of payments a transaction makes, which the
+// minimum fee is multiplied by.
+func feeUnits(tx *Transaction) uint64 {
+	if len(tx.Outputs) > 1 {
+		return uint64(len(tx.Outputs))
+	}
+	return 1
+}
+
+// validateMultiTransfer performs the stateless checks on a multi_transfer
+// transaction. The transaction's Value must be the total of its outputs, and
+// adding the fee to it must not overflow.
+func validateMultiTransfer(tx *Transaction) error {
+	if len(tx.Outputs) == 0 {
+		return errors.New("multi_transfer requires at least one output")
+	}
+	if len(tx.Outputs) > MaxTransferOutputs {
+		return fmt.Errorf("multi_transfer has more than %d outputs", MaxTransferOutputs)
+	}
+	total := uint64(0)
+	for i, out := range tx.Outputs {
+		if out.Value == 0 {
+			return fmt.Errorf("output %d has zero value", i)
+		}
+		if total > math.MaxUint64-out.Value {
+			return errors.New("multi_transfer outputs overflow")
+		}
+		total += out.Value
+	}
+	if total != tx.Value {
+		return fmt.Errorf("multi_transfer value %d does not match the outputs' total %d", tx.Value, total)
+	}
+	if total > math.MaxUint64-tx.Fee {
+		return errors.New("multi_transfer outputs and fee overflow")
+	}
+	return nil
+}
+
+// pays reports whether a transaction credits addr, as its recipient or as one
+// of its outputs.
+func (t *Transaction) pays(addr Address) bool {
+	if t.To == addr {
+		return true
+	}
+	for _, out := range t.Outputs {
+		if out.To == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOutputsField rejects outputs on every transaction type but
+// multi_transfer.
+func validateOutputsField(tx *Transaction) error {
+	if len(tx.Outputs) > 0 && tx.Type != "multi_transfer" {
+		return fmt.Errorf("%s transactions cannot carry outputs", tx.Type)
+	}
+	return nil
+}
+
+// applyMultiTransfer credits the outputs of a multi_transfer whose total has
+// already been debited from the sender.
+func (s *State) applyMultiTransfer(tx *Transaction) error {
+	for _, out := range tx.Outputs {
+		acc, err := s.GetAccount(out.To)
+		if err != nil {
+			return err
+		}
+		acc.Balance += out.Value
+		if err := s.PutAccount(acc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
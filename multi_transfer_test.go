@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiTransfer_PaysEveryOutput(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t)
+	user := newTokenTestAccount(t, state, 100)
+
+	tx := tokenTx(t, state, user, &Transaction{
+		To: Address{1}, Value: 60, Type: "multi_transfer",
+		Outputs: []TransferOutput{{To: Address{1}, Value: 10}, {To: Address{2}, Value: 20}, {To: Address{1}, Value: 30}},
+	})
+	applyAt(t, bc, state, vr, 1, tx)
+
+	receipt, err := bc.GetReceipt(tx.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptStatusSuccess, receipt.Status)
+	assert.Equal(t, uint64(GasTransaction+3*GasTransferOutput), TransactionGas(tx))
+
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(100-60-1), acc.Balance)
+	assert.Equal(t, uint64(1), acc.Nonce, "one nonce for all outputs")
+	first, _ := state.GetAccount(Address{1})
+	assert.Equal(t, uint64(40), first.Balance)
+	second, _ := state.GetAccount(Address{2})
+	assert.Equal(t, uint64(20), second.Balance)
+}
+
+func TestMultiTransfer_AllOrNothing(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t)
+	user := newTokenTestAccount(t, state, 100)
+
+	cases := map[string]*Transaction{
+		"does not match the outputs' total": {
+			Value: 25, Outputs: []TransferOutput{{To: Address{1}, Value: 10}, {To: Address{2}, Value: 20}},
+		},
+		"zero value": {
+			Value: 10, Outputs: []TransferOutput{{To: Address{1}, Value: 10}, {To: Address{2}}},
+		},
+		"insufficient balance": {
+			Value: 150, Outputs: []TransferOutput{{To: Address{1}, Value: 50}, {To: Address{2}, Value: 100}},
+		},
+		"and fee overflow": {
+			Value: math.MaxUint64, Outputs: []TransferOutput{{To: Address{1}, Value: math.MaxUint64 - 10}, {To: Address{2}, Value: 10}},
+		},
+	}
+	height := uint64(1)
+	for want, tx := range cases {
+		tx.Type = "multi_transfer"
+		tx.To = tx.Outputs[0].To
+		tx = tokenTx(t, state, user, tx)
+		applyAt(t, bc, state, vr, height, tx)
+		height++
+
+		receipt, err := bc.GetReceipt(tx.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, ReceiptStatusFailed, receipt.Status)
+		assert.Contains(t, receipt.Error, want)
+	}
+
+	for _, addr := range []Address{{1}, {2}} {
+		acc, _ := state.GetAccount(addr)
+		assert.Equal(t, uint64(0), acc.Balance, "no output is paid when any is invalid")
+	}
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(100-4), acc.Balance, "only the fees are charged")
+
+	// The outputs' total is checked with the fee added
+	tx := &Transaction{Value: math.MaxUint64, Fee: 1, Outputs: []TransferOutput{{To: Address{1}, Value: math.MaxUint64}}}
+	assert.ErrorContains(t, validateMultiTransfer(tx), "multi_transfer outputs and fee overflow")
+	tx.Fee = 0
+	assert.NoError(t, validateMultiTransfer(tx))
+}
+
+func TestMultiTransfer_Pool(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	pool := NewTransactionPool()
+	pool.SetFeeRules(1, 0)
+
+	outputs := []TransferOutput{{To: Address{1}, Value: 1}, {To: Address{2}, Value: 1}, {To: Address{3}, Value: 1}}
+	tx := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 3, Type: "multi_transfer", Outputs: outputs})
+	assert.ErrorContains(t, pool.AddTransaction(tx, user.key.PubKey(), state), "fee 1 below minimum 3", "the minimum fee applies per output")
+
+	tx.Fee = 3
+	require.NoError(t, tx.Sign(user.key))
+	require.NoError(t, pool.AddTransaction(tx, user.key.PubKey(), state))
+
+	stray := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer", Outputs: outputs[:1]})
+	assert.ErrorContains(t, pool.AddTransaction(stray, user.key.PubKey(), state), "transfer transactions cannot carry outputs")
+	assert.ErrorContains(t, state.ApplyTransaction(stray), "transfer transactions cannot carry outputs")
+}
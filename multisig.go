@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+const MaxMultisigKeys = 16
+
+// multisigAddressDomain separates multisig addresses from single-key ones.
+var multisigAddressDomain = []byte("dyphira/multisig/v1")
+
+// MultisigSignature is one co-signer's signature, identified by the index of
+// its key in the envelope's key set.
+type MultisigSignature struct {
+	Index     int    `json:"index"`
+	Signature []byte `json:"signature"`
+}
+
+// MultisigEnvelope carries the key set of an M-of-N account and the signatures
+// collected so far. The key set and threshold are covered by the transaction
+// hash; the signatures are not, so co-signers can sign independently.
+type MultisigEnvelope struct {
+	Threshold  int                 `json:"threshold"`
+	PubKeys    [][]byte            `json:"pubKeys"` // Compressed secp256k1 keys, sorted
+	Signatures []MultisigSignature `json:"signatures,omitempty"`
+}
+
+// sortMultisigKeys returns the keys in canonical order so that the address
+// does not depend on the order the co-signers were listed in.
+func sortMultisigKeys(pubKeys [][]byte) [][]byte {
+	sorted := make([][]byte, len(pubKeys))
+	copy(sorted, pubKeys)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	return sorted
+}
+
+// NewMultisigEnvelope builds an envelope for an M-of-N key set.
+func NewMultisigEnvelope(threshold int, pubKeys []*btcec.PublicKey) (*MultisigEnvelope, error) {
+	keys := make([][]byte, len(pubKeys))
+	for i, pub := range pubKeys {
+		keys[i] = pub.SerializeCompressed()
+	}
+	env := &MultisigEnvelope{Threshold: threshold, PubKeys: sortMultisigKeys(keys)}
+	if err := env.validateKeySet(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// validateKeySet checks the threshold and that the keys are valid, distinct and
+// in canonical order.
+func (m *MultisigEnvelope) validateKeySet() error {
+	if len(m.PubKeys) == 0 || len(m.PubKeys) > MaxMultisigKeys {
+		return fmt.Errorf("multisig key set must have 1-%d keys", MaxMultisigKeys)
+	}
+	if m.Threshold < 1 || m.Threshold > len(m.PubKeys) {
+		return fmt.Errorf("multisig threshold must be between 1 and %d", len(m.PubKeys))
+	}
+	for i, key := range m.PubKeys {
+		if _, err := btcec.ParsePubKey(key); err != nil || len(key) != btcec.PubKeyBytesLenCompressed {
+			return fmt.Errorf("invalid multisig public key %d", i)
+		}
+		if i > 0 && bytes.Compare(m.PubKeys[i-1], key) >= 0 {
+			return errors.New("multisig public keys must be distinct and sorted")
+		}
+	}
+	return nil
+}
+
+// Address derives the account address from the threshold and key set.
+func (m *MultisigEnvelope) Address() Address {
+	h := sha3.New256()
+	h.Write(multisigAddressDomain)
+	h.Write([]byte{byte(m.Threshold)})
+	for _, key := range m.PubKeys {
+		h.Write(key)
+	}
+	var addr Address
+	copy(addr[:], h.Sum(nil))
+	return addr
+}
+
+// MultisigAddress derives the address of an M-of-N account.
+func MultisigAddress(threshold int, pubKeys []*btcec.PublicKey) (Address, error) {
+	env, err := NewMultisigEnvelope(threshold, pubKeys)
+	if err != nil {
+		return Address{}, err
+	}
+	return env.Address(), nil
+}
+
+// keyIndex returns the position of pub in the key set, or -1.
+func (m *MultisigEnvelope) keyIndex(pub *btcec.PublicKey) int {
+	key := pub.SerializeCompressed()
+	for i, k := range m.PubKeys {
+		if bytes.Equal(k, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// addSignature records a co-signer's signature, replacing any earlier one from
+// the same key, and keeps the signatures ordered by key index.
+func (m *MultisigEnvelope) addSignature(sig MultisigSignature) {
+	for i := range m.Signatures {
+		if m.Signatures[i].Index == sig.Index {
+			m.Signatures[i] = sig
+			return
+		}
+	}
+	m.Signatures = append(m.Signatures, sig)
+	sort.Slice(m.Signatures, func(i, j int) bool { return m.Signatures[i].Index < m.Signatures[j].Index })
+}
+
+// MultisigHash is the hash co-signers sign: the transaction without its hash,
+// single signature or collected multisig signatures.
+func (t *Transaction) MultisigHash() (Hash, error) {
+	if t.Multisig == nil {
+		return Hash{}, errors.New("transaction has no multisig envelope")
+	}
+	tempTx := *t
+	tempTx.Hash = Hash{}
+	tempTx.Signature = nil
+	env := *t.Multisig
+	env.Signatures = nil
+	tempTx.Multisig = &env
+	data, err := json.Marshal(tempTx)
+	if err != nil {
+		return Hash{}, err
+	}
+	return sha3.Sum256(data), nil
+}
+
+// SignMultisig adds the signature of one co-signer to a multisig transaction.
+func (t *Transaction) SignMultisig(privKey *btcec.PrivateKey) error {
+	hash, err := t.MultisigHash()
+	if err != nil {
+		return err
+	}
+	index := t.Multisig.keyIndex(privKey.PubKey())
+	if index < 0 {
+		return errors.New("key is not part of the multisig key set")
+	}
+	t.Hash = hash
+	t.Multisig.addSignature(MultisigSignature{
+		Index:     index,
+		Signature: ecdsa.Sign(privKey, hash[:]).Serialize(),
+	})
+	return nil
+}
+
+// CombineMultisig merges the signatures of partially signed copies of the same
+// multisig transaction into t.
+func (t *Transaction) CombineMultisig(others ...*Transaction) error {
+	hash, err := t.MultisigHash()
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		otherHash, err := other.MultisigHash()
+		if err != nil {
+			return err
+		}
+		if otherHash != hash {
+			return fmt.Errorf("cannot combine signatures of different transactions %s and %s", hash.ToHex(), otherHash.ToHex())
+		}
+		for _, sig := range other.Multisig.Signatures {
+			t.Multisig.addSignature(sig)
+		}
+	}
+	t.Hash = hash
+	return nil
+}
+
+// VerifyMultisig checks that a multisig transaction is sent from the address of
+// its key set and carries valid signatures from at least threshold co-signers.
+func (t *Transaction) VerifyMultisig() error {
+	if t.Multisig == nil {
+		return errors.New("transaction has no multisig envelope")
+	}
+	if err := t.Multisig.validateKeySet(); err != nil {
+		return err
+	}
+	if t.Multisig.Address() != t.From {
+		return errors.New("sender is not the address of the multisig key set")
+	}
+	hash, err := t.MultisigHash()
+	if err != nil {
+		return err
+	}
+	if hash != t.Hash {
+		return errors.New("transaction hash mismatch")
+	}
+
+	signed := make(map[int]bool)
+	for _, s := range t.Multisig.Signatures {
+		if s.Index < 0 || s.Index >= len(t.Multisig.PubKeys) || signed[s.Index] {
+			return fmt.Errorf("invalid multisig signature index %d", s.Index)
+		}
+		pub, _ := btcec.ParsePubKey(t.Multisig.PubKeys[s.Index])
+		sig, err := ecdsa.ParseDERSignature(s.Signature)
+		if err != nil || !sig.Verify(hash[:], pub) {
+			return fmt.Errorf("invalid multisig signature from key %d", s.Index)
+		}
+		signed[s.Index] = true
+	}
+	if len(signed) < t.Multisig.Threshold {
+		return fmt.Errorf("multisig transaction has %d of %d required signatures", len(signed), t.Multisig.Threshold)
+	}
+	return nil
+}
+
+// verifyTransactionSender checks the signature of a transaction and returns the
+// address it is authorised to spend from. Multisig transactions carry their own
+// keys, so pubKey is ignored for them. Other transactions must be signed with
+// the current key of their sender, which rotate_key may have replaced.
+func verifyTransactionSender(tx *Transaction, pubKey *btcec.PublicKey, state *State) (Address, error) {
+	if tx.Multisig != nil {
+		if err := tx.VerifyMultisig(); err != nil {
+			return Address{}, err
+		}
+		return tx.From, nil
+	}
+	if pubKey == nil || !tx.Verify(pubKey) {
+		return Address{}, errors.New("invalid signature")
+	}
+	if err := checkSigningKey(state, tx.From, pubKey); err != nil {
+		return Address{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	return tx.From, nil
+}
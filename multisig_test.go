@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMultisigTestKeys(t *testing.T, n int) ([]*btcec.PrivateKey, []*btcec.PublicKey) {
+	privs := make([]*btcec.PrivateKey, n)
+	pubs := make([]*btcec.PublicKey, n)
+	for i := range privs {
+		key, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		privs[i] = key
+		pubs[i] = key.PubKey()
+	}
+	return privs, pubs
+}
+
+func newMultisigTestTx(t *testing.T, state *State, threshold int, pubs []*btcec.PublicKey) *Transaction {
+	env, err := NewMultisigEnvelope(threshold, pubs)
+	require.NoError(t, err)
+	from := env.Address()
+	require.NoError(t, state.PutAccount(&Account{Address: from, Balance: 100}))
+	return &Transaction{
+		From:      from,
+		To:        Address{1},
+		Value:     10,
+		Nonce:     1,
+		Fee:       1,
+		Timestamp: time.Now().UnixNano(),
+		Type:      "transfer",
+		Multisig:  env,
+	}
+}
+
+func TestMultisigAddress(t *testing.T) {
+	_, pubs := newMultisigTestKeys(t, 3)
+
+	addr, err := MultisigAddress(2, pubs)
+	require.NoError(t, err)
+	reordered, err := MultisigAddress(2, []*btcec.PublicKey{pubs[2], pubs[0], pubs[1]})
+	require.NoError(t, err)
+	assert.Equal(t, addr, reordered, "key order must not change the address")
+
+	other, err := MultisigAddress(3, pubs)
+	require.NoError(t, err)
+	assert.NotEqual(t, addr, other, "threshold is part of the address")
+
+	_, err = MultisigAddress(4, pubs)
+	assert.Error(t, err)
+	_, err = MultisigAddress(1, []*btcec.PublicKey{pubs[0], pubs[0]})
+	assert.Error(t, err, "duplicate keys")
+}
+
+func TestMultisig_PartialSigningAndCombine(t *testing.T) {
+	privs, pubs := newMultisigTestKeys(t, 3)
+	state := NewState()
+	tx := newMultisigTestTx(t, state, 2, pubs)
+
+	// Each co-signer signs its own copy offline
+	copyA, copyB := *tx, *tx
+	envA, envB := *tx.Multisig, *tx.Multisig
+	copyA.Multisig, copyB.Multisig = &envA, &envB
+	require.NoError(t, copyA.SignMultisig(privs[0]))
+	require.NoError(t, copyB.SignMultisig(privs[2]))
+
+	assert.ErrorContains(t, copyA.VerifyMultisig(), "1 of 2 required signatures")
+
+	require.NoError(t, copyA.CombineMultisig(&copyB))
+	require.NoError(t, copyA.VerifyMultisig())
+	assert.Len(t, copyA.Multisig.Signatures, 2)
+
+	outsider, _ := btcec.NewPrivateKey()
+	assert.Error(t, copyA.SignMultisig(outsider))
+
+	// Signatures from a different transaction cannot be combined
+	changed := copyB
+	changed.Value = 99
+	assert.ErrorContains(t, copyA.CombineMultisig(&changed), "cannot combine")
+}
+
+func TestMultisig_PoolAndState(t *testing.T) {
+	privs, pubs := newMultisigTestKeys(t, 3)
+	state := NewState()
+	tx := newMultisigTestTx(t, state, 2, pubs)
+	tp := NewTransactionPool()
+
+	require.NoError(t, tx.SignMultisig(privs[1]))
+	assert.Error(t, tp.AddTransaction(tx, nil, state), "below threshold")
+	assert.Error(t, state.ApplyTransaction(tx), "below threshold")
+
+	require.NoError(t, tx.SignMultisig(privs[0]))
+	require.NoError(t, tp.AddTransaction(tx, nil, state))
+	require.NoError(t, state.ApplyTransaction(tx))
+
+	acc, _ := state.GetAccount(tx.From)
+	assert.Equal(t, uint64(89), acc.Balance)
+	assert.Equal(t, uint64(1), acc.Nonce)
+
+	// A tampered transaction no longer matches the signed hash
+	tampered := *tx
+	tampered.Nonce = 2
+	tampered.Value = 50
+	assert.ErrorContains(t, state.ApplyTransaction(&tampered), "hash mismatch")
+
+	// The sender must be the address of the key set
+	spoofed := *tx
+	spoofed.From = Address{9}
+	assert.ErrorContains(t, spoofed.VerifyMultisig(), "sender is not the address")
+}
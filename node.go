@@ -7,6 +7,7 @@ import (
 	"log"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"bytes"
@@ -19,14 +20,12 @@ import (
 )
 
 const (
-	TransactionTopic   = "/dyphira/transactions/v1"
-	BlockTopic         = "/dyphira/blocks/v1"
-	ApprovalTopic      = "/dyphira/approvals/v1"
-	BlockRequestTopic  = "/dyphira/block-requests/v1"
-	BlockResponseTopic = "/dyphira/block-responses/v1"
-	ValidatorTopic     = "/dyphira/validators/v1"
-	EpochLength        = 270 // blocks - matches specification
-	CommitteeSize      = 30
+	TransactionTopic = "/dyphira/transactions/v1"
+	BlockTopic       = "/dyphira/blocks/v1"
+	ApprovalTopic    = "/dyphira/approvals/v1"
+	ValidatorTopic   = "/dyphira/validators/v1"
+	EpochLength      = 270 // blocks - matches specification
+	CommitteeSize    = 30
 )
 
 // AppNode represents the full blockchain application.
@@ -50,6 +49,7 @@ type AppNode struct {
 	committeeSelector *CommitteeSelector
 	proposerSelector  *ProposerSelector
 	committee         []*Validator
+	params            ConsensusParams // governed parameters for the current epoch
 	pendingBlocks     map[Hash]*BlockApproval
 	pendingBlocksMu   sync.RWMutex
 
@@ -68,13 +68,25 @@ type AppNode struct {
 	metrics *MetricsCollector
 
 	// Block synchronization
-	syncTicker *time.Ticker
-	syncDone   chan bool
+	blockSyncer   *BlockSyncer
+	lightServer   *LightServer
+	blockImportMu sync.Mutex // Serializes adding and applying blocks
+	syncTicker    *time.Ticker
+	syncDone      chan bool
 
 	// Fast Sync and Transaction Batching
 	fastSyncManager    *FastSyncManager
+	snapshots          *SnapshotStore // Epoch state snapshots served to syncing peers
 	transactionBatcher *TransactionBatcher
 
+	// Software upgrades
+	upgradeHalted atomic.Bool
+	OnUpgradeHalt func(plan UpgradePlan) // called once when the node halts for an upgrade
+
+	// Checkpoint sync
+	Checkpoint *Checkpoint // Trusted block to start from instead of syncing from genesis
+	Backfill   bool        // Download the blocks below Checkpoint once it is reached
+
 	// --- TESTING ONLY ---
 	DisableTestTransactions bool // If true, disables addTestTransactions in Start()
 }
@@ -105,9 +117,18 @@ func NewAppNode(ctx context.Context, listenPort int, dbPath string, p2pPrivKey c
 	vr := NewValidatorRegistry(validatorStore, "validators")
 	txPool := NewTransactionPool()
 
-	// Clear any existing validators to ensure clean state
-	if err := vr.ClearAllValidators(); err != nil {
-		return nil, fmt.Errorf("failed to clear validator registry: %w", err)
+	// A new chain starts from an empty validator registry, without the upgrade
+	// plan of a previous chain. A chain store kept across a restart keeps its
+	// registry, so that the upgrade the chain halted at can be migrated.
+	if bc.Height() == 0 {
+		if err := vr.ClearAllValidators(); err != nil {
+			return nil, fmt.Errorf("failed to clear validator registry: %w", err)
+		}
+	}
+
+	// Run the migration for an upgrade the chain halted at, if this binary implements it
+	if err := runUpgradeMigrations(bc.Height(), chainStore, vr); err != nil {
+		return nil, err
 	}
 
 	// --- P2P Component ---
@@ -123,6 +144,10 @@ func NewAppNode(ctx context.Context, listenPort int, dbPath string, p2pPrivKey c
 	p2p.OnPeerConnect = func(peerID peer.ID, address string) {
 		barNet.AddPeer(peerID, address)
 	}
+	p2p.OnInvalidMessage = func(peerID peer.ID, reason string) {
+		barNet.UpdatePOMScore(peerID, 1, reason)
+	}
+	p2p.PeerScore = barNet.GossipScore
 
 	// Use the ECDSA public key to derive the blockchain address
 	addr := pubKeyToAddress(privKey.PubKey())
@@ -139,6 +164,7 @@ func NewAppNode(ctx context.Context, listenPort int, dbPath string, p2pPrivKey c
 		barNet:            barNet,
 		handshakeManager:  nil, // Will be initialized after node creation
 		committeeSelector: &CommitteeSelector{Registry: vr},
+		params:            vr.GetConsensusParams(),
 		pendingBlocks:     make(map[Hash]*BlockApproval),
 		approvalBuffer:    make(map[Hash][]*Approval),
 		inactivity:        make(map[Address]int),
@@ -158,6 +184,9 @@ func NewAppNode(ctx context.Context, listenPort int, dbPath string, p2pPrivKey c
 
 	// --- Fast Sync Manager ---
 	node.fastSyncManager = NewFastSyncManager(node)
+	node.snapshots = NewSnapshotStore()
+	node.blockSyncer = NewBlockSyncer(node)
+	node.lightServer = NewLightServer(node)
 
 	// --- Transaction Batcher ---
 	node.transactionBatcher = NewTransactionBatcher(txPool, 100, 5*time.Second)
@@ -170,11 +199,6 @@ func NewAppNode(ctx context.Context, listenPort int, dbPath string, p2pPrivKey c
 		}
 	})
 
-	// Register self as a validator (participating by default)
-	if err := vr.RegisterValidator(&Validator{Address: addr, Stake: 100, Participating: true}); err != nil {
-		return nil, fmt.Errorf("failed to register self as validator: %w", err)
-	}
-
 	// Give initial balance to the validator account
 	initialAccount := &Account{
 		Address: addr,
@@ -185,7 +209,9 @@ func NewAppNode(ctx context.Context, listenPort int, dbPath string, p2pPrivKey c
 		return nil, fmt.Errorf("failed to set initial account balance: %w", err)
 	}
 
-	log.Printf("Node %s registered as validator (ECDSA address, participating) with initial balance %d", addr.ToHex(), initialAccount.Balance)
+	// Validators come from the genesis file or register_validator transactions,
+	// so that every node selects committees from the same registry
+	log.Printf("Node %s started with initial balance %d", addr.ToHex(), initialAccount.Balance)
 
 	return node, nil
 }
@@ -201,9 +227,18 @@ func NewAppNodeWithStores(ctx context.Context, listenPort int, p2pPrivKey crypto
 	vr := NewValidatorRegistry(validatorStore, "validators")
 	txPool := NewTransactionPool()
 
-	// Clear any existing validators to ensure clean state
-	if err := vr.ClearAllValidators(); err != nil {
-		return nil, fmt.Errorf("failed to clear validator registry: %w", err)
+	// A new chain starts from an empty validator registry, without the upgrade
+	// plan of a previous chain. A chain store kept across a restart keeps its
+	// registry, so that the upgrade the chain halted at can be migrated.
+	if bc.Height() == 0 {
+		if err := vr.ClearAllValidators(); err != nil {
+			return nil, fmt.Errorf("failed to clear validator registry: %w", err)
+		}
+	}
+
+	// Run the migration for an upgrade the chain halted at, if this binary implements it
+	if err := runUpgradeMigrations(bc.Height(), chainStore, vr); err != nil {
+		return nil, err
 	}
 
 	// --- P2P Component ---
@@ -219,6 +254,10 @@ func NewAppNodeWithStores(ctx context.Context, listenPort int, p2pPrivKey crypto
 	p2p.OnPeerConnect = func(peerID peer.ID, address string) {
 		barNet.AddPeer(peerID, address)
 	}
+	p2p.OnInvalidMessage = func(peerID peer.ID, reason string) {
+		barNet.UpdatePOMScore(peerID, 1, reason)
+	}
+	p2p.PeerScore = barNet.GossipScore
 
 	// Use the ECDSA public key to derive the blockchain address
 	addr := pubKeyToAddress(privKey.PubKey())
@@ -235,6 +274,7 @@ func NewAppNodeWithStores(ctx context.Context, listenPort int, p2pPrivKey crypto
 		barNet:            barNet,
 		handshakeManager:  nil, // Will be initialized after node creation
 		committeeSelector: &CommitteeSelector{Registry: vr},
+		params:            vr.GetConsensusParams(),
 		pendingBlocks:     make(map[Hash]*BlockApproval),
 		approvalBuffer:    make(map[Hash][]*Approval),
 		inactivity:        make(map[Address]int),
@@ -254,6 +294,9 @@ func NewAppNodeWithStores(ctx context.Context, listenPort int, p2pPrivKey crypto
 
 	// --- Fast Sync Manager ---
 	node.fastSyncManager = NewFastSyncManager(node)
+	node.snapshots = NewSnapshotStore()
+	node.blockSyncer = NewBlockSyncer(node)
+	node.lightServer = NewLightServer(node)
 
 	// --- Transaction Batcher ---
 	node.transactionBatcher = NewTransactionBatcher(txPool, 100, 5*time.Second)
@@ -266,11 +309,6 @@ func NewAppNodeWithStores(ctx context.Context, listenPort int, p2pPrivKey crypto
 		}
 	})
 
-	// Register self as a validator (participating by default)
-	if err := vr.RegisterValidator(&Validator{Address: addr, Stake: 100, Participating: true}); err != nil {
-		return nil, fmt.Errorf("failed to register self as validator: %w", err)
-	}
-
 	// Give initial balance to the validator account
 	initialAccount := &Account{
 		Address: addr,
@@ -281,7 +319,9 @@ func NewAppNodeWithStores(ctx context.Context, listenPort int, p2pPrivKey crypto
 		return nil, fmt.Errorf("failed to set initial account balance: %w", err)
 	}
 
-	log.Printf("Node %s registered as validator (ECDSA address, participating) with initial balance %d", addr.ToHex(), initialAccount.Balance)
+	// Validators come from the genesis file or register_validator transactions,
+	// so that every node selects committees from the same registry
+	log.Printf("Node %s started with initial balance %d", addr.ToHex(), initialAccount.Balance)
 	return node, nil
 }
 
@@ -316,11 +356,13 @@ func (n *AppNode) Start() error {
 	n.p2p.RegisterTopic(TransactionTopic)
 	n.p2p.RegisterTopic(BlockTopic)
 	n.p2p.RegisterTopic(ApprovalTopic)
-	n.p2p.RegisterTopic(BlockRequestTopic)
-	n.p2p.RegisterTopic(BlockResponseTopic)
 	n.p2p.RegisterTopic(ValidatorTopic)
+	n.registerTopicValidators()
 
 	go n.p2p.Subscribe(n.ctx, n.handleNetworkMessage)
+	n.fastSyncManager.RegisterProtocol()
+	n.blockSyncer.RegisterProtocol()
+	n.lightServer.RegisterProtocol()
 	go n.p2p.Discover(n.ctx)
 	go n.producerLoop()
 
@@ -338,8 +380,11 @@ func (n *AppNode) Start() error {
 	// Start BAR inactivity monitor
 	n.inactivityMonitor.Start(n.ctx)
 
-	// Start Fast Sync Manager (if node is behind)
-	if n.bc.Height() < 10 {
+	// Start from a trusted checkpoint, or fast sync if the node is behind
+	if n.Checkpoint != nil && n.bc.Height() < n.Checkpoint.Height {
+		log.Printf("INFO: Node %s starting from checkpoint at height %d", n.address.ToHex(), n.Checkpoint.Height)
+		go n.startFromCheckpoint()
+	} else if n.bc.Height() < 10 {
 		log.Printf("INFO: Node %s starting fast sync (height: %d)", n.address.ToHex(), n.bc.Height())
 		n.fastSyncManager.Start(n.ctx)
 	}
@@ -383,58 +428,34 @@ func (n *AppNode) handleNetworkMessage(topic string, msg *pubsub.Message) {
 		n.handleBlockProposal(msg)
 	case ApprovalTopic:
 		n.handleApproval(msg)
-	case BlockRequestTopic:
-		n.handleBlockRequest(msg)
-	case BlockResponseTopic:
-		n.handleBlockResponse(msg)
 	case ValidatorTopic:
 		n.handleValidatorRegistration(msg)
 	}
 }
 
+// handleTransaction adds a gossiped transaction to the pool. The topic
+// validator has already decoded it and checked its signature, so a pool
+// rejection here depends on local state, such as a nonce another transaction
+// used first, and is not held against the peer that relayed it.
 func (n *AppNode) handleTransaction(msg *pubsub.Message) {
-	log.Printf("DEBUG: Node %s received transaction message, data size: %d bytes", n.address.ToHex(), len(msg.Data))
-
-	var netTx NetworkTransaction
-	if err := json.Unmarshal(msg.Data, &netTx); err != nil {
-		log.Printf("Failed to decode network tx: %v", err)
-		// BAR: Update POM score for malformed message
-		n.barNet.UpdatePOMScore(msg.ReceivedFrom, 1, "malformed transaction message")
-		return
-	}
-
-	if netTx.Tx == nil {
-		log.Printf("Received nil transaction in network message")
-		n.barNet.UpdatePOMScore(msg.ReceivedFrom, 1, "nil transaction in message")
-		return
-	}
-	if netTx.PubKey == nil {
-		log.Printf("Received nil public key in network message")
-		n.barNet.UpdatePOMScore(msg.ReceivedFrom, 1, "nil pubkey in message")
+	validated, ok := msg.ValidatorData.(*validatedTransaction)
+	if !ok {
+		log.Printf("WARN: Node %s dropping unvalidated transaction message", n.address.ToHex())
 		return
 	}
+	tx := validated.tx
 
-	log.Printf("DEBUG: Node %s received transaction %s", n.address.ToHex(), netTx.Tx.Hash.ToHex())
+	log.Printf("DEBUG: Node %s received transaction %s", n.address.ToHex(), tx.Hash.ToHex())
 
-	pubKey, err := UnmarshalPublicKey(netTx.PubKey)
-	if err != nil {
-		log.Printf("Failed to unmarshal public key: %v", err)
-		// BAR: Update POM score for invalid public key
-		n.barNet.UpdatePOMScore(msg.ReceivedFrom, 1, "invalid public key")
-		return
-	}
-
-	if err := n.txPool.AddTransaction(netTx.Tx, pubKey, n.state); err != nil {
+	if err := n.txPool.AddTransaction(tx, validated.pubKey, n.state); err != nil {
 		log.Printf("Failed to add transaction to pool: %v", err)
-		// BAR: Update POM score for invalid transaction
-		n.barNet.UpdatePOMScore(msg.ReceivedFrom, 1, "invalid transaction")
 		return
 	}
 
 	// Record metrics for successful transaction
 	n.metrics.RecordTransaction()
 
-	log.Printf("SUCCESS: Node %s added transaction %s to pool", n.address.ToHex(), netTx.Tx.Hash.ToHex())
+	log.Printf("SUCCESS: Node %s added transaction %s to pool", n.address.ToHex(), tx.Hash.ToHex())
 }
 
 func (n *AppNode) handleBlockProposal(msg *pubsub.Message) {
@@ -478,6 +499,22 @@ func (n *AppNode) processReceivedBlock(block *Block) {
 		return
 	}
 
+	if !n.checkUpgradeHeight(block.Header.BlockNumber) {
+		log.Printf("WARN: Node %s ignoring block #%d: halted for upgrade", n.address.ToHex(), block.Header.BlockNumber)
+		return
+	}
+
+	if n.fastSyncManager.Importing() {
+		log.Printf("DEBUG: Node %s ignoring block #%d during fast sync", n.address.ToHex(), block.Header.BlockNumber)
+		return
+	}
+
+	// The proposer must have signed with its current key, which may have been rotated
+	if err := verifyBlockSignature(n.state, block); err != nil {
+		log.Printf("WARN: Node %s rejecting block #%d: %v", n.address.ToHex(), block.Header.BlockNumber, err)
+		return
+	}
+
 	log.Printf("DEBUG: Node %s processing block #%d, current height: %d", n.address.ToHex(), block.Header.BlockNumber, currentHeight)
 
 	approval := NewBlockApproval(block, n.committee)
@@ -491,7 +528,7 @@ func (n *AppNode) processReceivedBlock(block *Block) {
 		log.Printf("INFO: Node %s found %d buffered approvals for block %s", n.address.ToHex(), len(bufferedApprovals), block.Header.Hash.ToHex())
 		for _, approvalMsg := range bufferedApprovals {
 			// Intentionally not calling processApproval to avoid lock contention
-			if err := approval.AddSignature(approvalMsg.Address, approvalMsg.Signature); err != nil {
+			if err := approval.AddApproval(approvalMsg); err != nil {
 				log.Printf("ERROR: Failed to add buffered approval signature for block %s: %v", approvalMsg.BlockHash.ToHex(), err)
 			}
 		}
@@ -511,8 +548,7 @@ func (n *AppNode) processReceivedBlock(block *Block) {
 
 	if isCommitteeMember {
 		log.Printf("INFO: Node %s (committee member) is voting for block #%d", n.address.ToHex(), block.Header.BlockNumber)
-		sig := btcec_ecdsa.Sign(n.privKey, block.Header.Hash[:])
-		if err := approval.AddSignature(n.address, sig.Serialize()); err != nil {
+		if err := approval.AddApproval(n.signApproval(block)); err != nil {
 			log.Printf("ERROR: Failed to add self-approval: %v", err)
 			n.pendingBlocksMu.Lock()
 			delete(n.pendingBlocks, block.Header.Hash)
@@ -543,6 +579,10 @@ func (n *AppNode) handleApproval(msg *pubsub.Message) {
 }
 
 func (n *AppNode) processApproval(approvalMsg *Approval) {
+	if err := verifyApproval(n.state, approvalMsg); err != nil {
+		log.Printf("WARN: Node %s rejecting approval for block %s from %s: %v", n.address.ToHex(), approvalMsg.BlockHash.ToHex(), approvalMsg.Address.ToHex(), err)
+		return
+	}
 	n.pendingBlocksMu.RLock()
 	approval, exists := n.pendingBlocks[approvalMsg.BlockHash]
 	n.pendingBlocksMu.RUnlock()
@@ -555,7 +595,7 @@ func (n *AppNode) processApproval(approvalMsg *Approval) {
 		return
 	}
 
-	if err := approval.AddSignature(approvalMsg.Address, approvalMsg.Signature); err != nil {
+	if err := approval.AddApproval(approvalMsg); err != nil {
 		log.Printf("ERROR: Failed to add approval signature for block %s: %v", approvalMsg.BlockHash.ToHex(), err)
 		return
 	}
@@ -618,14 +658,19 @@ func (n *AppNode) BroadcastTransaction(tx *Transaction) error {
 	return nil
 }
 
-func (n *AppNode) broadcastApproval(block *Block) {
+// signApproval signs the node's approval of a block.
+func (n *AppNode) signApproval(block *Block) *Approval {
 	sig := btcec_ecdsa.Sign(n.privKey, block.Header.Hash[:])
-	approval := &Approval{
+	return &Approval{
 		BlockHash: block.Header.Hash,
 		Address:   n.address,
 		Signature: sig.Serialize(),
+		PubKey:    n.privKey.PubKey().SerializeCompressed(),
 	}
-	approvalBytes, err := json.Marshal(approval)
+}
+
+func (n *AppNode) broadcastApproval(block *Block) {
+	approvalBytes, err := json.Marshal(n.signApproval(block))
 	if err != nil {
 		log.Printf("ERROR: Failed to marshal approval: %v", err)
 		return
@@ -637,7 +682,7 @@ func (n *AppNode) broadcastApproval(block *Block) {
 
 // producerLoop is the main loop for block production and consensus.
 func (n *AppNode) producerLoop() {
-	blockInterval := 2 * time.Second
+	blockInterval := n.params.BlockInterval()
 	ticker := time.NewTicker(blockInterval)
 	defer ticker.Stop()
 
@@ -672,10 +717,27 @@ func (n *AppNode) producerLoop() {
 			// Update committee and proposer selection
 			n.ForceCommitteeAndProposer()
 
+			// Follow governed changes to the block interval
+			if interval := n.params.BlockInterval(); interval != blockInterval {
+				log.Printf("INFO: Block interval changed from %s to %s", blockInterval, interval)
+				blockInterval = interval
+				ticker.Reset(blockInterval)
+			}
+
 			// Check if we should propose a block
 			currentHeight := n.bc.Height()
 			nextHeight := currentHeight + 1
 
+			// Stop at a scheduled upgrade this binary does not implement
+			if !n.checkUpgradeHeight(nextHeight) {
+				continue
+			}
+
+			// Fast sync imports blocks until it hands over to gossip
+			if n.fastSyncManager.Importing() {
+				continue
+			}
+
 			// Check if we have a proposer selector and committee
 			if n.proposerSelector == nil || len(n.committee) == 0 {
 				log.Printf("DEBUG: No proposer selector or committee available, skipping block production")
@@ -700,7 +762,7 @@ func (n *AppNode) producerLoop() {
 					len(txs), batch.TotalFee, batch.Priority)
 
 				// Create the block
-				block, err := n.bc.CreateBlock(txs, proposer, n.privKey)
+				block, err := n.bc.CreateBlockWithState(txs, proposer, n.privKey, n.state)
 				if err != nil {
 					log.Printf("ERROR: Failed to create block: %v", err)
 					continue
@@ -712,15 +774,9 @@ func (n *AppNode) producerLoop() {
 					continue
 				}
 
-				// Add the block to our blockchain
-				if err := n.bc.AddBlock(block); err != nil {
-					log.Printf("ERROR: Failed to add block to blockchain: %v", err)
-					continue
-				}
-
-				// Apply the block to our state
-				if err := n.bc.ApplyBlockWithRegistry(block, n.state, n.vr); err != nil {
-					log.Printf("ERROR: Failed to apply block to state: %v", err)
+				// Apply the block to our state, and store it once it has applied
+				if err := n.importBlock(block); err != nil {
+					log.Printf("ERROR: Failed to import block: %v", err)
 					continue
 				}
 
@@ -728,6 +784,7 @@ func (n *AppNode) producerLoop() {
 				for _, tx := range txs {
 					n.txPool.RemoveTransaction(tx.Hash)
 				}
+				n.updatePool()
 
 				log.Printf("INFO: Node %s successfully created and added block %d with %d transactions",
 					n.address.ToHex(), nextHeight, len(txs))
@@ -761,13 +818,19 @@ func (n *AppNode) producerLoop() {
 }
 
 func (n *AppNode) ForceCommitteeAndProposer() {
-	currentHeight := n.bc.Height()
-	epoch := currentHeight / EpochLength
-	epochStartHeight := epoch * EpochLength
+	epochInfo := n.vr.CurrentEpoch()
+	epoch := epochInfo.Number
+	epochStartHeight := epochInfo.StartHeight
 
 	// Check if we need to re-elect committee
 	needReElection := false
 
+	// Pick up governed parameter changes once per epoch
+	if n.proposerSelector == nil || n.proposerSelector.EpochStart != epochStartHeight {
+		n.applyConsensusParams(n.vr.GetConsensusParams())
+	}
+	committeeSize := int(n.params.CommitteeSize)
+
 	// Re-elect if no committee exists
 	if n.committee == nil || len(n.committee) == 0 {
 		needReElection = true
@@ -779,25 +842,16 @@ func (n *AppNode) ForceCommitteeAndProposer() {
 	}
 
 	// Re-elect if we have fewer committee members than expected
-	if len(n.committee) < CommitteeSize {
+	if len(n.committee) < committeeSize {
 		needReElection = true
 	}
 
-	// Re-elect if we have new validators that aren't in the committee
-	if n.committee != nil {
-		committeeMap := make(map[Address]bool)
-		for _, member := range n.committee {
-			committeeMap[member.Address] = true
-		}
-
-		allValidators, err := n.vr.GetAllValidators()
-		if err == nil {
-			for _, v := range allValidators {
-				if v.Participating && !committeeMap[v.Address] {
-					needReElection = true
-					break
-				}
-			}
+	// Re-elect if the registry now selects another committee, since peers
+	// only accept certificates from the committee their registry selects
+	if !needReElection {
+		selected, err := n.committeeSelector.SelectCommittee(committeeSize)
+		if err == nil && !sameCommittee(selected, n.committee) {
+			needReElection = true
 		}
 	}
 
@@ -805,7 +859,7 @@ func (n *AppNode) ForceCommitteeAndProposer() {
 		return
 	}
 
-	newCommittee, err := n.committeeSelector.SelectCommittee(CommitteeSize)
+	newCommittee, err := n.committeeSelector.SelectCommittee(committeeSize)
 	if err != nil {
 		log.Printf("ERROR: Failed to get committee for epoch %d: %v", epoch, err)
 		return
@@ -826,11 +880,25 @@ func (n *AppNode) ForceCommitteeAndProposer() {
 		TestSyncCommittee(newCommittee)
 	}
 
-	n.proposerSelector = NewProposerSelectorWithRotation(newCommittee, epochStartHeight, EpochLength)
+	n.proposerSelector = NewProposerSelectorWithRotation(newCommittee, epochStartHeight, epochInfo.Length)
 	log.Printf("INFO: Node %s elected new committee for epoch starting at height %d. Committee size: %d, members: %v",
 		n.address.ToHex(), epochStartHeight, len(n.committee), committeeAddresses)
 }
 
+// applyConsensusParams hands the governed consensus parameters to the
+// components that enforce them.
+func (n *AppNode) applyConsensusParams(params ConsensusParams) {
+	if params != n.params {
+		log.Printf("INFO: Applying consensus parameters: %+v", params)
+	}
+	n.params = params
+	n.bc.SetMaxBlockSize(params.MaxBlockSize)
+	n.bc.SetGasRules(params.BlockGasLimit, params.MinBaseFee)
+	n.txPool.SetFeeRules(params.MinTransactionFee, params.MaxBatchFee)
+	n.txPool.SetGasRules(params.BlockGasLimit, n.bc.NextBaseFee())
+	n.barNet.SetPOMThresholds(int(params.POMThreshold), int(params.POMBanThreshold))
+}
+
 func ReplaceInactiveValidator(committee []*Validator, inactiveAddress Address, vr *ValidatorRegistry) ([]*Validator, error) {
 	log.Printf("INFO: Replacing inactive validator %s", inactiveAddress.ToHex())
 
@@ -890,91 +958,10 @@ func ReplaceInactiveValidator(committee []*Validator, inactiveAddress Address, v
 	return newCommittee, nil
 }
 
-type BlockRequest struct {
-	Height uint64  `json:"height"`
-	From   Address `json:"from"`
-}
-
-type BlockResponse struct {
-	Block *Block  `json:"block"`
-	From  Address `json:"from"`
-}
-
-func (n *AppNode) handleBlockRequest(msg *pubsub.Message) {
-	var request BlockRequest
-	if err := json.Unmarshal(msg.Data, &request); err != nil {
-		log.Printf("ERROR: Failed to decode block request: %v", err)
-		return
-	}
-
-	if request.From == n.address {
-		return
-	}
-
-	log.Printf("INFO: Node %s received block request for height %d from %s",
-		n.address.ToHex(), request.Height, request.From.ToHex())
-
-	block, err := n.bc.GetBlockByHeight(request.Height)
-	if err != nil {
-		log.Printf("DEBUG: Node %s doesn't have block #%d", n.address.ToHex(), request.Height)
-		return
-	}
-
-	response := &BlockResponse{
-		Block: block,
-		From:  n.address,
-	}
-	responseBytes, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("ERROR: Failed to marshal block response: %v", err)
-		return
-	}
-
-	log.Printf("INFO: Node %s sending block #%d to %s", n.address.ToHex(), request.Height, request.From.ToHex())
-	if err := n.p2p.Publish(n.ctx, BlockResponseTopic, responseBytes); err != nil {
-		log.Printf("ERROR: Failed to publish block response: %v", err)
-	}
-}
-
-func (n *AppNode) handleBlockResponse(msg *pubsub.Message) {
-	var response BlockResponse
-	if err := json.Unmarshal(msg.Data, &response); err != nil {
-		log.Printf("ERROR: Failed to decode block response: %v", err)
-		return
-	}
-
-	if response.From == n.address {
-		return
-	}
-
-	log.Printf("INFO: Node %s received block response for block #%d from %s",
-		n.address.ToHex(), response.Block.Header.BlockNumber, response.From.ToHex())
-
-	n.processReceivedBlock(response.Block)
-}
-
-func (n *AppNode) RequestBlock(height uint64) {
-	request := &BlockRequest{
-		Height: height,
-		From:   n.address,
-	}
-
-	requestBytes, err := json.Marshal(request)
-	if err != nil {
-		log.Printf("ERROR: Failed to marshal block request: %v", err)
-		return
-	}
-
-	log.Printf("INFO: Node %s requesting block #%d", n.address.ToHex(), height)
-	if err := n.p2p.Publish(n.ctx, BlockRequestTopic, requestBytes); err != nil {
-		log.Printf("ERROR: Failed to publish block request: %v", err)
-	}
-}
-
 func (n *AppNode) finalizeApprovedBlock(block *Block) {
 	// Atomically check and remove the block from pending to "claim" it for finalization.
 	n.pendingBlocksMu.Lock()
-	_, ok := n.pendingBlocks[block.Header.Hash]
+	approval, ok := n.pendingBlocks[block.Header.Hash]
 	if !ok {
 		// Block was already finalized by another goroutine.
 		n.pendingBlocksMu.Unlock()
@@ -984,18 +971,19 @@ func (n *AppNode) finalizeApprovedBlock(block *Block) {
 	n.pendingBlocksMu.Unlock()
 
 	log.Printf("SUCCESS: Node %s confirms block %s is now APPROVED!", n.address.ToHex(), block.Header.Hash.ToHex())
-	if err := n.bc.AddBlock(block); err != nil {
-		log.Printf("CRITICAL: Failed to add approved block %d to blockchain: %v", block.Header.BlockNumber, err)
-		// If adding fails, we've already "claimed" it, so other nodes won't retry.
-		// This is a critical state. For now, we just log and halt processing for this block.
+	n.blockImportMu.Lock()
+	defer n.blockImportMu.Unlock()
+	if n.bc.HasBlock(block.Header.Hash) {
+		// Already imported by block sync
 		return
 	}
-	log.Printf("SUCCESS: Node %s added approved block %d to blockchain.", n.address.ToHex(), block.Header.BlockNumber)
-	if err := n.bc.ApplyBlockWithRegistry(block, n.state, n.vr); err != nil {
-		log.Printf("ERROR: Failed to apply block transactions to state: %v", err)
+	block.Certificate = approval.Certificate()
+	if err := n.importBlock(block); err != nil {
+		// We've already "claimed" the block, so other goroutines won't retry it
+		log.Printf("ERROR: Failed to import approved block %d: %v", block.Header.BlockNumber, err)
 		return
 	}
-	log.Printf("SUCCESS: Node %s applied block %d transactions to state.", n.address.ToHex(), block.Header.BlockNumber)
+	log.Printf("SUCCESS: Node %s applied and added approved block %d to blockchain.", n.address.ToHex(), block.Header.BlockNumber)
 
 	// Record metrics for block finalization
 	n.metrics.RecordBlockProduction()
@@ -1006,6 +994,32 @@ func (n *AppNode) finalizeApprovedBlock(block *Block) {
 	for _, tx := range block.Transactions {
 		n.txPool.RemoveTransaction(tx.Hash)
 	}
+	n.updatePool()
+}
+
+// importBlock applies a block that extends the chain and stores it once it has
+// applied. Every path that adds blocks to the chain goes through it, so none
+// can apply a block at or past a scheduled upgrade this binary does not
+// implement: reaching one halts the node instead.
+func (n *AppNode) importBlock(block *Block) error {
+	if !n.checkUpgradeHeight(block.Header.BlockNumber) {
+		return fmt.Errorf("block %d: halted for upgrade", block.Header.BlockNumber)
+	}
+	if err := n.bc.ApplyBlockWithRegistry(block, n.state, n.vr); err != nil {
+		return fmt.Errorf("block %d: %w", block.Header.BlockNumber, err)
+	}
+	if err := n.bc.AddBlock(block); err != nil {
+		return err
+	}
+	n.snapshots.AfterBlock(block.Header.BlockNumber, n.state, n.vr)
+	return nil
+}
+
+// updatePool prepares the transaction pool for the next block: it follows the
+// base fee and drops transactions that have expired.
+func (n *AppNode) updatePool() {
+	n.txPool.SetGasRules(n.params.BlockGasLimit, n.bc.NextBaseFee())
+	n.txPool.EvictExpired(n.state.Height() + 1)
 }
 
 func (n *AppNode) broadcastValidatorRegistration() {
@@ -1040,6 +1054,11 @@ func (n *AppNode) sendValidatorRegistration() {
 	validatorRegistration := &ValidatorRegistration{
 		Address: n.address,
 		Stake:   validator.Stake,
+		PeerID:  n.p2p.host.ID().String(),
+	}
+	if err := validatorRegistration.Sign(n.privKey); err != nil {
+		log.Printf("ERROR: Failed to sign validator registration: %v", err)
+		return
 	}
 	registrationBytes, err := json.Marshal(validatorRegistration)
 	if err != nil {
@@ -1053,34 +1072,36 @@ func (n *AppNode) sendValidatorRegistration() {
 	}
 }
 
+// handleValidatorRegistration handles validator announcements gossiped on ValidatorTopic.
+// Announcements are informational only: the registry is changed exclusively by
+// signed register_validator, participation and leave_participation transactions.
+// The topic validator checked the signature; the key must also be the
+// announced address's current one.
 func (n *AppNode) handleValidatorRegistration(msg *pubsub.Message) {
 	var registration ValidatorRegistration
 	if err := json.Unmarshal(msg.Data, &registration); err != nil {
 		log.Printf("ERROR: Failed to decode validator registration: %v", err)
 		return
 	}
-	log.Printf("INFO: Node %s received validator registration for %s with stake %d", n.address.ToHex(), registration.Address.ToHex(), registration.Stake)
+	hash, err := registration.SigningHash()
+	if err != nil {
+		log.Printf("ERROR: Failed to hash validator registration: %v", err)
+		return
+	}
+	if err := verifyKeySignature(n.state, registration.Address, registration.PubKey, hash, registration.Signature); err != nil {
+		log.Printf("WARN: Dropping validator announcement for %s: %v", registration.Address.ToHex(), err)
+		n.barNet.UpdatePOMScore(msg.GetFrom(), 1, "validator announcement not signed by its validator")
+		return
+	}
+	log.Printf("INFO: Node %s received validator announcement for %s with stake %d", n.address.ToHex(), registration.Address.ToHex(), registration.Stake)
 
-	// Register the validator in the registry
-	if err := n.vr.RegisterValidator(&Validator{
-		Address:       registration.Address,
-		Stake:         registration.Stake,
-		Participating: true,
-	}); err != nil {
-		log.Printf("ERROR: Failed to register validator: %v", err)
-	} else {
-		log.Printf("INFO: Node %s registered validator %s with stake %d", n.address.ToHex(), registration.Address.ToHex(), registration.Stake)
-		// Force committee re-selection to include the new validator
-		n.ForceCommitteeAndProposer()
-		// Initialize the account for the new validator if it doesn't exist or has zero balance
-		acc, _ := n.state.GetAccount(registration.Address)
-		if acc.Balance == 0 {
-			acc.Balance = 1000
-			if err := n.state.PutAccount(acc); err != nil {
-				log.Printf("ERROR: Failed to set initial balance for validator %s: %v", registration.Address.ToHex(), err)
-			}
-			log.Printf("INFO: Initialized account for validator %s with balance 1000 (on registration)", registration.Address.ToHex())
-		}
+	v, err := n.vr.GetValidator(registration.Address)
+	if err != nil {
+		log.Printf("ERROR: Failed to look up announced validator %s: %v", registration.Address.ToHex(), err)
+		return
+	}
+	if v == nil {
+		log.Printf("DEBUG: Announced validator %s is not registered on-chain; ignoring until a register_validator transaction is included", registration.Address.ToHex())
 	}
 }
 
@@ -1181,18 +1202,10 @@ func (n *AppNode) syncLoop() {
 	}
 }
 
+// performBlockSync downloads any blocks the node is missing from its peers.
 func (n *AppNode) performBlockSync() {
-	currentHeight := n.bc.Height()
-
-	// Check if we have any connected peers by checking if we can publish
-	// For simplicity, we'll just request the next few blocks we might be missing
-	for height := currentHeight + 1; height <= currentHeight+3; height++ {
-		// Check if we have a block at this height by trying to get it
-		_, err := n.bc.GetBlockByHeight(height)
-		if err != nil {
-			// Block doesn't exist at this height, request it
-			log.Printf("DEBUG: Node %s requesting block %d for synchronization", n.address.ToHex(), height)
-			n.RequestBlock(height)
-		}
+	if n.fastSyncManager.Importing() {
+		return
 	}
+	n.blockSyncer.Sync(n.ctx)
 }
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
@@ -13,34 +15,54 @@ import (
 
 const (
 	OptimisticPushTopic = "/dyphira/optimistic-push/v1"
-	PushTimeout         = 30 * time.Second
+	PushTimeout         = 30 * time.Second // How long a push request waits for its response
+
+	MaxPushBlocks  = 16  // Recent blocks pushed to a full node
+	MaxPushHeaders = 100 // Recent headers pushed to a light node
 )
 
 // OptimisticPushMessage represents an optimistic push message
 type OptimisticPushMessage struct {
-	Type          string  `json:"type"` // "push_request", "push_response", "block_data"
+	Type          string  `json:"type"` // "push_request" or "push_response"
 	From          peer.ID `json:"from"`
 	To            peer.ID `json:"to"`
 	RequestID     string  `json:"request_id"`
 	Timestamp     int64   `json:"timestamp"`
 	ClientVersion string  `json:"client_version"`
 
-	// Block data for push response
-	BlockHeight  uint64        `json:"block_height,omitempty"`
-	BlockData    interface{}   `json:"block_data,omitempty"`
-	BlockHeaders []interface{} `json:"block_headers,omitempty"` // For light nodes
-	IsLightNode  bool          `json:"is_light_node"`
+	// The sender's recent finalized blocks, with their signatures and commit
+	// certificates, or only their headers for light nodes
+	BlockHeight uint64        `json:"block_height,omitempty"`
+	Blocks      []*Block      `json:"blocks,omitempty"`
+	Headers     []*syncHeader `json:"headers,omitempty"` // For light nodes
+	IsLightNode bool          `json:"is_light_node"`
+}
+
+// pushRequestKey identifies a push request sent to one peer.
+type pushRequestKey struct {
+	id   string
+	peer peer.ID
+}
+
+// pendingPush is a push request awaiting its response.
+type pendingPush struct {
+	isLightNode bool
+	expires     time.Time
 }
 
 // OptimisticPushManager manages optimistic push protocol for new nodes
 type OptimisticPushManager struct {
 	node *AppNode
+
+	pending   map[pushRequestKey]pendingPush // Outstanding requests; a response to any other is unsolicited
+	pendingMu sync.Mutex
 }
 
 // NewOptimisticPushManager creates a new optimistic push manager
 func NewOptimisticPushManager(node *AppNode) *OptimisticPushManager {
 	return &OptimisticPushManager{
-		node: node,
+		node:    node,
+		pending: make(map[pushRequestKey]pendingPush),
 	}
 }
 
@@ -73,13 +95,18 @@ func (opm *OptimisticPushManager) handleOptimisticPushMessage(topic string, msg
 		return
 	}
 
+	// Gossip is signed by its author, who must be the peer the message claims
+	// to be from
+	if pushMsg.From != msg.GetFrom() {
+		opm.node.barNet.UpdatePOMScore(msg.GetFrom(), 1, "optimistic push message with a forged sender")
+		return
+	}
+
 	switch pushMsg.Type {
 	case "push_request":
 		opm.handlePushRequest(&pushMsg)
 	case "push_response":
 		opm.handlePushResponse(&pushMsg)
-	case "block_data":
-		opm.handleBlockData(&pushMsg)
 	}
 }
 
@@ -103,47 +130,96 @@ func (opm *OptimisticPushManager) handlePushRequest(request *OptimisticPushMessa
 	opm.sendPushResponse(request.From, request.RequestID, request.IsLightNode)
 }
 
-// handlePushResponse handles incoming push responses
+// handlePushResponse handles incoming push responses. A response must answer
+// an outstanding request to its sender and carry what was asked for: blocks
+// for a full node, headers for a light one.
 func (opm *OptimisticPushManager) handlePushResponse(response *OptimisticPushMessage) {
 	// Verify the response is for us
 	if response.To != opm.node.p2p.host.ID() {
 		return
 	}
 
+	request, ok := opm.takePending(response.RequestID, response.From)
+	if !ok {
+		log.Printf("BAR: Unsolicited push response from peer %s for request %s", response.From, response.RequestID)
+		opm.node.barNet.UpdatePOMScore(response.From, 1, "unsolicited optimistic push")
+		return
+	}
+	if (request.isLightNode && len(response.Blocks) > 0) || (!request.isLightNode && len(response.Headers) > 0) {
+		opm.node.barNet.UpdatePOMScore(response.From, 1, "optimistic push of the wrong kind")
+		return
+	}
+
 	log.Printf("BAR: Received push response from peer %s for request %s",
 		response.From, response.RequestID)
 
-	// Process the received block data
-	if response.BlockData != nil {
-		opm.processReceivedBlockData(response.BlockData, response.BlockHeight)
+	if len(response.Blocks) > 0 {
+		if err := opm.processReceivedBlocks(response.From, response.Blocks); err != nil {
+			log.Printf("BAR: Pushed blocks from %s: %v", response.From, err)
+		}
 	}
-
-	if response.BlockHeaders != nil {
-		opm.processReceivedBlockHeaders(response.BlockHeaders)
+	if len(response.Headers) > 0 {
+		if err := opm.processReceivedBlockHeaders(response.From, response.Headers); err != nil {
+			log.Printf("BAR: Pushed headers from %s: %v", response.From, err)
+		}
 	}
 }
 
-// handleBlockData handles incoming block data messages
-func (opm *OptimisticPushManager) handleBlockData(blockMsg *OptimisticPushMessage) {
-	// Verify the block data is for us
-	if blockMsg.To != opm.node.p2p.host.ID() {
-		return
+// addPending records a push request sent to a peer, dropping expired ones.
+func (opm *OptimisticPushManager) addPending(requestID string, to peer.ID, isLightNode bool) {
+	opm.pendingMu.Lock()
+	defer opm.pendingMu.Unlock()
+	now := time.Now()
+	for key, request := range opm.pending {
+		if now.After(request.expires) {
+			delete(opm.pending, key)
+		}
 	}
+	opm.pending[pushRequestKey{requestID, to}] = pendingPush{isLightNode: isLightNode, expires: now.Add(PushTimeout)}
+}
 
-	log.Printf("BAR: Received block data from peer %s for height %d",
-		blockMsg.From, blockMsg.BlockHeight)
+// removePending forgets a push request that could not be sent.
+func (opm *OptimisticPushManager) removePending(requestID string, to peer.ID) {
+	opm.pendingMu.Lock()
+	defer opm.pendingMu.Unlock()
+	delete(opm.pending, pushRequestKey{requestID, to})
+}
 
-	// Process the received block data
-	if blockMsg.BlockData != nil {
-		opm.processReceivedBlockData(blockMsg.BlockData, blockMsg.BlockHeight)
+// takePending removes and returns the outstanding request a response from a
+// peer answers. Each request is answered once.
+func (opm *OptimisticPushManager) takePending(requestID string, from peer.ID) (pendingPush, bool) {
+	opm.pendingMu.Lock()
+	defer opm.pendingMu.Unlock()
+	key := pushRequestKey{requestID, from}
+	request, ok := opm.pending[key]
+	delete(opm.pending, key)
+	if !ok || time.Now().After(request.expires) {
+		return pendingPush{}, false
 	}
+	return request, true
 }
 
 // sendPushResponse sends a push response with block data to a requesting peer
 func (opm *OptimisticPushManager) sendPushResponse(to peer.ID, requestID string, isLightNode bool) {
-	// Get current blockchain state
-	currentHeight := opm.node.bc.Height()
+	response := opm.newPushResponse(to, requestID, isLightNode)
+	responseData, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("BAR: Failed to marshal push response: %v", err)
+		return
+	}
 
+	if err := opm.node.p2p.Publish(opm.node.ctx, OptimisticPushTopic, responseData); err != nil {
+		log.Printf("BAR: Failed to send push response: %v", err)
+		return
+	}
+
+	log.Printf("BAR: Sent push response to peer %s with %d blocks and %d headers", to, len(response.Blocks), len(response.Headers))
+}
+
+// newPushResponse answers a push request with the recent blocks, or for a
+// light node their headers.
+func (opm *OptimisticPushManager) newPushResponse(to peer.ID, requestID string, isLightNode bool) *OptimisticPushMessage {
+	currentHeight := opm.node.bc.Height()
 	response := &OptimisticPushMessage{
 		Type:          "push_response",
 		From:          opm.node.p2p.host.ID(),
@@ -154,28 +230,12 @@ func (opm *OptimisticPushManager) sendPushResponse(to peer.ID, requestID string,
 		BlockHeight:   currentHeight,
 		IsLightNode:   isLightNode,
 	}
-
-	// Add block data based on node type
 	if isLightNode {
-		// For light nodes, send block headers
-		response.BlockHeaders = opm.getBlockHeaders(currentHeight)
+		response.Headers = opm.getBlockHeaders(currentHeight)
 	} else {
-		// For full nodes, send full block data
-		response.BlockData = opm.getBlockData(currentHeight)
-	}
-
-	responseData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("BAR: Failed to marshal push response: %v", err)
-		return
-	}
-
-	if err := opm.node.p2p.Publish(opm.node.ctx, OptimisticPushTopic, responseData); err != nil {
-		log.Printf("BAR: Failed to send push response: %v", err)
-		return
+		response.Blocks = opm.getRecentBlocks(currentHeight)
 	}
-
-	log.Printf("BAR: Sent push response to peer %s with %d blocks", to, currentHeight)
+	return response
 }
 
 // RequestOptimisticPush requests optimistic push from whitelisted peers
@@ -195,84 +255,186 @@ func (opm *OptimisticPushManager) RequestOptimisticPush(isLightNode bool) error
 
 	// Send push request to all whitelisted peers
 	for _, peerInfo := range whitelist {
-		request := &OptimisticPushMessage{
-			Type:          "push_request",
-			From:          opm.node.p2p.host.ID(),
-			To:            peerInfo.ID,
-			RequestID:     requestID,
-			Timestamp:     time.Now().UnixNano(),
-			ClientVersion: "dyphira-v1.0",
-			IsLightNode:   isLightNode,
-		}
-
-		requestData, err := json.Marshal(request)
-		if err != nil {
-			log.Printf("BAR: Failed to marshal push request: %v", err)
-			continue
-		}
-
-		if err := opm.node.p2p.Publish(opm.node.ctx, OptimisticPushTopic, requestData); err != nil {
+		if err := opm.sendPushRequest(peerInfo.ID, requestID, isLightNode); err != nil {
 			log.Printf("BAR: Failed to send push request to %s: %v", peerInfo.ID, err)
 			continue
 		}
-
 		log.Printf("BAR: Sent push request to peer %s", peerInfo.ID)
 	}
 
 	return nil
 }
 
-// getBlockHeaders returns block headers for light nodes
-func (opm *OptimisticPushManager) getBlockHeaders(height uint64) []interface{} {
-	headers := make([]interface{}, 0)
+// sendPushRequest asks a peer to push its recent blocks, and records the
+// request so that the response is accepted.
+func (opm *OptimisticPushManager) sendPushRequest(to peer.ID, requestID string, isLightNode bool) error {
+	request := &OptimisticPushMessage{
+		Type:          "push_request",
+		From:          opm.node.p2p.host.ID(),
+		To:            to,
+		RequestID:     requestID,
+		Timestamp:     time.Now().UnixNano(),
+		ClientVersion: "dyphira-v1.0",
+		IsLightNode:   isLightNode,
+	}
+	requestData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push request: %w", err)
+	}
 
-	// Get headers for the last 100 blocks (or all if less)
-	startHeight := uint64(0)
-	if height > 100 {
-		startHeight = height - 100
+	opm.addPending(requestID, to, isLightNode)
+	if err := opm.node.p2p.Publish(opm.node.ctx, OptimisticPushTopic, requestData); err != nil {
+		opm.removePending(requestID, to)
+		return err
 	}
+	return nil
+}
+
+// getBlockHeaders returns the headers of the last MaxPushHeaders blocks up to
+// height, for light nodes
+func (opm *OptimisticPushManager) getBlockHeaders(height uint64) []*syncHeader {
+	var headers []*syncHeader
+	for _, block := range opm.recentBlocks(height, MaxPushHeaders) {
+		headers = append(headers, newSyncHeader(block))
+	}
+	return headers
+}
+
+// getRecentBlocks returns the last MaxPushBlocks blocks up to height, for
+// full nodes
+func (opm *OptimisticPushManager) getRecentBlocks(height uint64) []*Block {
+	return opm.recentBlocks(height, MaxPushBlocks)
+}
 
+// recentBlocks returns up to count finalized blocks ending at height. The
+// genesis block, which every node has, is left out.
+func (opm *OptimisticPushManager) recentBlocks(height, count uint64) []*Block {
+	startHeight := uint64(1)
+	if height >= count {
+		startHeight = height - count + 1
+	}
+	var blocks []*Block
 	for i := startHeight; i <= height; i++ {
 		block, err := opm.node.bc.GetBlockByHeight(i)
 		if err != nil {
-			continue
+			break
 		}
-		headers = append(headers, block.Header)
+		blocks = append(blocks, block)
 	}
+	return blocks
+}
 
-	return headers
+// checkPushedHeaders checks that pushed headers are well-formed and form a
+// chain of consecutive blocks.
+func checkPushedHeaders(headers []*syncHeader) error {
+	for i, h := range headers {
+		if i == 0 {
+			if h == nil || h.Header == nil {
+				return errors.New("empty header")
+			}
+			if hash, err := h.Header.ComputeHash(); err != nil || hash != h.Header.Hash {
+				return errors.New("header has a bad hash")
+			}
+			continue
+		}
+		if err := checkHeaderLink(headers[i-1].Header, h); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// getBlockData returns full block data for full nodes
-func (opm *OptimisticPushManager) getBlockData(height uint64) interface{} {
-	// Return the latest block for now
-	block, err := opm.node.bc.GetBlockByHeight(height)
+// processReceivedBlocks imports pushed blocks the way block sync does: each
+// must match its header, follow the chain tip, and carry the proposer's
+// signature and a commit certificate that verify against the node's state.
+// If the blocks start beyond the tip, block sync fetches the blocks between.
+func (opm *OptimisticPushManager) processReceivedBlocks(from peer.ID, blocks []*Block) error {
+	n := opm.node
+	log.Printf("BAR: Processing %d pushed blocks", len(blocks))
+
+	headers := make([]*syncHeader, len(blocks))
+	for i, block := range blocks {
+		if block == nil || block.Header == nil {
+			n.barNet.UpdatePOMScore(from, 1, "malformed optimistic push")
+			return errors.New("empty block")
+		}
+		if err := verifyBlockBody(block); err != nil {
+			n.barNet.UpdatePOMScore(from, 1, "pushed block does not match its header")
+			return fmt.Errorf("block %d: %w", block.Header.BlockNumber, err)
+		}
+		headers[i] = newSyncHeader(block)
+	}
+	if err := checkPushedHeaders(headers); err != nil {
+		n.barNet.UpdatePOMScore(from, 1, "malformed optimistic push")
+		return err
+	}
+
+	if n.fastSyncManager != nil && n.fastSyncManager.Importing() {
+		return nil
+	}
+	last, err := n.bc.GetLastBlock()
 	if err != nil {
+		return err
+	}
+	for len(blocks) > 0 && blocks[0].Header.BlockNumber <= last.Header.BlockNumber {
+		blocks = blocks[1:]
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	if blocks[0].Header.BlockNumber != last.Header.BlockNumber+1 {
+		go n.blockSyncer.Sync(n.ctx)
 		return nil
 	}
-	return block
-}
-
-// processReceivedBlockData processes received block data
-func (opm *OptimisticPushManager) processReceivedBlockData(blockData interface{}, height uint64) {
-	log.Printf("BAR: Processing received block data for height %d", height)
 
-	// TODO: Implement block data processing
-	// This would involve:
-	// 1. Validating the block data
-	// 2. Adding blocks to the blockchain if they're missing
-	// 3. Updating the node's state
+	parent := last.Header
+	var verified []*Block
+	for _, block := range blocks {
+		// As in block sync, only a block right after the tip is the sender's
+		// fault: later ones may be signed with keys rotated in between
+		if err := n.blockSyncer.verifyHeader(parent, newSyncHeader(block)); err != nil {
+			if len(verified) == 0 {
+				n.barNet.UpdatePOMScore(from, 1, "pushed block failed verification")
+			}
+			log.Printf("BAR: Pushed block %d failed verification: %v", block.Header.BlockNumber, err)
+			break
+		}
+		verified = append(verified, block)
+		parent = block.Header
+	}
+	if len(verified) == 0 {
+		return nil
+	}
+	imported, err := n.blockSyncer.importBlocks(verified)
+	log.Printf("BAR: Imported %d pushed blocks, chain height is now %d", imported, n.bc.Height())
+	return err
 }
 
-// processReceivedBlockHeaders processes received block headers
-func (opm *OptimisticPushManager) processReceivedBlockHeaders(headers []interface{}) {
+// processReceivedBlockHeaders verifies pushed headers against the chain tip
+// and, if any extend it, fetches their blocks with block sync.
+func (opm *OptimisticPushManager) processReceivedBlockHeaders(from peer.ID, headers []*syncHeader) error {
+	n := opm.node
 	log.Printf("BAR: Processing received %d block headers", len(headers))
 
-	// TODO: Implement block header processing for light nodes
-	// This would involve:
-	// 1. Validating the headers
-	// 2. Storing headers for light node verification
-	// 3. Requesting full blocks for headers of interest
+	if err := checkPushedHeaders(headers); err != nil {
+		n.barNet.UpdatePOMScore(from, 1, "malformed optimistic push")
+		return err
+	}
+	last, err := n.bc.GetLastBlock()
+	if err != nil {
+		return err
+	}
+	for _, h := range headers {
+		if h.Header.BlockNumber == last.Header.BlockNumber+1 {
+			if err := n.blockSyncer.verifyHeader(last.Header, h); err != nil {
+				n.barNet.UpdatePOMScore(from, 1, "pushed header failed verification")
+				return err
+			}
+			go n.blockSyncer.Sync(n.ctx)
+			return nil
+		}
+	}
+	return nil
 }
 
 // TriggerOptimisticPushForNewPeer triggers optimistic push for a newly promoted peer
@@ -286,23 +448,8 @@ func (opm *OptimisticPushManager) TriggerOptimisticPushForNewPeer(peerID peer.ID
 	log.Printf("BAR: Triggering optimistic push for newly promoted peer %s", peerID)
 
 	// Send a push request to the new peer
-	request := &OptimisticPushMessage{
-		Type:          "push_request",
-		From:          opm.node.p2p.host.ID(),
-		To:            peerID,
-		RequestID:     fmt.Sprintf("new_peer_push_%d", time.Now().UnixNano()),
-		Timestamp:     time.Now().UnixNano(),
-		ClientVersion: "dyphira-v1.0",
-		IsLightNode:   false, // Assume full node for now
-	}
-
-	requestData, err := json.Marshal(request)
-	if err != nil {
-		log.Printf("BAR: Failed to marshal new peer push request: %v", err)
-		return
-	}
-
-	if err := opm.node.p2p.Publish(opm.node.ctx, OptimisticPushTopic, requestData); err != nil {
+	requestID := fmt.Sprintf("new_peer_push_%d", time.Now().UnixNano())
+	if err := opm.sendPushRequest(peerID, requestID, false); err != nil {
 		log.Printf("BAR: Failed to send new peer push request: %v", err)
 		return
 	}
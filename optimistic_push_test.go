@@ -177,11 +177,136 @@ func TestOptimisticPushManager_Integration(t *testing.T) {
 	height := opm.node.bc.Height()
 	assert.Equal(t, uint64(0), height) // Should start at height 0
 
-	// Test block data retrieval (should return nil for non-existent block)
-	blockData := opm.getBlockData(1)
-	assert.Nil(t, blockData) // No block at height 1
+	// Test block retrieval (should be empty for non-existent block)
+	blocks := opm.getRecentBlocks(1)
+	assert.Empty(t, blocks) // No block at height 1
 
-	// Test block headers retrieval - should return genesis block header
+	// Test block headers retrieval - the genesis block is not pushed
 	headers := opm.getBlockHeaders(0)
-	assert.Len(t, headers, 1) // Genesis block header
+	assert.Empty(t, headers)
+}
+
+// newPushTest builds a server with a chain of the given length and a client
+// that knows its proposer, each with an optimistic push manager.
+func newPushTest(t *testing.T, ctx context.Context, length int) (server, client *AppNode) {
+	server, client = newBlockSyncTest(t, ctx, length)
+	server.optimisticPushManager = NewOptimisticPushManager(server)
+	client.optimisticPushManager = NewOptimisticPushManager(client)
+	client.barNet.AddPeer(server.p2p.host.ID(), "")
+	return server, client
+}
+
+func TestOptimisticPushManager_ImportsPushedBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newPushTest(t, ctx, 10)
+	serverID, clientID := server.p2p.host.ID(), client.p2p.host.ID()
+	client.optimisticPushManager.addPending("req_1", serverID, false)
+	response := server.optimisticPushManager.newPushResponse(clientID, "req_1", false)
+	require.Len(t, response.Blocks, 10)
+	assert.NotNil(t, response.Blocks[9].Certificate)
+
+	client.optimisticPushManager.handlePushResponse(response)
+	assert.Equal(t, uint64(10), client.bc.Height())
+	assert.Equal(t, server.state.Root(), client.state.Root())
+	assert.Equal(t, 0, pomScore(client.barNet, serverID))
+
+	// Each request is answered once
+	client.optimisticPushManager.handlePushResponse(response)
+	assert.Equal(t, 1, pomScore(client.barNet, serverID))
+}
+
+func TestOptimisticPushManager_SyncsPastPushedBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The pushed blocks start beyond the client's tip, so block sync fetches
+	// the blocks before them
+	server, client := newPushTest(t, ctx, MaxPushBlocks+5)
+	serverID := connectSyncPeer(t, ctx, client, server)
+	client.optimisticPushManager.addPending("req_1", serverID, false)
+	response := server.optimisticPushManager.newPushResponse(client.p2p.host.ID(), "req_1", false)
+	assert.Equal(t, uint64(6), response.Blocks[0].Header.BlockNumber)
+
+	client.optimisticPushManager.handlePushResponse(response)
+	assert.Eventually(t, func() bool { return client.bc.Height() == server.bc.Height() }, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestOptimisticPushManager_PenalizesBadPushes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newPushTest(t, ctx, 5)
+	serverID, clientID := server.p2p.host.ID(), client.p2p.host.ID()
+	opm := client.optimisticPushManager
+
+	// Unsolicited
+	opm.handlePushResponse(server.optimisticPushManager.newPushResponse(clientID, "req_1", false))
+	assert.Equal(t, 1, pomScore(client.barNet, serverID))
+
+	// Headers in answer to a full node's request
+	opm.addPending("req_2", serverID, false)
+	opm.handlePushResponse(server.optimisticPushManager.newPushResponse(clientID, "req_2", true))
+	assert.Equal(t, 2, pomScore(client.barNet, serverID))
+
+	// A block whose transactions were changed
+	opm.addPending("req_3", serverID, false)
+	response := server.optimisticPushManager.newPushResponse(clientID, "req_3", false)
+	tampered := *response.Blocks[2]
+	tx := *tampered.Transactions[0]
+	tx.Value++
+	tampered.Transactions = []*Transaction{&tx}
+	response.Blocks[2] = &tampered
+	opm.handlePushResponse(response)
+	assert.Equal(t, 3, pomScore(client.barNet, serverID))
+	assert.Equal(t, uint64(0), client.bc.Height())
+
+	// A response to a request that expired
+	opm.addPending("req_4", serverID, false)
+	opm.pendingMu.Lock()
+	opm.pending[pushRequestKey{"req_4", serverID}] = pendingPush{expires: time.Now().Add(-time.Second)}
+	opm.pendingMu.Unlock()
+	opm.handlePushResponse(server.optimisticPushManager.newPushResponse(clientID, "req_4", false))
+	assert.Equal(t, 4, pomScore(client.barNet, serverID))
+	assert.Equal(t, uint64(0), client.bc.Height())
+}
+
+func TestOptimisticPushManager_RejectsSelfDeclaredCommittees(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The client's registry selects the proposer and two more validators, but
+	// the pushed blocks are certified by a committee of the proposer alone
+	server, client := newPushTest(t, ctx, 5)
+	for _, addr := range []Address{{7}, {8}} {
+		require.NoError(t, client.vr.RegisterValidator(&Validator{Address: addr, Participating: true}))
+	}
+	serverID, clientID := server.p2p.host.ID(), client.p2p.host.ID()
+	client.optimisticPushManager.addPending("req_1", serverID, false)
+	response := server.optimisticPushManager.newPushResponse(clientID, "req_1", false)
+	require.Len(t, response.Blocks[0].Certificate.Committee, 1)
+
+	client.optimisticPushManager.handlePushResponse(response)
+	assert.Equal(t, uint64(0), client.bc.Height())
+	assert.Equal(t, 1, pomScore(client.barNet, serverID))
+}
+
+func TestOptimisticPushManager_PushOverGossip(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newPushTest(t, ctx, 5)
+	connectSyncPeer(t, ctx, client, server)
+	connectSyncPeer(t, ctx, server, client)
+	server.optimisticPushManager.Start(ctx)
+	client.optimisticPushManager.Start(ctx)
+
+	// Retry until the gossip mesh has formed
+	assert.Eventually(t, func() bool {
+		require.NoError(t, client.optimisticPushManager.RequestOptimisticPush(false))
+		time.Sleep(200 * time.Millisecond)
+		return client.bc.Height() == server.bc.Height()
+	}, 10*time.Second, 100*time.Millisecond)
+	assert.Equal(t, 0, pomScore(client.barNet, server.p2p.host.ID()))
 }
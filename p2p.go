@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
@@ -13,6 +16,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	core_routing "github.com/libp2p/go-libp2p/core/routing"
 	discovery_routing "github.com/libp2p/go-libp2p/p2p/discovery/routing"
 	"github.com/libp2p/go-libp2p/p2p/discovery/util"
@@ -24,6 +28,7 @@ type P2PNode struct {
 	host       host.Host
 	dht        *dht.IpfsDHT
 	pubsub     *pubsub.PubSub
+	privKey    crypto.PrivKey // Signs the envelope of every published message
 	txTopic    *pubsub.Topic
 	blockTopic *pubsub.Topic
 
@@ -33,8 +38,13 @@ type P2PNode struct {
 	ctx      context.Context
 
 	// BAR integration hooks
-	OnPeerConnect   func(peerID peer.ID, address string)
-	OnPeerHandshake func(peerID peer.ID, address string)
+	OnPeerConnect    func(peerID peer.ID, address string)
+	OnPeerHandshake  func(peerID peer.ID, address string)
+	OnInvalidMessage func(peerID peer.ID, reason string) // called when a gossiped message fails validation
+	PeerScore        func(peerID peer.ID) float64        // application-specific gossipsub score of a peer
+
+	// Payload checks run by the topic validators, keyed by topic
+	validators map[string]func(msg *pubsub.Message) error
 
 	// Bandwidth tracking
 	bandwidthIn  uint64
@@ -64,7 +74,16 @@ func NewP2PNode(ctx context.Context, listenPort int, privKey crypto.PrivKey) (*P
 		return nil, err
 	}
 
-	ps, err := pubsub.NewGossipSub(ctx, host)
+	n := &P2PNode{
+		host:       host,
+		dht:        kdht,
+		privKey:    privKey,
+		topics:     make(map[string]*pubsub.Topic),
+		handlers:   make(map[string]func(*pubsub.Message)),
+		validators: make(map[string]func(msg *pubsub.Message) error),
+		ctx:        ctx,
+	}
+	n.pubsub, err = pubsub.NewGossipSub(ctx, host, pubsub.WithPeerScore(n.peerScoreParams(), peerScoreThresholds))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create pubsub service: %w", err)
 	}
@@ -74,26 +93,109 @@ func NewP2PNode(ctx context.Context, listenPort int, privKey crypto.PrivKey) (*P
 		fmt.Printf("Listening on: %s/p2p/%s\n", addr, host.ID())
 	}
 
-	return &P2PNode{
-		host:     host,
-		dht:      kdht,
-		pubsub:   ps,
-		topics:   make(map[string]*pubsub.Topic),
-		handlers: make(map[string]func(*pubsub.Message)),
-		ctx:      ctx,
-	}, nil
+	return n, nil
+}
+
+// Gossipsub score thresholds. Banned BAR peers score below the graylist
+// threshold, so nothing they send is processed.
+var peerScoreThresholds = &pubsub.PeerScoreThresholds{
+	GossipThreshold:             -10,
+	PublishThreshold:            -50,
+	GraylistThreshold:           -80,
+	AcceptPXThreshold:           10,
+	OpportunisticGraftThreshold: 1,
+}
+
+// peerScoreParams returns the gossipsub scoring parameters. The
+// application-specific part of a peer's score comes from PeerScore.
+func (n *P2PNode) peerScoreParams() *pubsub.PeerScoreParams {
+	return &pubsub.PeerScoreParams{
+		SkipAtomicValidation: true,
+		Topics:               make(map[string]*pubsub.TopicScoreParams), // filled in by RegisterTopic
+		AppSpecificScore: func(p peer.ID) float64 {
+			if n.PeerScore == nil {
+				return 0
+			}
+			return n.PeerScore(p)
+		},
+		AppSpecificWeight: 1,
+		DecayInterval:     time.Second,
+		DecayToZero:       0.01,
+		RetainScore:       10 * time.Minute,
+	}
+}
+
+// topicScoreParams penalizes peers for forwarding messages that fail
+// validation on a topic. The penalty grows with the square of the count.
+var topicScoreParams = &pubsub.TopicScoreParams{
+	SkipAtomicValidation:           true,
+	TopicWeight:                    1,
+	TimeInMeshQuantum:              time.Second, // unused, but scoring divides by it
+	InvalidMessageDeliveriesWeight: -5,
+	InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(10 * time.Minute),
 }
 
-// RegisterTopic joins a topic and stores it for later use.
+// RegisterTopic joins a topic and stores it for later use. Messages on the
+// topic are validated before they are delivered or forwarded.
 func (n *P2PNode) RegisterTopic(topicName string) {
+	if err := n.pubsub.RegisterTopicValidator(topicName, n.validateMessage(topicName)); err != nil {
+		log.Fatalf("Failed to register validator for topic %s: %v", topicName, err)
+	}
 	topic, err := n.pubsub.Join(topicName)
 	if err != nil {
 		log.Fatalf("Failed to join topic %s: %v", topicName, err)
 	}
+	if err := topic.SetScoreParams(topicScoreParams); err != nil {
+		log.Fatalf("Failed to set score parameters for topic %s: %v", topicName, err)
+	}
 	n.topics[topicName] = topic
 	log.Printf("DEBUG: Registered topic %s", topicName)
 }
 
+// SetTopicValidator sets the payload check run on every message of a topic
+// before it is delivered or forwarded. The check sees the opened envelope.
+// It returns errIgnoreMessage to drop a message without penalizing anyone,
+// and any other error to reject it.
+func (n *P2PNode) SetTopicValidator(topicName string, check func(msg *pubsub.Message) error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.validators[topicName] = check
+}
+
+// errIgnoreMessage is returned by a topic validator for a message that is
+// well-formed but not worth forwarding, such as a block for an old height.
+var errIgnoreMessage = errors.New("message ignored")
+
+// validateMessage returns the pubsub validator of a topic. It opens the
+// signed envelope and runs the topic's payload check. Rejected messages are
+// not forwarded, gossipsub lowers the score of the peer that relayed them,
+// and OnInvalidMessage is told about their author.
+func (n *P2PNode) validateMessage(topicName string) pubsub.ValidatorEx {
+	return func(ctx context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		opened, err := openMessage(topicName, msg)
+		if err == nil {
+			n.mu.RLock()
+			check := n.validators[topicName]
+			n.mu.RUnlock()
+			if check != nil {
+				err = check(opened)
+			}
+		}
+		if errors.Is(err, errIgnoreMessage) {
+			return pubsub.ValidationIgnore
+		}
+		if err != nil {
+			log.Printf("WARN: Rejecting message on topic %s from peer %s: %v", topicName, msg.GetFrom(), err)
+			if n.OnInvalidMessage != nil && msg.GetFrom() != n.host.ID() {
+				n.OnInvalidMessage(msg.GetFrom(), err.Error())
+			}
+			return pubsub.ValidationReject
+		}
+		msg.ValidatorData = opened
+		return pubsub.ValidationAccept
+	}
+}
+
 // Subscribe creates a single subscription that handles messages from all registered topics.
 func (n *P2PNode) Subscribe(ctx context.Context, handler func(topic string, msg *pubsub.Message)) {
 	for topicName, topic := range n.topics {
@@ -126,8 +228,41 @@ func (n *P2PNode) handleSubscription(ctx context.Context, topicName string, sub
 		n.UpdateBandwidthIn(uint64(len(msg.Data)))
 
 		log.Printf("DEBUG: Received message on topic %s from peer %s, size: %d bytes", topicName, msg.ReceivedFrom, len(msg.Data))
-		handler(topicName, msg)
+		// The topic validator opened the envelope before delivery
+		opened, ok := msg.ValidatorData.(*pubsub.Message)
+		if !ok {
+			log.Printf("WARN: Dropping unvalidated message on topic %s from peer %s", topicName, msg.GetFrom())
+			continue
+		}
+		handler(topicName, opened)
+	}
+}
+
+// openMessage verifies the signed envelope of a gossiped message and returns
+// a copy of the message carrying only the payload. The envelope must be
+// signed by the message's author for the topic it arrived on.
+func openMessage(topicName string, msg *pubsub.Message) (*pubsub.Message, error) {
+	var env SignedEnvelope
+	if err := json.Unmarshal(msg.Data, &env); err != nil {
+		return nil, fmt.Errorf("malformed envelope: %w", err)
+	}
+	signer, err := env.Open()
+	if err != nil {
+		return nil, err
+	}
+	if signer != msg.GetFrom() {
+		return nil, fmt.Errorf("envelope signed by %s, not its author", signer)
+	}
+	if env.PayloadType != topicName {
+		return nil, fmt.Errorf("envelope for %q published on %s", env.PayloadType, topicName)
 	}
+
+	// The pubsub message is shared with the router, so it is not modified in place
+	inner := *msg.Message
+	inner.Data = env.Payload
+	opened := *msg
+	opened.Message = &inner
+	return &opened, nil
 }
 
 // Publish sends a message to a specific topic.
@@ -137,12 +272,21 @@ func (n *P2PNode) Publish(ctx context.Context, topicName string, data []byte) er
 		return fmt.Errorf("not subscribed to topic: %s", topicName)
 	}
 
-	log.Printf("DEBUG: Publishing message to topic %s, size: %d bytes", topicName, len(data))
+	env, err := SealEnvelope(n.privKey, topicName, data)
+	if err != nil {
+		return err
+	}
+	envBytes, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+
+	log.Printf("DEBUG: Publishing message to topic %s, size: %d bytes", topicName, len(envBytes))
 
 	// Track outgoing bandwidth
-	n.UpdateBandwidthOut(uint64(len(data)))
+	n.UpdateBandwidthOut(uint64(len(envBytes)))
 
-	err := topic.Publish(ctx, data)
+	err = topic.Publish(ctx, envBytes)
 	if err != nil {
 		log.Printf("ERROR: Failed to publish to topic %s: %v", topicName, err)
 		return err
@@ -266,3 +410,13 @@ func (p2p *P2PNode) UpdateBandwidthOut(bytes uint64) {
 }
 
 // Publish publishes a message to a topic with bandwidth tracking
+
+// SetStreamHandler serves a request/response protocol on direct streams.
+func (n *P2PNode) SetStreamHandler(protocolID protocol.ID, handler network.StreamHandler) {
+	n.host.SetStreamHandler(protocolID, handler)
+}
+
+// NewStream opens a stream to a peer for a protocol.
+func (n *P2PNode) NewStream(ctx context.Context, peerID peer.ID, protocolID protocol.ID) (network.Stream, error) {
+	return n.host.NewStream(ctx, peerID, protocolID)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ReceiptStatusSuccess = "success"
+	ReceiptStatusFailed  = "failed"
+)
+
+// Receipt records the outcome of a transaction included in a block.
+type Receipt struct {
+	TxHash          Hash          `json:"txHash"`
+	BlockHeight     uint64        `json:"blockHeight"`
+	Status          string        `json:"status"`
+	Error           string        `json:"error,omitempty"` // why a failed transaction failed
+	FeePaid         uint64        `json:"feePaid"`
+	GasUsed         uint64        `json:"gasUsed"`
+	ContractAddress *Address      `json:"contractAddress,omitempty"`
+	ReturnValue     uint64        `json:"returnValue,omitempty"`
+	Logs            []ContractLog `json:"logs"`
+}
+
+// checkInclusion checks that a transaction may be included in a block: its
+// multisig signatures are valid, its nonce is the sender's next one and the
+// sender can pay its fee. A block holding a transaction that fails it is
+// invalid as a whole.
+func checkInclusion(s *State, tx *Transaction) error {
+	if tx.Multisig != nil {
+		if err := tx.VerifyMultisig(); err != nil {
+			return err
+		}
+	}
+	sender, err := s.GetAccount(tx.From)
+	if err != nil {
+		return err
+	}
+	if sender.Nonce+1 != tx.Nonce {
+		return fmt.Errorf("invalid nonce. got %d, want %d", tx.Nonce, sender.Nonce+1)
+	}
+	if sender.Balance < tx.Fee {
+		return fmt.Errorf("fee %d exceeds the sender's balance %d", tx.Fee, sender.Balance)
+	}
+	if err := checkVestingSpend(s, tx.From, tx.Fee, s.Height()); err != nil {
+		return fmt.Errorf("fee: %w", err)
+	}
+	return nil
+}
+
+// failTransaction records a transaction that passed checkInclusion but could
+// not be executed. The sender still pays the fee and uses up the nonce.
+func (s *State) failTransaction(tx *Transaction, cause error) (*Receipt, error) {
+	sender, err := s.GetAccount(tx.From)
+	if err != nil {
+		return nil, err
+	}
+	sender.Balance -= tx.Fee
+	sender.Nonce++
+	if err := s.PutAccount(sender); err != nil {
+		return nil, err
+	}
+	return &Receipt{
+		TxHash:      tx.Hash,
+		BlockHeight: s.Height(),
+		Status:      ReceiptStatusFailed,
+		Error:       cause.Error(),
+		FeePaid:     tx.Fee,
+		GasUsed:     TransactionGas(tx),
+		Logs:        []ContractLog{},
+	}, nil
+}
+
+func receiptKey(txHash Hash) []byte {
+	return []byte("receipt_" + txHash.ToHex())
+}
+
+// PutReceipt stores the receipt of an applied transaction.
+func (bc *Blockchain) PutReceipt(receipt *Receipt) error {
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	return bc.store.Put(receiptKey(receipt.TxHash), data)
+}
+
+// GetReceipt returns the receipt of an applied transaction.
+func (bc *Blockchain) GetReceipt(txHash Hash) (*Receipt, error) {
+	data, err := bc.store.Get(receiptKey(txHash))
+	if err != nil {
+		return nil, fmt.Errorf("receipt for %s not found: %w", txHash.ToHex(), err)
+	}
+	var receipt Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
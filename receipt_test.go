@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedTransfer(t *testing.T, from tokenTestAccount, nonce, value uint64) *Transaction {
+	tx := &Transaction{
+		From: from.addr, To: Address{1}, Value: value, Nonce: nonce, Fee: 1,
+		Type: "transfer", Timestamp: time.Now().UnixNano(),
+	}
+	require.NoError(t, tx.Sign(from.key))
+	return tx
+}
+
+func TestBlockchain_FailedTransactionsGetReceipts(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+
+	ok := signedTransfer(t, user, 1, 10)
+	overspend := signedTransfer(t, user, 2, 1000)
+	after := signedTransfer(t, user, 3, 5)
+	applyAt(t, bc, state, vr, 1, ok, overspend, after)
+
+	receipt, err := bc.GetReceipt(ok.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptStatusSuccess, receipt.Status)
+	assert.Equal(t, uint64(1), receipt.FeePaid)
+	assert.Equal(t, uint64(GasTransaction), receipt.GasUsed)
+
+	receipt, err = bc.GetReceipt(overspend.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptStatusFailed, receipt.Status)
+	assert.Equal(t, "insufficient balance", receipt.Error)
+	assert.Equal(t, uint64(1), receipt.FeePaid, "the sender still pays for a failed transaction")
+
+	receipt, err = bc.GetReceipt(after.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptStatusSuccess, receipt.Status, "later transactions still apply")
+
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(100-11-1-6), acc.Balance)
+	assert.Equal(t, uint64(3), acc.Nonce)
+}
+
+func TestBlockchain_RejectsBlocksWithUnincludableTransactions(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+	poor := newTokenTestAccount(t, state, 0)
+
+	cases := map[string]*Transaction{
+		"invalid nonce":                signedTransfer(t, user, 7, 1),
+		"exceeds the sender's balance": signedTransfer(t, poor, 1, 0),
+	}
+	for want, tx := range cases {
+		block := &Block{Header: &Header{BlockNumber: 1, Gas: blockGas([]*Transaction{tx})}, Transactions: []*Transaction{tx}}
+		assert.ErrorContains(t, bc.ApplyBlockWithRegistry(block, state, vr), want)
+		_, err := bc.GetReceipt(tx.Hash)
+		assert.Error(t, err, "no receipt for %s", want)
+	}
+
+	// Nor may the fee come out of a balance still locked by vesting
+	schedule := &VestingSchedule{Total: 100, Start: 0, Cliff: 50, End: 100}
+	require.NoError(t, state.PutVesting(user.addr, schedule))
+	tx := signedTransfer(t, user, 1, 0)
+	block := &Block{Header: &Header{BlockNumber: 1, Gas: blockGas([]*Transaction{tx})}, Transactions: []*Transaction{tx}}
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(block, state, vr), "fee")
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(100), acc.Balance)
+}
+
+func TestBlockchain_FailedDelegationLeavesRegistry(t *testing.T) {
+	state, vr, bc, vals := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+
+	stray := tokenTx(t, state, user, &Transaction{To: Address{9}, Value: 10, Type: "delegate"})
+	applyAt(t, bc, state, vr, 1, stray)
+	receipt, err := bc.GetReceipt(stray.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptStatusFailed, receipt.Status)
+	assert.Contains(t, receipt.Error, "non-registered validator")
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(99), acc.Balance, "only the fee is charged")
+
+	// A delegation the sender cannot fund does not reach the registry
+	tooMuch := tokenTx(t, state, user, &Transaction{To: vals[0].addr, Value: 1000, Type: "delegate"})
+	applyAt(t, bc, state, vr, 2, tooMuch)
+	v, err := vr.GetValidator(vals[0].addr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), v.DelegatedStake)
+}
+
+func TestAPIServer_TransactionReceipt(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+	tx := signedTransfer(t, user, 1, 1000)
+	applyAt(t, bc, state, vr, 1, tx)
+	api := &APIServer{node: &AppNode{state: state, bc: bc}}
+
+	w := httptest.NewRecorder()
+	api.handleTransactionByHash(w, httptest.NewRequest(http.MethodGet, "/transactions/"+tx.Hash.ToHex()+"/receipt", nil))
+	var response struct {
+		Success bool
+		Data    Receipt
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, ReceiptStatusFailed, response.Data.Status)
+	assert.Equal(t, "insufficient balance", response.Data.Error)
+
+	w = httptest.NewRecorder()
+	api.handleTransactionByHash(w, httptest.NewRequest(http.MethodGet, "/transactions/"+Hash{}.ToHex()+"/receipt", nil))
+	assert.Contains(t, w.Body.String(), "Receipt not found")
+}
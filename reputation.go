@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxAttestationScore is the highest compute score a single attestation may report.
+	MaxAttestationScore = 1000
+	// ReputationDecayPercent is the share of a validator's reputation carried over
+	// into the next epoch; the rest is replaced by the epoch's attested score.
+	ReputationDecayPercent = 80
+
+	attestationPrefix       = "attestation_"
+	reputationHistoryPrefix = "reputation_history_"
+)
+
+// ComputeAttestation is the payload of a compute_attestation transaction: a
+// committee member's report of the compute work another validator performed
+// during the current epoch.
+type ComputeAttestation struct {
+	Subject Address `json:"subject"`
+	Score   uint64  `json:"score"`
+}
+
+// ReputationEpoch is one epoch of a validator's reputation history.
+type ReputationEpoch struct {
+	Epoch        uint64 `json:"epoch"`
+	EpochScore   uint64 `json:"epochScore"`
+	Attestations int    `json:"attestations"`
+	Reputation   uint64 `json:"reputation"`
+}
+
+// validateComputeAttestation performs the stateless checks on a compute_attestation transaction.
+func validateComputeAttestation(tx *Transaction) error {
+	if tx.Attestation == nil {
+		return errors.New("compute attestation payload is missing")
+	}
+	if tx.Value != 0 {
+		return errors.New("compute attestations must not carry value")
+	}
+	if tx.Attestation.Subject == tx.From {
+		return errors.New("validators cannot attest to their own compute")
+	}
+	if tx.Attestation.Score > MaxAttestationScore {
+		return fmt.Errorf("attestation score %d exceeds maximum %d", tx.Attestation.Score, MaxAttestationScore)
+	}
+	return nil
+}
+
+// isCommitteeMember reports whether addr is part of the committee the registry currently selects.
+func isCommitteeMember(vr *ValidatorRegistry, addr Address) (bool, error) {
+	committee, err := registryCommittee(vr)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range committee {
+		if v.Address == addr {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nextReputation decays the previous reputation and blends in the epoch score.
+func nextReputation(previous, epochScore uint64) uint64 {
+	return (previous*ReputationDecayPercent + epochScore*(100-ReputationDecayPercent)) / 100
+}
+
+// medianScore returns the lower median of the attested scores, so that a
+// single outlying attester cannot move a validator's score on its own.
+func medianScore(scores []uint64) uint64 {
+	if len(scores) == 0 {
+		return 0
+	}
+	sorted := append([]uint64(nil), scores...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)-1)/2]
+}
+
+func (vr *ValidatorRegistry) attestationKey(subject, attester Address) []byte {
+	key := append([]byte(attestationPrefix), subject[:]...)
+	return append(key, attester[:]...)
+}
+
+func (vr *ValidatorRegistry) reputationHistoryKey(addr Address, epoch uint64) []byte {
+	key := append([]byte(reputationHistoryPrefix), addr[:]...)
+	return binary.BigEndian.AppendUint64(key, epoch)
+}
+
+// RecordAttestation stores an attester's score for a subject in the current
+// epoch. A later attestation from the same attester replaces the earlier one.
+func (vr *ValidatorRegistry) RecordAttestation(attester, subject Address, score uint64) error {
+	data, err := json.Marshal(score)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put(vr.attestationKey(subject, attester), data)
+}
+
+// AggregateReputation folds the attestations collected during epoch into every
+// registered validator's ComputeReputation, records the result in the
+// reputation history and clears the attestations.
+func (vr *ValidatorRegistry) AggregateReputation(epoch uint64) error {
+	allData, err := vr.store.List()
+	if err != nil {
+		return err
+	}
+
+	scores := make(map[Address][]uint64)
+	for key, data := range allData {
+		if !strings.HasPrefix(key, attestationPrefix) {
+			continue
+		}
+		var subject Address
+		copy(subject[:], key[len(attestationPrefix):])
+		var score uint64
+		if err := json.Unmarshal(data, &score); err == nil {
+			scores[subject] = append(scores[subject], score)
+		}
+		if err := vr.store.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+
+	validators, err := vr.GetAllValidators()
+	if err != nil {
+		return err
+	}
+	for _, v := range validators {
+		attested := scores[v.Address]
+		if len(attested) == 0 && v.ComputeReputation == 0 {
+			continue
+		}
+		record := ReputationEpoch{
+			Epoch:        epoch,
+			EpochScore:   medianScore(attested),
+			Attestations: len(attested),
+		}
+		record.Reputation = nextReputation(v.ComputeReputation, record.EpochScore)
+
+		if err := vr.UpdateReputation(v.Address, record.Reputation); err != nil {
+			return err
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := vr.store.Put(vr.reputationHistoryKey(v.Address, epoch), data); err != nil {
+			return err
+		}
+	}
+	log.Printf("INFO: Aggregated compute reputation for epoch %d (%d validators attested)", epoch, len(scores))
+	return nil
+}
+
+// GetReputationHistory returns a validator's reputation records, oldest epoch first.
+func (vr *ValidatorRegistry) GetReputationHistory(addr Address) ([]ReputationEpoch, error) {
+	allData, err := vr.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := string(append([]byte(reputationHistoryPrefix), addr[:]...))
+	history := make([]ReputationEpoch, 0)
+	for key, data := range allData {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var record ReputationEpoch
+		if err := json.Unmarshal(data, &record); err != nil {
+			continue
+		}
+		history = append(history, record)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Epoch < history[j].Epoch })
+	return history, nil
+}
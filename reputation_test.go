@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateReputation_MedianAndDecay(t *testing.T) {
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	subject := Address{1}
+	idle := Address{2}
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: subject, Stake: 100}))
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: idle, Stake: 100, ComputeReputation: 500}))
+
+	require.NoError(t, vr.RecordAttestation(Address{10}, subject, 100))
+	require.NoError(t, vr.RecordAttestation(Address{11}, subject, 500))
+	require.NoError(t, vr.RecordAttestation(Address{12}, subject, 1000))
+	// A repeated attestation from the same member replaces the earlier one
+	require.NoError(t, vr.RecordAttestation(Address{12}, subject, 900))
+
+	require.NoError(t, vr.AggregateReputation(0))
+
+	v, _ := vr.GetValidator(subject)
+	assert.Equal(t, uint64(100), v.ComputeReputation) // 20% of median 500
+
+	// Validators without attestations decay towards zero
+	v, _ = vr.GetValidator(idle)
+	assert.Equal(t, uint64(400), v.ComputeReputation)
+
+	// Attestations are consumed by aggregation
+	require.NoError(t, vr.AggregateReputation(1))
+	v, _ = vr.GetValidator(subject)
+	assert.Equal(t, uint64(80), v.ComputeReputation)
+
+	history, err := vr.GetReputationHistory(subject)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, ReputationEpoch{Epoch: 0, EpochScore: 500, Attestations: 3, Reputation: 100}, history[0])
+	assert.Equal(t, ReputationEpoch{Epoch: 1, EpochScore: 0, Attestations: 0, Reputation: 80}, history[1])
+}
+
+func TestComputeAttestation_Validation(t *testing.T) {
+	state, priv, addr1, addr2 := setupTxPoolTest()
+	tp := NewTransactionPool()
+
+	selfTx := &Transaction{From: addr1, Nonce: 1, Type: "compute_attestation", Attestation: &ComputeAttestation{Subject: addr1, Score: 10}}
+	require.NoError(t, selfTx.Sign(priv))
+	assert.Error(t, tp.AddTransaction(selfTx, priv.PubKey(), state))
+
+	highTx := &Transaction{From: addr1, Nonce: 1, Type: "compute_attestation", Attestation: &ComputeAttestation{Subject: addr2, Score: MaxAttestationScore + 1}}
+	require.NoError(t, highTx.Sign(priv))
+	assert.Error(t, tp.AddTransaction(highTx, priv.PubKey(), state))
+
+	emptyTx := &Transaction{From: addr1, Nonce: 1, Type: "compute_attestation"}
+	require.NoError(t, emptyTx.Sign(priv))
+	assert.Error(t, tp.AddTransaction(emptyTx, priv.PubKey(), state))
+
+	okTx := &Transaction{From: addr1, Nonce: 1, Fee: 1, Type: "compute_attestation", Attestation: &ComputeAttestation{Subject: addr2, Score: 10}}
+	require.NoError(t, okTx.Sign(priv))
+	assert.NoError(t, tp.AddTransaction(okTx, priv.PubKey(), state))
+}
+
+func TestComputeAttestation_OnlyCommitteeMembersCount(t *testing.T) {
+	state := NewState()
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	bc, _ := NewBlockchain(NewMemoryStore())
+
+	memberKey, _ := btcec.NewPrivateKey()
+	member := pubKeyToAddress(memberKey.PubKey())
+	outsiderKey, _ := btcec.NewPrivateKey()
+	outsider := pubKeyToAddress(outsiderKey.PubKey())
+	subject := Address{7}
+
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: member, Stake: 100, Participating: true}))
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: subject, Stake: 100, Participating: true}))
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: outsider, Stake: 100, Participating: false}))
+	require.NoError(t, state.PutAccount(&Account{Address: member, Balance: 10}))
+	require.NoError(t, state.PutAccount(&Account{Address: outsider, Balance: 10}))
+
+	attest := func(key *btcec.PrivateKey, from Address, score uint64) *Transaction {
+		tx := &Transaction{
+			From:        from,
+			To:          subject,
+			Nonce:       1,
+			Fee:         1,
+			Timestamp:   time.Now().UnixNano(),
+			Type:        "compute_attestation",
+			Attestation: &ComputeAttestation{Subject: subject, Score: score},
+		}
+		require.NoError(t, tx.Sign(key))
+		return tx
+	}
+
+	block := &Block{Transactions: []*Transaction{attest(memberKey, member, 600), attest(outsiderKey, outsider, 0)}}
+	require.NoError(t, bc.ApplyBlockWithRegistry(block, state, vr))
+
+	// Both senders pay the fee, but only the committee member's report is counted
+	acc, _ := state.GetAccount(outsider)
+	assert.Equal(t, uint64(9), acc.Balance)
+
+	require.NoError(t, processEpochTransition(1, vr))
+	v, _ := vr.GetValidator(subject)
+	assert.Equal(t, uint64(120), v.ComputeReputation)
+
+	history, _ := vr.GetReputationHistory(subject)
+	require.Len(t, history, 1)
+	assert.Equal(t, 1, history[0].Attestations)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// SnapshotChunkEntries is the number of trie entries in each snapshot
+	// chunk; only the last chunk of a snapshot may hold fewer.
+	SnapshotChunkEntries = 1024
+
+	// SnapshotRetention is the number of epoch snapshots a node keeps to serve.
+	SnapshotRetention = 2
+
+	// maxSnapshotChunks bounds the manifests a node accepts, so a peer cannot
+	// make it track an arbitrary number of chunks.
+	maxSnapshotChunks = 1 << 16
+)
+
+// SnapshotManifest describes the state after the block at Height. The state is
+// split into chunks of consecutive trie entries in key order; Chunks lists the
+// hash of each and Root is the state root they rebuild.
+type SnapshotManifest struct {
+	Height    uint64 `json:"height"`
+	Root      Hash   `json:"root"`
+	ChunkSize int    `json:"chunkSize"`
+	Entries   int    `json:"entries"`
+	Chunks    []Hash `json:"chunks"`
+}
+
+// SnapshotChunk is one chunk of the snapshot at Height.
+type SnapshotChunk struct {
+	Height  uint64   `json:"height"`
+	Index   int      `json:"index"`
+	Entries []KVPair `json:"entries"`
+}
+
+// snapshotChunkHash hashes the length-prefixed keys and values of a chunk.
+func snapshotChunkHash(entries []KVPair) Hash {
+	h := sha3.New256()
+	var buf [binary.MaxVarintLen64]byte
+	for _, kv := range entries {
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(kv.Key)))])
+		h.Write(kv.Key)
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(kv.Value)))])
+		h.Write(kv.Value)
+	}
+	var hash Hash
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+// NewStateSnapshot splits the current state into chunks and builds their manifest.
+func NewStateSnapshot(state *State) (*SnapshotManifest, []*SnapshotChunk) {
+	height := state.Height()
+	root, entries := state.Trie.Snapshot()
+	manifest := &SnapshotManifest{Height: height, Root: root, ChunkSize: SnapshotChunkEntries, Entries: len(entries)}
+	var chunks []*SnapshotChunk
+	for start := 0; start < len(entries); start += SnapshotChunkEntries {
+		end := min(start+SnapshotChunkEntries, len(entries))
+		chunk := &SnapshotChunk{Height: height, Index: len(chunks), Entries: entries[start:end]}
+		chunks = append(chunks, chunk)
+		manifest.Chunks = append(manifest.Chunks, snapshotChunkHash(chunk.Entries))
+	}
+	return manifest, chunks
+}
+
+// validate checks that the manifest is consistent with fixed-size chunks.
+func (m *SnapshotManifest) validate() error {
+	if m.ChunkSize <= 0 || m.ChunkSize > SnapshotChunkEntries {
+		return fmt.Errorf("invalid chunk size %d", m.ChunkSize)
+	}
+	if len(m.Chunks) > maxSnapshotChunks {
+		return fmt.Errorf("snapshot has %d chunks, more than the maximum of %d", len(m.Chunks), maxSnapshotChunks)
+	}
+	if want := (m.Entries + m.ChunkSize - 1) / m.ChunkSize; m.Entries < 0 || len(m.Chunks) != want {
+		return fmt.Errorf("snapshot of %d entries should have %d chunks, not %d", m.Entries, want, len(m.Chunks))
+	}
+	return nil
+}
+
+// chunkEntries returns the number of entries chunk index must hold.
+func (m *SnapshotManifest) chunkEntries(index int) int {
+	if index == len(m.Chunks)-1 {
+		return m.Entries - index*m.ChunkSize
+	}
+	return m.ChunkSize
+}
+
+// SnapshotStore keeps the latest epoch snapshots of a node to serve to peers.
+type SnapshotStore struct {
+	snapshots  map[uint64][]*SnapshotChunk
+	manifests  map[uint64]*SnapshotManifest
+	validators map[uint64][]KVPair // Validator registry at each snapshot, for checkpoint sync
+	heights    []uint64            // Oldest first
+	mu         sync.RWMutex
+}
+
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{
+		snapshots:  make(map[uint64][]*SnapshotChunk),
+		manifests:  make(map[uint64]*SnapshotManifest),
+		validators: make(map[uint64][]KVPair),
+	}
+}
+
+// AfterBlock takes a snapshot of the state and the validator registry once the
+// block at height, the last block of the current epoch, has been applied.
+func (ss *SnapshotStore) AfterBlock(height uint64, state *State, vr *ValidatorRegistry) {
+	if vr == nil || height+1 != vr.CurrentEpoch().EndHeight() {
+		return
+	}
+	manifest, chunks := NewStateSnapshot(state)
+	ss.Add(manifest, chunks)
+	if validators, err := vr.Export(); err != nil {
+		log.Printf("ERROR: Failed to export the validator registry at height %d: %v", height, err)
+	} else {
+		ss.AddValidators(manifest.Height, validators)
+	}
+	log.Printf("INFO: Took state snapshot at height %d: %d entries in %d chunks, root %s",
+		manifest.Height, manifest.Entries, len(manifest.Chunks), manifest.Root.ToHex())
+}
+
+// Add stores a snapshot, dropping the oldest beyond SnapshotRetention.
+func (ss *SnapshotStore) Add(manifest *SnapshotManifest, chunks []*SnapshotChunk) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.manifests[manifest.Height]; !ok {
+		ss.heights = append(ss.heights, manifest.Height)
+		sort.Slice(ss.heights, func(i, j int) bool { return ss.heights[i] < ss.heights[j] })
+	}
+	ss.manifests[manifest.Height] = manifest
+	ss.snapshots[manifest.Height] = chunks
+	for len(ss.heights) > SnapshotRetention {
+		delete(ss.manifests, ss.heights[0])
+		delete(ss.snapshots, ss.heights[0])
+		delete(ss.validators, ss.heights[0])
+		ss.heights = ss.heights[1:]
+	}
+}
+
+// AddValidators stores the validator registry exported with the snapshot at
+// height, which must have been added already.
+func (ss *SnapshotStore) AddValidators(height uint64, entries []KVPair) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.manifests[height]; ok {
+		ss.validators[height] = entries
+	}
+}
+
+// Validators returns the validator registry exported with the snapshot at height.
+func (ss *SnapshotStore) Validators(height uint64) ([]KVPair, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	entries, ok := ss.validators[height]
+	if !ok {
+		return nil, fmt.Errorf("no validator set at height %d", height)
+	}
+	return entries, nil
+}
+
+// Latest returns the manifest of the most recent snapshot, or nil if there is none.
+func (ss *SnapshotStore) Latest() *SnapshotManifest {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	if len(ss.heights) == 0 {
+		return nil
+	}
+	return ss.manifests[ss.heights[len(ss.heights)-1]]
+}
+
+// Manifest returns the manifest of the snapshot at height.
+func (ss *SnapshotStore) Manifest(height uint64) (*SnapshotManifest, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	manifest, ok := ss.manifests[height]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot at height %d", height)
+	}
+	return manifest, nil
+}
+
+// Chunk returns chunk index of the snapshot at height.
+func (ss *SnapshotStore) Chunk(height uint64, index int) (*SnapshotChunk, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	chunks, ok := ss.snapshots[height]
+	if !ok {
+		return nil, fmt.Errorf("no snapshot at height %d", height)
+	}
+	if index < 0 || index >= len(chunks) {
+		return nil, fmt.Errorf("snapshot at height %d has no chunk %d", height, index)
+	}
+	return chunks[index], nil
+}
+
+// SnapshotImporter collects the chunks of a snapshot, checking each against
+// the manifest, and rebuilds the state once all have arrived.
+type SnapshotImporter struct {
+	manifest *SnapshotManifest
+	chunks   [][]KVPair
+	received int
+}
+
+func NewSnapshotImporter(manifest *SnapshotManifest) (*SnapshotImporter, error) {
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+	return &SnapshotImporter{manifest: manifest, chunks: make([][]KVPair, len(manifest.Chunks))}, nil
+}
+
+// AddChunk checks a chunk against its hash in the manifest and keeps it.
+func (imp *SnapshotImporter) AddChunk(chunk *SnapshotChunk) error {
+	m := imp.manifest
+	if chunk.Height != m.Height {
+		return fmt.Errorf("chunk is from the snapshot at height %d, not %d", chunk.Height, m.Height)
+	}
+	if chunk.Index < 0 || chunk.Index >= len(m.Chunks) {
+		return fmt.Errorf("snapshot has no chunk %d", chunk.Index)
+	}
+	if imp.chunks[chunk.Index] != nil {
+		return nil
+	}
+	if len(chunk.Entries) != m.chunkEntries(chunk.Index) {
+		return fmt.Errorf("chunk %d has %d entries, want %d", chunk.Index, len(chunk.Entries), m.chunkEntries(chunk.Index))
+	}
+	if hash := snapshotChunkHash(chunk.Entries); hash != m.Chunks[chunk.Index] {
+		return fmt.Errorf("chunk %d hashes to %s, not %s", chunk.Index, hash.ToHex(), m.Chunks[chunk.Index].ToHex())
+	}
+	imp.chunks[chunk.Index] = chunk.Entries
+	imp.received++
+	return nil
+}
+
+// Missing returns the indexes of the chunks not received yet.
+func (imp *SnapshotImporter) Missing() []int {
+	var missing []int
+	for i, entries := range imp.chunks {
+		if entries == nil {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// State rebuilds the state from the received chunks and checks it against the
+// manifest's root.
+func (imp *SnapshotImporter) State() (*State, error) {
+	if imp.received != len(imp.chunks) {
+		return nil, fmt.Errorf("missing %d of %d snapshot chunks", len(imp.chunks)-imp.received, len(imp.chunks))
+	}
+	state := NewState()
+	var last []byte
+	for _, entries := range imp.chunks {
+		for _, kv := range entries {
+			// Chunks cover the keys in order, so each key appears once
+			if last != nil && bytes.Compare(kv.Key, last) <= 0 {
+				return nil, errors.New("snapshot entries are not in key order")
+			}
+			last = kv.Key
+			state.Trie.Insert(kv.Key, kv.Value)
+		}
+	}
+	if root := state.Root(); root != imp.manifest.Root {
+		return nil, fmt.Errorf("snapshot entries hash to %s, not the root %s", root.ToHex(), imp.manifest.Root.ToHex())
+	}
+	state.SetHeight(imp.manifest.Height)
+	return state, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSnapshotTestState(t *testing.T, accounts int) *State {
+	state := NewState()
+	for i := 0; i < accounts; i++ {
+		require.NoError(t, state.PutAccount(&Account{Address: Address{byte(i >> 8), byte(i)}, Balance: uint64(i)}))
+	}
+	state.SetHeight(7)
+	return state
+}
+
+func TestStateSnapshot_ChunksRebuildState(t *testing.T) {
+	state := newSnapshotTestState(t, SnapshotChunkEntries*2+5)
+	manifest, chunks := NewStateSnapshot(state)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, 5, len(chunks[2].Entries))
+	assert.Equal(t, uint64(7), manifest.Height)
+
+	importer, err := NewSnapshotImporter(manifest)
+	require.NoError(t, err)
+	// Chunks may arrive in any order
+	for _, i := range []int{2, 0, 1} {
+		require.NoError(t, importer.AddChunk(chunks[i]))
+	}
+	assert.Empty(t, importer.Missing())
+	rebuilt, err := importer.State()
+	require.NoError(t, err)
+	assert.Equal(t, state.Root(), rebuilt.Root())
+	assert.Equal(t, uint64(7), rebuilt.Height())
+}
+
+func TestSnapshotImporter_RejectsBadChunks(t *testing.T) {
+	state := newSnapshotTestState(t, SnapshotChunkEntries+1)
+	manifest, chunks := NewStateSnapshot(state)
+	importer, err := NewSnapshotImporter(manifest)
+	require.NoError(t, err)
+
+	tampered := &SnapshotChunk{Height: chunks[0].Height, Index: 0, Entries: append([]KVPair{}, chunks[0].Entries...)}
+	tampered.Entries[3] = KVPair{Key: tampered.Entries[3].Key, Value: []byte(`{"balance":1000000}`)}
+	assert.ErrorContains(t, importer.AddChunk(tampered), "hashes to")
+
+	short := &SnapshotChunk{Height: chunks[0].Height, Index: 0, Entries: chunks[0].Entries[1:]}
+	assert.ErrorContains(t, importer.AddChunk(short), "entries, want")
+	assert.ErrorContains(t, importer.AddChunk(&SnapshotChunk{Height: 8, Index: 1}), "not 7")
+	assert.ErrorContains(t, importer.AddChunk(&SnapshotChunk{Height: 7, Index: 2}), "no chunk 2")
+
+	require.NoError(t, importer.AddChunk(chunks[1]))
+	assert.Equal(t, []int{0}, importer.Missing())
+	_, err = importer.State()
+	assert.ErrorContains(t, err, "missing 1 of 2")
+}
+
+func TestSnapshotImporter_ChecksRoot(t *testing.T) {
+	state := newSnapshotTestState(t, 10)
+	manifest, chunks := NewStateSnapshot(state)
+
+	// A manifest whose chunk hashes match but whose root does not is rejected
+	forged := *manifest
+	forged.Root = Hash{1}
+	importer, err := NewSnapshotImporter(&forged)
+	require.NoError(t, err)
+	require.NoError(t, importer.AddChunk(chunks[0]))
+	_, err = importer.State()
+	assert.ErrorContains(t, err, "not the root")
+
+	inconsistent := *manifest
+	inconsistent.Entries = SnapshotChunkEntries + 1
+	_, err = NewSnapshotImporter(&inconsistent)
+	assert.ErrorContains(t, err, "should have 2 chunks")
+}
+
+func TestSnapshotStore_EpochSnapshots(t *testing.T) {
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	store := NewSnapshotStore()
+	state := newSnapshotTestState(t, 3)
+	last := vr.CurrentEpoch().EndHeight() - 1
+
+	store.AfterBlock(last-1, state, vr)
+	assert.Nil(t, store.Latest(), "snapshots are only taken at the end of an epoch")
+	store.AfterBlock(last, state, vr)
+	require.NotNil(t, store.Latest())
+
+	for i := 0; i < SnapshotRetention+1; i++ {
+		state.SetHeight(uint64(100 + i))
+		store.Add(NewStateSnapshot(state))
+	}
+	latest := store.Latest()
+	assert.Equal(t, uint64(100+SnapshotRetention), latest.Height)
+	_, err := store.Manifest(100)
+	assert.Error(t, err, "the oldest snapshot is dropped")
+	chunk, err := store.Chunk(latest.Height, 0)
+	require.NoError(t, err)
+	assert.Equal(t, latest.Chunks[0], snapshotChunkHash(chunk.Entries))
+	_, err = store.Chunk(latest.Height, 1)
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcutil/bech32"
@@ -13,12 +14,38 @@ import (
 
 type State struct {
 	Trie *MerkleTrie
+
+	// height is the block whose transactions are being (or were last) applied.
+	// Height-dependent rules such as vesting are evaluated against it.
+	height atomic.Uint64
 }
 
 func NewState() *State {
 	return &State{Trie: NewMerkleTrie()}
 }
 
+// Copy returns a copy of the state that can be changed without changing s.
+func (s *State) Copy() *State {
+	c := &State{Trie: s.Trie.Copy()}
+	c.SetHeight(s.Height())
+	return c
+}
+
+// SetHeight records the height of the block being applied.
+func (s *State) SetHeight(height uint64) {
+	s.height.Store(height)
+}
+
+// Height returns the height of the block being, or last, applied.
+func (s *State) Height() uint64 {
+	return s.height.Load()
+}
+
+// Root returns the root hash of the state trie.
+func (s *State) Root() Hash {
+	return s.Trie.RootHash()
+}
+
 // GetAccount retrieves an account from the trie.
 func (s *State) GetAccount(addr Address) (*Account, error) {
 	data, found := s.Trie.Get(addr[:])
@@ -45,25 +72,91 @@ func (s *State) PutAccount(acc *Account) error {
 
 // ApplyTransaction applies a transaction to the state.
 func (s *State) ApplyTransaction(tx *Transaction) error {
+	_, err := s.ApplyTransactionWithReceipt(tx)
+	return err
+}
+
+// ApplyTransactionWithReceipt applies a transaction to the state and returns
+// its receipt.
+func (s *State) ApplyTransactionWithReceipt(tx *Transaction) (*Receipt, error) {
+	receipt := &Receipt{
+		TxHash:      tx.Hash,
+		BlockHeight: s.Height(),
+		Status:      ReceiptStatusSuccess,
+		FeePaid:     tx.Fee,
+		GasUsed:     intrinsicGas(tx),
+		Logs:        []ContractLog{},
+	}
+	if err := s.applyTransaction(tx, receipt); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+func (s *State) applyTransaction(tx *Transaction, receipt *Receipt) error {
 	sender, err := s.GetAccount(tx.From)
 	if err != nil {
 		return err
 	}
 
+	// Multisig transactions carry their key set, so their signatures can be
+	// checked against the sender address here as well as in the pool
+	if tx.Multisig != nil {
+		if err := tx.VerifyMultisig(); err != nil {
+			return err
+		}
+	}
+
 	if sender.Nonce+1 != tx.Nonce {
 		return fmt.Errorf("invalid nonce. got %d, want %d", tx.Nonce, sender.Nonce+1)
 	}
 
-	if tx.Value+tx.Fee > sender.Balance {
+	if err := validateAssetField(tx); err != nil {
+		return err
+	}
+	if err := validateTransactionData(tx); err != nil {
+		return err
+	}
+	if err := validateOutputsField(tx); err != nil {
+		return err
+	}
+
+	cost, err := nativeCost(tx)
+	if err != nil {
+		return err
+	}
+	if cost > sender.Balance {
 		return errors.New("insufficient balance")
 	}
 
+	// Vesting accounts may only spend the part of their balance already released
+	if err := checkVestingSpend(s, tx.From, cost, s.Height()); err != nil {
+		return err
+	}
+
 	// Handle different transaction types
+	var execution *contractExecution
 	switch tx.Type {
-	case "participation":
-		// Participation transaction logic - handled in block application
-		if s.Trie != nil {
-			// We'll update the ValidatorRegistry in the block application logic
+	case "participation", "leave_participation":
+		// Joining or leaving the committee only costs the fee; the registry change
+		// is scheduled for the next epoch in block application.
+		if tx.Value != 0 {
+			return errors.New("participation transactions must not carry value")
+		}
+	case "compute_attestation":
+		// Attestations only cost the fee; they are recorded in the validator
+		// registry during block application
+		if err := validateComputeAttestation(tx); err != nil {
+			return err
+		}
+	case "submit_proposal":
+		// Proposals only cost the fee; they are recorded during block application
+		if err := validateProposal(tx); err != nil {
+			return err
+		}
+	case "vote":
+		if err := validateVote(tx); err != nil {
+			return err
 		}
 	case "register_validator":
 		// Validator registration - stake is locked from sender's balance
@@ -77,17 +170,115 @@ func (s *State) ApplyTransaction(tx *Transaction) error {
 		if tx.Value == 0 {
 			return errors.New("delegation requires non-zero amount")
 		}
+	case "issue_token":
+		// The supply is credited to the issuer after the fee is paid
+		if err := validateTokenIssuance(tx); err != nil {
+			return err
+		}
+		if err := checkTokenIssuance(s, tx); err != nil {
+			return err
+		}
+	case "mint_token":
+		if err := validateTokenMint(tx); err != nil {
+			return err
+		}
+		if err := checkTokenFunds(s, tx.From, tx); err != nil {
+			return err
+		}
+	case "htlc_lock", "htlc_claim", "htlc_refund":
+		// The locked value is debited below and held in escrow until claimed or refunded
+		if err := validateHTLC(tx); err != nil {
+			return err
+		}
+		if err := checkHTLC(s, tx, s.Height()); err != nil {
+			return err
+		}
+	case "create_vesting":
+		// The value is credited to the recipient below and locked by the schedule
+		if err := validateCreateVesting(tx); err != nil {
+			return err
+		}
+		if err := checkCreateVesting(s, tx); err != nil {
+			return err
+		}
+	case "deploy_contract", "call_contract":
+		// Contracts run against a storage overlay that is only written once the
+		// transaction's fee and value have been paid
+		if err := validateContractTx(tx); err != nil {
+			return err
+		}
+		if execution, err = s.executeContract(tx, s.Height()); err != nil {
+			return err
+		}
+	case "rotate_key":
+		// The new key is bound to the sender once the fee has been paid
+		if err := validateKeyRotation(tx); err != nil {
+			return err
+		}
+	case "multi_transfer":
+		// The outputs are checked up front so that they are paid all or nothing
+		if err := validateMultiTransfer(tx); err != nil {
+			return err
+		}
 	case "transfer":
 		// Standard transfer - handled below
+		if tx.Asset != "" {
+			if err := checkTokenFunds(s, tx.From, tx); err != nil {
+				return err
+			}
+		}
 	default:
 		return fmt.Errorf("unknown transaction type: %s", tx.Type)
 	}
 
-	sender.Balance -= (tx.Value + tx.Fee)
+	sender.Balance -= cost
 	sender.Nonce += 1
 
-	// For transfer transactions, update recipient balance
-	if tx.Type == "transfer" {
+	// Token transactions move the asset; the sender only paid the fee natively
+	if tx.Type == "issue_token" || tx.Asset != "" {
+		if err := s.PutAccount(sender); err != nil {
+			return err
+		}
+		return s.applyTokenTransaction(tx)
+	}
+
+	if execution != nil {
+		if err := s.PutAccount(sender); err != nil {
+			return err
+		}
+		return execution.commit(s, tx, receipt)
+	}
+
+	if tx.Type == "multi_transfer" {
+		if err := s.PutAccount(sender); err != nil {
+			return err
+		}
+		return s.applyMultiTransfer(tx)
+	}
+
+	if tx.Type == "rotate_key" {
+		if err := s.PutAccount(sender); err != nil {
+			return err
+		}
+		return s.applyKeyRotation(tx)
+	}
+
+	// HTLC transactions move funds into or out of escrow
+	if tx.HTLC != nil {
+		if err := s.PutAccount(sender); err != nil {
+			return err
+		}
+		return s.applyHTLCTransaction(tx)
+	}
+
+	if tx.Type == "create_vesting" {
+		if err := s.PutVesting(tx.To, tx.Vesting); err != nil {
+			return err
+		}
+	}
+
+	// For transfer and vesting transactions, update recipient balance
+	if tx.Type == "transfer" || tx.Type == "create_vesting" {
 		toAcc, _ := s.GetAccount(tx.To)
 		if toAcc == nil {
 			// If the recipient doesn't exist, create a new account.
@@ -108,6 +299,9 @@ func (s *State) ApplyTransaction(tx *Transaction) error {
 
 // ApplyBlock applies all transactions in a block to the state.
 func (s *State) ApplyBlock(block *Block) error {
+	if block.Header != nil {
+		s.SetHeight(block.Header.BlockNumber)
+	}
 	for _, tx := range block.Transactions {
 		if err := s.ApplyTransaction(tx); err != nil {
 			// In a real implementation, we would need to handle this failure
@@ -154,6 +348,10 @@ func (s *State) ExportSnapshot() ([]*Account, error) {
 		return accounts, nil
 	}
 	for _, kv := range s.Trie.All() {
+		// Token definitions and balances share the trie; accounts are keyed by address
+		if len(kv.Key) != len(Address{}) {
+			continue
+		}
 		var acc Account
 		if err := json.Unmarshal(kv.Value, &acc); err != nil {
 			return nil, err
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	MinTokenSymbolLength = 2
+	MaxTokenSymbolLength = 12
+	MaxTokenDecimals     = 18
+
+	// Token entries live in the state trie next to the accounts. Every key kind
+	// has a fixed length so that no key is a prefix of another one.
+	tokenKeyPrefix        = "tok:"
+	tokenBalanceKeyPrefix = "tbal:"
+)
+
+// TokenIssuance is the payload of an issue_token transaction.
+type TokenIssuance struct {
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+	Supply   uint64 `json:"supply"`
+	// MintAuthority may mint additional supply; the zero address fixes the supply
+	MintAuthority Address `json:"mintAuthority"`
+}
+
+// Token describes an issued asset.
+type Token struct {
+	Symbol        string  `json:"symbol"`
+	Decimals      uint8   `json:"decimals"`
+	TotalSupply   uint64  `json:"totalSupply"`
+	MintAuthority Address `json:"mintAuthority"`
+	Issuer        Address `json:"issuer"`
+}
+
+// tokenBalance is the trie value of a per-asset balance. The symbol is kept in
+// the value because the key only carries its hash.
+type tokenBalance struct {
+	Symbol  string `json:"symbol"`
+	Balance uint64 `json:"balance"`
+}
+
+func symbolHash(symbol string) Hash {
+	return sha3.Sum256([]byte(symbol))
+}
+
+func tokenKey(symbol string) []byte {
+	h := symbolHash(symbol)
+	return append([]byte(tokenKeyPrefix), h[:]...)
+}
+
+func tokenBalancePrefix(addr Address) []byte {
+	return append([]byte(tokenBalanceKeyPrefix), addr[:]...)
+}
+
+func tokenBalanceKey(addr Address, symbol string) []byte {
+	h := symbolHash(symbol)
+	return append(tokenBalancePrefix(addr), h[:]...)
+}
+
+// validateTokenSymbol checks that a symbol is 2-12 upper-case letters or digits.
+func validateTokenSymbol(symbol string) error {
+	if len(symbol) < MinTokenSymbolLength || len(symbol) > MaxTokenSymbolLength {
+		return fmt.Errorf("token symbol must be %d-%d characters", MinTokenSymbolLength, MaxTokenSymbolLength)
+	}
+	for _, c := range symbol {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("invalid token symbol %q: only A-Z and 0-9 are allowed", symbol)
+		}
+	}
+	return nil
+}
+
+// validateTokenIssuance performs the stateless checks on an issue_token transaction.
+func validateTokenIssuance(tx *Transaction) error {
+	if tx.Token == nil {
+		return errors.New("issue_token transaction missing token payload")
+	}
+	if tx.Value != 0 || tx.Asset != "" {
+		return errors.New("issue_token transactions must not carry value")
+	}
+	if err := validateTokenSymbol(tx.Token.Symbol); err != nil {
+		return err
+	}
+	if tx.Token.Decimals > MaxTokenDecimals {
+		return fmt.Errorf("token decimals must be at most %d", MaxTokenDecimals)
+	}
+	return nil
+}
+
+// validateTokenMint performs the stateless checks on a mint_token transaction.
+func validateTokenMint(tx *Transaction) error {
+	if tx.Asset == "" {
+		return errors.New("mint_token transaction missing asset")
+	}
+	if tx.Value == 0 {
+		return errors.New("mint amount must be positive")
+	}
+	return nil
+}
+
+// validateAssetField rejects an asset on transaction types that only move the
+// native currency.
+func validateAssetField(tx *Transaction) error {
+	if tx.Asset != "" && tx.Type != "transfer" && tx.Type != "mint_token" {
+		return fmt.Errorf("%s transactions cannot carry an asset", tx.Type)
+	}
+	return nil
+}
+
+// nativeCost returns the amount of the native currency a transaction debits
+// from its sender. Asset transfers and mints move tokens and only pay the fee
+// natively. A value and fee whose sum overflows are an error.
+func nativeCost(tx *Transaction) (uint64, error) {
+	if tx.Asset != "" {
+		return tx.Fee, nil
+	}
+	if tx.Value > math.MaxUint64-tx.Fee {
+		return 0, errors.New("transaction value and fee overflow")
+	}
+	return tx.Value + tx.Fee, nil
+}
+
+// checkTokenFunds checks that the sender of an asset-carrying transaction can
+// cover it with the token balances in state.
+func checkTokenFunds(state *State, from Address, tx *Transaction) error {
+	token, err := state.GetToken(tx.Asset)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return fmt.Errorf("unknown token %s", tx.Asset)
+	}
+	switch tx.Type {
+	case "mint_token":
+		if token.MintAuthority == (Address{}) || token.MintAuthority != from {
+			return fmt.Errorf("sender is not the mint authority of %s", tx.Asset)
+		}
+		if token.TotalSupply+tx.Value < token.TotalSupply {
+			return fmt.Errorf("mint would overflow the supply of %s", tx.Asset)
+		}
+	default:
+		balance, err := state.GetTokenBalance(from, tx.Asset)
+		if err != nil {
+			return err
+		}
+		if tx.Value > balance {
+			return fmt.Errorf("insufficient %s balance. want %d, have %d", tx.Asset, tx.Value, balance)
+		}
+	}
+	return nil
+}
+
+// GetToken returns the issued token with the given symbol, or nil if there is none.
+func (s *State) GetToken(symbol string) (*Token, error) {
+	data, found := s.Trie.Get(tokenKey(symbol))
+	if !found {
+		return nil, nil
+	}
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// PutToken stores a token definition in the trie.
+func (s *State) PutToken(token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	s.Trie.Insert(tokenKey(token.Symbol), data)
+	return nil
+}
+
+// GetTokenBalance returns an account's balance of the given token.
+func (s *State) GetTokenBalance(addr Address, symbol string) (uint64, error) {
+	data, found := s.Trie.Get(tokenBalanceKey(addr, symbol))
+	if !found {
+		return 0, nil
+	}
+	var bal tokenBalance
+	if err := json.Unmarshal(data, &bal); err != nil {
+		return 0, err
+	}
+	return bal.Balance, nil
+}
+
+// SetTokenBalance stores an account's balance of the given token.
+func (s *State) SetTokenBalance(addr Address, symbol string, balance uint64) error {
+	data, err := json.Marshal(tokenBalance{Symbol: symbol, Balance: balance})
+	if err != nil {
+		return err
+	}
+	s.Trie.Insert(tokenBalanceKey(addr, symbol), data)
+	return nil
+}
+
+// GetTokenBalances returns every token balance held by an account, keyed by symbol.
+func (s *State) GetTokenBalances(addr Address) (map[string]uint64, error) {
+	balances := make(map[string]uint64)
+	for _, kv := range s.Trie.PrefixScan(tokenBalancePrefix(addr)) {
+		var bal tokenBalance
+		if err := json.Unmarshal(kv.Value, &bal); err != nil {
+			return nil, err
+		}
+		balances[bal.Symbol] = bal.Balance
+	}
+	return balances, nil
+}
+
+// GetTokens returns all issued tokens sorted by symbol.
+func (s *State) GetTokens() ([]*Token, error) {
+	var tokens []*Token
+	for _, kv := range s.Trie.PrefixScan([]byte(tokenKeyPrefix)) {
+		var token Token
+		if err := json.Unmarshal(kv.Value, &token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Symbol < tokens[j].Symbol })
+	return tokens, nil
+}
+
+// checkTokenIssuance checks that an issue_token transaction does not reuse an
+// existing symbol.
+func checkTokenIssuance(state *State, tx *Transaction) error {
+	existing, err := state.GetToken(tx.Token.Symbol)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("token %s already exists", tx.Token.Symbol)
+	}
+	return nil
+}
+
+// applyTokenTransaction applies the token side of an issue_token, mint_token or
+// asset transfer. The transaction has already been checked by ApplyTransaction.
+func (s *State) applyTokenTransaction(tx *Transaction) error {
+	switch tx.Type {
+	case "issue_token":
+		token := &Token{
+			Symbol:        tx.Token.Symbol,
+			Decimals:      tx.Token.Decimals,
+			TotalSupply:   tx.Token.Supply,
+			MintAuthority: tx.Token.MintAuthority,
+			Issuer:        tx.From,
+		}
+		if err := s.PutToken(token); err != nil {
+			return err
+		}
+		return s.SetTokenBalance(tx.From, token.Symbol, tx.Token.Supply)
+	case "mint_token":
+		token, err := s.GetToken(tx.Asset)
+		if err != nil {
+			return err
+		}
+		token.TotalSupply += tx.Value
+		if err := s.PutToken(token); err != nil {
+			return err
+		}
+		return s.creditToken(tx.To, tx.Asset, tx.Value)
+	default:
+		balance, err := s.GetTokenBalance(tx.From, tx.Asset)
+		if err != nil {
+			return err
+		}
+		if err := s.SetTokenBalance(tx.From, tx.Asset, balance-tx.Value); err != nil {
+			return err
+		}
+		return s.creditToken(tx.To, tx.Asset, tx.Value)
+	}
+}
+
+func (s *State) creditToken(addr Address, symbol string, amount uint64) error {
+	balance, err := s.GetTokenBalance(addr, symbol)
+	if err != nil {
+		return err
+	}
+	return s.SetTokenBalance(addr, symbol, balance+amount)
+}
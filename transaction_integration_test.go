@@ -61,7 +61,7 @@ func TestTransactionIntegration(t *testing.T) {
 	assert.Equal(t, tx.Hash, selectedTxs[0].Hash)
 
 	// Test 4: Create block with transaction
-	proposer := v1
+	proposer := &Validator{Address: Address{0xfe}, Stake: 100} // collects the fee tips
 	block, err := bc.CreateBlock(selectedTxs, proposer, privKey1)
 	require.NoError(t, err)
 	assert.Len(t, block.Transactions, 1)
@@ -235,10 +235,42 @@ func TestParticipationTransactionIntegration(t *testing.T) {
 	err = bc.ApplyBlockWithRegistry(block, state, vr)
 	assert.NoError(t, err)
 
-	// Verify validator is now participating
+	// Participation is scheduled, not yet active
 	updatedV, err := vr.GetValidator(addr)
 	assert.NoError(t, err)
+	assert.False(t, updatedV.Participating)
+	participating, pending, err := vr.GetPendingParticipation(addr)
+	require.NoError(t, err)
+	assert.True(t, pending)
+	assert.True(t, participating)
+
+	// Verify validator is participating once the next epoch begins
+	require.NoError(t, processEpochTransition(1, vr))
+	updatedV, err = vr.GetValidator(addr)
+	assert.NoError(t, err)
 	assert.True(t, updatedV.Participating)
+
+	// Leave participation, again effective at the following epoch
+	leave := &Transaction{
+		From:      addr,
+		To:        addr,
+		Nonce:     2,
+		Type:      "leave_participation",
+		Timestamp: time.Now().UnixNano(),
+	}
+	require.NoError(t, leave.Sign(privKey))
+	require.NoError(t, txPool.AddTransaction(leave, privKey.PubKey(), state))
+	require.NoError(t, state.ApplyTransaction(leave))
+	require.NoError(t, vr.ScheduleParticipation(addr, false))
+
+	// Re-processing an epoch that already ran is a no-op
+	require.NoError(t, processEpochTransition(1, vr))
+	updatedV, _ = vr.GetValidator(addr)
+	assert.True(t, updatedV.Participating)
+
+	require.NoError(t, processEpochTransition(2, vr))
+	updatedV, _ = vr.GetValidator(addr)
+	assert.False(t, updatedV.Participating)
 }
 
 // TestTransactionValidationIntegration tests transaction validation across components
@@ -340,7 +372,7 @@ func TestTransactionStateConsistency(t *testing.T) {
 	}
 
 	// Create block with all transactions
-	proposer := &Validator{Address: addr1, Stake: 100}
+	proposer := &Validator{Address: Address{0xfe}, Stake: 100} // collects the fee tips
 	block, err := bc.CreateBlock(txs, proposer, privKey1)
 	require.NoError(t, err)
 
@@ -29,6 +29,14 @@ type TransactionPool struct {
 	maxBatchFee  uint64
 	batchTimeout int64 // nanoseconds
 
+	// Minimum fee accepted into the pool
+	minFee uint64
+
+	// Gas rules of the next block: transactions must fit in the block gas
+	// limit and pay at least the base fee
+	blockGasLimit uint64
+	baseFee       uint64
+
 	// Priority tracking
 	priorityScores map[Hash]float64
 }
@@ -36,9 +44,10 @@ type TransactionPool struct {
 func NewTransactionPool() *TransactionPool {
 	return &TransactionPool{
 		transactions:   make(map[Hash]*Transaction),
-		maxBatchSize:   100,        // Maximum transactions per batch
-		maxBatchFee:    1000,       // Maximum total fee per batch
-		batchTimeout:   5000000000, // 5 seconds in nanoseconds
+		maxBatchSize:   100,                // Maximum transactions per batch
+		maxBatchFee:    DefaultMaxBatchFee, // Maximum total fee per batch
+		batchTimeout:   5000000000,         // 5 seconds in nanoseconds
+		blockGasLimit:  DefaultBlockGasLimit,
 		priorityScores: make(map[Hash]float64),
 	}
 }
@@ -52,6 +61,22 @@ func (tp *TransactionPool) SetBatchingConfig(maxSize int, maxFee uint64, timeout
 	tp.batchTimeout = timeout
 }
 
+// SetFeeRules applies the governed fee parameters to the pool
+func (tp *TransactionPool) SetFeeRules(minFee, maxBatchFee uint64) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.minFee = minFee
+	tp.maxBatchFee = maxBatchFee
+}
+
+// SetGasRules applies the block gas limit and the base fee of the next block
+func (tp *TransactionPool) SetGasRules(blockGasLimit, baseFee uint64) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	tp.blockGasLimit = blockGasLimit
+	tp.baseFee = baseFee
+}
+
 // calculatePriority calculates a priority score for a transaction
 func (tp *TransactionPool) calculatePriority(tx *Transaction) float64 {
 	// Base priority on fee-to-value ratio
@@ -75,7 +100,7 @@ func (tp *TransactionPool) calculatePriority(tx *Transaction) float64 {
 		typeMultiplier = 2.0
 	case "delegate":
 		typeMultiplier = 1.5
-	case "participation":
+	case "participation", "leave_participation":
 		typeMultiplier = 1.2
 	}
 
@@ -87,114 +112,150 @@ func (tp *TransactionPool) AddTransaction(tx *Transaction, pubKey *btcec.PublicK
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
 
-	// 1. Verify Signature
-	if !tx.Verify(pubKey) {
-		log.Printf("DEBUG: Signature verification failed for tx %s", tx.Hash.ToHex())
-		return errors.New("invalid signature")
+	// 1. Verify Signature. Multisig transactions are checked against the key
+	// set in their envelope instead of pubKey.
+	senderAddr, err := verifyTransactionSender(tx, pubKey, state)
+	if err != nil {
+		log.Printf("DEBUG: Signature verification failed for tx %s: %v", tx.Hash.ToHex(), err)
+		return err
+	}
+
+	// Enforce the governed minimum fee, which applies per payment
+	if minFee := tp.minFee * feeUnits(tx); tx.Fee < minFee {
+		return fmt.Errorf("fee %d below minimum %d", tx.Fee, minFee)
+	}
+
+	// The transaction must fit in a block and cover the current base fee
+	if gas := TransactionGas(tx); gas > tp.blockGasLimit {
+		return fmt.Errorf("transaction gas %d exceeds the %d block gas limit", gas, tp.blockGasLimit)
+	}
+	if err := checkBaseFee(tx, tp.baseFee); err != nil {
+		return err
+	}
+
+	// Transactions that are not valid yet wait in the pool; expired ones are refused
+	if err := validateValidityWindow(tx); err != nil {
+		return err
+	}
+	if tx.expired(state.Height() + 1) {
+		return fmt.Errorf("transaction expired at height %d", tx.ValidUntilHeight)
+	}
+
+	if err := validateAssetField(tx); err != nil {
+		return err
+	}
+	if err := validateTransactionData(tx); err != nil {
+		return err
+	}
+	if err := validateOutputsField(tx); err != nil {
+		return err
+	}
+
+	cost, err := nativeCost(tx)
+	if err != nil {
+		return err
 	}
 
-	// Handle different transaction types
+	// Vesting accounts may only spend their released balance in the next block
+	if err := checkVestingSpend(state, senderAddr, cost, state.Height()+1); err != nil {
+		return err
+	}
+
+	// Type-specific checks
 	switch tx.Type {
-	case "participation":
-		// Only check for duplicates
-		if _, ok := tp.transactions[tx.Hash]; ok {
-			return errors.New("transaction already in pool")
-		}
-		tp.transactions[tx.Hash] = tx
-		log.Printf("Added participation transaction to pool: %x", tx.Hash)
-		return nil
-	case "register_validator":
-		// Check for duplicates
-		if _, ok := tp.transactions[tx.Hash]; ok {
-			return errors.New("transaction already in pool")
+	case "participation", "leave_participation":
+		if tx.Value != 0 {
+			err = errors.New("participation transactions must not carry value")
 		}
-		// Validate stake amount
-		if tx.Value == 0 {
-			return errors.New("validator registration requires non-zero stake")
-		}
-		// Check nonce and balance from state
-		senderAddr := pubKeyToAddress(pubKey)
-		sender, err := state.GetAccount(senderAddr)
-		if err != nil {
-			// For new accounts, create them with 0 balance and nonce 0
-			sender = &Account{Address: senderAddr, Balance: 0, Nonce: 0}
-			if err := state.PutAccount(sender); err != nil {
-				return fmt.Errorf("failed to create new account: %w", err)
-			}
+	case "compute_attestation":
+		err = validateComputeAttestation(tx)
+	case "submit_proposal":
+		err = validateProposal(tx)
+	case "vote":
+		err = validateVote(tx)
+	case "issue_token":
+		err = validateTokenIssuance(tx)
+		if err == nil {
+			err = checkTokenIssuance(state, tx)
 		}
-
-		if tx.Nonce != sender.Nonce+1 {
-			return fmt.Errorf("invalid nonce. got %d, want %d", tx.Nonce, sender.Nonce+1)
+	case "mint_token":
+		err = validateTokenMint(tx)
+		if err == nil {
+			err = checkTokenFunds(state, senderAddr, tx)
 		}
-
-		if tx.Value+tx.Fee > sender.Balance {
-			return fmt.Errorf("insufficient balance. want %d, have %d", tx.Value+tx.Fee, sender.Balance)
+	case "htlc_lock", "htlc_claim", "htlc_refund":
+		err = validateHTLC(tx)
+		if err == nil {
+			// Timeouts are checked against the next block
+			err = checkHTLC(state, tx, state.Height()+1)
 		}
-
-		tp.transactions[tx.Hash] = tx
-		log.Printf("Added validator registration transaction to pool: %x", tx.Hash)
-		return nil
-	case "delegate":
-		// Check for duplicates
-		if _, ok := tp.transactions[tx.Hash]; ok {
-			return errors.New("transaction already in pool")
+	case "deploy_contract", "call_contract":
+		err = validateContractTx(tx)
+	case "rotate_key":
+		err = validateKeyRotation(tx)
+	case "multi_transfer":
+		err = validateMultiTransfer(tx)
+	case "create_vesting":
+		err = validateCreateVesting(tx)
+		if err == nil {
+			err = checkCreateVesting(state, tx)
 		}
-		// Validate delegation amount
+	case "register_validator":
 		if tx.Value == 0 {
-			return errors.New("delegation requires non-zero amount")
-		}
-		// Check nonce and balance from state
-		senderAddr := pubKeyToAddress(pubKey)
-		sender, err := state.GetAccount(senderAddr)
-		if err != nil {
-			// For new accounts, create them with 0 balance and nonce 0
-			sender = &Account{Address: senderAddr, Balance: 0, Nonce: 0}
-			if err := state.PutAccount(sender); err != nil {
-				return fmt.Errorf("failed to create new account: %w", err)
-			}
+			err = errors.New("validator registration requires non-zero stake")
 		}
-
-		if tx.Nonce != sender.Nonce+1 {
-			return fmt.Errorf("invalid nonce. got %d, want %d", tx.Nonce, sender.Nonce+1)
+	case "delegate":
+		if tx.Value == 0 {
+			err = errors.New("delegation requires non-zero amount")
 		}
-
-		if tx.Value+tx.Fee > sender.Balance {
-			return fmt.Errorf("insufficient balance. want %d, have %d", tx.Value+tx.Fee, sender.Balance)
+	case "transfer":
+		// Asset transfers move tokens rather than the native currency
+		if tx.Asset != "" {
+			err = checkTokenFunds(state, senderAddr, tx)
 		}
-
-		tp.transactions[tx.Hash] = tx
-		log.Printf("Added delegation transaction to pool: %x", tx.Hash)
-		return nil
 	default:
-		// Standard transfer transaction validation
-		// 2. Check nonce and balance from state
-		senderAddr := pubKeyToAddress(pubKey)
-		sender, err := state.GetAccount(senderAddr)
-		if err != nil {
-			// For new accounts, create them with 0 balance and nonce 0
-			sender = &Account{Address: senderAddr, Balance: 0, Nonce: 0}
-			if err := state.PutAccount(sender); err != nil {
-				return fmt.Errorf("failed to create new account: %w", err)
-			}
-		}
+		err = fmt.Errorf("unknown transaction type: %s", tx.Type)
+	}
+	if err != nil {
+		return err
+	}
 
-		if tx.Nonce != sender.Nonce+1 {
-			return fmt.Errorf("invalid nonce. got %d, want %d", tx.Nonce, sender.Nonce+1)
-		}
+	if err := checkSenderNonceAndFunds(tx, state, cost); err != nil {
+		return err
+	}
 
-		if tx.Value+tx.Fee > sender.Balance {
-			return fmt.Errorf("insufficient balance. want %d, have %d", tx.Value+tx.Fee, sender.Balance)
-		}
+	// Check for duplicates
+	if _, ok := tp.transactions[tx.Hash]; ok {
+		return errors.New("transaction already in pool")
+	}
 
-		// 3. Check for duplicates
-		if _, ok := tp.transactions[tx.Hash]; ok {
-			return errors.New("transaction already in pool")
+	// Dry-run contracts against the current state so that calls that revert
+	// or run out of gas are not gossiped
+	if tx.Type == "deploy_contract" || tx.Type == "call_contract" {
+		if _, err := state.executeContract(tx, state.Height()+1); err != nil {
+			return err
 		}
+	}
 
-		tp.transactions[tx.Hash] = tx
-		log.Printf("Added transaction to pool: %x", tx.Hash)
-		return nil
+	tp.transactions[tx.Hash] = tx
+	log.Printf("Added %s transaction to pool: %x", tx.Type, tx.Hash)
+	return nil
+}
+
+// checkSenderNonceAndFunds checks that a transaction carries its sender's next
+// nonce and that the sender's native balance covers cost.
+func checkSenderNonceAndFunds(tx *Transaction, state *State, cost uint64) error {
+	sender, err := state.GetAccount(tx.From)
+	if err != nil {
+		return fmt.Errorf("failed to get sender account: %w", err)
+	}
+	if tx.Nonce != sender.Nonce+1 {
+		return fmt.Errorf("invalid nonce. got %d, want %d", tx.Nonce, sender.Nonce+1)
 	}
+	if cost > sender.Balance {
+		return fmt.Errorf("insufficient balance. want %d, have %d", cost, sender.Balance)
+	}
+	return nil
 }
 
 // RemoveTransaction removes a transaction from the pool by hash.
@@ -204,6 +265,25 @@ func (tp *TransactionPool) RemoveTransaction(hash [32]byte) {
 	delete(tp.transactions, hash)
 }
 
+// EvictExpired removes the transactions that can no longer be included from
+// height on, and returns how many were removed.
+func (tp *TransactionPool) EvictExpired(height uint64) int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	evicted := 0
+	for hash, tx := range tp.transactions {
+		if tx.expired(height) {
+			delete(tp.transactions, hash)
+			delete(tp.priorityScores, hash)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		log.Printf("INFO: Evicted %d expired transactions from pool", evicted)
+	}
+	return evicted
+}
+
 // SelectTransactions selects up to n transactions for block inclusion, filtering by nonce and balance at selection time.
 func (tp *TransactionPool) SelectTransactions(n int, state *State) []*Transaction {
 	tp.mu.RLock()
@@ -236,8 +316,31 @@ func (tp *TransactionPool) SelectTransactions(n int, state *State) []*Transactio
 			log.Printf("DEBUG: Skipping tx %s: invalid nonce at selection. got %d, want %d", tx.Hash.ToHex(), tx.Nonce, sender.Nonce+1)
 			continue
 		}
-		if tx.Value+tx.Fee > sender.Balance {
-			log.Printf("DEBUG: Skipping tx %s: insufficient balance at selection. want %d, have %d", tx.Hash.ToHex(), tx.Value+tx.Fee, sender.Balance)
+		cost, err := nativeCost(tx)
+		if err != nil {
+			log.Printf("DEBUG: Skipping tx %s: %v", tx.Hash.ToHex(), err)
+			continue
+		}
+		if cost > sender.Balance {
+			log.Printf("DEBUG: Skipping tx %s: insufficient balance at selection. want %d, have %d", tx.Hash.ToHex(), cost, sender.Balance)
+			continue
+		}
+		if tx.Asset != "" {
+			if err := checkTokenFunds(state, tx.From, tx); err != nil {
+				log.Printf("DEBUG: Skipping tx %s: %v", tx.Hash.ToHex(), err)
+				continue
+			}
+		}
+		if err := checkVestingSpend(state, tx.From, cost, state.Height()+1); err != nil {
+			log.Printf("DEBUG: Skipping tx %s: %v", tx.Hash.ToHex(), err)
+			continue
+		}
+		if err := checkBaseFee(tx, tp.baseFee); err != nil {
+			log.Printf("DEBUG: Skipping tx %s: %v", tx.Hash.ToHex(), err)
+			continue
+		}
+		if err := checkValidityWindow(tx, state.Height()+1); err != nil {
+			log.Printf("DEBUG: Skipping tx %s: %v", tx.Hash.ToHex(), err)
 			continue
 		}
 
@@ -251,15 +354,27 @@ func (tp *TransactionPool) SelectTransactions(n int, state *State) []*Transactio
 		return validTxs[i].priority > validTxs[j].priority
 	})
 
-	// Select top n transactions
+	// Select top n transactions that fit in the block gas limit. Only one
+	// transaction per sender can have the next nonce, and a block holding two
+	// would be invalid.
 	txs := make([]*Transaction, 0, n)
-	for i, txWithPrio := range validTxs {
-		if i >= n {
+	gas := uint64(0)
+	senders := make(map[Address]bool)
+	for _, txWithPrio := range validTxs {
+		if len(txs) >= n {
 			break
 		}
+		if senders[txWithPrio.tx.From] {
+			continue
+		}
+		if gas+TransactionGas(txWithPrio.tx) > tp.blockGasLimit {
+			continue
+		}
+		gas += TransactionGas(txWithPrio.tx)
 		log.Printf("DEBUG: Selecting transaction %s (To: %s, Value: %d, Fee: %d, Priority: %.3f)",
 			txWithPrio.tx.Hash.ToHex(), txWithPrio.tx.To.ToHex(), txWithPrio.tx.Value, txWithPrio.tx.Fee, txWithPrio.priority)
 		txs = append(txs, txWithPrio.tx)
+		senders[txWithPrio.tx.From] = true
 	}
 
 	log.Printf("DEBUG: SelectTransactions returning %d transactions", len(txs))
@@ -292,7 +407,20 @@ func (tp *TransactionPool) CreateOptimizedBatch(state *State) *TransactionBatch
 		if tx.Nonce != sender.Nonce+1 {
 			continue
 		}
-		if tx.Value+tx.Fee > sender.Balance {
+		cost, err := nativeCost(tx)
+		if err != nil || cost > sender.Balance {
+			continue
+		}
+		if tx.Asset != "" && checkTokenFunds(state, tx.From, tx) != nil {
+			continue
+		}
+		if checkVestingSpend(state, tx.From, cost, state.Height()+1) != nil {
+			continue
+		}
+		if checkBaseFee(tx, tp.baseFee) != nil {
+			continue
+		}
+		if checkValidityWindow(tx, state.Height()+1) != nil {
 			continue
 		}
 
@@ -309,6 +437,8 @@ func (tp *TransactionPool) CreateOptimizedBatch(state *State) *TransactionBatch
 	var batch []*Transaction
 	totalFee := uint64(0)
 	totalSize := 0
+	totalGas := uint64(0)
+	senders := make(map[Address]bool)
 
 	for _, txWithPrio := range validTxs {
 		tx := txWithPrio.tx
@@ -317,9 +447,15 @@ func (tp *TransactionPool) CreateOptimizedBatch(state *State) *TransactionBatch
 		if len(batch) >= tp.maxBatchSize {
 			break
 		}
+		if senders[tx.From] {
+			continue // Only one transaction per sender has the next nonce
+		}
 		if totalFee+tx.Fee > tp.maxBatchFee {
 			continue
 		}
+		if totalGas+TransactionGas(tx) > tp.blockGasLimit {
+			continue
+		}
 
 		// Estimate transaction size (simplified)
 		txSize := 200                   // Base size estimate
@@ -328,8 +464,10 @@ func (tp *TransactionPool) CreateOptimizedBatch(state *State) *TransactionBatch
 		}
 
 		batch = append(batch, tx)
+		senders[tx.From] = true
 		totalFee += tx.Fee
 		totalSize += txSize
+		totalGas += TransactionGas(tx)
 	}
 
 	// Calculate batch priority (average of transaction priorities)
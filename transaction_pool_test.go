@@ -1,12 +1,14 @@
 package main
 
 import (
+	"math"
 	"testing"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	ecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -29,6 +31,7 @@ func makePoolTestTx(from, to Address, value, nonce uint64, priv *btcec.PrivateKe
 		Value: value,
 		Nonce: nonce,
 		Fee:   0,
+		Type:  "transfer",
 	}
 	data, _ := tx.Encode()
 	tx.Hash = sha3.Sum256(data)
@@ -52,6 +55,12 @@ func TestTransactionPool(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, 1, tp.Size())
 
+	// A transaction of a type no block would apply is refused
+	unknown := &Transaction{From: addr1, To: addr2, Value: 10, Nonce: 1, Type: "teleport"}
+	require.NoError(t, unknown.Sign(priv))
+	assert.ErrorContains(t, tp.AddTransaction(unknown, priv.PubKey(), state), "unknown transaction type")
+	assert.Equal(t, 1, tp.Size())
+
 	// Remove transaction
 	tp.RemoveTransaction(tx1.Hash)
 	assert.Equal(t, 0, tp.Size())
@@ -122,9 +131,81 @@ func TestParticipationTransaction(t *testing.T) {
 	_ = bc.ApplyBlockWithRegistry(block, state2, vr)
 
 	v2, _ := vr.GetValidator(addr1)
+	assert.False(t, v2.Participating, "Participation should not take effect before the next epoch")
+
+	require.NoError(t, vr.ActivatePendingParticipation())
+	v2, _ = vr.GetValidator(addr1)
 	assert.True(t, v2.Participating, "Validator should be marked as participating after participation tx")
 }
 
+func TestParticipationTransaction_NonceAndBalanceChecked(t *testing.T) {
+	state, priv, addr1, _ := setupTxPoolTest()
+	tp := NewTransactionPool()
+
+	// Wrong nonce is rejected
+	tx := &Transaction{From: addr1, To: addr1, Nonce: 2, Type: "participation"}
+	require.NoError(t, tx.Sign(priv))
+	assert.Error(t, tp.AddTransaction(tx, priv.PubKey(), state))
+
+	// Fee above balance is rejected
+	tx = &Transaction{From: addr1, To: addr1, Nonce: 1, Fee: 1000, Type: "leave_participation"}
+	require.NoError(t, tx.Sign(priv))
+	assert.Error(t, tp.AddTransaction(tx, priv.PubKey(), state))
+
+	// Value is not allowed
+	tx = &Transaction{From: addr1, To: addr1, Value: 5, Nonce: 1, Type: "participation"}
+	require.NoError(t, tx.Sign(priv))
+	assert.Error(t, tp.AddTransaction(tx, priv.PubKey(), state))
+
+	tx = &Transaction{From: addr1, To: addr1, Nonce: 1, Fee: 1, Type: "leave_participation"}
+	require.NoError(t, tx.Sign(priv))
+	assert.NoError(t, tp.AddTransaction(tx, priv.PubKey(), state))
+}
+
+func TestCheckSenderNonceAndFunds(t *testing.T) {
+	state, _, addr1, _ := setupTxPoolTest()
+
+	tx := &Transaction{From: addr1, Nonce: 1, Value: 90, Fee: 10}
+	check := func() error {
+		cost, err := nativeCost(tx)
+		require.NoError(t, err)
+		return checkSenderNonceAndFunds(tx, state, cost)
+	}
+	assert.NoError(t, check())
+
+	tx.Fee = 11
+	assert.ErrorContains(t, check(), "insufficient balance")
+
+	// Token transfers only cost the fee in native currency
+	tx.Asset = "TOK"
+	assert.NoError(t, check())
+
+	tx.Nonce = 2
+	assert.ErrorContains(t, check(), "invalid nonce")
+}
+
+func TestNativeCost_RejectsOverflow(t *testing.T) {
+	state, priv, addr1, addr2 := setupTxPoolTest()
+	tx := &Transaction{From: addr1, To: addr2, Value: math.MaxUint64, Fee: 1, Nonce: 1, Type: "transfer"}
+	require.NoError(t, tx.Sign(priv))
+	_, err := nativeCost(tx)
+	assert.ErrorContains(t, err, "overflow")
+
+	// The pool refuses it, selection skips it and applying it fails
+	tp := NewTransactionPool()
+	assert.ErrorContains(t, tp.AddTransaction(tx, priv.PubKey(), state), "overflow")
+	tp.transactions[tx.Hash] = tx
+	assert.Empty(t, tp.SelectTransactions(10, state))
+	assert.Empty(t, tp.CreateOptimizedBatch(state).Transactions)
+	assert.ErrorContains(t, state.ApplyTransaction(tx), "overflow")
+	acc, err := state.GetAccount(addr1)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), acc.Balance)
+	recipient, err := state.GetAccount(addr2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(50), recipient.Balance)
+}
+
 func TestTransactionBatching(t *testing.T) {
 	pool := NewTransactionPool()
 	state := NewState()
@@ -363,3 +444,17 @@ func TestTransactionSelectionWithPriority(t *testing.T) {
 	// Second transaction should be high fee transaction
 	assert.Equal(t, uint64(20), selected[1].Fee)
 }
+
+func TestTransactionSelection_OneTransactionPerSender(t *testing.T) {
+	pool := NewTransactionPool()
+	state := NewState()
+	sender := newTokenTestAccount(t, state, 1000)
+
+	// Two transactions with the same nonce cannot both go into a block
+	for _, value := range []uint64{1, 2} {
+		tx := tokenTx(t, state, sender, &Transaction{To: Address{1}, Value: value, Type: "transfer"})
+		require.NoError(t, pool.AddTransaction(tx, sender.key.PubKey(), state))
+	}
+	assert.Len(t, pool.SelectTransactions(10, state), 1)
+	assert.Len(t, pool.CreateOptimizedBatch(state).Transactions, 1)
+}
@@ -84,8 +84,10 @@ type Block struct {
 	Header        *Header
 	Transactions  []*Transaction
 	ValidatorList []*Validator
-	Signature     []byte // Proposer's signature on the block header hash
-	Size          uint64 `json:"size"` // The overall size in bytes of the block
+	Signature     []byte             // Proposer's signature on the block header hash
+	ProposerKey   []byte             `json:"proposerKey,omitempty"` // Compressed key the signature was made with
+	Size          uint64             `json:"size"`                  // The overall size in bytes of the block
+	Certificate   *CommitCertificate `json:"certificate,omitempty"` // Committee approvals, set when the block is finalized
 }
 
 // Header represents the header of a block.
@@ -94,9 +96,11 @@ type Header struct {
 	PreviousHash    Hash    `json:"previousHash"`
 	Timestamp       int64   `json:"timestamp"`
 	Proposer        Address `json:"proposer"`
-	Gas             uint64  `json:"gas"` // The total amount of transaction fees for the current block
+	Gas             uint64  `json:"gas"`     // The total gas reserved by the block's transactions
+	BaseFee         uint64  `json:"baseFee"` // Fee per unit of gas burned by the block's transactions
 	TransactionRoot Hash    `json:"transactionRoot"`
-	Hash            Hash    `json:"hash"` // Hash of the current block header
+	StateRoot       Hash    `json:"stateRoot"` // Root of the proposer's state after the previous block
+	Hash            Hash    `json:"hash"`      // Hash of the current block header
 }
 
 // Transaction represents a single transaction.
@@ -107,10 +111,75 @@ type Transaction struct {
 	Nonce     uint64  `json:"nonce"`
 	Fee       uint64  `json:"fee"`
 	Timestamp int64   `json:"timestamp"`
-	Type      string  `json:"type"` // "transfer", "participation", "register_validator", "delegate"
+	Type      string  `json:"type"` // "transfer", "participation", "leave_participation", "register_validator", "delegate", "compute_attestation", "submit_proposal", "vote", "issue_token", "mint_token", "create_vesting", "htlc_lock", "htlc_claim", "htlc_refund", "deploy_contract", "call_contract", "multi_transfer", "rotate_key"
 	Signature []byte  `json:"signature"`
 	Hash      Hash    `json:"hash"`
 	Used      bool    `json:"used"` // Flag to prevent duplicate inclusion
+
+	// Attestation is the payload of a compute_attestation transaction
+	Attestation *ComputeAttestation `json:"attestation,omitempty"`
+	// Proposal and Vote are the payloads of governance transactions
+	Proposal *ProposalPayload `json:"proposal,omitempty"`
+	Vote     *VotePayload     `json:"vote,omitempty"`
+	// Asset is the token symbol moved by a transfer or mint_token; empty means
+	// the native currency
+	Asset string `json:"asset,omitempty"`
+	// Token is the payload of an issue_token transaction
+	Token *TokenIssuance `json:"token,omitempty"`
+	// Multisig replaces Signature for transactions sent from an M-of-N account
+	Multisig *MultisigEnvelope `json:"multisig,omitempty"`
+	// Vesting is the schedule created for the recipient of a create_vesting transaction
+	Vesting *VestingSchedule `json:"vesting,omitempty"`
+	// HTLC is the payload of the htlc_lock, htlc_claim and htlc_refund transactions
+	HTLC *HTLCPayload `json:"htlc,omitempty"`
+	// Contract is the payload of the deploy_contract and call_contract transactions
+	Contract *ContractPayload `json:"contract,omitempty"`
+	// ValidFromHeight and ValidUntilHeight bound the heights of the blocks the
+	// transaction may be included in; zero leaves that side open
+	ValidFromHeight  uint64 `json:"validFromHeight,omitempty"`
+	ValidUntilHeight uint64 `json:"validUntilHeight,omitempty"`
+	// Data is a free-form memo, such as an exchange deposit reference
+	Data []byte `json:"data,omitempty"`
+	// Outputs are the payments of a multi_transfer transaction
+	Outputs []TransferOutput `json:"outputs,omitempty"`
+	// KeyRotation is the payload of a rotate_key transaction
+	KeyRotation *KeyRotation `json:"keyRotation,omitempty"`
+}
+
+// MaxTransactionDataLength bounds the memo carried in Transaction.Data.
+const MaxTransactionDataLength = 256
+
+// validateTransactionData checks the size of a transaction's memo.
+func validateTransactionData(tx *Transaction) error {
+	if len(tx.Data) > MaxTransactionDataLength {
+		return fmt.Errorf("transaction data exceeds %d bytes", MaxTransactionDataLength)
+	}
+	return nil
+}
+
+// validateValidityWindow performs the stateless checks on a transaction's
+// validity window.
+func validateValidityWindow(tx *Transaction) error {
+	if tx.ValidUntilHeight != 0 && tx.ValidFromHeight > tx.ValidUntilHeight {
+		return fmt.Errorf("valid from height %d is after valid until height %d", tx.ValidFromHeight, tx.ValidUntilHeight)
+	}
+	return nil
+}
+
+// checkValidityWindow checks that a transaction may be included in the block at height.
+func checkValidityWindow(tx *Transaction, height uint64) error {
+	if height < tx.ValidFromHeight {
+		return fmt.Errorf("transaction is not valid before height %d", tx.ValidFromHeight)
+	}
+	if tx.ValidUntilHeight != 0 && height > tx.ValidUntilHeight {
+		return fmt.Errorf("transaction expired at height %d", tx.ValidUntilHeight)
+	}
+	return nil
+}
+
+// expired reports whether a transaction can no longer be included from height on.
+func (t *Transaction) expired(height uint64) bool {
+	return t.ValidUntilHeight != 0 && height > t.ValidUntilHeight
 }
 
 // Encode serializes the Transaction to a JSON byte slice for hashing.
@@ -121,6 +190,20 @@ func (t *Transaction) Encode() ([]byte, error) {
 	return json.Marshal(tempTx)
 }
 
+// transactionContentHash recomputes the hash a transaction was signed under.
+func transactionContentHash(tx *Transaction) (Hash, error) {
+	if tx.Multisig != nil {
+		return tx.MultisigHash()
+	}
+	tempTx := *tx
+	tempTx.Hash, tempTx.Signature, tempTx.Used = Hash{}, nil, false
+	data, err := json.Marshal(tempTx)
+	if err != nil {
+		return Hash{}, err
+	}
+	return sha3.Sum256(data), nil
+}
+
 // Decode deserializes a JSON byte slice into a Transaction.
 func (t *Transaction) Decode(data []byte) error {
 	return json.Unmarshal(data, t)
@@ -190,9 +273,36 @@ type Validator struct {
 }
 
 // ValidatorRegistration represents a validator registration message for network sharing.
+// It is signed with the validator's account key and names the peer that
+// publishes it, so that an announcement cannot be made for another address.
 type ValidatorRegistration struct {
-	Address Address `json:"address"`
-	Stake   uint64  `json:"stake"`
+	Address   Address `json:"address"`
+	Stake     uint64  `json:"stake"`
+	PeerID    string  `json:"peerId"`
+	PubKey    []byte  `json:"pubKey"`
+	Signature []byte  `json:"signature"`
+}
+
+// SigningHash returns the hash a validator registration is signed over.
+func (r *ValidatorRegistration) SigningHash() (Hash, error) {
+	unsigned := *r
+	unsigned.PubKey, unsigned.Signature = nil, nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return Hash{}, err
+	}
+	return sha3.Sum256(data), nil
+}
+
+// Sign signs the registration with the validator's account key.
+func (r *ValidatorRegistration) Sign(privKey *btcec.PrivateKey) error {
+	hash, err := r.SigningHash()
+	if err != nil {
+		return err
+	}
+	r.PubKey = privKey.PubKey().SerializeCompressed()
+	r.Signature = ecdsa.Sign(privKey, hash[:]).Serialize()
+	return nil
 }
 
 // Helper functions for testing and setup
@@ -214,6 +324,7 @@ func (b *Block) Sign(privKey *btcec.PrivateKey) error {
 	}
 	sig := ecdsa.Sign(privKey, b.Header.Hash[:])
 	b.Signature = sig.Serialize()
+	b.ProposerKey = privKey.PubKey().SerializeCompressed()
 	return nil
 }
 
@@ -246,4 +357,5 @@ type Approval struct {
 	BlockHash Hash    `json:"blockHash"`
 	Address   Address `json:"address"`
 	Signature []byte  `json:"signature"`
+	PubKey    []byte  `json:"pubKey,omitempty"` // Compressed key the signature was made with
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	MaxUpgradeNameLength = 64
+
+	upgradePlanKey    = "upgrade_plan"
+	upgradeDonePrefix = "upgrade_done_"
+)
+
+// UpgradePlan schedules a named software upgrade at a block height. Nodes whose
+// binary does not know the upgrade halt block production at that height.
+type UpgradePlan struct {
+	Name   string `json:"name"`
+	Height uint64 `json:"height"`
+	Info   string `json:"info,omitempty"`
+}
+
+// UpgradeHandler is registered by a binary that implements a named upgrade. It
+// migrates the stores once, either when the upgrade height is reached or, if the
+// node had already halted for the upgrade, when the new binary starts.
+type UpgradeHandler func(plan UpgradePlan, chainStore, validatorStore Storage) error
+
+var (
+	upgradeHandlersMu sync.RWMutex
+	upgradeHandlers   = make(map[string]UpgradeHandler)
+)
+
+// RegisterUpgradeHandler registers the handler for a named upgrade.
+func RegisterUpgradeHandler(name string, handler UpgradeHandler) {
+	upgradeHandlersMu.Lock()
+	defer upgradeHandlersMu.Unlock()
+	upgradeHandlers[name] = handler
+}
+
+func lookupUpgradeHandler(name string) (UpgradeHandler, bool) {
+	upgradeHandlersMu.RLock()
+	defer upgradeHandlersMu.RUnlock()
+	handler, ok := upgradeHandlers[name]
+	return handler, ok
+}
+
+// validateUpgradePlan performs the stateless checks on an upgrade plan.
+func validateUpgradePlan(plan *UpgradePlan) error {
+	if plan.Name == "" || len(plan.Name) > MaxUpgradeNameLength {
+		return fmt.Errorf("upgrade name must be 1-%d characters", MaxUpgradeNameLength)
+	}
+	if plan.Height == 0 {
+		return errors.New("upgrade height must be positive")
+	}
+	return nil
+}
+
+// ScheduleUpgrade stores the upgrade plan, replacing any plan not yet reached.
+func (vr *ValidatorRegistry) ScheduleUpgrade(plan UpgradePlan) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put([]byte(upgradePlanKey), data)
+}
+
+// GetUpgradePlan returns the pending upgrade plan, or nil if there is none.
+func (vr *ValidatorRegistry) GetUpgradePlan() (*UpgradePlan, error) {
+	data, err := vr.store.Get([]byte(upgradePlanKey))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var plan UpgradePlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// IsUpgradeApplied reports whether the named upgrade's handler has already run.
+func (vr *ValidatorRegistry) IsUpgradeApplied(name string) bool {
+	_, err := vr.store.Get([]byte(upgradeDonePrefix + name))
+	return err == nil
+}
+
+// applyUpgrade runs the handler for a plan once and records it as applied.
+func applyUpgrade(plan UpgradePlan, handler UpgradeHandler, chainStore Storage, vr *ValidatorRegistry) error {
+	if vr.IsUpgradeApplied(plan.Name) {
+		return nil
+	}
+	if err := handler(plan, chainStore, vr.store); err != nil {
+		return fmt.Errorf("upgrade %q migration failed: %w", plan.Name, err)
+	}
+	data, err := json.Marshal(plan.Height)
+	if err != nil {
+		return err
+	}
+	if err := vr.store.Put([]byte(upgradeDonePrefix+plan.Name), data); err != nil {
+		return err
+	}
+	log.Printf("INFO: Applied upgrade %q scheduled at height %d", plan.Name, plan.Height)
+	return nil
+}
+
+// runUpgradeMigrations is called when a node starts. If the chain stopped at a
+// pending upgrade and this binary implements it, the upgrade's migration runs
+// against the stores before the node resumes.
+func runUpgradeMigrations(chainHeight uint64, chainStore Storage, vr *ValidatorRegistry) error {
+	plan, err := vr.GetUpgradePlan()
+	if err != nil || plan == nil {
+		return err
+	}
+	if chainHeight+1 < plan.Height {
+		log.Printf("INFO: Upgrade %q scheduled at height %d", plan.Name, plan.Height)
+		return nil
+	}
+	handler, ok := lookupUpgradeHandler(plan.Name)
+	if !ok {
+		log.Printf("WARN: Upgrade %q at height %d is not implemented by this binary; block production will stay halted", plan.Name, plan.Height)
+		return nil
+	}
+	return applyUpgrade(*plan, handler, chainStore, vr)
+}
+
+// checkUpgradeHeight reports whether the node may produce or apply a block at
+// height. Reaching a scheduled upgrade this binary does not implement halts
+// the node.
+func (n *AppNode) checkUpgradeHeight(height uint64) bool {
+	plan, err := n.vr.GetUpgradePlan()
+	if err != nil {
+		log.Printf("ERROR: Failed to read upgrade plan: %v", err)
+		return true
+	}
+	if plan == nil || height < plan.Height {
+		return true
+	}
+	if handler, ok := lookupUpgradeHandler(plan.Name); ok {
+		if err := applyUpgrade(*plan, handler, n.chainStore, n.vr); err != nil {
+			log.Printf("CRITICAL: %v", err)
+			n.haltForUpgrade(*plan)
+			return false
+		}
+		return true
+	}
+	n.haltForUpgrade(*plan)
+	return false
+}
+
+// haltForUpgrade stops block production and reports the required upgrade.
+func (n *AppNode) haltForUpgrade(plan UpgradePlan) {
+	if n.upgradeHalted.Swap(true) {
+		return
+	}
+	log.Printf("CRITICAL: UPGRADE %q NEEDED at height %d: halting block production", plan.Name, plan.Height)
+	if n.OnUpgradeHalt != nil {
+		n.OnUpgradeHalt(plan)
+	}
+}
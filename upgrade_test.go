@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	crypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeProposal_SchedulesPlan(t *testing.T) {
+	state, vr, bc, vals := setupGovernanceTest(t, 100, 100)
+
+	upgrade := govTx(t, state, vals[0], &Transaction{
+		Type: "submit_proposal",
+		Proposal: &ProposalPayload{
+			Title:   "v2",
+			Upgrade: &UpgradePlan{Name: "v2", Height: 3 * EpochLength},
+		},
+	})
+	tooSoon := govTx(t, state, vals[1], &Transaction{
+		Type: "submit_proposal",
+		Proposal: &ProposalPayload{
+			Title:   "v2-now",
+			Upgrade: &UpgradePlan{Name: "v2-now", Height: EpochLength},
+		},
+	})
+	applyAt(t, bc, state, vr, 1, upgrade, tooSoon)
+
+	var votes []*Transaction
+	for _, v := range vals {
+		votes = append(votes,
+			govTx(t, state, v, &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: upgrade.Hash, Approve: true}}))
+	}
+	applyAt(t, bc, state, vr, 2, votes...)
+	votes = nil
+	for _, v := range vals {
+		votes = append(votes,
+			govTx(t, state, v, &Transaction{Type: "vote", Vote: &VotePayload{ProposalID: tooSoon.Hash, Approve: true}}))
+	}
+	applyAt(t, bc, state, vr, 3, votes...)
+
+	require.NoError(t, processEpochTransition(1, vr))
+	require.NoError(t, processEpochTransition(2, vr))
+
+	p, _ := vr.GetProposal(upgrade.Hash)
+	assert.Equal(t, ProposalStatusPassed, p.Status)
+	p, _ = vr.GetProposal(tooSoon.Hash)
+	assert.Equal(t, ProposalStatusFailed, p.Status)
+
+	plan, err := vr.GetUpgradePlan()
+	require.NoError(t, err)
+	require.NotNil(t, plan)
+	assert.Equal(t, UpgradePlan{Name: "v2", Height: 3 * EpochLength}, *plan)
+}
+
+func TestCheckUpgradeHeight_HaltsWithoutHandler(t *testing.T) {
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	node := &AppNode{vr: vr, chainStore: NewMemoryStore()}
+	var halted []UpgradePlan
+	node.OnUpgradeHalt = func(plan UpgradePlan) { halted = append(halted, plan) }
+
+	assert.True(t, node.checkUpgradeHeight(100), "no plan scheduled")
+
+	require.NoError(t, vr.ScheduleUpgrade(UpgradePlan{Name: "test-unhandled", Height: 50}))
+	assert.True(t, node.checkUpgradeHeight(49))
+	assert.False(t, node.checkUpgradeHeight(50))
+	assert.False(t, node.checkUpgradeHeight(51))
+	assert.Equal(t, []UpgradePlan{{Name: "test-unhandled", Height: 50}}, halted, "halt is reported once")
+}
+
+func TestCheckUpgradeHeight_RunsRegisteredHandlerOnce(t *testing.T) {
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	chainStore := NewMemoryStore()
+	node := &AppNode{vr: vr, chainStore: chainStore}
+	node.OnUpgradeHalt = func(plan UpgradePlan) { t.Fatalf("unexpected halt for %s", plan.Name) }
+
+	calls := 0
+	RegisterUpgradeHandler("test-handled", func(plan UpgradePlan, cs, vs Storage) error {
+		calls++
+		return cs.Put([]byte("migrated"), []byte(plan.Name))
+	})
+
+	require.NoError(t, vr.ScheduleUpgrade(UpgradePlan{Name: "test-handled", Height: 10}))
+	assert.True(t, node.checkUpgradeHeight(10))
+	assert.True(t, node.checkUpgradeHeight(11))
+	assert.Equal(t, 1, calls)
+	assert.True(t, vr.IsUpgradeApplied("test-handled"))
+
+	data, err := chainStore.Get([]byte("migrated"))
+	require.NoError(t, err)
+	assert.Equal(t, "test-handled", string(data))
+}
+
+func TestRunUpgradeMigrations_OnRestart(t *testing.T) {
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	chainStore := NewMemoryStore()
+	require.NoError(t, vr.ScheduleUpgrade(UpgradePlan{Name: "test-restart", Height: 20}))
+
+	calls := 0
+	RegisterUpgradeHandler("test-restart", func(plan UpgradePlan, cs, vs Storage) error {
+		calls++
+		return nil
+	})
+
+	// Upgrade height not reached yet: nothing to migrate
+	require.NoError(t, runUpgradeMigrations(10, chainStore, vr))
+	assert.Equal(t, 0, calls)
+
+	// The old binary halted before block 20; the new one migrates on start
+	require.NoError(t, runUpgradeMigrations(19, chainStore, vr))
+	require.NoError(t, runUpgradeMigrations(19, chainStore, vr))
+	assert.Equal(t, 1, calls)
+}
+
+func TestNewAppNodeWithStores_MigratesOnRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The chain store kept across the restart ends just before the upgrade
+	chainStore, validatorStore := NewMemoryStore(), NewMemoryStore()
+	bc, err := NewBlockchain(chainStore)
+	require.NoError(t, err)
+	require.NoError(t, bc.AddBlock(&Block{Header: &Header{BlockNumber: 19}}))
+	vr := NewValidatorRegistry(validatorStore, "validators")
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: Address{1}, Stake: 100, Participating: true}))
+	require.NoError(t, vr.ScheduleUpgrade(UpgradePlan{Name: "test-restart-node", Height: 20}))
+
+	calls := 0
+	RegisterUpgradeHandler("test-restart-node", func(plan UpgradePlan, cs, vs Storage) error {
+		calls++
+		return nil
+	})
+	p2pKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	privKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	node, err := NewAppNodeWithStores(ctx, 0, p2pKey, privKey, chainStore, validatorStore)
+	require.NoError(t, err)
+	t.Cleanup(func() { node.p2p.host.Close() })
+
+	assert.Equal(t, 1, calls)
+	assert.True(t, node.vr.IsUpgradeApplied("test-restart-node"))
+	v, err := node.vr.GetValidator(Address{1})
+	require.NoError(t, err)
+	assert.NotNil(t, v, "the registry is kept with the chain")
+}
@@ -51,7 +51,7 @@ func TestValidatorRegistrationTransaction(t *testing.T) {
 	assert.Equal(t, tx.Hash, selectedTxs[0].Hash)
 
 	// Create block with transaction
-	proposer := &Validator{Address: addr, Stake: 100}
+	proposer := &Validator{Address: Address{0xfe}, Stake: 100} // collects the fee tips
 	block, err := bc.CreateBlock(selectedTxs, proposer, priv)
 	require.NoError(t, err)
 	assert.Len(t, block.Transactions, 1)
@@ -77,6 +77,16 @@ func TestValidatorRegistrationTransaction(t *testing.T) {
 	assert.NotNil(t, validator)
 	assert.Equal(t, uint64(500), validator.Stake)
 	assert.Equal(t, uint64(0), validator.DelegatedStake)
+
+	// Participation starts at the next epoch boundary
+	assert.False(t, validator.Participating)
+	participating, pending, err := vr.GetPendingParticipation(addr)
+	require.NoError(t, err)
+	assert.True(t, pending)
+	assert.True(t, participating)
+	require.NoError(t, vr.ActivatePendingParticipation())
+	validator, err = vr.GetValidator(addr)
+	require.NoError(t, err)
 	assert.True(t, validator.Participating)
 
 	// Verify account balance is reduced
@@ -140,7 +150,7 @@ func TestDelegationTransaction(t *testing.T) {
 	assert.Equal(t, tx.Hash, selectedTxs[0].Hash)
 
 	// Create block with transaction
-	proposer := &Validator{Address: addr1, Stake: 100}
+	proposer := &Validator{Address: Address{0xfe}, Stake: 100} // collects the fee tips
 	block, err := bc.CreateBlock(selectedTxs, proposer, privKey1)
 	require.NoError(t, err)
 	assert.Len(t, block.Transactions, 1)
@@ -378,7 +388,7 @@ func TestMultipleDelegations(t *testing.T) {
 	assert.Len(t, selectedTxs, 2)
 
 	// Create block with transactions
-	proposer := &Validator{Address: addr1, Stake: 100}
+	proposer := &Validator{Address: Address{0xfe}, Stake: 100} // collects the fee tips
 	block, err := bc.CreateBlock(selectedTxs, proposer, privKey1)
 	require.NoError(t, err)
 	assert.Len(t, block.Transactions, 2)
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"sort"
 	"strings"
 )
 
+const (
+	pendingParticipationPrefix = "pending_participation_"
+	currentEpochKey            = "current_epoch"
+)
+
 type ValidatorRegistry struct {
 	store  Storage
 	bucket string
@@ -103,19 +110,157 @@ func (vr *ValidatorRegistry) GetAllValidators() ([]*Validator, error) {
 	return validators, nil
 }
 
-// ClearAllValidators removes all validators from the registry.
+// registryKeyPrefixes are the prefixes of every key the registry derives from
+// the chain: validators, participation changes, reputation, the epoch, the
+// consensus parameters, governance and upgrades.
+var registryKeyPrefixes = []string{
+	"validator_", pendingParticipationPrefix, attestationPrefix, reputationHistoryPrefix,
+	currentEpochKey, consensusParamsKey, proposalPrefix, votePrefix, upgradePlanKey, upgradeDonePrefix,
+}
+
+// ClearAllValidators resets the registry for a new chain. Along with the
+// validators it removes everything else the registry derives from the chain,
+// so that a new chain does not start in an old chain's epoch, with its
+// parameters, proposals or pending upgrade.
 func (vr *ValidatorRegistry) ClearAllValidators() error {
 	allData, err := vr.store.List()
 	if err != nil {
 		return err
 	}
 
-	prefix := "validator_"
 	for key := range allData {
-		if strings.HasPrefix(key, prefix) {
-			if err := vr.store.Delete([]byte(key)); err != nil {
+		for _, prefix := range registryKeyPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				if err := vr.store.Delete([]byte(key)); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (vr *ValidatorRegistry) pendingParticipationKey(addr Address) []byte {
+	return append([]byte(pendingParticipationPrefix), addr[:]...)
+}
+
+// ScheduleParticipation records a participation change for a validator. The
+// change only takes effect when ActivatePendingParticipation runs at the next
+// epoch boundary; a later change in the same epoch overrides an earlier one.
+func (vr *ValidatorRegistry) ScheduleParticipation(addr Address, participating bool) error {
+	data, err := json.Marshal(participating)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put(vr.pendingParticipationKey(addr), data)
+}
+
+// GetPendingParticipation returns the scheduled participation change for a
+// validator, if any.
+func (vr *ValidatorRegistry) GetPendingParticipation(addr Address) (participating bool, pending bool, err error) {
+	data, err := vr.store.Get(vr.pendingParticipationKey(addr))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	if err := json.Unmarshal(data, &participating); err != nil {
+		return false, false, err
+	}
+	return participating, true, nil
+}
+
+// ActivatePendingParticipation applies every scheduled participation change
+// and clears the schedule. Changes for validators that are no longer
+// registered are dropped.
+func (vr *ValidatorRegistry) ActivatePendingParticipation() error {
+	allData, err := vr.store.List()
+	if err != nil {
+		return err
+	}
+
+	for key, data := range allData {
+		if !strings.HasPrefix(key, pendingParticipationPrefix) {
+			continue
+		}
+		var addr Address
+		copy(addr[:], key[len(pendingParticipationPrefix):])
+
+		var participating bool
+		if err := json.Unmarshal(data, &participating); err == nil {
+			v, err := vr.GetValidator(addr)
+			if err != nil {
 				return err
 			}
+			if v != nil {
+				v.Participating = participating
+				if err := vr.RegisterValidator(v); err != nil {
+					return err
+				}
+			}
+		}
+		if err := vr.store.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CurrentEpoch returns the epoch the chain is in. Before the first transition
+// has been processed this is epoch 0, starting at genesis with the length from
+// the consensus parameters.
+func (vr *ValidatorRegistry) CurrentEpoch() EpochInfo {
+	data, err := vr.store.Get([]byte(currentEpochKey))
+	if err == nil {
+		var info EpochInfo
+		if err := json.Unmarshal(data, &info); err == nil {
+			return info
+		}
+	}
+	return EpochInfo{Number: 0, StartHeight: 0, Length: vr.GetConsensusParams().EpochLength}
+}
+
+// SetCurrentEpoch records the epoch the chain has transitioned into.
+func (vr *ValidatorRegistry) SetCurrentEpoch(info EpochInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return vr.store.Put([]byte(currentEpochKey), data)
+}
+
+// Export returns every entry of the registry in key order: validators,
+// scheduled participation changes, the current epoch and the governance and
+// reputation data kept alongside them.
+func (vr *ValidatorRegistry) Export() ([]KVPair, error) {
+	allData, err := vr.store.List()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]KVPair, 0, len(allData))
+	for key, data := range allData {
+		entries = append(entries, KVPair{Key: []byte(key), Value: data})
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].Key, entries[j].Key) < 0 })
+	return entries, nil
+}
+
+// Import replaces the contents of the registry with exported entries.
+func (vr *ValidatorRegistry) Import(entries []KVPair) error {
+	allData, err := vr.store.List()
+	if err != nil {
+		return err
+	}
+	for key := range allData {
+		if err := vr.store.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	for _, kv := range entries {
+		if err := vr.store.Put(kv.Key, kv.Value); err != nil {
+			return err
 		}
 	}
 	return nil
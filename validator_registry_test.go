@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidatorRegistry(t *testing.T) {
@@ -54,3 +55,26 @@ func TestValidatorRegistry(t *testing.T) {
 	assert.Equal(t, 1, len(vals))
 	assert.Equal(t, addr, vals[0].Address)
 }
+
+func TestValidatorRegistry_ClearAllValidators(t *testing.T) {
+	store := NewMemoryStore()
+	vr := NewValidatorRegistry(store, "validators")
+	addr := Address{1}
+	require.NoError(t, vr.RegisterValidator(&Validator{Address: addr, Stake: 100}))
+	require.NoError(t, vr.ScheduleParticipation(addr, true))
+	require.NoError(t, vr.SetCurrentEpoch(EpochInfo{Number: 3, StartHeight: 20, Length: 10}))
+	params := DefaultConsensusParams()
+	params.EpochLength = 10
+	require.NoError(t, vr.SetConsensusParams(params))
+	require.NoError(t, vr.PutProposal(&Proposal{ID: Hash{1}, Proposer: addr, Status: ProposalStatusVoting}))
+	require.NoError(t, vr.RecordVote(Hash{1}, addr, true))
+	require.NoError(t, vr.ScheduleUpgrade(UpgradePlan{Name: "v2", Height: 30}))
+	require.NoError(t, store.Put([]byte(upgradeDonePrefix+"v1"), []byte("10")))
+
+	require.NoError(t, vr.ClearAllValidators())
+	entries, err := vr.Export()
+	require.NoError(t, err)
+	assert.Empty(t, entries, "a new chain starts from an empty registry")
+	assert.Equal(t, uint64(0), vr.CurrentEpoch().Number)
+	assert.Equal(t, DefaultConsensusParams(), vr.GetConsensusParams())
+}
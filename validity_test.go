@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidityWindow(t *testing.T) {
+	tx := &Transaction{ValidFromHeight: 5, ValidUntilHeight: 10}
+	require.NoError(t, validateValidityWindow(tx))
+	assert.ErrorContains(t, checkValidityWindow(tx, 4), "not valid before height 5")
+	assert.NoError(t, checkValidityWindow(tx, 5))
+	assert.NoError(t, checkValidityWindow(tx, 10))
+	assert.ErrorContains(t, checkValidityWindow(tx, 11), "expired at height 10")
+
+	assert.NoError(t, checkValidityWindow(&Transaction{}, 1_000_000), "zero leaves the window open")
+	assert.Error(t, validateValidityWindow(&Transaction{ValidFromHeight: 10, ValidUntilHeight: 5}))
+}
+
+func TestValidityWindow_IsSigned(t *testing.T) {
+	user := newTokenTestAccount(t, NewState(), 100)
+	a := &Transaction{From: user.addr, To: Address{1}, Value: 1, Nonce: 1, Type: "transfer", ValidUntilHeight: 10}
+	b := *a
+	b.ValidUntilHeight = 20
+	require.NoError(t, a.Sign(user.key))
+	require.NoError(t, b.Sign(user.key))
+	assert.NotEqual(t, a.Hash, b.Hash)
+}
+
+func TestTransactionPool_ValidityWindow(t *testing.T) {
+	state := NewState()
+	user := newTokenTestAccount(t, state, 100)
+	state.SetHeight(10)
+	tp := NewTransactionPool()
+
+	expired := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer", ValidUntilHeight: 10})
+	assert.ErrorContains(t, tp.AddTransaction(expired, user.key.PubKey(), state), "expired at height 10")
+
+	// A transaction that is not valid yet waits in the pool until its window opens
+	future := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer", ValidFromHeight: 13, ValidUntilHeight: 14})
+	require.NoError(t, tp.AddTransaction(future, user.key.PubKey(), state))
+	assert.Empty(t, tp.SelectTransactions(10, state))
+	state.SetHeight(12)
+	assert.Len(t, tp.SelectTransactions(10, state), 1)
+	assert.Len(t, tp.CreateOptimizedBatch(state).Transactions, 1)
+
+	assert.Equal(t, 0, tp.EvictExpired(14))
+	assert.Equal(t, 1, tp.EvictExpired(15))
+	assert.Equal(t, 0, tp.Size())
+}
+
+func TestBlockchain_RejectsOutOfWindowTransactions(t *testing.T) {
+	state, vr, bc, _ := setupGovernanceTest(t, 100)
+	user := newTokenTestAccount(t, state, 100)
+
+	late := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer", ValidUntilHeight: 4})
+	block := &Block{Header: &Header{BlockNumber: 5, Gas: GasTransaction}, Transactions: []*Transaction{late}}
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(block, state, vr), "expired at height 4")
+
+	early := tokenTx(t, state, user, &Transaction{To: Address{1}, Value: 1, Type: "transfer", ValidFromHeight: 6})
+	block = &Block{Header: &Header{BlockNumber: 5, Gas: GasTransaction}, Transactions: []*Transaction{early}}
+	assert.ErrorContains(t, bc.ApplyBlockWithRegistry(block, state, vr), "not valid before height 6")
+
+	applyAt(t, bc, state, vr, 6, early)
+	acc, _ := state.GetAccount(user.addr)
+	assert.Equal(t, uint64(1), acc.Nonce)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVestingSchedule_Vested(t *testing.T) {
+	schedule := &VestingSchedule{Total: 1000, Start: 100, Cliff: 200, End: 1100}
+	require.NoError(t, schedule.Validate())
+
+	assert.Equal(t, uint64(0), schedule.Vested(0))
+	assert.Equal(t, uint64(0), schedule.Vested(199), "nothing vests before the cliff")
+	assert.Equal(t, uint64(100), schedule.Vested(200), "the cliff releases the linear amount since start")
+	assert.Equal(t, uint64(500), schedule.Vested(600))
+	assert.Equal(t, uint64(1000), schedule.Vested(1100))
+	assert.Equal(t, uint64(1000), schedule.Vested(5000))
+	assert.Equal(t, uint64(500), schedule.Locked(600))
+
+	assert.Error(t, (&VestingSchedule{Total: 1, Start: 10, Cliff: 10, End: 10}).Validate())
+	assert.Error(t, (&VestingSchedule{Total: 1, Start: 10, Cliff: 5, End: 20}).Validate())
+	assert.Error(t, (&VestingSchedule{Total: 0, Start: 0, Cliff: 0, End: 20}).Validate())
+}
+
+func TestCreateVesting_OnlyVestedPortionSpendable(t *testing.T) {
+	state := NewState()
+	funder := newTokenTestAccount(t, state, 2000)
+	beneficiary := newTokenTestAccount(t, state, 0)
+
+	create := tokenTx(t, state, funder, &Transaction{
+		To:      beneficiary.addr,
+		Value:   1000,
+		Type:    "create_vesting",
+		Vesting: &VestingSchedule{Total: 1000, Start: 0, Cliff: 10, End: 100},
+	})
+	require.NoError(t, state.ApplyTransaction(create))
+
+	acc, _ := state.GetAccount(beneficiary.addr)
+	assert.Equal(t, uint64(1000), acc.Balance)
+
+	// A second schedule for the same account is rejected
+	again := tokenTx(t, state, funder, &Transaction{
+		To:      beneficiary.addr,
+		Value:   1,
+		Type:    "create_vesting",
+		Vesting: &VestingSchedule{Total: 1, Start: 0, Cliff: 0, End: 1},
+	})
+	assert.ErrorContains(t, state.ApplyTransaction(again), "already has a vesting schedule")
+
+	state.SetHeight(5)
+	spend := tokenTx(t, state, beneficiary, &Transaction{To: funder.addr, Value: 1, Type: "transfer"})
+	assert.ErrorContains(t, state.ApplyTransaction(spend), "insufficient unlocked balance")
+
+	// Half way through the schedule half of the total is spendable
+	state.SetHeight(50)
+	tooMuch := tokenTx(t, state, beneficiary, &Transaction{To: funder.addr, Value: 500, Type: "transfer"})
+	assert.ErrorContains(t, state.ApplyTransaction(tooMuch), "insufficient unlocked balance")
+	ok := tokenTx(t, state, beneficiary, &Transaction{To: funder.addr, Value: 499, Type: "transfer"})
+	require.NoError(t, state.ApplyTransaction(ok))
+
+	status, err := state.GetVestingStatus(beneficiary.addr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(500), status.Vested)
+	assert.Equal(t, uint64(500), status.Locked)
+}
+
+func TestCreateVesting_RequiresNewAccountOrSender(t *testing.T) {
+	state := NewState()
+	funder := newTokenTestAccount(t, state, 2000)
+	holder := newTokenTestAccount(t, state, 10)
+
+	// An account that already holds funds cannot be given a schedule by others
+	other := tokenTx(t, state, funder, &Transaction{
+		To:      holder.addr,
+		Value:   100,
+		Type:    "create_vesting",
+		Vesting: &VestingSchedule{Total: 100, Start: 0, Cliff: 0, End: 10},
+	})
+	assert.ErrorContains(t, state.ApplyTransaction(other), "must be a new account or the sender")
+
+	// Its owner may lock its own funds
+	own := tokenTx(t, state, holder, &Transaction{
+		To:      holder.addr,
+		Value:   5,
+		Type:    "create_vesting",
+		Vesting: &VestingSchedule{Total: 5, Start: 0, Cliff: 0, End: 10},
+	})
+	require.NoError(t, state.ApplyTransaction(own))
+	status, err := state.GetVestingStatus(holder.addr)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), status.Total)
+}
+
+func TestTransactionPool_VestingLockedBalance(t *testing.T) {
+	state := NewState()
+	beneficiary := newTokenTestAccount(t, state, 1000)
+	require.NoError(t, state.PutVesting(beneficiary.addr, &VestingSchedule{Total: 1000, Start: 0, Cliff: 0, End: 100}))
+	state.SetHeight(9)
+	tp := NewTransactionPool()
+
+	// The pool checks against the next block, at height 10
+	tooMuch := tokenTx(t, state, beneficiary, &Transaction{To: Address{1}, Value: 100, Type: "transfer"})
+	assert.ErrorContains(t, tp.AddTransaction(tooMuch, beneficiary.key.PubKey(), state), "insufficient unlocked balance")
+	ok := tokenTx(t, state, beneficiary, &Transaction{To: Address{1}, Value: 99, Type: "transfer"})
+	require.NoError(t, tp.AddTransaction(ok, beneficiary.key.PubKey(), state))
+}
+
+func TestGenesis_AppliesVestingAllocations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	team := "00000000000000000000000000000000000000aa"
+	genesisJSON := `{"accounts": [
+		{"address": "` + team + `", "balance": 5000, "vesting": {"total": 4000, "start": 0, "cliff": 100, "end": 1000}},
+		{"address": "00000000000000000000000000000000000000bb", "balance": 10}
+	]}`
+	require.NoError(t, os.WriteFile(path, []byte(genesisJSON), 0600))
+
+	genesis, err := LoadGenesis(path)
+	require.NoError(t, err)
+	state := NewState()
+	require.NoError(t, genesis.Apply(state, NewValidatorRegistry(NewMemoryStore(), "validators")))
+
+	addr, _ := HexToAddress(team)
+	acc, _ := state.GetAccount(addr)
+	assert.Equal(t, uint64(5000), acc.Balance)
+	status, err := state.GetVestingStatus(addr)
+	require.NoError(t, err)
+	require.NotNil(t, status)
+	assert.Equal(t, uint64(4000), status.Locked)
+
+	bad := &Genesis{Accounts: []GenesisAccount{{Address: team, Balance: 1, Vesting: &VestingSchedule{Total: 2, End: 1}}}}
+	assert.ErrorContains(t, bad.Apply(NewState(), NewValidatorRegistry(NewMemoryStore(), "validators")), "exceeds balance")
+}
+
+func TestGenesis_RegistersValidators(t *testing.T) {
+	genesis := &Genesis{Validators: []GenesisValidator{{Address: "00000000000000000000000000000000000000aa", Stake: 100}}}
+	vr := NewValidatorRegistry(NewMemoryStore(), "validators")
+	require.NoError(t, genesis.Apply(NewState(), vr))
+
+	addr, _ := HexToAddress("00000000000000000000000000000000000000aa")
+	v, err := vr.GetValidator(addr)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, uint64(100), v.Stake)
+	assert.True(t, v.Participating)
+
+	committee, err := genesis.Committee()
+	require.NoError(t, err)
+	assert.Equal(t, []Address{addr}, committee)
+
+	genesis.Validators[0].Stake = 0
+	assert.ErrorContains(t, genesis.Apply(NewState(), vr), "stake must be positive")
+}
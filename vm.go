@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The contract VM is a small stack machine over 64-bit unsigned words. It has
+// no access to the host beyond the call context and the contract's own
+// storage, uses wrapping integer arithmetic only, and charges gas for every
+// instruction, so execution is deterministic and always terminates.
+//
+// Instructions with several operands take the first from the top of the stack:
+// SUB computes top - second, SSTORE stores second under key top, JUMPI jumps
+// to top if second is non-zero and LOG emits topic top with data second.
+
+// OpCode is a single VM instruction.
+type OpCode byte
+
+const (
+	OpStop OpCode = 0x00
+	OpPush OpCode = 0x01 // followed by an 8-byte big-endian immediate
+	OpPop  OpCode = 0x02
+	OpDup  OpCode = 0x03 // followed by a 1-byte depth: 1 duplicates the top item
+	OpSwap OpCode = 0x04 // followed by a 1-byte depth: 1 swaps the top two items
+
+	OpAdd OpCode = 0x10
+	OpSub OpCode = 0x11
+	OpMul OpCode = 0x12
+	OpDiv OpCode = 0x13
+	OpMod OpCode = 0x14
+
+	OpLt     OpCode = 0x20
+	OpGt     OpCode = 0x21
+	OpEq     OpCode = 0x22
+	OpIsZero OpCode = 0x23
+	OpAnd    OpCode = 0x24
+	OpOr     OpCode = 0x25
+	OpNot    OpCode = 0x26
+
+	OpJump  OpCode = 0x30
+	OpJumpI OpCode = 0x31
+
+	OpSLoad  OpCode = 0x40
+	OpSStore OpCode = 0x41
+
+	OpCaller       OpCode = 0x50 // first 8 bytes of the caller address
+	OpCallValue    OpCode = 0x51
+	OpCallDataLoad OpCode = 0x52
+	OpCallDataSize OpCode = 0x53 // number of 8-byte words of call data
+	OpBlockHeight  OpCode = 0x54
+
+	OpLog OpCode = 0x60
+
+	OpReturn OpCode = 0xF0
+	OpRevert OpCode = 0xFD
+)
+
+const (
+	MaxStackDepth   = 1024
+	MaxContractSize = 24 * 1024
+)
+
+// Gas costs of the VM instructions.
+const (
+	GasVeryLow    = 3
+	GasLow        = 5
+	GasBase       = 2
+	GasJump       = 8
+	GasJumpI      = 10
+	GasSLoad      = 50
+	GasSStore     = 200
+	GasLog        = 100
+	GasCodeByte   = 200 // per byte of deployed code
+	GasCallBase   = 700
+	GasDeployBase = 1000
+)
+
+var (
+	ErrOutOfGas         = errors.New("out of gas")
+	ErrStackOverflow    = errors.New("stack overflow")
+	ErrStackUnderflow   = errors.New("stack underflow")
+	ErrInvalidJump      = errors.New("invalid jump destination")
+	ErrInvalidOpCode    = errors.New("invalid opcode")
+	ErrExecutionReverts = errors.New("execution reverted")
+)
+
+var opGas = map[OpCode]uint64{
+	OpStop: 0, OpPush: GasVeryLow, OpPop: GasBase, OpDup: GasVeryLow, OpSwap: GasVeryLow,
+	OpAdd: GasVeryLow, OpSub: GasVeryLow, OpMul: GasLow, OpDiv: GasLow, OpMod: GasLow,
+	OpLt: GasVeryLow, OpGt: GasVeryLow, OpEq: GasVeryLow, OpIsZero: GasVeryLow,
+	OpAnd: GasVeryLow, OpOr: GasVeryLow, OpNot: GasVeryLow,
+	OpJump: GasJump, OpJumpI: GasJumpI,
+	OpSLoad: GasSLoad, OpSStore: GasSStore,
+	OpCaller: GasBase, OpCallValue: GasBase, OpCallDataLoad: GasVeryLow, OpCallDataSize: GasBase, OpBlockHeight: GasBase,
+	OpLog:    GasLog,
+	OpReturn: 0, OpRevert: 0,
+}
+
+// immediateSize returns the number of immediate bytes following an opcode.
+func immediateSize(op OpCode) int {
+	switch op {
+	case OpPush:
+		return 8
+	case OpDup, OpSwap:
+		return 1
+	}
+	return 0
+}
+
+// ValidateCode checks that code only contains known opcodes with complete
+// immediates, and returns the instruction boundaries that jumps may target.
+func ValidateCode(code []byte) (map[uint64]bool, error) {
+	if len(code) == 0 || len(code) > MaxContractSize {
+		return nil, fmt.Errorf("contract code must be 1-%d bytes", MaxContractSize)
+	}
+	dests := make(map[uint64]bool)
+	for pc := 0; pc < len(code); {
+		op := OpCode(code[pc])
+		if _, ok := opGas[op]; !ok {
+			return nil, fmt.Errorf("%w 0x%02x at %d", ErrInvalidOpCode, code[pc], pc)
+		}
+		dests[uint64(pc)] = true
+		pc += 1 + immediateSize(op)
+		if pc > len(code) {
+			return nil, fmt.Errorf("truncated immediate at %d", pc)
+		}
+	}
+	return dests, nil
+}
+
+// ContractStorage is the storage a contract execution reads and writes.
+type ContractStorage interface {
+	Load(key uint64) (uint64, error)
+	Store(key, value uint64)
+}
+
+// CallContext describes a contract call.
+type CallContext struct {
+	Contract Address
+	Caller   Address
+	Value    uint64
+	Input    []byte
+	Height   uint64
+	GasLimit uint64
+}
+
+// ContractLog is an event emitted by a contract.
+type ContractLog struct {
+	Contract Address `json:"contract"`
+	Topic    uint64  `json:"topic"`
+	Data     uint64  `json:"data"`
+}
+
+// ExecutionResult is the outcome of a contract call.
+type ExecutionResult struct {
+	GasUsed     uint64
+	ReturnValue uint64
+	Logs        []ContractLog
+}
+
+// Execute runs code in ctx. Storage writes are only made through storage; the
+// caller discards them when an error is returned.
+func Execute(code []byte, ctx *CallContext, storage ContractStorage) (*ExecutionResult, error) {
+	dests, err := ValidateCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExecutionResult{}
+	stack := make([]uint64, 0, 16)
+	pop := func() (uint64, error) {
+		if len(stack) == 0 {
+			return 0, ErrStackUnderflow
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	push := func(v uint64) error {
+		if len(stack) >= MaxStackDepth {
+			return ErrStackOverflow
+		}
+		stack = append(stack, v)
+		return nil
+	}
+	pop2 := func() (uint64, uint64, error) {
+		a, err := pop()
+		if err != nil {
+			return 0, 0, err
+		}
+		b, err := pop()
+		return a, b, err
+	}
+	boolWord := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	for pc := uint64(0); pc < uint64(len(code)); {
+		op := OpCode(code[pc])
+		cost := opGas[op]
+		if result.GasUsed+cost > ctx.GasLimit {
+			result.GasUsed = ctx.GasLimit
+			return result, ErrOutOfGas
+		}
+		result.GasUsed += cost
+
+		next := pc + 1 + uint64(immediateSize(op))
+		switch op {
+		case OpStop:
+			return result, nil
+		case OpPush:
+			err = push(binary.BigEndian.Uint64(code[pc+1 : pc+9]))
+		case OpPop:
+			_, err = pop()
+		case OpDup:
+			n := int(code[pc+1])
+			if n == 0 || n > len(stack) {
+				return result, ErrStackUnderflow
+			}
+			err = push(stack[len(stack)-n])
+		case OpSwap:
+			n := int(code[pc+1])
+			if n == 0 || n >= len(stack) {
+				return result, ErrStackUnderflow
+			}
+			top := len(stack) - 1
+			stack[top], stack[top-n] = stack[top-n], stack[top]
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpLt, OpGt, OpEq, OpAnd, OpOr:
+			var a, b uint64
+			if a, b, err = pop2(); err != nil {
+				return result, err
+			}
+			var v uint64
+			switch op {
+			case OpAdd:
+				v = a + b
+			case OpSub:
+				v = a - b
+			case OpMul:
+				v = a * b
+			case OpDiv:
+				if b != 0 {
+					v = a / b
+				}
+			case OpMod:
+				if b != 0 {
+					v = a % b
+				}
+			case OpLt:
+				v = boolWord(a < b)
+			case OpGt:
+				v = boolWord(a > b)
+			case OpEq:
+				v = boolWord(a == b)
+			case OpAnd:
+				v = a & b
+			case OpOr:
+				v = a | b
+			}
+			err = push(v)
+		case OpIsZero, OpNot:
+			var a uint64
+			if a, err = pop(); err != nil {
+				return result, err
+			}
+			if op == OpIsZero {
+				err = push(boolWord(a == 0))
+			} else {
+				err = push(^a)
+			}
+		case OpJump:
+			var dest uint64
+			if dest, err = pop(); err != nil {
+				return result, err
+			}
+			if !dests[dest] {
+				return result, ErrInvalidJump
+			}
+			next = dest
+		case OpJumpI:
+			var dest, cond uint64
+			if dest, cond, err = pop2(); err != nil {
+				return result, err
+			}
+			if cond != 0 {
+				if !dests[dest] {
+					return result, ErrInvalidJump
+				}
+				next = dest
+			}
+		case OpSLoad:
+			var key, v uint64
+			if key, err = pop(); err != nil {
+				return result, err
+			}
+			if v, err = storage.Load(key); err != nil {
+				return result, err
+			}
+			err = push(v)
+		case OpSStore:
+			var key, v uint64
+			if key, v, err = pop2(); err != nil {
+				return result, err
+			}
+			storage.Store(key, v)
+		case OpCaller:
+			err = push(binary.BigEndian.Uint64(ctx.Caller[:8]))
+		case OpCallValue:
+			err = push(ctx.Value)
+		case OpCallDataLoad:
+			var i uint64
+			if i, err = pop(); err != nil {
+				return result, err
+			}
+			var word [8]byte
+			if i < uint64(len(ctx.Input))/8+1 {
+				copy(word[:], ctx.Input[min(i*8, uint64(len(ctx.Input))):])
+			}
+			err = push(binary.BigEndian.Uint64(word[:]))
+		case OpCallDataSize:
+			err = push((uint64(len(ctx.Input)) + 7) / 8)
+		case OpBlockHeight:
+			err = push(ctx.Height)
+		case OpLog:
+			var topic, data uint64
+			if topic, data, err = pop2(); err != nil {
+				return result, err
+			}
+			result.Logs = append(result.Logs, ContractLog{Contract: ctx.Contract, Topic: topic, Data: data})
+		case OpReturn:
+			if len(stack) > 0 {
+				result.ReturnValue = stack[len(stack)-1]
+			}
+			return result, nil
+		case OpRevert:
+			return result, ErrExecutionReverts
+		}
+		if err != nil {
+			return result, err
+		}
+		pc = next
+	}
+	return result, nil
+}